@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"uniback/dto"
+	"uniback/models"
+	"uniback/utils"
+)
+
+const (
+	// Ограничение на размер ответа: например, дни - примерно за год
+	maxAnalyticsPeriods = 400
+	defaultForecastDays = 30
+	maxForecastDays     = 180
+)
+
+// AnalyticsHanlder отдаёт обороты по всем счетам пользователя за период
+// from..to (по умолчанию - последние 12 месяцев) с разбивкой по
+// granularity: day, week или month (по умолчанию).
+func (c *AuthController) AnalyticsHanlder(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Analytics from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodGet {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	granularity := r.URL.Query().Get("granularity")
+	if granularity == "" {
+		granularity = models.GranularityMonth
+	}
+
+	from, to, err := parseDateRange(r.URL.Query())
+	if err != nil {
+		log.Error("Wrong analytics period: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	if to == nil {
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		to = &tomorrow
+	}
+	if from == nil {
+		yearAgo := time.Date(now.Year(), now.Month()-11, 1, 0, 0, 0, 0, time.UTC)
+		from = &yearAgo
+	}
+	if !from.Before(*to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	periods, err := models.CountPeriods(*from, *to, granularity)
+	if err != nil {
+		log.Error("Wrong granularity: %s", granularity)
+		http.Error(w, "granularity must be day, week or month", http.StatusBadRequest)
+		return
+	}
+
+	if periods > maxAnalyticsPeriods {
+		log.Error("Too many analytics periods: %d", periods)
+		http.Error(w, "Period is too long for this granularity", http.StatusBadRequest)
+		return
+	}
+
+	analytics, err := c.analytics.Analytics(r.Context(), claims.Username, *from, *to, granularity)
+	if err != nil {
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to get analytics", http.StatusInternalServerError)
+		return
+	}
+
+	c.writeJson(w, r, dto.AnalyticsToDto(analytics))
+}
+
+// ForecastHandler прогнозирует баланс счетов по дням на days дней вперёд
+// (по умолчанию 30, не больше maxForecastDays).
+func (c *AuthController) ForecastHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Forecast from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodGet {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	days := defaultForecastDays
+	if str := r.URL.Query().Get("days"); str != "" {
+		value, err := strconv.Atoi(str)
+		if err != nil || value <= 0 || value > maxForecastDays {
+			log.Error("Wrong forecast days: %s", str)
+			http.Error(w, fmt.Sprintf("days must be from 1 to %d", maxForecastDays), http.StatusBadRequest)
+			return
+		}
+		days = value
+	}
+
+	forecasts, err := c.analytics.Forecast(r.Context(), claims.Username, days, time.Now())
+	if err != nil {
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to build forecast", http.StatusInternalServerError)
+		return
+	}
+
+	c.writeJson(w, r, dto.ForecastToDto(days, forecasts))
+}
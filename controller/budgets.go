@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"uniback/dto"
+	"uniback/models"
+	"uniback/utils"
+)
+
+const monthLayout = "2006-01"
+
+// BudgetsHandler: GET - бюджеты за месяц (?month=YYYY-MM, по умолчанию текущий)
+// с тратами и прогнозом, POST - создать бюджет по категории или изменить его сумму.
+func (c *AuthController) BudgetsHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Budgets from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	month := models.MonthStart(now)
+
+	if r.Method == http.MethodPost {
+		var budgetDto dto.BudgetRequestDto
+
+		err := json.NewDecoder(r.Body).Decode(&budgetDto)
+		if err != nil {
+			log.Error("Json parse error: %w", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := c.validateRequest(w, budgetDto); err != nil {
+			return
+		}
+
+		if !models.IsCategory(budgetDto.Category) {
+			log.Error("Unknown category: %s", budgetDto.Category)
+			http.Error(w, "Unknown category", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := c.userRepo.SetBudget(r.Context(), claims.Username, budgetDto.Category, budgetDto.Amount); err != nil {
+			log.Critical("DB error: %w", err)
+			http.Error(w, "Failed to save budget", http.StatusInternalServerError)
+			return
+		}
+	} else if str := r.URL.Query().Get("month"); str != "" {
+		parsed, err := time.Parse(monthLayout, str)
+		if err != nil {
+			http.Error(w, "month must be YYYY-MM", http.StatusBadRequest)
+			return
+		}
+		month = parsed
+	}
+
+	report, err := c.analytics.BudgetReport(r.Context(), claims.Username, month, now)
+	if err != nil {
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to get budgets", http.StatusInternalServerError)
+		return
+	}
+
+	c.writeJson(w, r, dto.BudgetReportToDto(month.Format(monthLayout), report))
+}
+
+func (c *AuthController) DeleteBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Delete Budget from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodDelete {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	err := c.userRepo.DeleteBudget(r.Context(), claims.Username, r.PathValue("category"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Budget not found", http.StatusNotFound)
+			return
+		}
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to delete budget", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Authorization", r.Header.Get("Authorization"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TransactionCategoryHandler меняет категорию операции со своего счёта. С
+// apply_to_merchant категория запоминается правилом для этой торговой точки.
+func (c *AuthController) TransactionCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Transaction Category from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	transactionId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Wrong transaction id", http.StatusBadRequest)
+		return
+	}
+
+	var categoryDto dto.TransactionCategoryRequestDto
+
+	err = json.NewDecoder(r.Body).Decode(&categoryDto)
+	if err != nil {
+		log.Error("Json parse error: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.validateRequest(w, categoryDto); err != nil {
+		return
+	}
+
+	if !models.IsCategory(categoryDto.Category) {
+		log.Error("Unknown category: %s", categoryDto.Category)
+		http.Error(w, "Unknown category", http.StatusBadRequest)
+		return
+	}
+
+	descriptor, err := c.userRepo.SetTransactionCategory(r.Context(), claims.Username, transactionId, categoryDto.Category)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to change category", http.StatusInternalServerError)
+		return
+	}
+
+	if categoryDto.ApplyToMerchant {
+		if err := c.userRepo.AddCategoryRule(r.Context(), claims.Username, likeEscape(descriptor), categoryDto.Category); err != nil {
+			log.Critical("DB error: %w", err)
+			http.Error(w, "Failed to save category rule", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	c.writeJson(w, r, dto.TransactionCategoryResponseDto{Id: transactionId, Category: categoryDto.Category})
+}
+
+// likeEscape экранирует спецсимволы ILIKE, чтобы правило совпадало только с точным описанием.
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
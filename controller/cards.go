@@ -0,0 +1,501 @@
+package controller
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"uniback/dto"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/utils"
+)
+
+var errCardDeclined = errors.New("card declined")
+
+// CardPaymentHandler оплачивает покупку картой: сумма блокируется на счёте карты,
+// а при capture=true сразу списывается.
+func (c *AuthController) CardPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Card Payment from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	var paymentDto dto.CardPaymentRequestDto
+
+	err := json.NewDecoder(r.Body).Decode(&paymentDto)
+	if err != nil {
+		log.Error("Json parse error: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.validateRequest(w, paymentDto); err != nil {
+		return
+	}
+
+	userId, err := c.userRepo.GetUserId(r.Context(), claims.Username)
+	if err != nil {
+		log.Error("Error getting userid: %w", err)
+		http.Error(w, "Bad user ID", http.StatusBadRequest)
+		return
+	}
+
+	ip := clientIp(r)
+	retryAfter, err := c.cardGuard.Check(r.Context(), claims.Username, ip)
+	if err != nil {
+		log.Critical("Can't check card throttle: %w", err)
+		http.Error(w, "Failed to check card", http.StatusInternalServerError)
+		return
+	}
+
+	if retryAfter > 0 {
+		log.Error("Card checks of %s from %s are blocked for %s", claims.Username, ip, retryAfter)
+		tooManyRequests(w, retryAfter, "Too many wrong card checks, try later")
+		return
+	}
+
+	card, err := c.verifyCard(r.Context(), paymentDto.Number, paymentDto.Expiry, paymentDto.Cvv)
+	if err != nil {
+		log.Error("Card verification error: %w", err)
+		if errors.Is(err, errCardDeclined) {
+			if err := c.cardGuard.Failure(r.Context(), claims.Username, ip, card); err != nil {
+				log.Critical("Can't record card check failure: %w", err)
+			}
+			http.Error(w, "Wrong card data", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to check card", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	account, err := c.userRepo.GetAccountByNumber(r.Context(), card.AccountNumber)
+	if err != nil {
+		log.Error("Error card account: %w", err)
+		http.Error(w, "Failed to get card account", http.StatusInternalServerError)
+		return
+	}
+
+	if account.Status != "active" {
+		log.Error("Try to pay with card of not active account")
+		http.Error(w, "Try to perform trasaction with not active account", http.StatusBadRequest)
+		return
+	}
+
+	hold, err := c.service.AuthorizeCardPayment(r.Context(), *card, *account, userId, paymentDto.Amount, paymentDto.Merchant)
+	if err != nil {
+		log.Error("Card authorization error: %w", err)
+		http.Error(w, "Payment declined", http.StatusBadRequest)
+		return
+	}
+
+	if paymentDto.Capture {
+		hold, err = c.service.CaptureCardPayment(r.Context(), *hold, hold.Amount)
+		if err != nil {
+			log.Error("Card capture error: %w", err)
+			http.Error(w, "Payment declined", http.StatusBadRequest)
+			return
+		}
+	}
+
+	c.writeCardHold(w, r, hold, models.MaskCardNumber(paymentDto.Number))
+}
+
+func (c *AuthController) CaptureCardHoldHandler(w http.ResponseWriter, r *http.Request) {
+	c.cardHoldRequest(w, r, func(ctx context.Context, hold models.CardHold, captureDto dto.CardCaptureRequestDto) (*models.CardHold, error) {
+		amount := hold.Amount
+		if captureDto.Amount != nil {
+			amount = *captureDto.Amount
+		}
+		return c.service.CaptureCardPayment(ctx, hold, amount)
+	})
+}
+
+func (c *AuthController) VoidCardHoldHandler(w http.ResponseWriter, r *http.Request) {
+	c.cardHoldRequest(w, r, func(ctx context.Context, hold models.CardHold, captureDto dto.CardCaptureRequestDto) (*models.CardHold, error) {
+		return c.service.VoidCardPayment(ctx, hold)
+	})
+}
+
+// cardHoldRequest - общая часть capture и void: найти холд и проверить,
+// что с ним работает тот же пользователь, который проводил оплату.
+func (c *AuthController) cardHoldRequest(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, hold models.CardHold, captureDto dto.CardCaptureRequestDto) (*models.CardHold, error)) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Card Hold %s from: %s", r.URL.Path, r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	holdId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Wrong hold id", http.StatusBadRequest)
+		return
+	}
+
+	var captureDto dto.CardCaptureRequestDto
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&captureDto); err != nil {
+			log.Error("Json parse error: %w", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	userId, err := c.userRepo.GetUserId(r.Context(), claims.Username)
+	if err != nil {
+		log.Error("Error getting userid: %w", err)
+		http.Error(w, "Bad user ID", http.StatusBadRequest)
+		return
+	}
+
+	hold, err := c.userRepo.GetCardHold(r.Context(), holdId)
+	if err == nil && hold.InitiatorId != userId {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Card hold not found", http.StatusNotFound)
+			return
+		}
+		log.Error("DB error: %w", err)
+		http.Error(w, "Failed to get card hold", http.StatusInternalServerError)
+		return
+	}
+
+	hold, err = action(r.Context(), *hold, captureDto)
+	if err != nil {
+		log.Error("Card hold error: %w", err)
+		if errors.Is(err, repository.ErrHoldNotActive) {
+			http.Error(w, "Card hold is not active", http.StatusConflict)
+		} else {
+			http.Error(w, "Card hold error", http.StatusBadRequest)
+		}
+		return
+	}
+
+	c.writeCardHold(w, r, hold, "")
+}
+
+// verifyCard ищет карту по номеру и сверяет срок действия и CVV.
+// Любое несовпадение возвращает errCardDeclined без уточнения причины. Если
+// карта с таким номером есть, она возвращается вместе с ошибкой, чтобы учесть
+// неудачу по карте.
+func (c *AuthController) verifyCard(ctx context.Context, number string, expiry string, cvv string) (*models.Card, error) {
+	card, err := c.userRepo.GetCardByNumberHmac(ctx, c.cryptoService.HmacIndex(number))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errCardDeclined
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	storedExpiry := c.cryptoService.PgpDecode(card.Expiry)
+	month, year, err := models.ParseCardExpiry(storedExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	requestMonth, requestYear, err := models.ParseCardExpiry(expiry)
+	if err != nil || requestMonth != month || requestYear != year {
+		return card, errCardDeclined
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.cryptoService.PgpDecode(card.Cvv)), []byte(cvv)) != 1 {
+		return card, errCardDeclined
+	}
+
+	c.markCardExpired(ctx, card, month, year)
+
+	if card.Status != models.CardActive {
+		return card, errCardDeclined
+	}
+
+	return card, nil
+}
+
+// markCardExpired переводит карту в expired, если срок действия на ней уже прошёл.
+// Срок хранится зашифрованным, поэтому проверка идёт при каждом обращении к карте.
+func (c *AuthController) markCardExpired(ctx context.Context, card *models.Card, month int, year int) {
+	if !models.IsCardExpired(month, year, time.Now()) || !models.CanChangeCardStatus(card.Status, models.CardExpired) {
+		return
+	}
+
+	updated, err := c.userRepo.UpdateCardStatus(ctx, card.Id, models.CardExpired, 0, "expiry date passed")
+	if err != nil {
+		utils.GlobalLogger().Error("Can't mark card %d as expired: %w", card.Id, err)
+		return
+	}
+
+	card.Status = updated.Status
+}
+
+func (c *AuthController) cardToDto(ctx context.Context, card *models.Card) dto.CardResponseDto {
+	month, year, err := models.ParseCardExpiry(c.cryptoService.PgpDecode(card.Expiry))
+	if err != nil {
+		utils.GlobalLogger().Error("Card %d has broken expiry: %w", card.Id, err)
+	} else {
+		c.markCardExpired(ctx, card, month, year)
+	}
+
+	return dto.CardResponseDto{
+		Id:            card.Id,
+		Number:        models.MaskCardNumber(c.cryptoService.PgpDecode(card.Number)),
+		ExpiryMonth:   month,
+		ExpiryYear:    year,
+		AccountNumber: card.AccountNumber,
+		Status:        card.Status,
+		ReissuedFrom:  card.ReissuedFrom,
+		CreatedAt:     card.CreatedAt,
+	}
+}
+
+// generateCard выпускает номер, срок действия и CVV новой карты. Номер
+// проверяется на уникальность по слепому индексу.
+func (c *AuthController) generateCard(ctx context.Context) (*models.Card, error) {
+	var number string
+	var numberHmac []byte
+
+	for {
+		var err error
+		number, err = c.cryptoService.GenerateCardLuhn()
+		if err != nil {
+			return nil, err
+		}
+		numberHmac = c.cryptoService.HmacIndex(number)
+
+		isExist, err := c.userRepo.IsCardExists(ctx, numberHmac)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isExist {
+			break
+		}
+	}
+
+	currentTime := time.Now()
+	expiredTime := currentTime.AddDate(5, 0, 0)
+
+	return &models.Card{
+		Number:     c.cryptoService.PgpEncode(number),
+		NumberHmac: numberHmac,
+		Expiry:     c.cryptoService.PgpEncode(expiredTime.Format(models.CardExpiryLayout)),
+		Cvv:        c.cryptoService.PgpEncode(c.cryptoService.GenerateCvv()),
+		CreatedAt:  currentTime,
+	}, nil
+}
+
+func (c *AuthController) BlockCardHandler(w http.ResponseWriter, r *http.Request) {
+	c.cardStatusRequest(w, r, func(ctx context.Context, card models.Card, userId int) (*models.Card, error) {
+		return c.userRepo.UpdateCardStatus(ctx, card.Id, models.CardBlocked, userId, "blocked by owner")
+	})
+}
+
+func (c *AuthController) UnblockCardHandler(w http.ResponseWriter, r *http.Request) {
+	c.cardStatusRequest(w, r, func(ctx context.Context, card models.Card, userId int) (*models.Card, error) {
+		return c.userRepo.UpdateCardStatus(ctx, card.Id, models.CardActive, userId, "unblocked by owner")
+	})
+}
+
+// LostCardHandler помечает карту потерянной и сразу выпускает вместо неё
+// новую карту с другим номером на тот же счёт. В ответе - новая карта.
+func (c *AuthController) LostCardHandler(w http.ResponseWriter, r *http.Request) {
+	c.cardStatusRequest(w, r, func(ctx context.Context, card models.Card, userId int) (*models.Card, error) {
+		if !models.CanChangeCardStatus(card.Status, models.CardLost) {
+			return nil, repository.ErrCardStatus
+		}
+
+		newCard, err := c.generateCard(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return c.userRepo.ReissueCard(ctx, card.Id, *newCard, userId)
+	})
+}
+
+func (c *AuthController) CloseCardHandler(w http.ResponseWriter, r *http.Request) {
+	c.cardStatusRequest(w, r, func(ctx context.Context, card models.Card, userId int) (*models.Card, error) {
+		return c.userRepo.UpdateCardStatus(ctx, card.Id, models.CardClosed, userId, "closed by owner")
+	})
+}
+
+// cardStatusRequest - общая часть запросов смены статуса своей карты.
+func (c *AuthController) cardStatusRequest(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, card models.Card, userId int) (*models.Card, error)) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Card Status %s from: %s", r.URL.Path, r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	card, ok := c.userCard(w, r, claims.Username)
+	if !ok {
+		return
+	}
+
+	userId, err := c.userRepo.GetUserId(r.Context(), claims.Username)
+	if err != nil {
+		log.Error("Error getting userid: %w", err)
+		http.Error(w, "Bad user ID", http.StatusBadRequest)
+		return
+	}
+
+	// Карту с истёкшим сроком нельзя разблокировать, поэтому статус уточняется до смены
+	if month, year, err := models.ParseCardExpiry(c.cryptoService.PgpDecode(card.Expiry)); err == nil {
+		c.markCardExpired(r.Context(), card, month, year)
+	}
+
+	card, err = action(r.Context(), *card, userId)
+	if err != nil {
+		log.Error("Card status error: %w", err)
+		if errors.Is(err, repository.ErrCardStatus) {
+			http.Error(w, "Card status change is not allowed", http.StatusConflict)
+		} else {
+			http.Error(w, "Failed to change card status", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	jsonData, err := json.Marshal(c.cardToDto(r.Context(), card))
+	if err != nil {
+		log.Critical("Encode card to json error: %w", err)
+		http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Authorization", r.Header.Get("Authorization"))
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+func (c *AuthController) CardEventsHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Card Events from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodGet {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	card, ok := c.userCard(w, r, claims.Username)
+	if !ok {
+		return
+	}
+
+	events, err := c.userRepo.GetCardEvents(r.Context(), card.Id)
+	if err != nil {
+		log.Error("DB error: %w", err)
+		http.Error(w, "Failed to get card events", http.StatusInternalServerError)
+		return
+	}
+
+	response := dto.CardEventsResponseDto{
+		CardId: card.Id,
+		Events: []dto.CardEventDto{},
+	}
+	for _, event := range events {
+		response.Events = append(response.Events, dto.CardEventDto{
+			OldStatus: event.OldStatus,
+			NewStatus: event.NewStatus,
+			Reason:    event.Reason,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		log.Critical("Encode card events to json error: %w", err)
+		http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Authorization", r.Header.Get("Authorization"))
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// userCard читает карту из пути запроса. Чужая карта не отличается от несуществующей.
+func (c *AuthController) userCard(w http.ResponseWriter, r *http.Request, username string) (*models.Card, bool) {
+	cardId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Wrong card id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	card, err := c.userRepo.GetCardByIdAndUsername(r.Context(), cardId, username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Card not found", http.StatusNotFound)
+			return nil, false
+		}
+		utils.GlobalLogger().Error("DB error: %w", err)
+		http.Error(w, "Failed to get card", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return card, true
+}
+
+func (c *AuthController) writeCardHold(w http.ResponseWriter, r *http.Request, hold *models.CardHold, maskedNumber string) {
+	log := utils.GlobalLogger()
+
+	jsonData, err := json.Marshal(dto.CardHoldToDto(hold, maskedNumber))
+	if err != nil {
+		log.Critical("Encode card hold to json error: %w", err)
+		http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Authorization", r.Header.Get("Authorization"))
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
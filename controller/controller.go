@@ -2,9 +2,13 @@ package controller
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
+	"strings"
 	"time"
 	"uniback/dto"
 	"uniback/models"
@@ -12,31 +16,58 @@ import (
 	"uniback/service"
 	"uniback/utils"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/go-playground/validator/v10"
 	"golang.org/x/crypto/bcrypt"
 )
 
-type JWTClaims struct {
-	Username string
-	jwt.StandardClaims
-}
+type JWTClaims = service.TokenClaims
 
 type AuthController struct {
 	validate      validator.Validate
 	userRepo      repository.UserRepository
 	service       service.Service
 	cryptoService service.CryptoService
-	secretKey     string
+	statements    service.StatementService
+	credits       service.CreditService
+	analytics     service.AnalyticsService
+	notifier      service.Notifier
+	webhooks      service.WebhookService
+	sessions      *SessionConfig
+	tokens        service.TokenService
+	twoFactor     service.TwoFactorService
+	transfers     service.TransferConfirmService
+	loginGuard    service.LoginGuard
+	transferGuard service.AttemptGuard
+	cardGuard     service.CardGuard
 }
 
-func NewAuthController(u repository.UserRepository, cs service.CryptoService, sr service.Service, s string) *AuthController {
+func NewAuthController(u repository.UserRepository, cs service.CryptoService, sr service.Service, st service.StatementService, cr service.CreditService, an service.AnalyticsService, n service.Notifier, wh service.WebhookService, sc *SessionConfig, ts service.TokenService, tf service.TwoFactorService, tc service.TransferConfirmService, lg service.LoginGuard, tg service.AttemptGuard, cg service.CardGuard) *AuthController {
+	validate := validator.New()
+	// Money валидируется как сумма в копейках, чтобы работали теги gt/required
+	validate.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+		if money, ok := field.Interface().(models.Money); ok {
+			return money.Amount
+		}
+		return nil
+	}, models.Money{})
+
 	return &AuthController{
 		userRepo:      u,
 		service:       sr,
 		cryptoService: cs,
-		validate:      *validator.New(),
-		secretKey:     s,
+		statements:    st,
+		credits:       cr,
+		analytics:     an,
+		notifier:      n,
+		webhooks:      wh,
+		sessions:      sc,
+		tokens:        ts,
+		twoFactor:     tf,
+		transfers:     tc,
+		loginGuard:    lg,
+		transferGuard: tg,
+		cardGuard:     cg,
+		validate:      *validate,
 	}
 }
 
@@ -110,6 +141,8 @@ func (c *AuthController) RegistrationHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	log.Info("User %s created!", user.Username)
+	c.notify(user.Email, models.Notification{Event: models.NotifyRegistration, Username: user.Username})
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -138,48 +171,100 @@ func (c *AuthController) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userFromDb, err := c.userRepo.GetUserByUsername(r.Context(), user.Username)
-
+	ip := clientIp(r)
+	retryAfter, err := c.loginGuard.Check(r.Context(), user.Username, ip)
 	if err != nil {
-		log.Error("Getting %s from db error: %w", user.Username, err)
-		http.Error(w, "Wrong user login", http.StatusForbidden)
+		log.Critical("Can't check login throttle: %w", err)
+		http.Error(w, "Failed to login", http.StatusInternalServerError)
 		return
 	}
 
-	log.Debug("Get user from db: %s, %s", userFromDb.Name, userFromDb.Password)
+	if retryAfter > 0 {
+		log.Error("Login of %s from %s is blocked for %s", user.Username, ip, retryAfter)
+		c.auditLogin(r, user.Username, nil, models.LoginBlocked)
+		tooManyRequests(w, retryAfter, "Too many login attempts, try later")
+		return
+	}
+
+	userFromDb, err := c.userRepo.GetUserByUsername(r.Context(), user.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Пароль всё равно сравнивается, чтобы по времени ответа нельзя было
+		// отличить несуществующего пользователя
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(user.Password))
+		log.Error("Login of unknown user %s", user.Username)
+		c.loginFailed(w, r, user.Username, nil, models.LoginUnknownUser)
+		return
+	}
+	if err != nil {
+		log.Critical("Getting %s from db error: %w", user.Username, err)
+		http.Error(w, "Failed to login", http.StatusInternalServerError)
+		return
+	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(userFromDb.Password), []byte(user.Password))
 	if err != nil {
 		log.Error("Invalid password for %s (%w)", user.Username, err)
-		http.Error(w, "Invalid password", http.StatusUnauthorized)
+		c.loginFailed(w, r, user.Username, userFromDb, models.LoginWrongPassword)
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, JWTClaims{
-		Username: userFromDb.Name,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 24).Unix(),
-			IssuedAt:  time.Now().Unix(),
-		},
-	})
+	if userFromDb.TotpEnabled {
+		token, expiresAt, err := c.twoFactor.CreateChallenge(r.Context(), userFromDb.ID)
+		if err != nil {
+			log.Critical("Failed to create two-factor challenge: %w", err)
+			http.Error(w, "Failed to login", http.StatusInternalServerError)
+			return
+		}
 
-	tokenStr, err := token.SignedString([]byte(c.secretKey))
+		log.Info("User %s passed password check, waiting for two-factor code", user.Username)
+		c.auditLogin(r, user.Username, &userFromDb.ID, models.LoginMfaRequired)
+		c.writeJson(w, r, dto.TwoFactorChallengeDto{
+			Message:           "two-factor code required",
+			TwoFactorRequired: true,
+			ChallengeToken:    token,
+			ExpiresIn:         int(time.Until(expiresAt).Seconds()),
+		})
+		return
+	}
+
+	c.completeLogin(w, r, userFromDb.ID, userFromDb.Name, userFromDb.Email)
+}
 
+// completeLogin выдаёт сессию после проверки всех факторов входа и
+// уведомляет пользователя о входе с нового IP.
+func (c *AuthController) completeLogin(w http.ResponseWriter, r *http.Request, userId int, username string, email string) {
+	log := utils.GlobalLogger()
+
+	session, err := c.newSession(r.Context(), userId, username, nil)
 	if err != nil {
-		log.Critical("Failed to generate jwt: %w", err)
+		log.Critical("Failed to generate tokens: %w", err)
 		http.Error(w, "Failed to generate jwt", http.StatusInternalServerError)
 		return
 	}
 
-	log.Debug("For user %s jwt: %s", user.Username, tokenStr)
+	log.Debug("For user %s jwt: %s", username, session.accessToken)
 
-	w.Header().Set("Authorization", "Bearer "+tokenStr)
-	w.Header().Set("Content-Type", "application/json")
+	if err := c.loginGuard.Success(r.Context(), username); err != nil {
+		log.Error("Can't reset login failures of %s: %w", username, err)
+	}
+	c.auditLogin(r, username, &userId, models.LoginSuccess)
 
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "successful",
-		"user":    user.Username,
-	})
+	ip := clientIp(r)
+	isNewIp, err := c.userRepo.RememberLoginIp(r.Context(), userId, ip)
+	if err != nil {
+		log.Error("Can't save login ip for %s: %w", username, err)
+	} else if isNewIp {
+		c.notify(email, models.Notification{
+			Event:    models.NotifyNewLoginIp,
+			Username: username,
+			Data: map[string]string{
+				"ip":   ip,
+				"time": time.Now().Format("02.01.2006 15:04 MST"),
+			},
+		})
+	}
+
+	c.writeSession(w, session)
 }
 
 func (c *AuthController) AccountsHandler(w http.ResponseWriter, r *http.Request) {
@@ -371,6 +456,18 @@ func (c *AuthController) TransferHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	reason, err := c.transfers.ConfirmReason(r.Context(), sourceAccount.UserId, *destAccount, transferDto.Amount)
+	if err != nil {
+		log.Critical("Can't check transfer confirmation: %w", err)
+		http.Error(w, "Failed to check transfer", http.StatusInternalServerError)
+		return
+	}
+
+	if reason != "" {
+		c.requestTransferConfirm(w, r, claims.Username, *sourceAccount, *destAccount, transferDto.Amount, reason)
+		return
+	}
+
 	account, err := c.service.TransferTransaction(r.Context(), *sourceAccount, *destAccount, transferDto.Amount)
 
 	if err != nil {
@@ -442,43 +539,15 @@ func (c *AuthController) NewCardHandler(w http.ResponseWriter, r *http.Request)
 	log.Debug("Card account id: %d", cardAccount.Id)
 	log.Debug("UserId: %d", userId)
 
-	var newLuhnNumber string
-	var secureLuhnNumber []byte
-
-	for {
-		newLuhnNumber, err = c.cryptoService.GenerateCardLuhn()
-		if err != nil {
-			log.Error("Error generate Luhn number: %w", err)
-			http.Error(w, "Error generate Luhn number", http.StatusInternalServerError)
-			return
-		}
-		secureLuhnNumber = c.cryptoService.PgpEncode(newLuhnNumber)
-
-		isExist, err := c.userRepo.IsCardExists(r.Context(), secureLuhnNumber)
-		if err != nil {
-			log.Error("Can't read cards from DB: %w", err)
-			return
-		}
-
-		if !isExist {
-			break
-		}
+	newCard, err := c.generateCard(r.Context())
+	if err != nil {
+		log.Error("Can't generate card: %w", err)
+		http.Error(w, "Can't generate card", http.StatusInternalServerError)
+		return
 	}
+	newCard.AccountId = cardAccount.Id
 
-	currentTime := time.Now()
-	expiredTime := time.Now().AddDate(5, 0, 0)
-	secureExpiredTime := c.cryptoService.PgpEncode(expiredTime.String())
-
-	newCvv := c.cryptoService.GenerateCvv()
-	secureCvv := c.cryptoService.PgpEncode(newCvv)
-
-	err = c.userRepo.CreateNewCard(r.Context(), models.Card{
-		AccountId: cardAccount.Id,
-		Number:    secureLuhnNumber,
-		Expiry:    secureExpiredTime,
-		Cvv:       secureCvv,
-		CreatedAt: currentTime,
-	})
+	_, err = c.userRepo.CreateNewCard(r.Context(), *newCard, userId)
 
 	if err != nil {
 		log.Error("Can't save card: %w", err)
@@ -491,19 +560,51 @@ func (c *AuthController) NewCardHandler(w http.ResponseWriter, r *http.Request)
 }
 
 func (ac *AuthController) ShowCardsHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Show Cards from: %s", r.RemoteAddr)
 
-}
+	if r.Method != http.MethodGet {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-func (ac *AuthController) ShowCreditsHanlder(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "Service not implemented yet", http.StatusNotImplemented)
-}
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
 
-func (ac *AuthController) NewCreditHandler(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "Service not implemented yet", http.StatusNotImplemented)
-}
+	cards, err := ac.userRepo.GetCardsByUsername(r.Context(), claims.Username)
+	if err != nil {
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to get cards from DB", http.StatusInternalServerError)
+		return
+	}
+
+	response := dto.CardsResponseDto{
+		Cards: []dto.CardResponseDto{},
+	}
+
+	for _, card := range cards {
+		// CVV из БД не читается и в ответ не попадает
+		response.Cards = append(response.Cards, ac.cardToDto(r.Context(), &card))
+	}
+	response.CardsNum = len(response.Cards)
 
-func (ac *AuthController) AnalyticsHanlder(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "Service not implemented yet", http.StatusNotImplemented)
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		log.Critical("Encode cards to json error: %w", err)
+		http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Authorization", r.Header.Get("Authorization"))
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
 }
 
 func (ac *AuthController) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
@@ -516,17 +617,33 @@ func (ac *AuthController) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc
 			return
 		}
 
-		tokenString := authHeader[len("Bearer "):]
-		claims := &JWTClaims{}
+		tokenString, _ := strings.CutPrefix(authHeader, "Bearer ")
 
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(ac.secretKey), nil
-		})
+		claims, err := ac.tokens.Verify(tokenString)
+		if err != nil {
+			log.Error("Invalid token: %w", err)
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
 
 		log.Debug("Username from token: %s", claims.Username)
 
-		if err != nil || !token.Valid {
-			log.Error("Invalid token")
+		// Токены без jti нельзя отозвать
+		if claims.ID == "" {
+			log.Error("Token without jti from user %s", claims.Username)
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		revoked, err := ac.userRepo.IsTokenRevoked(r.Context(), claims.ID)
+		if err != nil {
+			log.Critical("DB Error: %w", err)
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+
+		if revoked {
+			log.Error("Revoked token from user %s", claims.Username)
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
@@ -580,7 +697,7 @@ func (c *AuthController) validateRequest(w http.ResponseWriter, s interface{}) e
 	return nil
 }
 
-func (c *AuthController) transactionRequest(w http.ResponseWriter, r *http.Request, transaction func(ctx context.Context, acc models.Account, amount float64) (*models.Account, error)) {
+func (c *AuthController) transactionRequest(w http.ResponseWriter, r *http.Request, transaction func(ctx context.Context, acc models.Account, amount models.Money) (*models.Account, error)) {
 	log := utils.GlobalLogger()
 	log.Info("Get http request for Transaction Account from: %s", r.RemoteAddr)
 
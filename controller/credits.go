@@ -0,0 +1,290 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"uniback/dto"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/service"
+	"uniback/utils"
+)
+
+func (c *AuthController) ShowCreditsHanlder(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Show Credits from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodGet {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	loans, err := c.userRepo.GetCreditsByUsername(r.Context(), claims.Username)
+	if err != nil {
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to get credits from DB", http.StatusInternalServerError)
+		return
+	}
+
+	response := dto.CreditsResponseDto{
+		Credits: []dto.CreditResponseDto{},
+	}
+	for _, loan := range loans {
+		response.Credits = append(response.Credits, dto.LoanToDto(&loan, nil))
+	}
+	response.CreditsNum = len(response.Credits)
+
+	c.writeJson(w, r, response)
+}
+
+func (c *AuthController) CreditHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Credit from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodGet {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	loan, ok := c.userCredit(w, r, claims.Username)
+	if !ok {
+		return
+	}
+
+	schedule, err := c.userRepo.GetCreditSchedule(r.Context(), loan.Id)
+	if err != nil {
+		log.Error("DB error: %w", err)
+		http.Error(w, "Failed to get credit schedule", http.StatusInternalServerError)
+		return
+	}
+
+	c.writeJson(w, r, dto.LoanToDto(loan, schedule))
+}
+
+// NewCreditHandler оформляет кредит на кредитный счёт пользователя и сразу
+// зачисляет на него сумму кредита. В ответе - полный график платежей.
+func (c *AuthController) NewCreditHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for New Credit from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	var creditDto dto.CreditCreateRequestDto
+
+	err := json.NewDecoder(r.Body).Decode(&creditDto)
+	if err != nil {
+		log.Error("Json parse error: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.validateRequest(w, creditDto); err != nil {
+		return
+	}
+
+	if creditDto.ScheduleType == "" {
+		creditDto.ScheduleType = models.ScheduleAnnuity
+	}
+
+	if creditDto.Product == "" {
+		creditDto.Product = models.DefaultCreditProduct
+	}
+
+	account, err := c.userRepo.GetAccountByUsername(r.Context(), creditDto.AccountNumber, claims.Username)
+	if err != nil {
+		log.Error("Error confirm account: %w", err)
+		http.Error(w, "Wrong account number", http.StatusBadRequest)
+		return
+	}
+
+	if account.AccountType != "credit" || account.Status != "active" {
+		log.Error("Try to issue credit to not credit or not active account")
+		http.Error(w, "Credit can be issued only to active credit account", http.StatusBadRequest)
+		return
+	}
+
+	loan, schedule, err := c.credits.IssueCredit(r.Context(), *account, creditDto.Product, creditDto.Principal, creditDto.TermMonths, creditDto.ScheduleType)
+	if err != nil {
+		log.Error("Issue credit error: %w", err)
+		switch {
+		case errors.Is(err, service.ErrUnknownCreditProduct):
+			http.Error(w, "Unknown credit product", http.StatusBadRequest)
+		case errors.Is(err, service.ErrNoKeyRate):
+			http.Error(w, "Key rate is not available, try later", http.StatusServiceUnavailable)
+		default:
+			http.Error(w, "Can't issue credit", http.StatusBadRequest)
+		}
+		return
+	}
+
+	c.writeJson(w, r, dto.LoanToDto(loan, schedule))
+}
+
+// RepayCreditHandler - частичное или полное досрочное погашение кредита со
+// счёта, к которому привязан кредит. В ответе - кредит с новым графиком.
+func (c *AuthController) RepayCreditHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Repay Credit from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	var repayDto dto.CreditRepayRequestDto
+
+	err := json.NewDecoder(r.Body).Decode(&repayDto)
+	if err != nil {
+		log.Error("Json parse error: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.validateRequest(w, repayDto); err != nil {
+		return
+	}
+
+	loan, ok := c.userCredit(w, r, claims.Username)
+	if !ok {
+		return
+	}
+
+	loan, schedule, err := c.credits.RepayCredit(r.Context(), *loan, repayDto.Amount, repayDto.Mode)
+	if err != nil {
+		log.Error("Repay credit error: %w", err)
+		switch {
+		case errors.Is(err, repository.ErrInsufficientFunds):
+			http.Error(w, "Not enough money on account", http.StatusBadRequest)
+		case errors.Is(err, repository.ErrAccountNotActive):
+			http.Error(w, "Account is not active", http.StatusBadRequest)
+		case errors.Is(err, service.ErrRepaymentTooLarge):
+			http.Error(w, "Repayment exceeds outstanding principal", http.StatusBadRequest)
+		case errors.Is(err, service.ErrCreditClosed):
+			http.Error(w, "Credit is already paid", http.StatusConflict)
+		case errors.Is(err, service.ErrCreditOverdue):
+			http.Error(w, "Pay overdue payments first", http.StatusConflict)
+		case errors.Is(err, repository.ErrCreditChanged):
+			http.Error(w, "Credit schedule was changed, try again", http.StatusConflict)
+		default:
+			http.Error(w, "Can't repay credit", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.writeJson(w, r, dto.LoanToDto(loan, schedule))
+}
+
+// CreditHistoryHandler отдаёт все версии графика платежей по кредиту.
+func (c *AuthController) CreditHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Credit History from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodGet {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	loan, ok := c.userCredit(w, r, claims.Username)
+	if !ok {
+		return
+	}
+
+	history, err := c.userRepo.GetCreditScheduleHistory(r.Context(), loan.Id)
+	if err != nil {
+		log.Error("DB error: %w", err)
+		http.Error(w, "Failed to get credit schedule", http.StatusInternalServerError)
+		return
+	}
+
+	repayments, err := c.userRepo.GetCreditRepayments(r.Context(), loan.Id)
+	if err != nil {
+		log.Error("DB error: %w", err)
+		http.Error(w, "Failed to get credit repayments", http.StatusInternalServerError)
+		return
+	}
+
+	c.writeJson(w, r, dto.CreditHistoryToDto(loan, history, repayments))
+}
+
+// userCredit читает кредит из пути запроса. Чужой кредит не отличается от несуществующего.
+func (c *AuthController) userCredit(w http.ResponseWriter, r *http.Request, username string) (*models.Loan, bool) {
+	creditId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Wrong credit id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	loan, err := c.userRepo.GetCreditByIdAndUsername(r.Context(), creditId, username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Credit not found", http.StatusNotFound)
+			return nil, false
+		}
+		utils.GlobalLogger().Error("DB error: %w", err)
+		http.Error(w, "Failed to get credit", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return loan, true
+}
+
+func (c *AuthController) writeJson(w http.ResponseWriter, r *http.Request, response any) {
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		utils.GlobalLogger().Critical("Encode response to json error: %w", err)
+		http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Authorization", r.Header.Get("Authorization"))
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
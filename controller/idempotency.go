@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+	"uniback/models"
+	"uniback/utils"
+)
+
+const idempotencyHeader = "Idempotency-Key"
+
+type responseRecorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	rec.code = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(data []byte) (int, error) {
+	if rec.code == 0 {
+		rec.code = http.StatusOK
+	}
+	rec.body.Write(data)
+	return rec.ResponseWriter.Write(data)
+}
+
+// IdempotencyMiddleware защищает денежные операции от повторного применения при
+// ретраях клиента. Должен стоять после AuthMiddleware, ключ уникален в рамках пользователя.
+// Если процесс упал, не сохранив ответ, повтор получает 409, пока не истечёт
+// models.IdempotencyLease, потом запрос выполняется заново.
+func (ac *AuthController) IdempotencyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := utils.GlobalLogger()
+
+		key := r.Header.Get(idempotencyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		if len(key) > 255 {
+			log.Error("Too long idempotency key")
+			http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+
+		claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+		if !ok {
+			log.Critical("No jwt claims in context")
+			http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			log.Error("Read body error: %w", err)
+			http.Error(w, "Can't read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		userId, err := ac.userRepo.GetUserId(r.Context(), claims.Username)
+		if err != nil {
+			log.Error("Can't get user id from DB: %w", err)
+			http.Error(w, "Failed to get user id from DB", http.StatusBadRequest)
+			return
+		}
+
+		hash := sha256.New()
+		hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		stored, created, err := ac.userRepo.AcquireIdempotencyKey(r.Context(), models.IdempotencyKey{
+			UserId:      userId,
+			Key:         key,
+			RequestHash: requestHash,
+		}, time.Now().Add(-models.IdempotencyLease))
+		if err != nil {
+			log.Critical("Idempotency key DB error: %w", err)
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+
+		if !created {
+			ac.replayIdempotentResponse(w, r, stored, requestHash)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next(rec, r)
+
+		// Ответ сохраняем даже если клиент уже отвалился по таймауту
+		ctx := context.WithoutCancel(r.Context())
+
+		if rec.code == 0 || rec.code >= http.StatusInternalServerError {
+			// Серверную ошибку можно повторить с тем же ключом
+			if err := ac.userRepo.DeleteIdempotencyKey(ctx, stored.Id); err != nil {
+				log.Critical("Can't release idempotency key %s: %w", key, err)
+			}
+			return
+		}
+
+		err = ac.userRepo.CompleteIdempotencyKey(ctx, stored.Id, rec.code, rec.body.Bytes(), rec.Header().Get("Content-Type"))
+		if err != nil {
+			log.Critical("Can't save idempotent response for key %s: %w", key, err)
+		}
+	}
+}
+
+func (ac *AuthController) replayIdempotentResponse(w http.ResponseWriter, r *http.Request, stored *models.IdempotencyKey, requestHash string) {
+	log := utils.GlobalLogger()
+
+	if stored.RequestHash != requestHash {
+		log.Error("Idempotency key %s reused with another request", stored.Key)
+		http.Error(w, "Idempotency-Key is already used for another request", http.StatusConflict)
+		return
+	}
+
+	if stored.Status != "completed" {
+		log.Error("Request with idempotency key %s is still in progress", stored.Key)
+		http.Error(w, "Request with this Idempotency-Key is in progress", http.StatusConflict)
+		return
+	}
+
+	log.Info("Replay response for idempotency key %s", stored.Key)
+
+	w.Header().Set("Authorization", r.Header.Get("Authorization"))
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+
+	w.WriteHeader(stored.ResponseCode)
+	w.Write(stored.ResponseBody)
+}
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+)
+
+// fakeIdempotencyRepo хранит ключи в памяти, остальные методы репозитория не нужны
+type fakeIdempotencyRepo struct {
+	repository.UserRepository
+	mtx  sync.Mutex
+	keys map[string]*models.IdempotencyKey
+}
+
+func (f *fakeIdempotencyRepo) GetUserId(ctx context.Context, username string) (int, error) {
+	return 1, nil
+}
+
+func (f *fakeIdempotencyRepo) AcquireIdempotencyKey(ctx context.Context, key models.IdempotencyKey, staleBefore time.Time) (*models.IdempotencyKey, bool, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	stored, ok := f.keys[key.Key]
+	if ok && stored.Status == "processing" && stored.CreatedAt.Before(staleBefore) && stored.RequestHash == key.RequestHash {
+		stored.CreatedAt = time.Now()
+		copied := *stored
+		return &copied, true, nil
+	}
+	if ok {
+		copied := *stored
+		return &copied, false, nil
+	}
+
+	key.Id = len(f.keys) + 1
+	key.Status = "processing"
+	key.CreatedAt = time.Now()
+	f.keys[key.Key] = &key
+	return &key, true, nil
+}
+
+func (f *fakeIdempotencyRepo) CompleteIdempotencyKey(ctx context.Context, id int, code int, body []byte, contentType string) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	for _, key := range f.keys {
+		if key.Id == id {
+			key.Status = "completed"
+			key.ResponseCode = code
+			key.ResponseBody = body
+			key.ContentType = contentType
+		}
+	}
+	return nil
+}
+
+func (f *fakeIdempotencyRepo) DeleteIdempotencyKey(ctx context.Context, id int) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	for name, key := range f.keys {
+		if key.Id == id {
+			delete(f.keys, name)
+		}
+	}
+	return nil
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	repo := &fakeIdempotencyRepo{keys: make(map[string]*models.IdempotencyKey)}
+	c := NewAuthController(repo, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	calls := 0
+	handler := c.IdempotencyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"balance":100.00}`))
+	})
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/accounts/deposit", strings.NewReader(body))
+		r.Header.Set(idempotencyHeader, key)
+		r = r.WithContext(context.WithValue(r.Context(), "jwtClaims", &JWTClaims{Username: "tester"}))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	first := send("key-1", `{"amount":100}`)
+	if first.Code != http.StatusOK || calls != 1 {
+		t.Fatalf("Expected first request to be executed, but code %d calls %d", first.Code, calls)
+	}
+
+	replay := send("key-1", `{"amount":100}`)
+	if replay.Code != http.StatusOK || calls != 1 {
+		t.Errorf("Expected replay without execution, but code %d calls %d", replay.Code, calls)
+	}
+
+	if replay.Body.String() != first.Body.String() || replay.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected stored response, but %s", replay.Body.String())
+	}
+
+	conflict := send("key-1", `{"amount":200}`)
+	if conflict.Code != http.StatusConflict || calls != 1 {
+		t.Errorf("Expected conflict for another body, but code %d calls %d", conflict.Code, calls)
+	}
+
+	send("key-2", `{"amount":100}`)
+	if calls != 2 {
+		t.Errorf("Expected new key to be executed, but calls %d", calls)
+	}
+
+	// Процесс упал, не сохранив ответ: пока аренда не истекла - 409, потом запрос выполняется
+	repo.keys["key-2"].Status = "processing"
+	if inProgress := send("key-2", `{"amount":100}`); inProgress.Code != http.StatusConflict || calls != 2 {
+		t.Errorf("Expected in progress conflict, but code %d calls %d", inProgress.Code, calls)
+	}
+
+	repo.keys["key-2"].CreatedAt = time.Now().Add(-models.IdempotencyLease - time.Minute)
+	if conflict := send("key-2", `{"amount":300}`); conflict.Code != http.StatusConflict || calls != 2 {
+		t.Errorf("Expected stale key with another body to conflict, but code %d calls %d", conflict.Code, calls)
+	}
+	if retry := send("key-2", `{"amount":100}`); retry.Code != http.StatusOK || calls != 3 {
+		t.Errorf("Expected stale key to be reclaimed, but code %d calls %d", retry.Code, calls)
+	}
+	if repo.keys["key-2"].Status != "completed" {
+		t.Errorf("Expected reclaimed key to be completed, but %s", repo.keys["key-2"].Status)
+	}
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"uniback/dto"
+	"uniback/models"
+	"uniback/utils"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyPasswordHash сравнивается с паролем при входе несуществующего пользователя
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("uniback-dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// loginFailed учитывает неудачный вход. Ответ одинаковый для неизвестного
+// пользователя и неверного пароля.
+func (c *AuthController) loginFailed(w http.ResponseWriter, r *http.Request, username string, user *models.User, result string) {
+	log := utils.GlobalLogger()
+
+	if err := c.loginGuard.Failure(r.Context(), username, clientIp(r), user); err != nil {
+		log.Critical("Can't record login failure of %s: %w", username, err)
+	}
+
+	var userId *int
+	if user != nil {
+		userId = &user.ID
+	}
+	c.auditLogin(r, username, userId, result)
+
+	http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+}
+
+// tooManyRequests отвечает 429 с Retry-After в целых секундах.
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, message, http.StatusTooManyRequests)
+}
+
+// auditLogin пишет попытку входа в журнал login_attempts. Ошибка журнала
+// только логируется и не мешает входу.
+func (c *AuthController) auditLogin(r *http.Request, username string, userId *int, result string) {
+	err := c.userRepo.CreateLoginAttempt(context.WithoutCancel(r.Context()), models.LoginAttempt{
+		Username:  username,
+		UserId:    userId,
+		Ip:        clientIp(r),
+		UserAgent: r.UserAgent(),
+		Result:    result,
+	})
+	if err != nil {
+		utils.GlobalLogger().Error("Can't save login attempt of %s: %w", username, err)
+	}
+}
+
+// UnlockLoginHandler снимает блокировку входа по токену из письма о блокировке.
+func (c *AuthController) UnlockLoginHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Unlock Login from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var unlockDto dto.LoginUnlockRequestDto
+
+	err := json.NewDecoder(r.Body).Decode(&unlockDto)
+	if err != nil {
+		log.Error("Json parse error: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.validateRequest(w, unlockDto); err != nil {
+		return
+	}
+
+	unlocked, err := c.loginGuard.Unlock(r.Context(), unlockDto.Token)
+	if err != nil {
+		log.Critical("Can't unlock login: %w", err)
+		http.Error(w, "Failed to unlock", http.StatusInternalServerError)
+		return
+	}
+
+	if !unlocked {
+		log.Error("Invalid unlock token from %s", r.RemoteAddr)
+		http.Error(w, "Invalid or expired unlock token", http.StatusBadRequest)
+		return
+	}
+
+	log.Info("Login unlocked from %s", r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+	"uniback/models"
+	"uniback/utils"
+)
+
+// Письмо отправляется после ответа клиенту, медленный SMTP не должен задерживать операцию
+const notifyTimeout = 30 * time.Second
+
+// notify отправляет письмо в фоне. Ошибка отправки только логируется:
+// операция уже выполнена и откатывать её из-за почты нельзя.
+func (c *AuthController) notify(email string, n models.Notification) {
+	if c.notifier == nil || email == "" {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+
+		if err := c.notifier.Notify(ctx, email, n); err != nil {
+			utils.GlobalLogger().Error("Can't send %s notification to %s: %w", n.Event, n.Username, err)
+		}
+	}()
+}
+
+// clientIp - адрес клиента без порта. Заголовкам X-Forwarded-For не доверяем,
+// их может подставить сам клиент.
+func clientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
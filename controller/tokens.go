@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"uniback/dto"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/service"
+	"uniback/utils"
+)
+
+type SessionConfig struct {
+	accessTtl  time.Duration
+	refreshTtl time.Duration
+}
+
+func SessionConfigFromGlobalConfig(cfg *utils.Config) *SessionConfig {
+	return &SessionConfig{
+		accessTtl:  time.Duration(cfg.AccessTokenTtlMin) * time.Minute,
+		refreshTtl: time.Duration(cfg.RefreshTokenTtlHours) * time.Hour,
+	}
+}
+
+// session - выданная пара токенов
+type session struct {
+	username     string
+	accessToken  string
+	refreshToken string
+	expiresAt    time.Time
+}
+
+// newSession выдаёт access-токен и refresh-токен. Если previous не nil,
+// refresh-токен previous заменяется новым из той же семьи и пользователь
+// берётся из него, иначе начинается новая семья (вход по паролю).
+func (c *AuthController) newSession(ctx context.Context, userId int, username string, previous []byte) (*session, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	next := models.RefreshToken{
+		UserId:          userId,
+		Username:        username,
+		TokenHash:       models.HashToken(refresh),
+		AccessJti:       jti,
+		AccessExpiresAt: now.Add(c.sessions.accessTtl),
+		ExpiresAt:       now.Add(c.sessions.refreshTtl),
+	}
+
+	var saved *models.RefreshToken
+	if previous == nil {
+		if next.FamilyId, err = randomHex(16); err != nil {
+			return nil, err
+		}
+		saved, err = c.userRepo.CreateRefreshToken(ctx, next)
+	} else {
+		saved, err = c.userRepo.RotateRefreshToken(ctx, previous, next)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := c.tokens.Issue(saved.Username, jti, saved.AccessExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session{username: saved.Username, accessToken: access, refreshToken: refresh, expiresAt: saved.AccessExpiresAt}, nil
+}
+
+func (c *AuthController) writeSession(w http.ResponseWriter, s *session) {
+	w.Header().Set("Authorization", "Bearer "+s.accessToken)
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(dto.TokenResponseDto{
+		Message:      "successful",
+		User:         s.username,
+		AccessToken:  s.accessToken,
+		RefreshToken: s.refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(s.expiresAt).Seconds()),
+	})
+}
+
+// RefreshTokenHandler меняет refresh-токен на новую пару токенов. Старый
+// refresh-токен после этого недействителен, а его повторное использование
+// отзывает все токены этой сессии.
+func (c *AuthController) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Refresh Token from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var refreshDto dto.RefreshTokenRequestDto
+
+	err := json.NewDecoder(r.Body).Decode(&refreshDto)
+	if err != nil {
+		log.Error("Json parse error: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.validateRequest(w, refreshDto); err != nil {
+		return
+	}
+
+	s, err := c.newSession(r.Context(), 0, "", models.HashToken(refreshDto.RefreshToken))
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRefreshTokenReused):
+			log.Critical("Refresh token reuse from %s, token family is revoked", r.RemoteAddr)
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		case errors.Is(err, repository.ErrRefreshTokenRevoked), errors.Is(err, sql.ErrNoRows):
+			log.Error("Invalid refresh token from %s: %w", r.RemoteAddr, err)
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		default:
+			log.Critical("Failed to refresh token: %w", err)
+			http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.writeSession(w, s)
+}
+
+// LogoutHandler отзывает текущий access-токен и refresh-токены этой сессии.
+func (c *AuthController) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Logout from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	if err := c.userRepo.RevokeTokenFamily(r.Context(), claims.ID, claims.ExpiresAt.Time); err != nil {
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to logout", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAllHandler отзывает все сессии пользователя на всех устройствах.
+func (c *AuthController) LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Logout All from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	if err := c.userRepo.RevokeUserTokens(r.Context(), claims.Username); err != nil {
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to logout", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JwksHandler отдаёт открытые ключи проверки access-токенов (RFC 7517).
+// Новый ключ появляется в JWKS раньше, чем начинает подписывать, поэтому
+// кэш на время max-age не мешает проверять токены после ротации.
+func (c *AuthController) JwksHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for JWKS from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodGet {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(service.JwksMaxAge.Seconds())))
+	json.NewEncoder(w).Encode(c.tokens.Jwks())
+}
+
+// randomToken - refresh-токен из 256 случайных бит
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"uniback/dto"
+	"uniback/models"
+	"uniback/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeTokenRepo хранит refresh-токены и отозванные jti в памяти
+type fakeTokenRepo struct {
+	repository.UserRepository
+	tokens  []*models.RefreshToken
+	revoked map[string]bool
+}
+
+func (f *fakeTokenRepo) IsUserExists(ctx context.Context, username string) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeTokenRepo) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return f.revoked[jti], nil
+}
+
+func (f *fakeTokenRepo) CreateRefreshToken(ctx context.Context, token models.RefreshToken) (*models.RefreshToken, error) {
+	token.Status = models.RefreshTokenActive
+	f.tokens = append(f.tokens, &token)
+	return &token, nil
+}
+
+func (f *fakeTokenRepo) RotateRefreshToken(ctx context.Context, hash []byte, next models.RefreshToken) (*models.RefreshToken, error) {
+	for _, token := range f.tokens {
+		if !bytes.Equal(token.TokenHash, hash) {
+			continue
+		}
+		switch token.Status {
+		case models.RefreshTokenRotated:
+			f.revokeFamily(token.FamilyId)
+			return nil, repository.ErrRefreshTokenReused
+		case models.RefreshTokenRevoked:
+			return nil, repository.ErrRefreshTokenRevoked
+		}
+		token.Status = models.RefreshTokenRotated
+		next.UserId, next.Username, next.FamilyId = token.UserId, token.Username, token.FamilyId
+		return f.CreateRefreshToken(ctx, next)
+	}
+	return nil, repository.ErrRefreshTokenRevoked
+}
+
+func (f *fakeTokenRepo) RevokeTokenFamily(ctx context.Context, accessJti string, accessExpiresAt time.Time) error {
+	f.revoked[accessJti] = true
+	for _, token := range f.tokens {
+		if token.AccessJti == accessJti {
+			f.revokeFamily(token.FamilyId)
+		}
+	}
+	return nil
+}
+
+func (f *fakeTokenRepo) revokeFamily(family string) {
+	for _, token := range f.tokens {
+		if token.FamilyId == family {
+			if token.Status == models.RefreshTokenActive {
+				token.Status = models.RefreshTokenRevoked
+			}
+			f.revoked[token.AccessJti] = true
+		}
+	}
+}
+
+// fakeTokenService выдаёт неподписанные токены "username:jti", подпись
+// проверяется в тестах JwtTokenService
+type fakeTokenService struct{}
+
+func (fakeTokenService) Issue(username string, jti string, expiresAt time.Time) (string, error) {
+	return username + ":" + jti, nil
+}
+
+func (fakeTokenService) Verify(token string) (*JWTClaims, error) {
+	username, jti, ok := strings.Cut(token, ":")
+	if !ok {
+		return nil, errors.New("wrong token")
+	}
+	claims := &JWTClaims{Username: username}
+	claims.ID = jti
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+	return claims, nil
+}
+
+func (fakeTokenService) Jwks() models.Jwks {
+	return models.Jwks{}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	repo := &fakeTokenRepo{revoked: map[string]bool{}}
+	c := NewAuthController(repo, nil, nil, nil, nil, nil, nil, nil, &SessionConfig{accessTtl: time.Minute, refreshTtl: time.Hour}, fakeTokenService{}, nil, nil, nil, nil, nil)
+
+	protected := c.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	call := func(access string) int {
+		r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+		r.Header.Set("Authorization", "Bearer "+access)
+		w := httptest.NewRecorder()
+		protected(w, r)
+		return w.Code
+	}
+	refresh := func(token string) (int, dto.TokenResponseDto) {
+		body, _ := json.Marshal(dto.RefreshTokenRequestDto{RefreshToken: token})
+		w := httptest.NewRecorder()
+		c.RefreshTokenHandler(w, httptest.NewRequest(http.MethodPost, "/token/refresh", bytes.NewReader(body)))
+		var resp dto.TokenResponseDto
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	login, err := c.newSession(context.Background(), 1, "tester", nil)
+	if err != nil {
+		t.Fatalf("Login error: %v", err)
+	}
+	if code := call(login.accessToken); code != http.StatusOK {
+		t.Fatalf("Expected access token to be accepted, but %d", code)
+	}
+
+	code, rotated := refresh(login.refreshToken)
+	if code != http.StatusOK || rotated.User != "tester" || rotated.RefreshToken == login.refreshToken {
+		t.Fatalf("Wrong refresh response %d %+v", code, rotated)
+	}
+	if code := call(rotated.AccessToken); code != http.StatusOK {
+		t.Fatalf("Expected new access token to be accepted, but %d", code)
+	}
+
+	// Старый refresh-токен предъявлен повторно: отзывается вся семья
+	if code, _ := refresh(login.refreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("Expected reuse to be rejected, but %d", code)
+	}
+	if code := call(rotated.AccessToken); code != http.StatusUnauthorized {
+		t.Errorf("Expected access token of revoked family to be rejected, but %d", code)
+	}
+	if code, _ := refresh(rotated.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("Expected refresh token of revoked family to be rejected, but %d", code)
+	}
+}
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	repo := &fakeTokenRepo{revoked: map[string]bool{}}
+	c := NewAuthController(repo, nil, nil, nil, nil, nil, nil, nil, &SessionConfig{accessTtl: time.Minute, refreshTtl: time.Hour}, fakeTokenService{}, nil, nil, nil, nil, nil)
+
+	s, err := c.newSession(context.Background(), 1, "tester", nil)
+	if err != nil {
+		t.Fatalf("Login error: %v", err)
+	}
+
+	logout := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	logout.Header.Set("Authorization", "Bearer "+s.accessToken)
+	w := httptest.NewRecorder()
+	c.AuthMiddleware(c.LogoutHandler)(w, logout)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Logout failed with %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	c.AuthMiddleware(c.LogoutHandler)(w, logout)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked token to be rejected, but %d", w.Code)
+	}
+
+	if repo.tokens[0].Status != models.RefreshTokenRevoked {
+		t.Errorf("Expected refresh token to be revoked, but %s", repo.tokens[0].Status)
+	}
+}
@@ -0,0 +1,312 @@
+package controller
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"uniback/dto"
+	"uniback/models"
+	"uniback/utils"
+)
+
+const (
+	dateLayout          = "2006-01-02"
+	cursorTimeLayout    = "2006-01-02T15:04:05.999999"
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+func (c *AuthController) TransactionsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Transactions History from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodGet {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	filter, err := parseTransactionFilter(r.URL.Query())
+	if err != nil {
+		log.Error("Wrong history filter: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account, err := c.userRepo.GetAccountByUsername(r.Context(), r.PathValue("number"), claims.Username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Error("Account %s not found for %s", r.PathValue("number"), claims.Username)
+			http.Error(w, "Account not found", http.StatusNotFound)
+			return
+		}
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to get account from DB", http.StatusInternalServerError)
+		return
+	}
+
+	// Берём на одну запись больше, чтобы понять, есть ли следующая страница
+	limit := filter.Limit
+	filter.Limit++
+
+	transactions, err := c.userRepo.GetAccountTransactions(r.Context(), account.Id, filter)
+	if err != nil {
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to get transactions from DB", http.StatusInternalServerError)
+		return
+	}
+
+	response := dto.AccountTransactionsResponseDto{
+		AccountNumber: account.AccountNumber,
+		Transactions:  []dto.AccountTransactionDto{},
+	}
+
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+		last := transactions[limit-1]
+		response.NextCursor = encodeTransactionCursor(models.TransactionCursor{Time: last.Time, Id: last.Id})
+	}
+
+	for _, trs := range transactions {
+		response.Transactions = append(response.Transactions, dto.AccountTransactionToDto(trs))
+	}
+
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		log.Critical("Encode transactions to json error: %w", err)
+		http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Authorization", r.Header.Get("Authorization"))
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
+
+// parseTransactionFilter разбирает query параметры: from и to - даты YYYY-MM-DD
+// (to включительно), type, direction (in|out), min_amount, max_amount, limit, cursor.
+func parseTransactionFilter(query url.Values) (models.TransactionFilter, error) {
+	filter := models.TransactionFilter{
+		Type:      query.Get("type"),
+		Direction: query.Get("direction"),
+		Limit:     defaultHistoryLimit,
+	}
+
+	from, to, err := parseDateRange(query)
+	if err != nil {
+		return filter, err
+	}
+	filter.From = from
+	filter.To = to
+
+	if filter.Direction != "" && filter.Direction != "in" && filter.Direction != "out" {
+		return filter, fmt.Errorf("direction must be in or out")
+	}
+
+	if filter.MinAmount, err = parseMoneyParam(query, "min_amount"); err != nil {
+		return filter, err
+	}
+
+	if filter.MaxAmount, err = parseMoneyParam(query, "max_amount"); err != nil {
+		return filter, err
+	}
+
+	if str := query.Get("limit"); str != "" {
+		limit, err := strconv.Atoi(str)
+		if err != nil || limit <= 0 || limit > maxHistoryLimit {
+			return filter, fmt.Errorf("limit must be from 1 to %d", maxHistoryLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if str := query.Get("cursor"); str != "" {
+		cursor, err := decodeTransactionCursor(str)
+		if err != nil {
+			return filter, err
+		}
+		filter.After = cursor
+	}
+
+	return filter, nil
+}
+
+func parseDateRange(query url.Values) (from *time.Time, to *time.Time, err error) {
+	if str := query.Get("from"); str != "" {
+		date, err := time.Parse(dateLayout, str)
+		if err != nil {
+			return nil, nil, fmt.Errorf("from must be a date YYYY-MM-DD")
+		}
+		from = &date
+	}
+
+	if str := query.Get("to"); str != "" {
+		date, err := time.Parse(dateLayout, str)
+		if err != nil {
+			return nil, nil, fmt.Errorf("to must be a date YYYY-MM-DD")
+		}
+		date = date.AddDate(0, 0, 1)
+		to = &date
+	}
+
+	if from != nil && to != nil && !from.Before(*to) {
+		return nil, nil, fmt.Errorf("from must be before to")
+	}
+
+	return from, to, nil
+}
+
+func parseMoneyParam(query url.Values, name string) (*models.Money, error) {
+	str := query.Get(name)
+	if str == "" {
+		return nil, nil
+	}
+
+	money, err := models.ParseMoney(str)
+	if err != nil {
+		return nil, fmt.Errorf("wrong %s: %w", name, err)
+	}
+
+	return &money, nil
+}
+
+func encodeTransactionCursor(cursor models.TransactionCursor) string {
+	raw := cursor.Time.Format(cursorTimeLayout) + "|" + strconv.Itoa(cursor.Id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeTransactionCursor(str string) (*models.TransactionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return nil, fmt.Errorf("wrong cursor")
+	}
+
+	timePart, idPart, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, fmt.Errorf("wrong cursor")
+	}
+
+	cursorTime, err := time.Parse(cursorTimeLayout, timePart)
+	if err != nil {
+		return nil, fmt.Errorf("wrong cursor")
+	}
+
+	id, err := strconv.Atoi(idPart)
+	if err != nil {
+		return nil, fmt.Errorf("wrong cursor")
+	}
+
+	return &models.TransactionCursor{Time: cursorTime, Id: id}, nil
+}
+
+// StatementHandler отдаёт выписку за период from..to (по умолчанию - с начала
+// текущего месяца по сегодня) в формате csv или pdf.
+func (c *AuthController) StatementHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Statement from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodGet {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	if format != "csv" && format != "pdf" {
+		log.Error("Wrong statement format: %s", format)
+		http.Error(w, "format must be csv or pdf", http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := parseDateRange(r.URL.Query())
+	if err != nil {
+		log.Error("Wrong statement period: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	if from == nil {
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		from = &monthStart
+	}
+	if to == nil {
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		to = &tomorrow
+	}
+	if !from.Before(*to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	account, err := c.userRepo.GetAccountByUsername(r.Context(), r.PathValue("number"), claims.Username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Error("Account %s not found for %s", r.PathValue("number"), claims.Username)
+			http.Error(w, "Account not found", http.StatusNotFound)
+			return
+		}
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to get account from DB", http.StatusInternalServerError)
+		return
+	}
+
+	statement, err := c.statements.BuildStatement(r.Context(), *account, *from, *to)
+	if err != nil {
+		log.Critical("Build statement error: %w", err)
+		http.Error(w, "Failed to build statement", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	contentType := "text/csv; charset=utf-8"
+	if format == "pdf" {
+		contentType = "application/pdf"
+		err = c.statements.WriteStatementPdf(&buf, statement)
+	} else {
+		err = c.statements.WriteStatementCsv(&buf, statement)
+	}
+
+	if err != nil {
+		log.Critical("Render statement error: %w", err)
+		http.Error(w, "Failed to render statement", http.StatusInternalServerError)
+		return
+	}
+
+	fileName := fmt.Sprintf("statement_%s_%s_%s.%s",
+		account.AccountNumber, from.Format(dateLayout), to.AddDate(0, 0, -1).Format(dateLayout), format)
+
+	w.Header().Set("Authorization", r.Header.Get("Authorization"))
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`"`)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
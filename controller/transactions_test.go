@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"net/url"
+	"testing"
+	"time"
+	"uniback/models"
+)
+
+func TestTransactionCursor(t *testing.T) {
+	cursor := models.TransactionCursor{
+		Time: time.Date(2025, 7, 2, 20, 16, 54, 123456000, time.UTC),
+		Id:   42,
+	}
+
+	decoded, err := decodeTransactionCursor(encodeTransactionCursor(cursor))
+	if err != nil {
+		t.Fatalf("Can't decode cursor: %v", err)
+	}
+
+	if !decoded.Time.Equal(cursor.Time) || decoded.Id != cursor.Id {
+		t.Errorf("Expected %v, but %v", cursor, *decoded)
+	}
+
+	if _, err := decodeTransactionCursor("not-a-cursor"); err == nil {
+		t.Errorf("Expected error for broken cursor")
+	}
+}
+
+func TestParseTransactionFilter(t *testing.T) {
+	filter, err := parseTransactionFilter(url.Values{
+		"from":       {"2025-07-01"},
+		"to":         {"2025-07-31"},
+		"direction":  {"in"},
+		"min_amount": {"10.50"},
+		"limit":      {"10"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if filter.To.Format(dateLayout) != "2025-08-01" {
+		t.Errorf("Expected to be inclusive, but %s", filter.To)
+	}
+
+	if filter.MinAmount.Amount != 1050 || filter.MaxAmount != nil || filter.Limit != 10 {
+		t.Errorf("Wrong filter: %+v", filter)
+	}
+
+	wrong := []url.Values{
+		{"from": {"01.07.2025"}},
+		{"from": {"2025-07-31"}, "to": {"2025-07-01"}},
+		{"direction": {"up"}},
+		{"min_amount": {"0.001"}},
+		{"limit": {"1000"}},
+	}
+
+	for _, query := range wrong {
+		if _, err := parseTransactionFilter(query); err == nil {
+			t.Errorf("Expected error for %v", query)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"uniback/dto"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/service"
+	"uniback/utils"
+)
+
+// requestTransferConfirm откладывает перевод до ввода кода и отвечает 202.
+func (c *AuthController) requestTransferConfirm(w http.ResponseWriter, r *http.Request, username string, source models.Account, dest models.Account, amount models.Money, reason string) {
+	log := utils.GlobalLogger()
+
+	user, err := c.userRepo.GetUserByUsername(r.Context(), username)
+	if err != nil {
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to get user", http.StatusInternalServerError)
+		return
+	}
+
+	// Пока подбор кодов приостановлен, новые коды тоже не отправляются
+	if !c.checkTransferGuard(w, r, username) {
+		return
+	}
+
+	transfer, err := c.transfers.Request(r.Context(), *user, source, dest, amount, reason)
+	if errors.Is(err, repository.ErrTooManyPending) {
+		log.Error("User %s has too many transfers waiting for confirmation", username)
+		http.Error(w, "Too many transfers wait for confirmation, confirm or wait for them to expire", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		log.Critical("Can't request transfer confirmation: %w", err)
+		http.Error(w, "Failed to send confirmation code", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info("Transfer %d of %s waits for confirmation (%s)", transfer.Id, username, reason)
+
+	jsonData, err := json.Marshal(dto.PendingTransferToDto(transfer))
+	if err != nil {
+		log.Critical("Encode pending transfer to json error: %w", err)
+		http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Authorization", r.Header.Get("Authorization"))
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(jsonData)
+}
+
+// ConfirmTransferHandler выполняет отложенный перевод по коду из письма.
+func (c *AuthController) ConfirmTransferHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Confirm Transfer from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		log.Error("Wrong transfer id: %w", err)
+		http.Error(w, "Wrong transfer id", http.StatusBadRequest)
+		return
+	}
+
+	var confirmDto dto.TransferConfirmRequestDto
+
+	err = json.NewDecoder(r.Body).Decode(&confirmDto)
+	if err != nil {
+		log.Error("Json parse error: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.validateRequest(w, confirmDto); err != nil {
+		return
+	}
+
+	if !c.checkTransferGuard(w, r, claims.Username) {
+		return
+	}
+
+	account, err := c.transfers.Confirm(r.Context(), claims.Username, id, confirmDto.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Transfer not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrTransferNotPending):
+			log.Error("Transfer %d is not pending: %w", id, err)
+			http.Error(w, "Transfer is already confirmed, expired or has no attempts left", http.StatusConflict)
+		case errors.Is(err, service.ErrWrongTransferCode):
+			log.Error("Wrong code for transfer %d from %s", id, r.RemoteAddr)
+			if err := c.transferGuard.Failure(r.Context(), claims.Username, clientIp(r)); err != nil {
+				log.Critical("Can't record transfer code failure: %w", err)
+			}
+			http.Error(w, "Wrong confirmation code", http.StatusUnprocessableEntity)
+		case errors.Is(err, service.ErrTransferFailed):
+			log.Error("transaction error: %w", err)
+			http.Error(w, "transaction error", http.StatusBadRequest)
+		default:
+			log.Critical("Failed to confirm transfer %d: %w", id, err)
+			http.Error(w, "Failed to confirm transfer", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.Info("Transfer %d of %s confirmed", id, claims.Username)
+	c.writeJson(w, r, dto.AccountToAccountReponseDto(account))
+}
+
+// checkTransferGuard отвечает 429, если пользователь или его IP подбирали коды
+// подтверждения переводов.
+func (c *AuthController) checkTransferGuard(w http.ResponseWriter, r *http.Request, username string) bool {
+	log := utils.GlobalLogger()
+
+	retryAfter, err := c.transferGuard.Check(r.Context(), username, clientIp(r))
+	if err != nil {
+		log.Critical("Can't check transfer code throttle: %w", err)
+		http.Error(w, "Failed to check transfer", http.StatusInternalServerError)
+		return false
+	}
+
+	if retryAfter > 0 {
+		log.Error("Transfer codes of %s from %s are blocked for %s", username, r.RemoteAddr, retryAfter)
+		tooManyRequests(w, retryAfter, "Too many wrong codes, try later")
+		return false
+	}
+
+	return true
+}
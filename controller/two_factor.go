@@ -0,0 +1,222 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"uniback/dto"
+	"uniback/models"
+	"uniback/service"
+	"uniback/utils"
+)
+
+// EnrollTwoFactorHandler создаёт секрет TOTP и otpauth URI для приложения-
+// аутентификатора. TOTP включается только после подтверждения кодом.
+func (c *AuthController) EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Enroll 2FA from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := c.twoFactorUser(w, r)
+	if !ok {
+		return
+	}
+
+	enrollment, err := c.twoFactor.Enroll(r.Context(), *user)
+	if errors.Is(err, service.ErrTotpEnabled) {
+		log.Error("User %s already has 2FA", user.Name)
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Critical("Failed to enroll 2FA: %w", err)
+		http.Error(w, "Failed to enroll two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	c.writeJson(w, r, dto.TwoFactorEnrollDto{Secret: enrollment.Secret, OtpauthUri: enrollment.Uri})
+}
+
+// ConfirmTwoFactorHandler включает TOTP и возвращает коды восстановления.
+func (c *AuthController) ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Confirm 2FA from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var confirmDto dto.TwoFactorConfirmRequestDto
+
+	err := json.NewDecoder(r.Body).Decode(&confirmDto)
+	if err != nil {
+		log.Error("Json parse error: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.validateRequest(w, confirmDto); err != nil {
+		return
+	}
+
+	user, ok := c.twoFactorUser(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := c.twoFactor.Confirm(r.Context(), user.ID, confirmDto.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTotpEnabled):
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		case errors.Is(err, service.ErrTotpNotEnabled):
+			http.Error(w, "Two-factor enrollment is not started", http.StatusConflict)
+		case errors.Is(err, service.ErrWrongMfaCode):
+			http.Error(w, "Wrong two-factor code", http.StatusUnprocessableEntity)
+		default:
+			log.Critical("Failed to confirm 2FA: %w", err)
+			http.Error(w, "Failed to confirm two-factor authentication", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.Info("User %s enabled 2FA", user.Name)
+	c.writeJson(w, r, dto.TwoFactorRecoveryCodesDto{Message: "two-factor authentication enabled", RecoveryCodes: codes})
+}
+
+// DisableTwoFactorHandler выключает TOTP по коду или коду восстановления.
+func (c *AuthController) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Disable 2FA from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var disableDto dto.TwoFactorDisableRequestDto
+
+	err := json.NewDecoder(r.Body).Decode(&disableDto)
+	if err != nil {
+		log.Error("Json parse error: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.validateRequest(w, disableDto); err != nil {
+		return
+	}
+
+	user, ok := c.twoFactorUser(w, r)
+	if !ok {
+		return
+	}
+
+	err = c.twoFactor.Disable(r.Context(), user.ID, disableDto.Code, disableDto.RecoveryCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTotpNotEnabled):
+			http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		case errors.Is(err, service.ErrWrongMfaCode):
+			http.Error(w, "Wrong two-factor code", http.StatusUnprocessableEntity)
+		default:
+			log.Critical("Failed to disable 2FA: %w", err)
+			http.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.Info("User %s disabled 2FA", user.Name)
+	w.Header().Set("Authorization", r.Header.Get("Authorization"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LoginTwoFactorHandler обменивает токен входа из LoginHandler и код TOTP
+// (или код восстановления) на сессию.
+func (c *AuthController) LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for 2FA login from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var loginDto dto.TwoFactorLoginRequestDto
+
+	err := json.NewDecoder(r.Body).Decode(&loginDto)
+	if err != nil {
+		log.Error("Json parse error: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.validateRequest(w, loginDto); err != nil {
+		return
+	}
+
+	// Подбор кодов по многим токенам входа ограничивается по IP
+	retryAfter, err := c.loginGuard.Check(r.Context(), "", clientIp(r))
+	if err != nil {
+		log.Critical("Can't check login throttle: %w", err)
+		http.Error(w, "Failed to login", http.StatusInternalServerError)
+		return
+	}
+
+	if retryAfter > 0 {
+		log.Error("2FA login from %s is blocked for %s", r.RemoteAddr, retryAfter)
+		tooManyRequests(w, retryAfter, "Too many login attempts, try later")
+		return
+	}
+
+	challenge, err := c.twoFactor.VerifyChallenge(r.Context(), loginDto.ChallengeToken, loginDto.Code, loginDto.RecoveryCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrMfaChallenge), errors.Is(err, service.ErrTotpNotEnabled):
+			log.Error("Invalid 2FA challenge from %s: %w", r.RemoteAddr, err)
+			http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		case errors.Is(err, service.ErrWrongMfaCode):
+			log.Error("Wrong 2FA code from %s", r.RemoteAddr)
+			if err := c.loginGuard.Failure(r.Context(), "", clientIp(r), nil); err != nil {
+				log.Critical("Can't record login failure: %w", err)
+			}
+			c.auditLogin(r, "", nil, models.LoginMfaFailed)
+			http.Error(w, "Wrong two-factor code", http.StatusUnauthorized)
+		default:
+			log.Critical("Failed to verify 2FA: %w", err)
+			http.Error(w, "Failed to login", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.completeLogin(w, r, challenge.UserId, challenge.Username, challenge.Email)
+}
+
+func (c *AuthController) twoFactorUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	log := utils.GlobalLogger()
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	user, err := c.userRepo.GetUserByUsername(r.Context(), claims.Username)
+	if err != nil {
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to get user", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return user, true
+}
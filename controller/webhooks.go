@@ -0,0 +1,321 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"uniback/dto"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/utils"
+)
+
+const maxWebhookDeliveries = 100
+
+// WebhooksHandler: GET - активные webhook пользователя, POST - новый webhook.
+// Секрет подписи возвращается только в ответе на POST.
+func (c *AuthController) WebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Webhooks from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		hooks, err := c.userRepo.GetWebhooks(r.Context(), claims.Username)
+		if err != nil {
+			log.Critical("DB error: %w", err)
+			http.Error(w, "Failed to get webhooks", http.StatusInternalServerError)
+			return
+		}
+
+		c.writeJson(w, r, dto.WebhooksToDto(hooks))
+		return
+	}
+
+	var hookDto dto.WebhookRequestDto
+
+	err := json.NewDecoder(r.Body).Decode(&hookDto)
+	if err != nil {
+		log.Error("Json parse error: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.validateRequest(w, hookDto); err != nil {
+		return
+	}
+
+	u, err := url.Parse(hookDto.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "Webhook url must be http or https", http.StatusBadRequest)
+		return
+	}
+
+	// Имена проверяются при отправке, после разрешения в адрес
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !models.IsPublicAddr(addr) {
+		log.Error("Webhook url with internal address: %s", hookDto.Url)
+		http.Error(w, "Webhook url must not point to internal address", http.StatusBadRequest)
+		return
+	}
+
+	for _, event := range hookDto.Events {
+		if !models.IsWebhookEvent(event) {
+			log.Error("Unknown webhook event: %s", event)
+			http.Error(w, "Unknown event: "+event, http.StatusBadRequest)
+			return
+		}
+	}
+	slices.Sort(hookDto.Events)
+
+	nonce, secret, err := c.webhooks.NewWebhookSecret()
+	if err != nil {
+		log.Critical("Can't create webhook secret: %w", err)
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	hook, err := c.userRepo.CreateWebhook(r.Context(), claims.Username, models.Webhook{
+		Url:         hookDto.Url,
+		Events:      slices.Compact(hookDto.Events),
+		SecretNonce: nonce,
+	})
+	if err != nil {
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	response := dto.WebhookToDto(hook)
+	response.Secret = secret
+
+	c.writeJson(w, r, response)
+}
+
+func (c *AuthController) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Delete Webhook from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodDelete {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	hookId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Wrong webhook id", http.StatusBadRequest)
+		return
+	}
+
+	err = c.userRepo.DeleteWebhook(r.Context(), claims.Username, hookId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return
+		}
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to delete webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Authorization", r.Header.Get("Authorization"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// WebhookDeliveriesHandler - журнал доставок webhook, последние сначала (?limit=, до 100).
+func (c *AuthController) WebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Webhook Deliveries from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodGet {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hook, ok := c.userWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	limit := maxWebhookDeliveries
+	if str := r.URL.Query().Get("limit"); str != "" {
+		parsed, err := strconv.Atoi(str)
+		if err != nil || parsed <= 0 || parsed > maxWebhookDeliveries {
+			http.Error(w, "limit must be from 1 to "+strconv.Itoa(maxWebhookDeliveries), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	deliveries, err := c.userRepo.GetWebhookDeliveries(r.Context(), hook.Id, limit)
+	if err != nil {
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to get webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	c.writeJson(w, r, dto.WebhookDeliveriesToDto(deliveries))
+}
+
+// RedeliverWebhookHandler сразу повторяет доставку и возвращает её результат.
+// Удалённому webhook доставки не повторяются.
+func (c *AuthController) RedeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Redeliver Webhook from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hook, ok := c.userWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if !hook.Active {
+		http.Error(w, "Webhook is deleted", http.StatusConflict)
+		return
+	}
+
+	deliveryId, err := strconv.ParseInt(r.PathValue("delivery"), 10, 64)
+	if err != nil {
+		http.Error(w, "Wrong delivery id", http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := c.userRepo.GetWebhookDelivery(r.Context(), hook.Id, deliveryId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Delivery not found", http.StatusNotFound)
+			return
+		}
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to get webhook delivery", http.StatusInternalServerError)
+		return
+	}
+
+	delivery, err = c.webhooks.Redeliver(r.Context(), *delivery)
+	if err != nil {
+		log.Critical("Redeliver error: %w", err)
+		http.Error(w, "Failed to redeliver webhook", http.StatusInternalServerError)
+		return
+	}
+
+	c.writeJson(w, r, dto.WebhookDeliveryToDto(delivery))
+}
+
+// userWebhook находит webhook из пути запроса среди webhook пользователя и
+// сам пишет ответ с ошибкой.
+func (c *AuthController) userWebhook(w http.ResponseWriter, r *http.Request) (*models.Webhook, bool) {
+	log := utils.GlobalLogger()
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	hookId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Wrong webhook id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	hook, err := c.userRepo.GetWebhookByIdAndUsername(r.Context(), hookId, claims.Username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Webhook not found", http.StatusNotFound)
+			return nil, false
+		}
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to get webhook", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return hook, true
+}
+
+// AccountStatusHandler блокирует, разблокирует или закрывает счёт пользователя.
+// Закрыть можно только счёт без остатка и непогашенных кредитов.
+func (c *AuthController) AccountStatusHandler(w http.ResponseWriter, r *http.Request) {
+	log := utils.GlobalLogger()
+	log.Info("Get http request for Account Status from: %s", r.RemoteAddr)
+
+	if r.Method != http.MethodPost {
+		log.Error("Wrong method!")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := r.Context().Value("jwtClaims").(*JWTClaims)
+	if !ok {
+		log.Critical("No jwt claims in context")
+		http.Error(w, "Failed to get claims", http.StatusInternalServerError)
+		return
+	}
+
+	var statusDto dto.AccountStatusRequestDto
+
+	err := json.NewDecoder(r.Body).Decode(&statusDto)
+	if err != nil {
+		log.Error("Json parse error: %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := c.validateRequest(w, statusDto); err != nil {
+		return
+	}
+
+	account, err := c.userRepo.GetAccountByUsername(r.Context(), r.PathValue("number"), claims.Username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Error("Account %s not found for %s", r.PathValue("number"), claims.Username)
+			http.Error(w, "Account not found", http.StatusNotFound)
+			return
+		}
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to get account from DB", http.StatusInternalServerError)
+		return
+	}
+
+	account, err = c.userRepo.UpdateAccountStatus(r.Context(), account.Id, statusDto.Status)
+	if err != nil {
+		if errors.Is(err, repository.ErrAccountStatus) || errors.Is(err, repository.ErrAccountNotEmpty) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Critical("DB error: %w", err)
+		http.Error(w, "Failed to change account status", http.StatusInternalServerError)
+		return
+	}
+
+	c.writeJson(w, r, dto.AccountToAccountReponseDto(account))
+}
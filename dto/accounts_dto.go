@@ -6,11 +6,11 @@ import (
 )
 
 type AccountResponseDto struct {
-	AccountNumber string    `json:"account_number"`
-	AccountType   string    `json:"account_type"`
-	Balance       float64   `json:"balance"`
-	OpeningDate   time.Time `json:"openin_date"`
-	Status        string    `json:"status"`
+	AccountNumber string       `json:"account_number"`
+	AccountType   string       `json:"account_type"`
+	Balance       models.Money `json:"balance"`
+	OpeningDate   time.Time    `json:"openin_date"`
+	Status        string       `json:"status"`
 }
 
 type AccountsResponseDto struct {
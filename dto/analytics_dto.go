@@ -0,0 +1,145 @@
+package dto
+
+import (
+	"fmt"
+	"uniback/models"
+)
+
+type AnalyticsPeriodDto struct {
+	PeriodStart string       `json:"period_start"`
+	Inflow      models.Money `json:"inflow"`
+	Outflow     models.Money `json:"outflow"`
+	Fees        models.Money `json:"fees"`
+	Net         models.Money `json:"net"`
+	EndBalance  models.Money `json:"end_balance"`
+}
+
+type AccountAnalyticsDto struct {
+	AccountNumber string               `json:"account_number"`
+	Periods       []AnalyticsPeriodDto `json:"periods"`
+}
+
+type AnalyticsResponseDto struct {
+	From        string                `json:"from"`
+	To          string                `json:"to"`
+	Granularity string                `json:"granularity"`
+	Accounts    []AccountAnalyticsDto `json:"accounts"`
+	Total       []AnalyticsPeriodDto  `json:"total"`
+}
+
+// AnalyticsToDto переводит аналитику в ответ API, To в ответе - последний день периода включительно.
+func AnalyticsToDto(a *models.Analytics) AnalyticsResponseDto {
+	result := AnalyticsResponseDto{
+		From:        a.From.Format("2006-01-02"),
+		To:          a.To.AddDate(0, 0, -1).Format("2006-01-02"),
+		Granularity: a.Granularity,
+		Accounts:    []AccountAnalyticsDto{},
+		Total:       analyticsPeriodsToDto(a.Total),
+	}
+
+	for _, acc := range a.Accounts {
+		result.Accounts = append(result.Accounts, AccountAnalyticsDto{
+			AccountNumber: acc.AccountNumber,
+			Periods:       analyticsPeriodsToDto(acc.Periods),
+		})
+	}
+
+	return result
+}
+
+func analyticsPeriodsToDto(periods []models.AnalyticsPeriod) []AnalyticsPeriodDto {
+	result := []AnalyticsPeriodDto{}
+	for _, p := range periods {
+		result = append(result, AnalyticsPeriodDto{
+			PeriodStart: p.PeriodStart.Format("2006-01-02"),
+			Inflow:      p.Inflow,
+			Outflow:     p.Outflow,
+			Fees:        p.Fees,
+			Net:         p.Net,
+			EndBalance:  p.EndBalance,
+		})
+	}
+	return result
+}
+
+type RecurringFlowDto struct {
+	Direction   string       `json:"direction"`
+	Type        string       `json:"type"`
+	Description string       `json:"description,omitempty"`
+	Amount      models.Money `json:"amount"`
+	Period      string       `json:"period"`
+	Occurrences int          `json:"occurrences"`
+	NextDate    string       `json:"next_date"`
+}
+
+type ForecastDayDto struct {
+	Date    string       `json:"date"`
+	Inflow  models.Money `json:"inflow"`
+	Outflow models.Money `json:"outflow"`
+	Balance models.Money `json:"balance"`
+}
+
+type AccountForecastDto struct {
+	AccountNumber string             `json:"account_number"`
+	StartBalance  models.Money       `json:"start_balance"`
+	EndBalance    models.Money       `json:"end_balance"`
+	NegativeOn    string             `json:"negative_on,omitempty"`
+	Recurring     []RecurringFlowDto `json:"recurring"`
+	Days          []ForecastDayDto   `json:"days"`
+}
+
+type ForecastResponseDto struct {
+	Days     int                  `json:"days"`
+	Accounts []AccountForecastDto `json:"accounts"`
+}
+
+func ForecastToDto(days int, forecasts []models.AccountForecast) ForecastResponseDto {
+	result := ForecastResponseDto{
+		Days:     days,
+		Accounts: []AccountForecastDto{},
+	}
+
+	for _, f := range forecasts {
+		item := AccountForecastDto{
+			AccountNumber: f.AccountNumber,
+			StartBalance:  f.StartBalance,
+			EndBalance:    f.StartBalance,
+			Recurring:     []RecurringFlowDto{},
+			Days:          []ForecastDayDto{},
+		}
+
+		if f.NegativeOn != nil {
+			item.NegativeOn = f.NegativeOn.Format("2006-01-02")
+		}
+
+		for _, flow := range f.Recurring {
+			period := fmt.Sprintf("%dd", flow.IntervalDays)
+			if flow.Monthly {
+				period = "monthly"
+			}
+			item.Recurring = append(item.Recurring, RecurringFlowDto{
+				Direction:   flow.Direction,
+				Type:        flow.Type,
+				Description: flow.Description,
+				Amount:      flow.Amount,
+				Period:      period,
+				Occurrences: flow.Occurrences,
+				NextDate:    flow.NextDate.Format("2006-01-02"),
+			})
+		}
+
+		for _, day := range f.Days {
+			item.Days = append(item.Days, ForecastDayDto{
+				Date:    day.Date.Format("2006-01-02"),
+				Inflow:  day.Inflow,
+				Outflow: day.Outflow,
+				Balance: day.Balance,
+			})
+			item.EndBalance = day.Balance
+		}
+
+		result.Accounts = append(result.Accounts, item)
+	}
+
+	return result
+}
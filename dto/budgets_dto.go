@@ -0,0 +1,53 @@
+package dto
+
+import "uniback/models"
+
+type BudgetRequestDto struct {
+	Category string       `json:"category" validate:"required,max=30"`
+	Amount   models.Money `json:"amount" validate:"required,gt=0,lte=1000000000"`
+}
+
+type TransactionCategoryRequestDto struct {
+	Category string `json:"category" validate:"required,max=30"`
+	// Запомнить категорию для всех будущих операций в той же торговой точке
+	ApplyToMerchant bool `json:"apply_to_merchant"`
+}
+
+type TransactionCategoryResponseDto struct {
+	Id       int    `json:"id"`
+	Category string `json:"category"`
+}
+
+type BudgetDto struct {
+	Category  string       `json:"category"`
+	Amount    models.Money `json:"amount"`
+	Spent     models.Money `json:"spent"`
+	Projected models.Money `json:"projected"`
+	Remaining models.Money `json:"remaining"`
+	Status    string       `json:"status"`
+}
+
+type BudgetsResponseDto struct {
+	Month   string      `json:"month"`
+	Budgets []BudgetDto `json:"budgets"`
+}
+
+func BudgetReportToDto(month string, report []models.BudgetStatus) BudgetsResponseDto {
+	result := BudgetsResponseDto{
+		Month:   month,
+		Budgets: []BudgetDto{},
+	}
+
+	for _, b := range report {
+		result.Budgets = append(result.Budgets, BudgetDto{
+			Category:  b.Category,
+			Amount:    b.Amount,
+			Spent:     b.Spent,
+			Projected: b.Projected,
+			Remaining: b.Remaining,
+			Status:    b.Status,
+		})
+	}
+
+	return result
+}
@@ -1,5 +1,75 @@
 package dto
 
+import (
+	"time"
+	"uniback/models"
+)
+
 type CardCreateRequestDto struct {
 	AccountNumber string `json:"account_number" validate:"required"`
 }
+
+type CardResponseDto struct {
+	Id            int       `json:"id"`
+	Number        string    `json:"number"`
+	ExpiryMonth   int       `json:"expiry_month"`
+	ExpiryYear    int       `json:"expiry_year"`
+	AccountNumber string    `json:"account_number"`
+	Status        string    `json:"status"`
+	ReissuedFrom  int       `json:"reissued_from,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type CardEventDto struct {
+	OldStatus string    `json:"old_status,omitempty"`
+	NewStatus string    `json:"new_status"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CardEventsResponseDto struct {
+	CardId int            `json:"card_id"`
+	Events []CardEventDto `json:"events"`
+}
+
+type CardsResponseDto struct {
+	CardsNum int               `json:"cards_num"`
+	Cards    []CardResponseDto `json:"cards"`
+}
+
+type CardPaymentRequestDto struct {
+	Number   string       `json:"number" validate:"required,numeric,len=16"`
+	Expiry   string       `json:"expiry" validate:"required,len=5"`
+	Cvv      string       `json:"cvv" validate:"required,numeric,len=3"`
+	Amount   models.Money `json:"amount" validate:"required,gt=0"`
+	Merchant string       `json:"merchant" validate:"required,max=100"`
+	Capture  bool         `json:"capture"`
+}
+
+type CardCaptureRequestDto struct {
+	Amount *models.Money `json:"amount,omitempty"`
+}
+
+type CardHoldResponseDto struct {
+	Id             int          `json:"id"`
+	Card           string       `json:"card,omitempty"`
+	Amount         models.Money `json:"amount"`
+	CapturedAmount models.Money `json:"captured_amount"`
+	Merchant       string       `json:"merchant"`
+	Status         string       `json:"status"`
+	CreatedAt      time.Time    `json:"created_at"`
+	ExpiresAt      time.Time    `json:"expires_at"`
+}
+
+func CardHoldToDto(hold *models.CardHold, maskedNumber string) CardHoldResponseDto {
+	return CardHoldResponseDto{
+		Id:             hold.Id,
+		Card:           maskedNumber,
+		Amount:         hold.Amount,
+		CapturedAmount: hold.CapturedAmount,
+		Merchant:       hold.Merchant,
+		Status:         hold.Status,
+		CreatedAt:      hold.CreatedAt,
+		ExpiresAt:      hold.ExpiresAt,
+	}
+}
@@ -0,0 +1,138 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+	"uniback/models"
+)
+
+type CreditCreateRequestDto struct {
+	AccountNumber string       `json:"account_number" validate:"required"`
+	Product       string       `json:"product" validate:"omitempty,max=20"`
+	Principal     models.Money `json:"principal" validate:"required,gt=0,lte=1000000000"`
+	TermMonths    int          `json:"term_months" validate:"required,gt=0,lte=360"`
+	ScheduleType  string       `json:"schedule_type" validate:"omitempty,oneof=annuity differentiated"`
+}
+
+type CreditRepayRequestDto struct {
+	Amount models.Money `json:"amount" validate:"required,gt=0,lte=1000000000"`
+	Mode   string       `json:"mode" validate:"required,oneof=shorten_term reduce_payment"`
+}
+
+type CreditPaymentDto struct {
+	Number    int          `json:"number"`
+	DueDate   string       `json:"due_date"`
+	Payment   models.Money `json:"payment"`
+	Principal models.Money `json:"principal"`
+	Interest  models.Money `json:"interest"`
+	Remaining models.Money `json:"remaining"`
+	Status    string       `json:"status"`
+}
+
+type CreditResponseDto struct {
+	Id              int                `json:"id"`
+	AccountNumber   string             `json:"account_number"`
+	Principal       models.Money       `json:"principal"`
+	Product         string             `json:"product"`
+	KeyRate         json.Number        `json:"key_rate"`
+	Margin          json.Number        `json:"margin"`
+	Rate            json.Number        `json:"rate"`
+	TermMonths      int                `json:"term_months"`
+	ScheduleType    string             `json:"schedule_type"`
+	MonthlyPayment  models.Money       `json:"monthly_payment"`
+	Status          string             `json:"status"`
+	CreatedAt       time.Time          `json:"created_at"`
+	ScheduleVersion int                `json:"schedule_version"`
+	Schedule        []CreditPaymentDto `json:"schedule,omitempty"`
+}
+
+type CreditRepaymentDto struct {
+	Mode      string       `json:"mode"`
+	Amount    models.Money `json:"amount"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// CreditScheduleVersionDto - версия графика. У первой версии нет погашения,
+// каждая следующая появилась после досрочного погашения Repayment.
+type CreditScheduleVersionDto struct {
+	Version   int                 `json:"version"`
+	Repayment *CreditRepaymentDto `json:"repayment,omitempty"`
+	Schedule  []CreditPaymentDto  `json:"schedule"`
+}
+
+type CreditHistoryResponseDto struct {
+	CreditId int                        `json:"credit_id"`
+	Versions []CreditScheduleVersionDto `json:"versions"`
+}
+
+type CreditsResponseDto struct {
+	CreditsNum int                 `json:"credits_num"`
+	Credits    []CreditResponseDto `json:"credits"`
+}
+
+func LoanToDto(loan *models.Loan, schedule []models.CreditPayment) CreditResponseDto {
+	result := CreditResponseDto{
+		Id:              loan.Id,
+		AccountNumber:   loan.AccountNumber,
+		Principal:       loan.Principal,
+		Product:         loan.Product,
+		KeyRate:         json.Number(models.FormatRate(loan.KeyRateBp)),
+		Margin:          json.Number(models.FormatRate(loan.MarginBp)),
+		Rate:            json.Number(models.FormatRate(loan.RateBp)),
+		TermMonths:      loan.TermMonths,
+		ScheduleType:    loan.ScheduleType,
+		MonthlyPayment:  loan.MonthlyPayment,
+		Status:          loan.Status,
+		CreatedAt:       loan.CreatedAt,
+		ScheduleVersion: loan.ScheduleVersion,
+	}
+
+	for _, p := range schedule {
+		result.Schedule = append(result.Schedule, creditPaymentToDto(p))
+	}
+
+	return result
+}
+
+// CreditHistoryToDto раскладывает строки всех версий графика по версиям.
+func CreditHistoryToDto(loan *models.Loan, history []models.CreditPayment, repayments []models.CreditRepayment) CreditHistoryResponseDto {
+	result := CreditHistoryResponseDto{
+		CreditId: loan.Id,
+		Versions: []CreditScheduleVersionDto{},
+	}
+
+	for version := 1; version <= loan.ScheduleVersion; version++ {
+		item := CreditScheduleVersionDto{
+			Version:  version,
+			Schedule: []CreditPaymentDto{},
+		}
+
+		for _, r := range repayments {
+			if r.Version == version {
+				item.Repayment = &CreditRepaymentDto{Mode: r.Mode, Amount: r.Amount, CreatedAt: r.CreatedAt}
+			}
+		}
+
+		for _, p := range history {
+			if p.Version == version {
+				item.Schedule = append(item.Schedule, creditPaymentToDto(p))
+			}
+		}
+
+		result.Versions = append(result.Versions, item)
+	}
+
+	return result
+}
+
+func creditPaymentToDto(p models.CreditPayment) CreditPaymentDto {
+	return CreditPaymentDto{
+		Number:    p.Number,
+		DueDate:   p.DueDate.Format("2006-01-02"),
+		Payment:   p.Payment,
+		Principal: p.Principal,
+		Interest:  p.Interest,
+		Remaining: p.Remaining,
+		Status:    p.Status,
+	}
+}
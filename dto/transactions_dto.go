@@ -1,12 +1,74 @@
 package dto
 
+import (
+	"time"
+	"uniback/models"
+)
+
 type TransactionRequestDto struct {
-	AccountNumber string  `json:"account_number" validate:"required"`
-	Amount        float64 `json:"amount" validate:"required,gt=0"`
+	AccountNumber string       `json:"account_number" validate:"required"`
+	Amount        models.Money `json:"amount" validate:"required,gt=0"`
 }
 
 type TransferRequestDto struct {
-	SourceAccountNumber      string  `json:"source_account_number" validate:"required"`
-	DestinationAccountNumber string  `json:"destination_account_number" validate:"required"`
-	Amount                   float64 `json:"amount" validate:"required,gt=0"`
+	SourceAccountNumber      string       `json:"source_account_number" validate:"required"`
+	DestinationAccountNumber string       `json:"destination_account_number" validate:"required"`
+	Amount                   models.Money `json:"amount" validate:"required,gt=0"`
+}
+
+type AccountTransactionDto struct {
+	Id                  int          `json:"id"`
+	Type                string       `json:"type"`
+	Direction           string       `json:"direction"`
+	Amount              models.Money `json:"amount"`
+	Fee                 models.Money `json:"fee"`
+	Time                time.Time    `json:"time"`
+	CounterpartyAccount string       `json:"counterparty_account,omitempty"`
+	Category            string       `json:"category,omitempty"`
+}
+
+type AccountTransactionsResponseDto struct {
+	AccountNumber string                  `json:"account_number"`
+	Transactions  []AccountTransactionDto `json:"transactions"`
+	NextCursor    string                  `json:"next_cursor,omitempty"`
+}
+
+func AccountTransactionToDto(trs models.AccountTransaction) AccountTransactionDto {
+	return AccountTransactionDto{
+		Id:                  trs.Id,
+		Type:                trs.Type,
+		Direction:           trs.Direction,
+		Amount:              trs.Amount,
+		Fee:                 trs.Fee,
+		Time:                trs.Time,
+		CounterpartyAccount: trs.CounterpartyAccount,
+		Category:            trs.Category,
+	}
+}
+
+// PendingTransferDto - перевод, ожидающий подтверждения кодом из письма
+type PendingTransferDto struct {
+	Id                       int64        `json:"id"`
+	Status                   string       `json:"status"`
+	Reason                   string       `json:"reason"`
+	SourceAccountNumber      string       `json:"source_account_number"`
+	DestinationAccountNumber string       `json:"destination_account_number"`
+	Amount                   models.Money `json:"amount"`
+	ExpiresAt                time.Time    `json:"expires_at"`
+}
+
+func PendingTransferToDto(transfer *models.PendingTransfer) PendingTransferDto {
+	return PendingTransferDto{
+		Id:                       transfer.Id,
+		Status:                   transfer.Status,
+		Reason:                   transfer.Reason,
+		SourceAccountNumber:      transfer.SourceAccountNumber,
+		DestinationAccountNumber: transfer.DestAccountNumber,
+		Amount:                   transfer.Amount,
+		ExpiresAt:                transfer.ExpiresAt,
+	}
+}
+
+type TransferConfirmRequestDto struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
 }
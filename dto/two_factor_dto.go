@@ -0,0 +1,36 @@
+package dto
+
+// TwoFactorChallengeDto - ответ на вход по паролю, если у пользователя включён
+// TOTP. ChallengeToken вместе с кодом отправляется на /login/2fa.
+type TwoFactorChallengeDto struct {
+	Message           string `json:"message"`
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"`
+}
+
+type TwoFactorLoginRequestDto struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode   string `json:"recovery_code" validate:"required_without=Code,omitempty,max=16"`
+}
+
+type TwoFactorEnrollDto struct {
+	Secret     string `json:"secret"`
+	OtpauthUri string `json:"otpauth_uri"`
+}
+
+type TwoFactorConfirmRequestDto struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// TwoFactorRecoveryCodesDto - коды восстановления показываются только один раз
+type TwoFactorRecoveryCodesDto struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorDisableRequestDto struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,max=16"`
+}
@@ -8,6 +8,24 @@ type UserCreateRequest struct {
 }
 
 type UserLoginRequest struct {
-	Username string `json:"username" validate:"required"`
+	Username string `json:"username" validate:"required,max=50"`
 	Password string `json:"password" validate:"required,min=6"`
 }
+
+type RefreshTokenRequestDto struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type TokenResponseDto struct {
+	Message      string `json:"message"`
+	User         string `json:"user"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// Время жизни access-токена в секундах
+	ExpiresIn int `json:"expires_in"`
+}
+
+type LoginUnlockRequestDto struct {
+	Token string `json:"token" validate:"required"`
+}
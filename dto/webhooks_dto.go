@@ -0,0 +1,80 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+	"uniback/models"
+)
+
+type WebhookRequestDto struct {
+	Url    string   `json:"url" validate:"required,url,max=2048"`
+	Events []string `json:"events" validate:"required,min=1,dive,required"`
+}
+
+type WebhookDto struct {
+	Id        int       `json:"id"`
+	Url       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	// Секрет подписи возвращается только при создании webhook
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookDeliveryDto struct {
+	Id            int64           `json:"id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	ResponseCode  int             `json:"response_code,omitempty"`
+	ResponseBody  string          `json:"response_body,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	LastAttemptAt *time.Time      `json:"last_attempt_at,omitempty"`
+}
+
+type AccountStatusRequestDto struct {
+	Status string `json:"status" validate:"required,oneof=active blocked closed"`
+}
+
+func WebhookToDto(hook *models.Webhook) WebhookDto {
+	return WebhookDto{
+		Id:        hook.Id,
+		Url:       hook.Url,
+		Events:    hook.Events,
+		Active:    hook.Active,
+		CreatedAt: hook.CreatedAt,
+	}
+}
+
+func WebhooksToDto(hooks []models.Webhook) []WebhookDto {
+	result := []WebhookDto{}
+	for i := range hooks {
+		result = append(result, WebhookToDto(&hooks[i]))
+	}
+	return result
+}
+
+func WebhookDeliveryToDto(d *models.WebhookDelivery) WebhookDeliveryDto {
+	return WebhookDeliveryDto{
+		Id:            d.Id,
+		Event:         d.Event,
+		Payload:       d.Payload,
+		Status:        d.Status,
+		Attempts:      d.Attempts,
+		ResponseCode:  d.ResponseCode,
+		ResponseBody:  d.ResponseBody,
+		Error:         d.Error,
+		CreatedAt:     d.CreatedAt,
+		LastAttemptAt: d.LastAttemptAt,
+	}
+}
+
+func WebhookDeliveriesToDto(deliveries []models.WebhookDelivery) []WebhookDeliveryDto {
+	result := []WebhookDeliveryDto{}
+	for i := range deliveries {
+		result = append(result, WebhookDeliveryToDto(&deliveries[i]))
+	}
+	return result
+}
@@ -6,7 +6,9 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 	"uniback/controller"
+	"uniback/models"
 	"uniback/repository/postgres"
 	"uniback/service"
 	"uniback/utils"
@@ -41,23 +43,173 @@ func main() {
 		return
 	}
 
-	authController := controller.NewAuthController(DataBase, CryptoService, Service, cfg.JwtKey)
+	if err := service.BackfillCardNumberIndex(ctx, DataBase, CryptoService); err != nil {
+		logger.Critical("Card number index backfill fail: %w", err)
+		return
+	}
+
+	TokenService, err := service.NewJwtTokenService(ctx, DataBase, CryptoService, service.TokenConfigFromGlobalConfig(cfg))
+	if err != nil {
+		logger.Critical("TokenService init fail: %w", err)
+		return
+	}
+
+	StatementService := service.NewLedgerStatementService(DataBase, cfg.AppName)
+
+	creditMargins, err := models.ParseCreditMargins(cfg.CreditMargins)
+	if err != nil {
+		logger.Critical("Wrong credit margins: %w", err)
+		return
+	}
+
+	var KeyRateProvider service.KeyRateProvider = service.NewCbrKeyRateProvider(DataBase, service.CbrKeyRateConfigFromGlobalConfig(cfg))
+	if cfg.KeyRateFile != "" {
+		logger.Info("Use key rates from file: %s", cfg.KeyRateFile)
+		KeyRateProvider, err = service.LoadKeyRateFile(cfg.KeyRateFile)
+		if err != nil {
+			logger.Critical("Can't load key rate file: %w", err)
+			return
+		}
+	}
+
+	penaltyRateBp, err := models.ParseRate(cfg.CreditPenalty)
+	if err != nil {
+		logger.Critical("Wrong credit penalty rate: %w", err)
+		return
+	}
+
+	CreditService := service.NewLoanService(DataBase, Service, KeyRateProvider, creditMargins, penaltyRateBp)
+
+	var Notifier service.Notifier = service.LogNotifier{}
+	if cfg.SmtpHost != "" {
+		Notifier, err = service.NewSmtpNotifier(service.SmtpConfigFromGlobalConfig(cfg))
+		if err != nil {
+			logger.Critical("Notifier init fail: %w", err)
+			return
+		}
+	} else {
+		logger.Info("SMTP_HOST is not set, notifications are written to log only")
+	}
+
+	Scheduler := service.NewScheduler(DataBase)
+	Scheduler.AddJob(service.Job{
+		Name:     "credit_payments",
+		Interval: time.Duration(cfg.JobIntervalMin) * time.Minute,
+		Run: func(ctx context.Context) (int, error) {
+			return CreditService.CollectDuePayments(ctx, time.Now())
+		},
+	})
+	Scheduler.AddJob(service.Job{
+		Name:     "credit_reminders",
+		Interval: time.Duration(cfg.JobIntervalMin) * time.Minute,
+		Run: func(ctx context.Context) (int, error) {
+			return service.RemindCreditPayments(ctx, DataBase, Notifier, time.Now(), cfg.RemindDays)
+		},
+	})
+
+	Scheduler.AddJob(service.Job{
+		Name:     "jwt_key_rotation",
+		Interval: time.Duration(cfg.JobIntervalMin) * time.Minute,
+		Run: func(ctx context.Context) (int, error) {
+			return TokenService.RotateKeys(ctx, time.Now())
+		},
+	})
+	Scheduler.AddJob(service.Job{
+		Name:     "token_cleanup",
+		Interval: time.Duration(cfg.JobIntervalMin) * time.Minute,
+		Run: func(ctx context.Context) (int, error) {
+			return DataBase.DeleteExpiredTokens(ctx, time.Now())
+		},
+	})
+	Scheduler.AddJob(service.Job{
+		Name:     "idempotency_cleanup",
+		Interval: time.Duration(cfg.JobIntervalMin) * time.Minute,
+		Run: func(ctx context.Context) (int, error) {
+			return DataBase.DeleteExpiredIdempotencyKeys(ctx, time.Now().Add(-models.IdempotencyKeyTtl))
+		},
+	})
+	TransferCodeGuard := service.NewThrottleAttemptGuard(DataBase, models.ThrottleScopeTransferUser, models.ThrottleScopeTransferIp, service.TransferCodeGuardConfigFromGlobalConfig(cfg))
+	CardGuard := service.NewThrottleCardGuard(DataBase, service.CardGuardConfigFromGlobalConfig(cfg))
+	LoginGuard := service.NewThrottleLoginGuard(DataBase, Notifier, service.LoginGuardConfigFromGlobalConfig(cfg))
+	Scheduler.AddJob(service.Job{
+		Name:     "login_throttle_cleanup",
+		Interval: time.Duration(cfg.JobIntervalMin) * time.Minute,
+		Run: func(ctx context.Context) (int, error) {
+			return LoginGuard.DeleteStale(ctx, time.Now())
+		},
+	})
+
+	Outbox := service.NewOutboxDispatcher(DataBase, service.OutboxConfigFromGlobalConfig(cfg))
+	Outbox.AddSink(service.NewNotificationSink(DataBase, Notifier, CryptoService))
+	WebhookService := service.NewHttpWebhookService(DataBase, CryptoService, service.WebhookConfigFromGlobalConfig(cfg))
+	Outbox.AddSink(WebhookService)
+
+	jobsCtx, stopJobs := context.WithCancel(ctx)
+	Scheduler.Start(jobsCtx)
+	Outbox.Start(jobsCtx)
+	defer Scheduler.Wait()
+	defer Outbox.Wait()
+	defer stopJobs()
+
+	AnalyticsService := service.NewSqlAnalyticsService(DataBase)
+	transferConfirmCfg, err := service.TransferConfirmConfigFromGlobalConfig(cfg)
+	if err != nil {
+		logger.Critical("Wrong transfer confirmation config: %w", err)
+		return
+	}
+	TransferConfirmService := service.NewCodeTransferConfirmService(DataBase, Service, Notifier, CryptoService, transferConfirmCfg)
+	TwoFactorService := service.NewTotpService(DataBase, CryptoService, service.TotpConfigFromGlobalConfig(cfg))
+
+	authController := controller.NewAuthController(DataBase, CryptoService, Service, StatementService, CreditService, AnalyticsService, Notifier, WebhookService, controller.SessionConfigFromGlobalConfig(cfg), TokenService, TwoFactorService, TransferConfirmService, LoginGuard, TransferCodeGuard, CardGuard)
 	http.HandleFunc("/register", authController.RegistrationHandler)
 	http.HandleFunc("/login", authController.LoginHandler)
+	http.HandleFunc("/login/2fa", authController.LoginTwoFactorHandler)
+	http.HandleFunc("/login/unlock", authController.UnlockLoginHandler)
+	http.HandleFunc("/token/refresh", authController.RefreshTokenHandler)
+	http.HandleFunc("/.well-known/jwks.json", authController.JwksHandler)
+	http.HandleFunc("/logout", authController.AuthMiddleware(authController.LogoutHandler))
+	http.HandleFunc("/logout/all", authController.AuthMiddleware(authController.LogoutAllHandler))
+	http.HandleFunc("/2fa/enroll", authController.AuthMiddleware(authController.EnrollTwoFactorHandler))
+	http.HandleFunc("/2fa/confirm", authController.AuthMiddleware(authController.ConfirmTwoFactorHandler))
+	http.HandleFunc("/2fa/disable", authController.AuthMiddleware(authController.DisableTwoFactorHandler))
 	//
 	http.HandleFunc("/accounts", authController.AuthMiddleware(authController.AccountsHandler))
 	http.HandleFunc("/accounts/new", authController.AuthMiddleware(authController.AccountsCreateHandler))
-	http.HandleFunc("/accounts/deposit", authController.AuthMiddleware(authController.DepositHandler))
-	http.HandleFunc("/accounts/withdrawal", authController.AuthMiddleware(authController.WithdrawalHandler))
-	http.HandleFunc("/accounts/transfer", authController.AuthMiddleware(authController.TransferHandler))
+	http.HandleFunc("/accounts/deposit", authController.AuthMiddleware(authController.IdempotencyMiddleware(authController.DepositHandler)))
+	http.HandleFunc("/accounts/withdrawal", authController.AuthMiddleware(authController.IdempotencyMiddleware(authController.WithdrawalHandler)))
+	http.HandleFunc("/accounts/transfer", authController.AuthMiddleware(authController.IdempotencyMiddleware(authController.TransferHandler)))
+	http.HandleFunc("/accounts/transfer/{id}/confirm", authController.AuthMiddleware(authController.IdempotencyMiddleware(authController.ConfirmTransferHandler)))
+	http.HandleFunc("/accounts/{number}/transactions", authController.AuthMiddleware(authController.TransactionsHistoryHandler))
+	http.HandleFunc("/accounts/{number}/statement", authController.AuthMiddleware(authController.StatementHandler))
+	http.HandleFunc("/accounts/{number}/status", authController.AuthMiddleware(authController.AccountStatusHandler))
 	//
 	http.HandleFunc("/cards", authController.AuthMiddleware(authController.ShowCardsHandler))
 	http.HandleFunc("/cards/new", authController.AuthMiddleware(authController.NewCardHandler))
+	http.HandleFunc("/cards/pay", authController.AuthMiddleware(authController.IdempotencyMiddleware(authController.CardPaymentHandler)))
+	http.HandleFunc("/cards/holds/{id}/capture", authController.AuthMiddleware(authController.IdempotencyMiddleware(authController.CaptureCardHoldHandler)))
+	http.HandleFunc("/cards/holds/{id}/void", authController.AuthMiddleware(authController.VoidCardHoldHandler))
+	http.HandleFunc("/cards/{id}/block", authController.AuthMiddleware(authController.BlockCardHandler))
+	http.HandleFunc("/cards/{id}/unblock", authController.AuthMiddleware(authController.UnblockCardHandler))
+	http.HandleFunc("/cards/{id}/lost", authController.AuthMiddleware(authController.LostCardHandler))
+	http.HandleFunc("/cards/{id}/close", authController.AuthMiddleware(authController.CloseCardHandler))
+	http.HandleFunc("/cards/{id}/events", authController.AuthMiddleware(authController.CardEventsHandler))
 	//
 	http.HandleFunc("/credits", authController.AuthMiddleware(authController.ShowCreditsHanlder))
-	http.HandleFunc("/credits/new", authController.AuthMiddleware(authController.NewCreditHandler))
+	http.HandleFunc("/credits/new", authController.AuthMiddleware(authController.IdempotencyMiddleware(authController.NewCreditHandler)))
+	http.HandleFunc("/credits/{id}", authController.AuthMiddleware(authController.CreditHandler))
+	http.HandleFunc("/credits/{id}/repay", authController.AuthMiddleware(authController.IdempotencyMiddleware(authController.RepayCreditHandler)))
+	http.HandleFunc("/credits/{id}/history", authController.AuthMiddleware(authController.CreditHistoryHandler))
 	//
 	http.HandleFunc("/analytics", authController.AuthMiddleware(authController.AnalyticsHanlder))
+	http.HandleFunc("/analytics/forecast", authController.AuthMiddleware(authController.ForecastHandler))
+	http.HandleFunc("/budgets", authController.AuthMiddleware(authController.BudgetsHandler))
+	http.HandleFunc("/budgets/{category}", authController.AuthMiddleware(authController.DeleteBudgetHandler))
+	http.HandleFunc("/transactions/{id}/category", authController.AuthMiddleware(authController.TransactionCategoryHandler))
+
+	http.HandleFunc("/webhooks", authController.AuthMiddleware(authController.WebhooksHandler))
+	http.HandleFunc("/webhooks/{id}", authController.AuthMiddleware(authController.DeleteWebhookHandler))
+	http.HandleFunc("/webhooks/{id}/deliveries", authController.AuthMiddleware(authController.WebhookDeliveriesHandler))
+	http.HandleFunc("/webhooks/{id}/deliveries/{delivery}/redeliver", authController.AuthMiddleware(authController.RedeliverWebhookHandler))
 
 	server := &http.Server{Addr: cfg.HostAddress}
 
@@ -75,7 +227,7 @@ func main() {
 	}()
 
 	logger.Info("Try to start server...")
-	err := server.ListenAndServe()
+	err = server.ListenAndServe()
 	if err != nil {
 		logger.Critical("Server can't run: %w", err)
 	}
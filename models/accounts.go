@@ -12,11 +12,32 @@ type Account struct {
 	UserId        int
 	AccountNumber string
 	AccountType   string
-	Balance       float64
+	Balance       Money
 	OpeningDate   time.Time
 	Status        string
 }
 
+const (
+	AccountActive  = "active"
+	AccountBlocked = "blocked"
+	AccountClosed  = "closed"
+)
+
+// Заблокированный счёт можно разблокировать, закрытый счёт не открывается.
+var accountStatusTransitions = map[string][]string{
+	AccountActive:  {AccountBlocked, AccountClosed},
+	AccountBlocked: {AccountActive, AccountClosed},
+}
+
+func CanChangeAccountStatus(from string, to string) bool {
+	for _, status := range accountStatusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
 func GenerateAccount() string {
 	// simulate ZZZ control key
 	controlKey := fmt.Sprintf("%03d", rand.Intn(1000))
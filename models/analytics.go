@@ -0,0 +1,107 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// AnalyticsPeriod - обороты счёта за период, начинающийся с PeriodStart.
+// Net = Inflow - Outflow - Fees, EndBalance - баланс на конец периода.
+type AnalyticsPeriod struct {
+	AccountId     int
+	AccountNumber string
+	PeriodStart   time.Time
+	Inflow        Money
+	Outflow       Money
+	Fees          Money
+	Net           Money
+	EndBalance    Money
+}
+
+type AccountAnalytics struct {
+	AccountId     int
+	AccountNumber string
+	Periods       []AnalyticsPeriod
+}
+
+// Analytics - обороты пользователя за [From, To) по каждому счёту и в сумме по всем счетам.
+type Analytics struct {
+	From        time.Time
+	To          time.Time
+	Granularity string
+	Accounts    []AccountAnalytics
+	Total       []AnalyticsPeriod
+}
+
+// CountPeriods считает число периодов гранулярности granularity в [from, to).
+func CountPeriods(from time.Time, to time.Time, granularity string) (int, error) {
+	var step func(time.Time) time.Time
+	switch granularity {
+	case GranularityDay:
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case GranularityWeek:
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case GranularityMonth:
+		step = func(t time.Time) time.Time { return AddMonths(t, 1) }
+	default:
+		return 0, fmt.Errorf("unknown granularity: %q", granularity)
+	}
+
+	count := 0
+	for t := from; t.Before(to); t = step(t) {
+		count++
+	}
+	return count, nil
+}
+
+// SummarizeAnalytics группирует строки по счетам и складывает итог по всем
+// счетам. Строки должны идти по счёту и по возрастанию периода, у каждого
+// счёта - одинаковый набор периодов.
+func SummarizeAnalytics(from time.Time, to time.Time, granularity string, rows []AnalyticsPeriod) *Analytics {
+	result := &Analytics{
+		From:        from,
+		To:          to,
+		Granularity: granularity,
+	}
+
+	totals := map[time.Time]int{}
+	for _, row := range rows {
+		if n := len(result.Accounts); n == 0 || result.Accounts[n-1].AccountId != row.AccountId {
+			result.Accounts = append(result.Accounts, AccountAnalytics{
+				AccountId:     row.AccountId,
+				AccountNumber: row.AccountNumber,
+			})
+		}
+		account := &result.Accounts[len(result.Accounts)-1]
+		account.Periods = append(account.Periods, row)
+
+		i, ok := totals[row.PeriodStart]
+		if !ok {
+			i = len(result.Total)
+			totals[row.PeriodStart] = i
+			result.Total = append(result.Total, AnalyticsPeriod{
+				PeriodStart: row.PeriodStart,
+				Inflow:      NewMoney(0),
+				Outflow:     NewMoney(0),
+				Fees:        NewMoney(0),
+				Net:         NewMoney(0),
+				EndBalance:  NewMoney(0),
+			})
+		}
+
+		total := &result.Total[i]
+		total.Inflow = total.Inflow.Add(row.Inflow)
+		total.Outflow = total.Outflow.Add(row.Outflow)
+		total.Fees = total.Fees.Add(row.Fees)
+		total.Net = total.Net.Add(row.Net)
+		total.EndBalance = total.EndBalance.Add(row.EndBalance)
+	}
+
+	return result
+}
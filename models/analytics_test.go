@@ -0,0 +1,43 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCountPeriods(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	for granularity, expected := range map[string]int{GranularityDay: 90, GranularityWeek: 13, GranularityMonth: 3} {
+		if count, err := CountPeriods(from, to, granularity); err != nil || count != expected {
+			t.Errorf("Expected %d periods by %s, but %d (%v)", expected, granularity, count, err)
+		}
+	}
+
+	if _, err := CountPeriods(from, to, "year"); err == nil {
+		t.Errorf("Expected error for unknown granularity")
+	}
+}
+
+func TestSummarizeAnalytics(t *testing.T) {
+	jan := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	rows := []AnalyticsPeriod{
+		{AccountId: 1, PeriodStart: jan, Inflow: NewMoney(10000), Outflow: NewMoney(0), Fees: NewMoney(0), Net: NewMoney(10000), EndBalance: NewMoney(10000)},
+		{AccountId: 1, PeriodStart: feb, Inflow: NewMoney(0), Outflow: NewMoney(3000), Fees: NewMoney(100), Net: NewMoney(-3100), EndBalance: NewMoney(6900)},
+		{AccountId: 2, PeriodStart: jan, Inflow: NewMoney(500), Outflow: NewMoney(0), Fees: NewMoney(0), Net: NewMoney(500), EndBalance: NewMoney(500)},
+		{AccountId: 2, PeriodStart: feb, Inflow: NewMoney(3000), Outflow: NewMoney(0), Fees: NewMoney(0), Net: NewMoney(3000), EndBalance: NewMoney(3500)},
+	}
+
+	result := SummarizeAnalytics(jan, feb.AddDate(0, 1, 0), GranularityMonth, rows)
+
+	if len(result.Accounts) != 2 || len(result.Accounts[0].Periods) != 2 || len(result.Total) != 2 {
+		t.Fatalf("Wrong analytics grouping: %+v", result)
+	}
+
+	if result.Total[1].Net.String() != "-1.00" || result.Total[1].EndBalance.String() != "104.00" || result.Total[1].Fees.String() != "1.00" {
+		t.Errorf("Wrong February total: %+v", result.Total[1])
+	}
+}
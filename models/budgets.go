@@ -0,0 +1,112 @@
+package models
+
+import (
+	"math/big"
+	"time"
+)
+
+// Категории операций. Набор совпадает с категориями в правилах category_rules.
+const (
+	CategoryIncome        = "income"
+	CategoryTransfers     = "transfers"
+	CategoryCash          = "cash"
+	CategoryLoans         = "loans"
+	CategoryGroceries     = "groceries"
+	CategoryRestaurants   = "restaurants"
+	CategoryTransport     = "transport"
+	CategoryHealth        = "health"
+	CategoryShopping      = "shopping"
+	CategoryUtilities     = "utilities"
+	CategoryEntertainment = "entertainment"
+	CategoryOther         = "other"
+)
+
+var Categories = []string{
+	CategoryIncome, CategoryTransfers, CategoryCash, CategoryLoans,
+	CategoryGroceries, CategoryRestaurants, CategoryTransport, CategoryHealth,
+	CategoryShopping, CategoryUtilities, CategoryEntertainment, CategoryOther,
+}
+
+func IsCategory(category string) bool {
+	for _, c := range Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	BudgetOk            = "ok"
+	BudgetProjectedOver = "projected_over"
+	BudgetOver          = "over"
+)
+
+// Budget - месячный лимит расходов пользователя по категории.
+type Budget struct {
+	Id       int
+	Category string
+	Amount   Money
+}
+
+// BudgetStatus - расходы по бюджету за месяц. Projected - прогноз расходов
+// на конец месяца по текущему темпу трат.
+type BudgetStatus struct {
+	Budget
+	Spent     Money
+	Projected Money
+	Remaining Money
+	Status    string
+}
+
+// MonthStart - первое число месяца даты t.
+func MonthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// ProjectSpending продлевает траты spent за прошедшие дни месяца month на весь
+// месяц. Для прошедших месяцев прогноз равен фактическим тратам.
+func ProjectSpending(spent Money, month time.Time, at time.Time) Money {
+	start := MonthStart(month)
+	end := start.AddDate(0, 1, 0)
+	today := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+
+	if !today.Before(end) || today.Before(start) {
+		return spent
+	}
+
+	// Сегодняшний день считается прошедшим: траты за него уже есть
+	elapsed := int64(today.Sub(start).Hours()/24) + 1
+	days := int64(end.Sub(start).Hours() / 24)
+
+	return roundRat(new(big.Rat).Mul(moneyRat(spent), big.NewRat(days, elapsed)), spent.Currency)
+}
+
+// BuildBudgetReport сопоставляет бюджеты с фактическими тратами по категориям.
+func BuildBudgetReport(month time.Time, at time.Time, budgets []Budget, spent map[string]Money) []BudgetStatus {
+	report := []BudgetStatus{}
+	for _, b := range budgets {
+		s, ok := spent[b.Category]
+		if !ok {
+			s = Money{Currency: b.Amount.Currency}
+		}
+
+		item := BudgetStatus{
+			Budget:    b,
+			Spent:     s,
+			Projected: ProjectSpending(s, month, at),
+			Remaining: b.Amount.Sub(s),
+			Status:    BudgetOk,
+		}
+
+		switch {
+		case item.Spent.Cmp(b.Amount) > 0:
+			item.Status = BudgetOver
+		case item.Projected.Cmp(b.Amount) > 0:
+			item.Status = BudgetProjectedOver
+		}
+
+		report = append(report, item)
+	}
+	return report
+}
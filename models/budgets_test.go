@@ -0,0 +1,51 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProjectSpending(t *testing.T) {
+	month := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	// 10 дней из 30 - темп 3x
+	if projected := ProjectSpending(NewMoney(100000), month, time.Date(2025, 4, 10, 18, 0, 0, 0, time.UTC)); projected.String() != "3000.00" {
+		t.Errorf("Expected 3000.00 projection, but %s", projected)
+	}
+
+	if projected := ProjectSpending(NewMoney(100000), month, time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)); projected.String() != "1000.00" {
+		t.Errorf("Expected past month projection equal to spent, but %s", projected)
+	}
+}
+
+func TestBuildBudgetReport(t *testing.T) {
+	month := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	at := time.Date(2025, 4, 10, 0, 0, 0, 0, time.UTC)
+
+	budgets := []Budget{
+		{Category: CategoryGroceries, Amount: NewMoney(1000000)},
+		{Category: CategoryRestaurants, Amount: NewMoney(500000)},
+		{Category: CategoryTransport, Amount: NewMoney(300000)},
+	}
+	spent := map[string]Money{
+		CategoryGroceries:   NewMoney(500000),
+		CategoryRestaurants: NewMoney(600000),
+	}
+
+	report := BuildBudgetReport(month, at, budgets, spent)
+	if len(report) != 3 {
+		t.Fatalf("Expected 3 budgets, but %d", len(report))
+	}
+
+	if report[0].Status != BudgetProjectedOver || report[0].Projected.String() != "15000.00" {
+		t.Errorf("Expected groceries projected over, but %+v", report[0])
+	}
+
+	if report[1].Status != BudgetOver || report[1].Remaining.String() != "-1000.00" {
+		t.Errorf("Expected restaurants over, but %+v", report[1])
+	}
+
+	if report[2].Status != BudgetOk || !report[2].Spent.IsZero() {
+		t.Errorf("Expected transport ok without spending, but %+v", report[2])
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const CardHoldTtl = 7 * 24 * time.Hour
+
+// CardHold - блокировка суммы на счёте карты до подтверждения (capture) или отмены (void).
+type CardHold struct {
+	Id             int
+	CardId         int
+	AccountId      int
+	InitiatorId    int
+	Amount         Money
+	CapturedAmount Money
+	Merchant       string
+	Status         string
+	TransactionId  int
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+}
@@ -1,12 +1,90 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 type Card struct {
-	Id        int
-	AccountId int
-	Number    []byte
-	Expiry    []byte
-	Cvv       []byte
-	CreatedAt time.Time
+	Id            int
+	AccountId     int
+	AccountNumber string
+	Number        []byte
+	NumberHmac    []byte
+	Expiry        []byte
+	Cvv           []byte
+	Status        string
+	ReissuedFrom  int
+	CreatedAt     time.Time
+}
+
+const (
+	CardActive  = "active"
+	CardBlocked = "blocked"
+	CardLost    = "lost"
+	CardExpired = "expired"
+	CardClosed  = "closed"
+)
+
+// Допустимые переходы статусов карты. Из lost, expired и closed карта
+// уже не возвращается в работу, вместо неё выпускается новая.
+var cardStatusTransitions = map[string][]string{
+	CardActive:  {CardBlocked, CardLost, CardExpired, CardClosed},
+	CardBlocked: {CardActive, CardLost, CardExpired, CardClosed},
+	CardLost:    {CardClosed},
+	CardExpired: {CardClosed},
+}
+
+// CardEvent - запись журнала изменений статуса карты.
+type CardEvent struct {
+	Id          int
+	CardId      int
+	OldStatus   string
+	NewStatus   string
+	InitiatorId int
+	Reason      string
+	CreatedAt   time.Time
+}
+
+func CanChangeCardStatus(from string, to string) bool {
+	for _, status := range cardStatusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+const CardExpiryLayout = "01/06"
+
+// MaskCardNumber оставляет видимыми только последние 4 цифры номера.
+func MaskCardNumber(number string) string {
+	if len(number) < 4 {
+		return strings.Repeat("*", len(number))
+	}
+	return "**** **** **** " + number[len(number)-4:]
+}
+
+// ParseCardExpiry разбирает срок действия карты. Поддерживается формат MM/YY и
+// старый формат time.Time.String(), в котором карты сохранялись раньше.
+func ParseCardExpiry(expiry string) (month int, year int, err error) {
+	if t, err := time.Parse(CardExpiryLayout, expiry); err == nil {
+		return int(t.Month()), t.Year(), nil
+	}
+
+	datePart, _, _ := strings.Cut(expiry, " ")
+	t, err := time.Parse("2006-01-02", datePart)
+	if err != nil {
+		return 0, 0, fmt.Errorf("wrong card expiry format")
+	}
+
+	return int(t.Month()), t.Year(), nil
+}
+
+// IsCardExpired сообщает, истёк ли срок действия карты: карта действует
+// до конца месяца, указанного на ней.
+func IsCardExpired(month int, year int, now time.Time) bool {
+	validUntil := time.Date(year, time.Month(month)+1, 1, 0, 0, 0, 0, now.Location())
+	return !now.Before(validUntil)
 }
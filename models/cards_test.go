@@ -0,0 +1,76 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaskCardNumber(t *testing.T) {
+	if MaskCardNumber("2200123456781234") != "**** **** **** 1234" {
+		t.Errorf("Wrong mask: %s", MaskCardNumber("2200123456781234"))
+	}
+
+	if MaskCardNumber("12") != "**" {
+		t.Errorf("Short number should be fully masked, but %s", MaskCardNumber("12"))
+	}
+}
+
+func TestParseCardExpiry(t *testing.T) {
+	month, year, err := ParseCardExpiry("07/30")
+	if err != nil || month != 7 || year != 2030 {
+		t.Errorf("Expected 07/2030, but %d/%d (%v)", month, year, err)
+	}
+
+	// Так срок сохранялся до перехода на формат MM/YY
+	month, year, err = ParseCardExpiry("2030-07-02 20:16:54.123456 +0300 MSK m=+157766400.000000001")
+	if err != nil || month != 7 || year != 2030 {
+		t.Errorf("Expected 07/2030 from legacy format, but %d/%d (%v)", month, year, err)
+	}
+
+	if _, _, err := ParseCardExpiry(""); err == nil {
+		t.Errorf("Expected error for empty expiry")
+	}
+}
+
+func TestIsCardExpired(t *testing.T) {
+	now := time.Date(2030, 7, 31, 23, 59, 0, 0, time.UTC)
+	if IsCardExpired(7, 2030, now) {
+		t.Errorf("Card 07/30 should be valid until the end of July")
+	}
+
+	if !IsCardExpired(7, 2030, now.Add(time.Minute)) {
+		t.Errorf("Card 07/30 should be expired in August")
+	}
+
+	if !IsCardExpired(12, 2029, now) {
+		t.Errorf("Card 12/29 should be expired")
+	}
+}
+
+func TestCanChangeCardStatus(t *testing.T) {
+	allowed := [][2]string{
+		{CardActive, CardBlocked},
+		{CardBlocked, CardActive},
+		{CardActive, CardLost},
+		{CardBlocked, CardExpired},
+		{CardLost, CardClosed},
+	}
+	for _, tr := range allowed {
+		if !CanChangeCardStatus(tr[0], tr[1]) {
+			t.Errorf("Expected %s -> %s to be allowed", tr[0], tr[1])
+		}
+	}
+
+	denied := [][2]string{
+		{CardActive, CardActive},
+		{CardLost, CardActive},
+		{CardExpired, CardActive},
+		{CardClosed, CardActive},
+		{CardClosed, CardBlocked},
+	}
+	for _, tr := range denied {
+		if CanChangeCardStatus(tr[0], tr[1]) {
+			t.Errorf("Expected %s -> %s to be denied", tr[0], tr[1])
+		}
+	}
+}
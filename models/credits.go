@@ -0,0 +1,321 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+)
+
+const (
+	ScheduleAnnuity        = "annuity"
+	ScheduleDifferentiated = "differentiated"
+)
+
+const (
+	CreditActive  = "active"
+	CreditOverdue = "overdue"
+	CreditPaid    = "paid"
+)
+
+const (
+	PaymentPending = "pending"
+	PaymentOverdue = "overdue"
+	PaymentPaid    = "paid"
+	// Строка старой версии графика, заменённой после досрочного погашения
+	PaymentSuperseded = "superseded"
+)
+
+// Режимы частичного досрочного погашения
+const (
+	RepayShortenTerm   = "shorten_term"
+	RepayReducePayment = "reduce_payment"
+)
+
+// Loan - выданный кредит (таблица credits), имя Credit уже занято направлением проводки.
+// Ставки хранятся в сотых долях процента годовых: 2150 = 21.50%.
+// RateBp = KeyRateBp + MarginBp на дату выдачи.
+type Loan struct {
+	Id             int
+	UserId         int
+	AccountId      int
+	AccountNumber  string
+	Principal      Money
+	Product        string
+	KeyRateBp      int
+	MarginBp       int
+	RateBp         int
+	TermMonths     int
+	ScheduleType   string
+	MonthlyPayment Money
+	Status         string
+	TransactionId  int
+	CreatedAt      time.Time
+	// Номер текущей версии графика, растёт при каждом досрочном погашении
+	ScheduleVersion int
+}
+
+// CreditPayment - строка графика платежей. Remaining - остаток долга после платежа.
+type CreditPayment struct {
+	Id        int
+	CreditId  int
+	Number    int
+	DueDate   time.Time
+	Payment   Money
+	Principal Money
+	Interest  Money
+	Remaining Money
+	Status    string
+	PaidAt    *time.Time
+	// Пени по просроченному платежу и дата, до которой они начислены
+	Penalty          Money
+	PenaltyAccruedAt *time.Time
+	TransactionId    int
+	Version          int
+}
+
+// CreditRepayment - досрочное погашение, после которого появилась версия графика Version.
+type CreditRepayment struct {
+	Id            int
+	CreditId      int
+	Version       int
+	Mode          string
+	Amount        Money
+	TransactionId int
+	CreatedAt     time.Time
+}
+
+// DueCreditPayment - платёж, срок которого наступил, со счётом для списания.
+type DueCreditPayment struct {
+	CreditPayment
+	AccountId int
+}
+
+// Total - сумма к списанию: платёж по графику и начисленные пени.
+func (p CreditPayment) Total() Money {
+	return p.Payment.Add(p.Penalty)
+}
+
+// ParseRate разбирает ставку в процентах годовых ("21.5") в сотые доли процента.
+func ParseRate(s string) (int, error) {
+	// Ставка с точностью до сотых разбирается так же, как сумма в копейках
+	rate, err := ParseMoney(s)
+	if err != nil || rate.IsNegative() {
+		return 0, fmt.Errorf("invalid rate value: %q", s)
+	}
+	return int(rate.Amount), nil
+}
+
+func FormatRate(rateBp int) string {
+	return NewMoney(int64(rateBp)).String()
+}
+
+// BuildCreditSchedule строит график ежемесячных платежей. Расчёт идёт в
+// рациональных числах без float, каждая сумма округляется до копейки, а
+// последний платёж закрывает остаток долга целиком.
+func BuildCreditSchedule(principal Money, rateBp int, months int, scheduleType string, start time.Time) ([]CreditPayment, error) {
+	if !principal.IsPositive() {
+		return nil, fmt.Errorf("credit principal must be positive")
+	}
+	if months <= 0 {
+		return nil, fmt.Errorf("credit term must be positive")
+	}
+	if rateBp < 0 {
+		return nil, fmt.Errorf("credit rate must not be negative")
+	}
+
+	// Месячная ставка: rateBp / 100 / 100 / 12
+	monthlyRate := big.NewRat(int64(rateBp), 120000)
+
+	var annuity Money
+	switch scheduleType {
+	case ScheduleAnnuity:
+		annuity = annuityPayment(principal, monthlyRate, months)
+	case ScheduleDifferentiated:
+	default:
+		return nil, fmt.Errorf("unknown schedule type: %q", scheduleType)
+	}
+
+	schedule := make([]CreditPayment, 0, months)
+	remaining := principal
+
+	for i := 1; i <= months; i++ {
+		interest := roundRat(new(big.Rat).Mul(moneyRat(remaining), monthlyRate), principal.Currency)
+
+		var principalPart Money
+		switch {
+		case i == months:
+			principalPart = remaining
+		case scheduleType == ScheduleAnnuity:
+			principalPart = annuity.Sub(interest)
+		default:
+			principalPart = Money{Amount: principal.Amount / int64(months), Currency: principal.Currency}
+		}
+
+		// При очень маленьком платеже проценты могут съесть его целиком
+		if principalPart.IsNegative() {
+			principalPart = Money{Currency: principal.Currency}
+		}
+		if principalPart.Cmp(remaining) > 0 {
+			principalPart = remaining
+		}
+
+		remaining = remaining.Sub(principalPart)
+
+		schedule = append(schedule, CreditPayment{
+			Number:    i,
+			DueDate:   AddMonths(start, i),
+			Payment:   principalPart.Add(interest),
+			Principal: principalPart,
+			Interest:  interest,
+			Remaining: remaining,
+			Status:    PaymentPending,
+		})
+	}
+
+	return schedule, nil
+}
+
+// RecalculateCreditSchedule строит новый график после досрочного погашения
+// суммы amount. pending - оставшиеся неоплаченные платежи текущего графика,
+// новые платежи получают их номера и даты. При shorten_term ежемесячный
+// платёж сохраняется, а срок сокращается, при reduce_payment срок прежний,
+// а платёж уменьшается. Если долг погашен целиком, график пустой.
+func RecalculateCreditSchedule(loan Loan, pending []CreditPayment, amount Money, mode string) ([]CreditPayment, error) {
+	if len(pending) == 0 {
+		return nil, fmt.Errorf("credit has no pending payments")
+	}
+
+	outstanding := Money{Currency: amount.Currency}
+	for _, p := range pending {
+		outstanding = outstanding.Add(p.Principal)
+	}
+
+	if !amount.IsPositive() || amount.Cmp(outstanding) > 0 {
+		return nil, fmt.Errorf("repayment must be positive and not exceed outstanding principal %s", outstanding)
+	}
+
+	rest := outstanding.Sub(amount)
+	if rest.IsZero() {
+		return nil, nil
+	}
+
+	months := len(pending)
+	switch {
+	case mode == RepayReducePayment:
+	case mode == RepayShortenTerm && loan.ScheduleType == ScheduleAnnuity:
+		months = annuityTerm(rest, big.NewRat(int64(loan.RateBp), 120000), pending[0].Payment, months)
+	case mode == RepayShortenTerm:
+		// Для дифференцированного графика сохраняется доля основного долга в платеже
+		part := pending[0].Principal.Amount
+		if part > 0 && (rest.Amount+part-1)/part < int64(months) {
+			months = int((rest.Amount + part - 1) / part)
+		}
+	default:
+		return nil, fmt.Errorf("unknown repayment mode: %q", mode)
+	}
+
+	schedule, err := BuildCreditSchedule(rest, loan.RateBp, months, loan.ScheduleType, pending[0].DueDate)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range schedule {
+		schedule[i].Number = pending[i].Number
+		schedule[i].DueDate = pending[i].DueDate
+	}
+
+	return schedule, nil
+}
+
+// CreditPenalty считает пени за days дней просрочки суммы amount по ставке
+// penaltyRateBp годовых (в сотых долях процента).
+func CreditPenalty(amount Money, penaltyRateBp int, days int) Money {
+	if days <= 0 || penaltyRateBp <= 0 {
+		return Money{Currency: amount.Currency}
+	}
+
+	penalty := new(big.Rat).Mul(moneyRat(amount), big.NewRat(int64(penaltyRateBp)*int64(days), 10000*365))
+	return roundRat(penalty, amount.Currency)
+}
+
+// AddMonths сдвигает дату на n месяцев. Если в целевом месяце нет такого
+// числа (31 января + 1 месяц), берётся последний день месяца.
+func AddMonths(t time.Time, n int) time.Time {
+	year, month, day := t.Date()
+	firstDay := time.Date(year, month+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := firstDay.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return firstDay.AddDate(0, 0, day-1)
+}
+
+// annuityPayment = P * r / (1 - (1 + r)^-n)
+func annuityPayment(principal Money, monthlyRate *big.Rat, months int) Money {
+	if monthlyRate.Sign() == 0 {
+		return roundRat(new(big.Rat).Quo(moneyRat(principal), big.NewRat(int64(months), 1)), principal.Currency)
+	}
+
+	growth := new(big.Rat).Add(big.NewRat(1, 1), monthlyRate)
+	power := big.NewRat(1, 1)
+	for i := 0; i < months; i++ {
+		power.Mul(power, growth)
+	}
+
+	// P * r * (1+r)^n / ((1+r)^n - 1)
+	numerator := new(big.Rat).Mul(moneyRat(principal), monthlyRate)
+	numerator.Mul(numerator, power)
+	denominator := new(big.Rat).Sub(power, big.NewRat(1, 1))
+
+	return roundRat(numerator.Quo(numerator, denominator), principal.Currency)
+}
+
+// annuityTerm находит минимальный срок, при котором аннуитетный платёж
+// не превышает payment: n = ceil(-ln(1 - P*r/A) / ln(1 + r)). Перебор сроков
+// с annuityPayment для ипотеки на 30 лет занимает больше секунды, поэтому срок
+// считается по формуле и только уточняется на округление платежа до копейки.
+func annuityTerm(principal Money, monthlyRate *big.Rat, payment Money, maxMonths int) int {
+	if !payment.IsPositive() {
+		return maxMonths
+	}
+
+	p, _ := moneyRat(principal).Float64()
+	a, _ := moneyRat(payment).Float64()
+	r, _ := monthlyRate.Float64()
+
+	exact := p / a
+	if r > 0 {
+		// Платёж не покрывает даже проценты - долг не гасится ни за какой срок
+		rest := 1 - p*r/a
+		if rest <= 0 {
+			return maxMonths
+		}
+		exact = -math.Log(rest) / math.Log1p(r)
+	}
+
+	if math.IsNaN(exact) || exact >= float64(maxMonths) {
+		return maxMonths
+	}
+
+	n := max(int(math.Ceil(exact)), 1)
+	if annuityPayment(principal, monthlyRate, n).Cmp(payment) > 0 {
+		n++
+	} else if n > 1 && annuityPayment(principal, monthlyRate, n-1).Cmp(payment) <= 0 {
+		n--
+	}
+
+	return min(n, maxMonths)
+}
+
+func moneyRat(m Money) *big.Rat {
+	return big.NewRat(m.Amount, 1)
+}
+
+// roundRat округляет сумму в копейках до целой копейки, половина - вверх.
+func roundRat(r *big.Rat, currency string) Money {
+	doubled := new(big.Int).Mul(r.Num(), big.NewInt(2))
+	doubled.Add(doubled, r.Denom())
+	quotient := new(big.Int).Div(doubled, new(big.Int).Mul(r.Denom(), big.NewInt(2)))
+	return Money{Amount: quotient.Int64(), Currency: currency}
+}
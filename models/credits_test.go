@@ -0,0 +1,178 @@
+package models
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestBuildAnnuitySchedule(t *testing.T) {
+	start := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+	schedule, err := BuildCreditSchedule(NewMoney(10000000), 1200, 12, ScheduleAnnuity, start)
+	if err != nil {
+		t.Fatalf("Schedule error: %v", err)
+	}
+
+	if len(schedule) != 12 {
+		t.Fatalf("Expected 12 payments, but %d", len(schedule))
+	}
+
+	// 100 000.00 под 12% годовых на 12 месяцев
+	if schedule[0].Payment.String() != "8884.88" || schedule[0].Interest.String() != "1000.00" {
+		t.Errorf("Wrong first payment: %s (interest %s)", schedule[0].Payment, schedule[0].Interest)
+	}
+
+	total := NewMoney(0)
+	for _, p := range schedule {
+		total = total.Add(p.Principal)
+		if p.Payment.Cmp(p.Principal.Add(p.Interest)) != 0 {
+			t.Errorf("Payment %d is not principal + interest", p.Number)
+		}
+	}
+
+	if total.String() != "100000.00" || !schedule[11].Remaining.IsZero() {
+		t.Errorf("Schedule must repay principal: total %s, remaining %s", total, schedule[11].Remaining)
+	}
+
+	// 31 января + 1 месяц = последний день февраля
+	if !schedule[0].DueDate.Equal(time.Date(2025, 2, 28, 0, 0, 0, 0, time.UTC)) || schedule[2].DueDate.Day() != 30 {
+		t.Errorf("Wrong due dates: %v, %v", schedule[0].DueDate, schedule[2].DueDate)
+	}
+}
+
+func TestBuildDifferentiatedSchedule(t *testing.T) {
+	schedule, err := BuildCreditSchedule(NewMoney(12000000), 1200, 12, ScheduleDifferentiated, time.Now())
+	if err != nil {
+		t.Fatalf("Schedule error: %v", err)
+	}
+
+	if schedule[0].Payment.String() != "11200.00" || schedule[11].Payment.String() != "10100.00" {
+		t.Errorf("Wrong differentiated payments: first %s, last %s", schedule[0].Payment, schedule[11].Payment)
+	}
+
+	if _, err := BuildCreditSchedule(NewMoney(100), 1200, 0, ScheduleAnnuity, time.Now()); err == nil {
+		t.Errorf("Expected error for zero term")
+	}
+
+	if _, err := BuildCreditSchedule(NewMoney(100), 1200, 12, "bullet", time.Now()); err == nil {
+		t.Errorf("Expected error for unknown schedule type")
+	}
+}
+
+func TestZeroRateSchedule(t *testing.T) {
+	schedule, err := BuildCreditSchedule(NewMoney(1000), 0, 3, ScheduleAnnuity, time.Now())
+	if err != nil {
+		t.Fatalf("Schedule error: %v", err)
+	}
+
+	if schedule[0].Payment.String() != "3.33" || schedule[2].Payment.String() != "3.34" {
+		t.Errorf("Wrong zero rate payments: %s, %s", schedule[0].Payment, schedule[2].Payment)
+	}
+}
+
+func TestParseCreditMargins(t *testing.T) {
+	margins, err := ParseCreditMargins("consumer:5.00, mortgage:2.5")
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	if margins["consumer"] != 500 || margins["mortgage"] != 250 || len(margins) != 2 {
+		t.Errorf("Wrong margins: %v", margins)
+	}
+
+	for _, wrong := range []string{"", "consumer", "consumer:-1", ":5.00", "consumer:abc"} {
+		if _, err := ParseCreditMargins(wrong); err == nil {
+			t.Errorf("Expected error for %q", wrong)
+		}
+	}
+}
+
+func TestCreditPenalty(t *testing.T) {
+	// 10 000.00 под 20% годовых за 30 дней
+	if p := CreditPenalty(NewMoney(1000000), 2000, 30); p.String() != "164.38" {
+		t.Errorf("Expected penalty 164.38, but %s", p)
+	}
+
+	if p := CreditPenalty(NewMoney(1000000), 2000, 0); !p.IsZero() {
+		t.Errorf("Expected no penalty without overdue days, but %s", p)
+	}
+}
+
+func TestRecalculateCreditSchedule(t *testing.T) {
+	loan := Loan{RateBp: 1200, ScheduleType: ScheduleAnnuity}
+	schedule, err := BuildCreditSchedule(NewMoney(10000000), loan.RateBp, 12, loan.ScheduleType, time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Schedule error: %v", err)
+	}
+
+	// Первые два платежа оплачены, досрочно гасим 50 000.00
+	pending := schedule[2:]
+
+	reduced, err := RecalculateCreditSchedule(loan, pending, NewMoney(5000000), RepayReducePayment)
+	if err != nil {
+		t.Fatalf("Recalculate error: %v", err)
+	}
+
+	if len(reduced) != 10 || reduced[0].Number != 3 || !reduced[0].DueDate.Equal(pending[0].DueDate) || !reduced[9].Remaining.IsZero() {
+		t.Errorf("Expected 10 payments from number 3, but %+v", reduced)
+	}
+
+	if reduced[0].Payment.Cmp(pending[0].Payment) >= 0 {
+		t.Errorf("Expected smaller payment, but %s", reduced[0].Payment)
+	}
+
+	shortened, err := RecalculateCreditSchedule(loan, pending, NewMoney(5000000), RepayShortenTerm)
+	if err != nil {
+		t.Fatalf("Recalculate error: %v", err)
+	}
+
+	if len(shortened) >= len(pending) || shortened[0].Payment.Cmp(pending[0].Payment) > 0 || !shortened[len(shortened)-1].Remaining.IsZero() {
+		t.Errorf("Expected shorter term with the same payment, but %d payments of %s", len(shortened), shortened[0].Payment)
+	}
+
+	outstanding := pending[0].Principal.Add(pending[0].Remaining)
+	if full, err := RecalculateCreditSchedule(loan, pending, outstanding, RepayShortenTerm); err != nil || len(full) != 0 {
+		t.Errorf("Expected empty schedule after full repayment, but %d (%v)", len(full), err)
+	}
+
+	if _, err := RecalculateCreditSchedule(loan, pending, outstanding.Add(NewMoney(1)), RepayShortenTerm); err == nil {
+		t.Errorf("Expected error for repayment above debt")
+	}
+}
+
+func TestAnnuityTerm(t *testing.T) {
+	// Перебором, как считалось раньше
+	bruteTerm := func(principal Money, rate *big.Rat, payment Money, maxMonths int) int {
+		for n := 1; n < maxMonths; n++ {
+			if annuityPayment(principal, rate, n).Cmp(payment) <= 0 {
+				return n
+			}
+		}
+		return maxMonths
+	}
+
+	for _, rateBp := range []int{0, 1, 1200, 2500} {
+		rate := big.NewRat(int64(rateBp), 120000)
+		for _, months := range []int{1, 2, 7, 12, 36} {
+			payment := annuityPayment(NewMoney(10000000), rate, months)
+			for _, rest := range []int64{1, 99, 123456, 5000000, 9999999, 10000000} {
+				want := bruteTerm(NewMoney(rest), rate, payment, 36)
+				if got := annuityTerm(NewMoney(rest), rate, payment, 36); got != want {
+					t.Errorf("rate %d, payment %s, rest %d: expected %d months, but %d", rateBp, payment, rest, want, got)
+				}
+			}
+		}
+	}
+
+	// Ипотека на 30 лет: срок минимальный и считается без перебора
+	rate := big.NewRat(1200, 120000)
+	payment := annuityPayment(NewMoney(500000000), rate, 360)
+	n := annuityTerm(NewMoney(300000000), rate, payment, 360)
+	if annuityPayment(NewMoney(300000000), rate, n).Cmp(payment) > 0 || annuityPayment(NewMoney(300000000), rate, n-1).Cmp(payment) <= 0 {
+		t.Errorf("Expected minimal term, but %d", n)
+	}
+
+	if n := annuityTerm(NewMoney(10000000), rate, NewMoney(100000), 360); n != 360 {
+		t.Errorf("Expected max term when payment does not cover interest, but %d", n)
+	}
+}
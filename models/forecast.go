@@ -0,0 +1,270 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// За сколько дней назад искать повторяющиеся операции
+	ForecastHistoryDays = 180
+	// Сколько раз операция должна повториться, чтобы считаться регулярной
+	minRecurringOccurrences = 3
+)
+
+const (
+	ForecastRecurring     = "recurring"
+	ForecastCreditPayment = "credit_payment"
+)
+
+// RecurringFlow - регулярная операция по счёту: зарплата, подписка, аренда.
+// Amount - изменение баланса со знаком, Monthly - повтор в то же число месяца,
+// иначе каждые IntervalDays дней.
+type RecurringFlow struct {
+	Direction    string
+	Type         string
+	Description  string
+	Amount       Money
+	IntervalDays int
+	Monthly      bool
+	Occurrences  int
+	LastDate     time.Time
+	NextDate     time.Time
+}
+
+// ForecastDay - прогноз по счёту на конец дня Date.
+type ForecastDay struct {
+	Date    time.Time
+	Inflow  Money
+	Outflow Money
+	Balance Money
+}
+
+type AccountForecast struct {
+	AccountId     int
+	AccountNumber string
+	StartBalance  Money
+	Recurring     []RecurringFlow
+	Days          []ForecastDay
+	// Первый день, когда баланс по прогнозу уходит в минус
+	NegativeOn *time.Time
+}
+
+// DetectRecurring ищет в истории счёта повторяющиеся операции: операции
+// группируются по направлению, типу, контрагенту и категории, внутри группы -
+// по сумме с допуском 10%. Кластер считается регулярным, если в нём не меньше
+// трёх операций, интервалы между ними похожи на неделю, две недели или месяц
+// и последняя операция была не раньше двух интервалов назад. Платежи по
+// кредитам не учитываются - они берутся из графика.
+func DetectRecurring(history []AccountTransaction, at time.Time) []RecurringFlow {
+	groups := map[string][]AccountTransaction{}
+	var keys []string
+	for _, trs := range history {
+		switch trs.Type {
+		case "credit_disbursement", "credit_payment", "credit_prepayment":
+			continue
+		}
+
+		key := trs.Direction + "|" + trs.Type + "|" + trs.CounterpartyAccount + "|" + trs.Category
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], trs)
+	}
+	sort.Strings(keys)
+
+	today := dateOnly(at)
+
+	var result []RecurringFlow
+	for _, key := range keys {
+		for _, cluster := range clusterByAmount(groups[key]) {
+			if flow, ok := recurringFlow(cluster, today); ok {
+				result = append(result, flow)
+			}
+		}
+	}
+
+	return result
+}
+
+// BuildForecast строит прогноз баланса счёта по дням на days дней после start.
+// Просроченные и сегодняшние платежи по кредиту попадают в первый день прогноза.
+func BuildForecast(acc Account, start time.Time, days int, recurring []RecurringFlow, payments []DueCreditPayment) AccountForecast {
+	forecast := AccountForecast{
+		AccountId:     acc.Id,
+		AccountNumber: acc.AccountNumber,
+		StartBalance:  acc.Balance,
+		Recurring:     recurring,
+	}
+
+	today := dateOnly(start)
+	first := today.AddDate(0, 0, 1)
+	last := today.AddDate(0, 0, days)
+
+	deltas := map[time.Time][]Money{}
+	for _, flow := range recurring {
+		for k := 1; !flow.occurrence(k).After(last); k++ {
+			date := flow.occurrence(k)
+			if date.Before(today) {
+				continue
+			}
+			// Ожидавшаяся сегодня операция ещё не прошла - переносим на завтра
+			if date.Before(first) {
+				date = first
+			}
+			deltas[date] = append(deltas[date], flow.Amount)
+		}
+	}
+
+	for _, p := range payments {
+		date := dateOnly(p.DueDate)
+		if date.Before(first) {
+			date = first
+		}
+		deltas[date] = append(deltas[date], p.Total().Neg())
+	}
+
+	balance := acc.Balance
+	for date := first; !date.After(last); date = date.AddDate(0, 0, 1) {
+		day := ForecastDay{
+			Date:    date,
+			Inflow:  Money{Currency: balance.Currency},
+			Outflow: Money{Currency: balance.Currency},
+		}
+
+		for _, delta := range deltas[date] {
+			if delta.IsNegative() {
+				day.Outflow = day.Outflow.Sub(delta)
+			} else {
+				day.Inflow = day.Inflow.Add(delta)
+			}
+			balance = balance.Add(delta)
+		}
+		day.Balance = balance
+
+		if forecast.NegativeOn == nil && balance.IsNegative() {
+			negativeOn := date
+			forecast.NegativeOn = &negativeOn
+		}
+
+		forecast.Days = append(forecast.Days, day)
+	}
+
+	return forecast
+}
+
+// clusterByAmount делит операции на группы с близкими суммами: сумма
+// отличается от минимальной в группе не больше чем на 10%.
+func clusterByAmount(history []AccountTransaction) [][]AccountTransaction {
+	sorted := append([]AccountTransaction(nil), history...)
+	sort.Slice(sorted, func(i, j int) bool { return absAmount(sorted[i]) < absAmount(sorted[j]) })
+
+	var clusters [][]AccountTransaction
+	for _, trs := range sorted {
+		n := len(clusters)
+		if n == 0 || absAmount(trs)*10 > absAmount(clusters[n-1][0])*11 {
+			clusters = append(clusters, nil)
+			n++
+		}
+		clusters[n-1] = append(clusters[n-1], trs)
+	}
+
+	return clusters
+}
+
+func recurringFlow(cluster []AccountTransaction, today time.Time) (RecurringFlow, bool) {
+	if len(cluster) < minRecurringOccurrences {
+		return RecurringFlow{}, false
+	}
+
+	sort.Slice(cluster, func(i, j int) bool { return cluster[i].Time.Before(cluster[j].Time) })
+
+	intervals := make([]int, 0, len(cluster)-1)
+	for i := 1; i < len(cluster); i++ {
+		intervals = append(intervals, daysBetween(dateOnly(cluster[i-1].Time), dateOnly(cluster[i].Time)))
+	}
+
+	interval := medianInt(intervals)
+	monthly := false
+	switch {
+	case interval >= 6 && interval <= 8:
+		interval = 7
+	case interval >= 13 && interval <= 16:
+		interval = 14
+	case interval >= 27 && interval <= 33:
+		interval, monthly = 30, true
+	default:
+		return RecurringFlow{}, false
+	}
+
+	// Интервалы должны быть стабильными, а не совпасть в среднем
+	tolerance := max(2, interval/5)
+	for _, i := range intervals {
+		if i < interval-tolerance || i > interval+tolerance {
+			return RecurringFlow{}, false
+		}
+	}
+
+	amounts := make([]int64, 0, len(cluster))
+	for _, trs := range cluster {
+		amounts = append(amounts, trs.Delta().Amount)
+	}
+	sort.Slice(amounts, func(i, j int) bool { return amounts[i] < amounts[j] })
+
+	latest := cluster[len(cluster)-1]
+	flow := RecurringFlow{
+		Direction:    latest.Direction,
+		Type:         latest.Type,
+		Description:  latest.CounterpartyAccount,
+		Amount:       Money{Amount: amounts[len(amounts)/2], Currency: latest.Amount.Currency},
+		IntervalDays: interval,
+		Monthly:      monthly,
+		Occurrences:  len(cluster),
+		LastDate:     dateOnly(latest.Time),
+	}
+	if flow.Description == "" {
+		flow.Description = latest.Category
+	}
+
+	// Операция давно не повторялась - вероятно, её больше нет
+	if daysBetween(flow.LastDate, today) > 2*interval {
+		return RecurringFlow{}, false
+	}
+
+	for k := 1; flow.NextDate.Before(today); k++ {
+		flow.NextDate = flow.occurrence(k)
+	}
+
+	return flow, true
+}
+
+// occurrence - дата k-го повтора после LastDate. Месяцы отсчитываются от
+// LastDate, чтобы 31-е число не сползало после коротких месяцев.
+func (f RecurringFlow) occurrence(k int) time.Time {
+	if f.Monthly {
+		return AddMonths(f.LastDate, k)
+	}
+	return f.LastDate.AddDate(0, 0, k*f.IntervalDays)
+}
+
+func absAmount(trs AccountTransaction) int64 {
+	amount := trs.Delta().Amount
+	if amount < 0 {
+		return -amount
+	}
+	return amount
+}
+
+func medianInt(values []int) int {
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	return sorted[len(sorted)/2]
+}
+
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func daysBetween(from time.Time, to time.Time) int {
+	return int(to.Sub(from).Hours() / 24)
+}
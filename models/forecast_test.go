@@ -0,0 +1,73 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetectRecurring(t *testing.T) {
+	at := time.Date(2025, 4, 20, 12, 0, 0, 0, time.UTC)
+
+	var history []AccountTransaction
+	// Зарплата 5-го числа с небольшим разбросом суммы
+	for i, amount := range []int64{10000000, 10050000, 9980000, 10000000} {
+		history = append(history, AccountTransaction{
+			Type: "transfer", Direction: "in", CounterpartyAccount: "40817810000000000001",
+			Amount: NewMoney(amount), Fee: NewMoney(0), Time: time.Date(2025, time.Month(i+1), 5, 10, 0, 0, 0, time.UTC),
+		})
+	}
+	// Еженедельная подписка
+	for i := 0; i < 5; i++ {
+		history = append(history, AccountTransaction{
+			Type: "card_payment", Direction: "out", Category: CategoryEntertainment,
+			Amount: NewMoney(39900), Fee: NewMoney(0), Time: time.Date(2025, 3, 20+7*i, 9, 0, 0, 0, time.UTC),
+		})
+	}
+	// Разовые покупки в той же категории с другой суммой
+	history = append(history,
+		AccountTransaction{Type: "card_payment", Direction: "out", Category: CategoryEntertainment, Amount: NewMoney(250000), Fee: NewMoney(0), Time: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		AccountTransaction{Type: "card_payment", Direction: "out", Category: CategoryEntertainment, Amount: NewMoney(260000), Fee: NewMoney(0), Time: time.Date(2025, 4, 2, 0, 0, 0, 0, time.UTC)},
+	)
+
+	flows := DetectRecurring(history, at)
+	if len(flows) != 2 {
+		t.Fatalf("Expected salary and subscription, but %+v", flows)
+	}
+
+	salary, subscription := flows[0], flows[1]
+
+	if !salary.Monthly || salary.Amount.String() != "100000.00" || !salary.NextDate.Equal(time.Date(2025, 5, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Wrong salary flow: %+v", salary)
+	}
+
+	if subscription.IntervalDays != 7 || subscription.Amount.String() != "-399.00" || !subscription.NextDate.Equal(time.Date(2025, 4, 24, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Wrong subscription flow: %+v", subscription)
+	}
+}
+
+func TestBuildForecast(t *testing.T) {
+	start := time.Date(2025, 4, 20, 12, 0, 0, 0, time.UTC)
+	acc := Account{Id: 1, AccountNumber: "1", Balance: NewMoney(1000000)}
+
+	recurring := []RecurringFlow{{
+		Amount: NewMoney(-300000), IntervalDays: 7,
+		LastDate: time.Date(2025, 4, 17, 0, 0, 0, 0, time.UTC), NextDate: time.Date(2025, 4, 24, 0, 0, 0, 0, time.UTC),
+	}}
+	payments := []DueCreditPayment{{CreditPayment: CreditPayment{
+		DueDate: time.Date(2025, 4, 25, 0, 0, 0, 0, time.UTC), Payment: NewMoney(500000),
+	}}}
+
+	forecast := BuildForecast(acc, start, 30, recurring, payments)
+	if len(forecast.Days) != 30 || !forecast.Days[0].Date.Equal(time.Date(2025, 4, 21, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected 30 days from tomorrow, but %d", len(forecast.Days))
+	}
+
+	// 10000 - 3000 (24.04) - 5000 (25.04) - 3000 (01.05) < 0
+	if forecast.NegativeOn == nil || !forecast.NegativeOn.Equal(time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected negative balance on 2025-05-01, but %v", forecast.NegativeOn)
+	}
+
+	if forecast.Days[4].Outflow.String() != "5000.00" || forecast.Days[4].Balance.String() != "2000.00" {
+		t.Errorf("Wrong forecast for 2025-04-25: %+v", forecast.Days[4])
+	}
+}
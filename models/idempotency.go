@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+const (
+	// Запрос дольше IdempotencyLease в processing считается оборванным (процесс
+	// упал, не сохранив ответ), и ключ можно занять повтором того же запроса
+	IdempotencyLease = 5 * time.Minute
+	// Ключи старше IdempotencyKeyTtl удаляются, повтор с ними выполнится заново
+	IdempotencyKeyTtl = 24 * time.Hour
+)
+
+type IdempotencyKey struct {
+	Id           int
+	UserId       int
+	Key          string
+	RequestHash  string
+	Status       string
+	ResponseCode int
+	ResponseBody []byte
+	ContentType  string
+	CreatedAt    time.Time
+}
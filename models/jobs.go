@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+	JobRunning = "running"
+	JobSuccess = "success"
+	JobFailed  = "failed"
+)
+
+// JobRun - запись о запуске фоновой задачи планировщика.
+type JobRun struct {
+	Id         int
+	Job        string
+	Status     string
+	Processed  int
+	Error      string
+	StartedAt  time.Time
+	FinishedAt *time.Time
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+const (
+	JwtAlgRS256 = "RS256"
+	JwtAlgEdDSA = "EdDSA"
+)
+
+// JwtKey - ключ подписи access-токенов. PrivateKey - PKCS#8 PEM, зашифрованный
+// PGP: в открытом виде закрытый ключ есть только в памяти TokenService. Ключ
+// без RetiredAt - последний созданный, он подписывает новые токены начиная с
+// ActivatesAt, а до того - прежний ключ, у которого RetiredAt = ActivatesAt
+// нового. Выведенным из оборота ключом только проверяются токены, выданные до ротации.
+type JwtKey struct {
+	Kid         string
+	Alg         string
+	PrivateKey  []byte
+	CreatedAt   time.Time
+	ActivatesAt time.Time
+	RetiredAt   *time.Time
+}
+
+// Jwk - открытый ключ в формате JWK (RFC 7517). Для RSA заполняются N и E,
+// для Ed25519 - Crv и X.
+type Jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type Jwks struct {
+	Keys []Jwk `json:"keys"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const DefaultCreditProduct = "consumer"
+
+// KeyRate - ключевая ставка ЦБ РФ, действующая с даты Date, в сотых долях процента.
+type KeyRate struct {
+	Date      time.Time
+	RateBp    int
+	FetchedAt time.Time
+}
+
+// ParseCreditMargins разбирает надбавки к ключевой ставке по кредитным
+// продуктам из строки вида "consumer:5.00,mortgage:2.00".
+func ParseCreditMargins(s string) (map[string]int, error) {
+	margins := make(map[string]int)
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		product, rate, ok := strings.Cut(item, ":")
+		product = strings.TrimSpace(product)
+		if !ok || product == "" {
+			return nil, fmt.Errorf("invalid credit margin: %q", item)
+		}
+
+		marginBp, err := ParseRate(strings.TrimSpace(rate))
+		if err != nil {
+			return nil, err
+		}
+
+		margins[product] = marginBp
+	}
+
+	if len(margins) == 0 {
+		return nil, fmt.Errorf("no credit products configured")
+	}
+
+	return margins, nil
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Системные счета главной книги банка
+const (
+	LedgerCashClearing    = "cash_clearing"
+	LedgerFeeIncome       = "fee_income"
+	LedgerOpeningBalance  = "opening_balance"
+	LedgerCardSettlement  = "card_settlement"
+	LedgerLoansReceivable = "loans_receivable"
+	LedgerInterestIncome  = "interest_income"
+)
+
+const (
+	Debit  = "debit"
+	Credit = "credit"
+)
+
+// Posting - одна сторона проводки. Если AccountId не ноль, то проводка идёт
+// по счёту клиента, иначе по системному счёту LedgerCode.
+type Posting struct {
+	Id         int
+	EntryId    int
+	AccountId  int
+	LedgerCode string
+	Direction  string
+	Amount     Money
+}
+
+type JournalEntry struct {
+	Id            int
+	TransactionId int
+	Description   string
+	CreatedAt     time.Time
+	Postings      []Posting
+}
+
+func DebitAccount(accountId int, amount Money) Posting {
+	return Posting{AccountId: accountId, Direction: Debit, Amount: amount}
+}
+
+func CreditAccount(accountId int, amount Money) Posting {
+	return Posting{AccountId: accountId, Direction: Credit, Amount: amount}
+}
+
+func DebitLedger(code string, amount Money) Posting {
+	return Posting{LedgerCode: code, Direction: Debit, Amount: amount}
+}
+
+func CreditLedger(code string, amount Money) Posting {
+	return Posting{LedgerCode: code, Direction: Credit, Amount: amount}
+}
+
+func NewJournalEntry(description string, postings ...Posting) JournalEntry {
+	entry := JournalEntry{Description: description}
+	// Нулевые проводки (например, комиссия 0) не пишем
+	for _, p := range postings {
+		if !p.Amount.IsZero() {
+			entry.Postings = append(entry.Postings, p)
+		}
+	}
+	return entry
+}
+
+// Validate проверяет, что сумма дебета равна сумме кредита.
+func (e JournalEntry) Validate() error {
+	if len(e.Postings) < 2 {
+		return fmt.Errorf("journal entry needs at least 2 postings")
+	}
+
+	var debit, credit Money
+	for _, p := range e.Postings {
+		if !p.Amount.IsPositive() {
+			return fmt.Errorf("posting amount must be positive: %s", p.Amount)
+		}
+		if p.AccountId == 0 && p.LedgerCode == "" {
+			return fmt.Errorf("posting without ledger account")
+		}
+
+		switch p.Direction {
+		case Debit:
+			debit = debit.Add(p.Amount)
+		case Credit:
+			credit = credit.Add(p.Amount)
+		default:
+			return fmt.Errorf("wrong posting direction: %s", p.Direction)
+		}
+	}
+
+	if debit.Cmp(credit) != 0 {
+		return fmt.Errorf("journal entry is not balanced: debit %s, credit %s", debit, credit)
+	}
+
+	return nil
+}
+
+// AccountDeltas возвращает изменения балансов клиентских счетов. Счета клиентов
+// для банка - пассив, поэтому кредит увеличивает баланс, а дебет уменьшает.
+func (e JournalEntry) AccountDeltas() map[int]Money {
+	deltas := make(map[int]Money)
+	for _, p := range e.Postings {
+		if p.AccountId == 0 {
+			continue
+		}
+		if p.Direction == Credit {
+			deltas[p.AccountId] = deltas[p.AccountId].Add(p.Amount)
+		} else {
+			deltas[p.AccountId] = deltas[p.AccountId].Sub(p.Amount)
+		}
+	}
+	return deltas
+}
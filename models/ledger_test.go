@@ -0,0 +1,47 @@
+package models
+
+import "testing"
+
+func TestJournalEntryValidate(t *testing.T) {
+	fee := NewMoney(150)
+	amount := NewMoney(10000)
+
+	transfer := NewJournalEntry("transfer",
+		DebitAccount(1, amount.Add(fee)),
+		CreditAccount(2, amount),
+		CreditLedger(LedgerFeeIncome, fee),
+	)
+	if err := transfer.Validate(); err != nil {
+		t.Errorf("Expected balanced transfer, but %v", err)
+	}
+
+	deltas := transfer.AccountDeltas()
+	if deltas[1].Amount != -10150 || deltas[2].Amount != 10000 || len(deltas) != 2 {
+		t.Errorf("Wrong account deltas: %v", deltas)
+	}
+
+	unbalanced := NewJournalEntry("broken",
+		DebitLedger(LedgerCashClearing, amount),
+		CreditAccount(1, amount.Sub(fee)),
+	)
+	if err := unbalanced.Validate(); err == nil {
+		t.Errorf("Expected unbalanced entry to fail")
+	}
+
+	zeroFee := NewJournalEntry("deposit",
+		DebitLedger(LedgerCashClearing, amount),
+		CreditAccount(1, amount),
+		CreditLedger(LedgerFeeIncome, NewMoney(0)),
+	)
+	if len(zeroFee.Postings) != 2 {
+		t.Errorf("Expected zero posting to be dropped, but %d postings", len(zeroFee.Postings))
+	}
+
+	negative := JournalEntry{Postings: []Posting{
+		DebitAccount(1, NewMoney(-5)),
+		CreditAccount(2, NewMoney(-5)),
+	}}
+	if err := negative.Validate(); err == nil {
+		t.Errorf("Expected negative postings to fail")
+	}
+}
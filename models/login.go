@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Результаты попытки входа для журнала login_attempts
+const (
+	LoginSuccess       = "success"
+	LoginMfaRequired   = "mfa_required"
+	LoginMfaFailed     = "mfa_failed"
+	LoginWrongPassword = "wrong_password"
+	LoginUnknownUser   = "unknown_user"
+	LoginBlocked       = "blocked"
+)
+
+// Счётчики неудачных входов ведутся по имени пользователя и по IP
+const (
+	LoginScopeUser = "user"
+	LoginScopeIp   = "ip"
+)
+
+// Счётчики неверных кодов подтверждения переводов и реквизитов карт в той же
+// таблице. ThrottleScopeCard - неудачи по самой карте, ключ - id карты
+const (
+	ThrottleScopeTransferUser = "transfer_user"
+	ThrottleScopeTransferIp   = "transfer_ip"
+	ThrottleScopeCard         = "card"
+	ThrottleScopeCardUser     = "card_user"
+	ThrottleScopeCardIp       = "card_ip"
+)
+
+type LoginAttempt struct {
+	Id        int64
+	Username  string
+	UserId    *int
+	Ip        string
+	UserAgent string
+	Result    string
+	CreatedAt time.Time
+}
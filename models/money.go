@@ -0,0 +1,199 @@
+package models
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Все счета сейчас открываются в рублях (код валюты 810 в номере счёта)
+const DefaultCurrency = "RUB"
+
+const minorUnits = 100
+
+var ErrMoneyPrecision = errors.New("money precision is limited to 2 fractional digits")
+
+// Money - денежная сумма с фиксированной точкой: Amount хранится в копейках.
+// Операции над суммами в разных валютах не поддерживаются, проверка валюты
+// остаётся на вызывающей стороне.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func NewMoney(minor int64) Money {
+	return Money{Amount: minor, Currency: DefaultCurrency}
+}
+
+// ParseMoney разбирает десятичную строку вида "-123.45". Дробная часть
+// длиннее двух знаков допускается только если лишние знаки нулевые.
+func ParseMoney(s string) (Money, error) {
+	str := strings.TrimSpace(s)
+	if str == "" {
+		return Money{}, fmt.Errorf("empty money value")
+	}
+
+	negative := false
+	switch str[0] {
+	case '-':
+		negative = true
+		str = str[1:]
+	case '+':
+		str = str[1:]
+	}
+
+	intPart, fracPart, hasDot := strings.Cut(str, ".")
+	if intPart == "" || (hasDot && fracPart == "") {
+		return Money{}, fmt.Errorf("invalid money value: %q", s)
+	}
+
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return Money{}, fmt.Errorf("invalid money value: %q", s)
+	}
+
+	if len(fracPart) > 2 {
+		if strings.Trim(fracPart[2:], "0") != "" {
+			return Money{}, fmt.Errorf("%w: %q", ErrMoneyPrecision, s)
+		}
+		fracPart = fracPart[:2]
+	}
+
+	for len(fracPart) < 2 {
+		fracPart += "0"
+	}
+
+	minor, err := strconv.ParseInt(intPart+fracPart, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid money value %q: %w", s, err)
+	}
+
+	if negative {
+		minor = -minor
+	}
+
+	return NewMoney(minor), nil
+}
+
+func (m Money) String() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/minorUnits, amount%minorUnits)
+}
+
+func (m Money) Add(o Money) Money {
+	return Money{Amount: m.Amount + o.Amount, Currency: m.currency(o)}
+}
+
+func (m Money) Sub(o Money) Money {
+	return Money{Amount: m.Amount - o.Amount, Currency: m.currency(o)}
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+func (m Money) Cmp(o Money) int {
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	}
+	return 0
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON принимает как число (100.50), так и строку ("100.50").
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil
+	}
+
+	str := string(data)
+	if len(data) > 1 && data[0] == '"' {
+		unquoted, err := strconv.Unquote(str)
+		if err != nil {
+			return fmt.Errorf("invalid money value: %s", str)
+		}
+		str = unquoted
+	}
+
+	parsed, err := ParseMoney(str)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
+
+// Scan читает значения DECIMAL, которые lib/pq отдаёт в виде текста.
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = NewMoney(0)
+		return nil
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	case int64:
+		*m = NewMoney(v * minorUnits)
+		return nil
+	case float64:
+		return m.scanString(strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	return fmt.Errorf("can't scan %T into Money", src)
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+func (m *Money) scanString(s string) error {
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) currency(o Money) string {
+	if m.Currency != "" {
+		return m.Currency
+	}
+	return o.Currency
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := []struct {
+		in    string
+		minor int64
+	}{
+		{"0", 0},
+		{"100", 10000},
+		{"100.5", 10050},
+		{"100.05", 10005},
+		{"-0.01", -1},
+		{"+12.30", 1230},
+		{"1.500", 150},
+	}
+
+	for _, c := range cases {
+		m, err := ParseMoney(c.in)
+		if err != nil {
+			t.Errorf("Expected %s to be parsed, but error: %v", c.in, err)
+			continue
+		}
+		if m.Amount != c.minor {
+			t.Errorf("Expected %s == %d minor units, but %d", c.in, c.minor, m.Amount)
+		}
+		if m.Currency != DefaultCurrency {
+			t.Errorf("Expected currency %s, but %s", DefaultCurrency, m.Currency)
+		}
+	}
+
+	for _, in := range []string{"", "abc", "1.", ".5", "1e2", "1,5", "--1", "99999999999999999999"} {
+		if _, err := ParseMoney(in); err == nil {
+			t.Errorf("Expected error for %q", in)
+		}
+	}
+
+	if _, err := ParseMoney("0.001"); !errors.Is(err, ErrMoneyPrecision) {
+		t.Errorf("Expected precision error for 0.001, but %v", err)
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	cases := map[int64]string{
+		0:      "0.00",
+		5:      "0.05",
+		10050:  "100.50",
+		-1:     "-0.01",
+		-12345: "-123.45",
+	}
+
+	for minor, str := range cases {
+		if NewMoney(minor).String() != str {
+			t.Errorf("Expected %d minor units == %s, but %s", minor, str, NewMoney(minor).String())
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	// 0.1 + 0.2 во float64 даёт 0.30000000000000004
+	sum := NewMoney(10).Add(NewMoney(20))
+	if sum.String() != "0.30" {
+		t.Errorf("Expected 0.10 + 0.20 == 0.30, but %s", sum)
+	}
+
+	total := NewMoney(0)
+	for i := 0; i < 1000; i++ {
+		total = total.Add(NewMoney(1))
+	}
+	if total.Amount != 1000 {
+		t.Errorf("Expected 1000 kopecks, but %d", total.Amount)
+	}
+
+	diff := NewMoney(100).Sub(NewMoney(150))
+	if !diff.IsNegative() || diff.Neg().Amount != 50 {
+		t.Errorf("Expected -0.50, but %s", diff)
+	}
+
+	if NewMoney(1).Cmp(NewMoney(2)) != -1 || NewMoney(2).Cmp(NewMoney(1)) != 1 || NewMoney(2).Cmp(NewMoney(2)) != 0 {
+		t.Errorf("Money compare is broken")
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var req struct {
+		Amount Money `json:"amount"`
+	}
+
+	if err := json.Unmarshal([]byte(`{"amount": 100.25}`), &req); err != nil || req.Amount.Amount != 10025 {
+		t.Errorf("Expected number 100.25 to be decoded, but %v (%d)", err, req.Amount.Amount)
+	}
+
+	if err := json.Unmarshal([]byte(`{"amount": "7.10"}`), &req); err != nil || req.Amount.Amount != 710 {
+		t.Errorf("Expected string 7.10 to be decoded, but %v (%d)", err, req.Amount.Amount)
+	}
+
+	if err := json.Unmarshal([]byte(`{"amount": 0.005}`), &req); !errors.Is(err, ErrMoneyPrecision) {
+		t.Errorf("Expected sub-kopeck amount to be rejected, but %v", err)
+	}
+
+	data, err := json.Marshal(map[string]Money{"balance": NewMoney(123456)})
+	if err != nil || string(data) != `{"balance":1234.56}` {
+		t.Errorf("Expected {\"balance\":1234.56}, but %s (%v)", data, err)
+	}
+}
+
+func TestMoneySql(t *testing.T) {
+	var m Money
+
+	if err := m.Scan([]byte("15.70")); err != nil || m.Amount != 1570 {
+		t.Errorf("Expected DECIMAL 15.70 to be scanned, but %v (%d)", err, m.Amount)
+	}
+
+	if err := m.Scan(nil); err != nil || m.Amount != 0 {
+		t.Errorf("Expected NULL to be scanned as zero, but %v (%d)", err, m.Amount)
+	}
+
+	if err := m.Scan(int64(3)); err != nil || m.Amount != 300 {
+		t.Errorf("Expected int 3 to be scanned as 3.00, but %v (%d)", err, m.Amount)
+	}
+
+	if err := m.Scan(true); err == nil {
+		t.Errorf("Expected error for bool scan")
+	}
+
+	value, err := NewMoney(-705).Value()
+	if err != nil || value != "-7.05" {
+		t.Errorf("Expected value -7.05, but %v (%v)", value, err)
+	}
+}
@@ -0,0 +1,31 @@
+package models
+
+// События, о которых клиент получает письмо
+const (
+	NotifyRegistration     = "registration"
+	NotifyNewLoginIp       = "new_login_ip"
+	NotifyDeposit          = "deposit"
+	NotifyWithdrawal       = "withdrawal"
+	NotifyTransferOut      = "transfer_out"
+	NotifyTransferIn       = "transfer_in"
+	NotifyCardIssued       = "card_issued"
+	NotifyCreditPaymentDue = "credit_payment_due"
+	NotifyTransferCode     = "transfer_code"
+	NotifyAccountLocked    = "account_locked"
+)
+
+// Notification - письмо клиенту. Data - параметры шаблона события,
+// все значения уже отформатированы для показа.
+type Notification struct {
+	Event    string
+	Username string
+	Data     map[string]string
+}
+
+// CreditReminder - платёж по кредиту, о котором клиенту ещё не напоминали.
+type CreditReminder struct {
+	DueCreditPayment
+	AccountNumber string
+	Username      string
+	Email         string
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxDone    = "done"
+	OutboxDead    = "dead"
+)
+
+// Типы исходящих событий
+const (
+	EventTransactionCreated   = "transaction.created"
+	EventCardIssued           = "card.issued"
+	EventAccountStatusChanged = "account.status_changed"
+)
+
+// OutboxEvent - событие из таблицы outbox. Delivered - получатели, которые
+// уже приняли событие на прошлых попытках.
+type OutboxEvent struct {
+	Id            int64
+	Event         string
+	Payload       json.RawMessage
+	Status        string
+	Attempts      int
+	Delivered     []string
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+}
+
+// TransactionEvent - данные события transaction.created. Для переводов
+// заполнены поля счёта получателя, Balance - остаток счёта списания.
+type TransactionEvent struct {
+	TransactionId     int       `json:"transaction_id"`
+	Type              string    `json:"type"`
+	AccountId         int       `json:"account_id"`
+	AccountNumber     string    `json:"account_number"`
+	DestAccountId     int       `json:"dest_account_id,omitempty"`
+	DestAccountNumber string    `json:"dest_account_number,omitempty"`
+	Amount            Money     `json:"amount"`
+	Fee               Money     `json:"fee"`
+	Balance           Money     `json:"balance"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// IncomingTransferEvent - данные transaction.created для webhook владельца
+// счёта получателя. Остаток, комиссия и внутренние id отправителя в него не
+// попадают.
+type IncomingTransferEvent struct {
+	Type              string    `json:"type"`
+	AccountNumber     string    `json:"account_number"`
+	DestAccountNumber string    `json:"dest_account_number"`
+	Amount            Money     `json:"amount"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+func (e TransactionEvent) Incoming() IncomingTransferEvent {
+	return IncomingTransferEvent{
+		Type:              e.Type,
+		AccountNumber:     e.AccountNumber,
+		DestAccountNumber: e.DestAccountNumber,
+		Amount:            e.Amount,
+		CreatedAt:         e.CreatedAt,
+	}
+}
+
+// CardIssuedEvent - данные события card.issued. Реквизиты карты в событие
+// не попадают.
+type CardIssuedEvent struct {
+	CardId        int       `json:"card_id"`
+	AccountId     int       `json:"account_id"`
+	AccountNumber string    `json:"account_number"`
+	ReissuedFrom  int       `json:"reissued_from,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// AccountStatusEvent - данные события account.status_changed.
+type AccountStatusEvent struct {
+	AccountId     int       `json:"account_id"`
+	AccountNumber string    `json:"account_number"`
+	OldStatus     string    `json:"old_status"`
+	Status        string    `json:"status"`
+	ChangedAt     time.Time `json:"changed_at"`
+}
+
+// OutboxBackoff - пауза перед попыткой attempt+1 после attempt неудачных:
+// base, 2*base, 4*base ... но не больше max.
+func OutboxBackoff(attempt int, base time.Duration, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{4, 80 * time.Second},
+		{20, time.Hour},
+	}
+
+	for _, c := range cases {
+		if got := OutboxBackoff(c.attempt, 10*time.Second, time.Hour); got != c.want {
+			t.Errorf("Attempt %d: expected %s, but %s", c.attempt, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Причины, по которым перевод нужно подтвердить кодом
+const (
+	TransferConfirmLargeAmount  = "large_amount"
+	TransferConfirmNewRecipient = "new_recipient"
+)
+
+const (
+	PendingTransferPending   = "pending"
+	PendingTransferConfirmed = "confirmed"
+	PendingTransferCompleted = "completed"
+	PendingTransferFailed    = "failed"
+)
+
+// PendingTransfer - перевод, ожидающий подтверждения одноразовым кодом.
+// Код отправляется клиенту и в БД хранится только его HMAC.
+type PendingTransfer struct {
+	Id                  int64
+	UserId              int
+	SourceAccountId     int
+	SourceAccountNumber string
+	DestAccountId       int
+	DestAccountNumber   string
+	Amount              Money
+	Reason              string
+	CodeHash            []byte
+	Status              string
+	Attempts            int
+	Error               string
+	ExpiresAt           time.Time
+	CreatedAt           time.Time
+	ConfirmedAt         *time.Time
+}
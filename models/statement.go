@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+type StatementLine struct {
+	AccountTransaction
+	Balance Money
+}
+
+// Statement - выписка по счёту за период [From, To)
+type Statement struct {
+	Account        Account
+	From           time.Time
+	To             time.Time
+	GeneratedAt    time.Time
+	OpeningBalance Money
+	ClosingBalance Money
+	TotalIn        Money
+	TotalOut       Money
+	TotalFee       Money
+	Lines          []StatementLine
+}
+
+// Delta - изменение баланса счёта от операции: комиссия всегда платится со счёта.
+func (t AccountTransaction) Delta() Money {
+	if t.Direction == "in" {
+		return t.Amount.Sub(t.Fee)
+	}
+	return t.Amount.Add(t.Fee).Neg()
+}
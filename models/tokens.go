@@ -0,0 +1,35 @@
+package models
+
+import (
+	"crypto/sha256"
+	"time"
+)
+
+const (
+	RefreshTokenActive  = "active"
+	RefreshTokenRotated = "rotated"
+	RefreshTokenRevoked = "revoked"
+)
+
+// RefreshToken - refresh-токен сессии. Сам токен не хранится, только TokenHash.
+// Все токены, полученные обновлением из одного входа, образуют семью FamilyId.
+// AccessJti - jti access-токена, выданного вместе с этим refresh-токеном.
+type RefreshToken struct {
+	Id              int64
+	UserId          int
+	Username        string
+	FamilyId        string
+	TokenHash       []byte
+	Status          string
+	AccessJti       string
+	AccessExpiresAt time.Time
+	ExpiresAt       time.Time
+	CreatedAt       time.Time
+}
+
+// HashToken - SHA-256 токена. У refresh-токена 256 бит случайности, поэтому
+// соль и медленный хеш не нужны.
+func HashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
@@ -6,9 +6,9 @@ type Transaction struct {
 	Id        int
 	AccountId int
 	Type      string
-	Amount    float64
+	Amount    Money
 	Time      time.Time
-	Fee       float64
+	Fee       Money
 }
 
 type TransactionTransfer struct {
@@ -16,3 +16,33 @@ type TransactionTransfer struct {
 	TransId       int
 	DestAccountId int
 }
+
+// AccountTransaction - операция глазами конкретного счёта: входящие переводы
+// видны на счёте получателя с направлением "in".
+type AccountTransaction struct {
+	Id                  int
+	Type                string
+	Direction           string
+	Amount              Money
+	Fee                 Money
+	Time                time.Time
+	CounterpartyAccount string
+	Category            string
+}
+
+// TransactionCursor - позиция для keyset пагинации (time DESC, id DESC)
+type TransactionCursor struct {
+	Time time.Time
+	Id   int
+}
+
+type TransactionFilter struct {
+	From      *time.Time
+	To        *time.Time
+	Type      string
+	Direction string
+	MinAmount *Money
+	MaxAmount *Money
+	After     *TransactionCursor
+	Limit     int
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Totp - настройки TOTP пользователя. Secret зашифрован PGP, LastStep - шаг
+// последнего принятого кода.
+type Totp struct {
+	UserId   int
+	Secret   []byte
+	Enabled  bool
+	LastStep *int64
+}
+
+// TotpEnrollment - данные для приложения-аутентификатора, показываются один раз.
+type TotpEnrollment struct {
+	Secret string
+	Uri    string
+}
+
+// MfaChallenge - вход, ожидающий второй фактор.
+type MfaChallenge struct {
+	Id        int64
+	UserId    int
+	Username  string
+	Email     string
+	Attempts  int
+	ExpiresAt time.Time
+}
@@ -6,4 +6,6 @@ type User struct {
 	Password string
 	Email    string
 	Phone    string
+	// Вход требует код TOTP
+	TotpEnabled bool
 }
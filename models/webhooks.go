@@ -0,0 +1,107 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/netip"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	WebhookDeliveryPending = "pending"
+	WebhookDeliverySuccess = "success"
+	WebhookDeliveryFailed  = "failed"
+)
+
+// WebhookEvents - события, на которые можно подписать webhook.
+var WebhookEvents = []string{EventTransactionCreated, EventCardIssued, EventAccountStatusChanged}
+
+func IsWebhookEvent(event string) bool {
+	return slices.Contains(WebhookEvents, event)
+}
+
+// Сети, которые не входят в IsPrivate/IsLoopback, но тоже не должны быть
+// адресом webhook: "этот" хост, CGNAT и широковещательный адрес.
+var webhookDeniedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("255.255.255.255/32"),
+}
+
+// IsPublicAddr проверяет, что на адрес можно отправлять webhook: запросы на
+// loopback, частные, link-local, multicast и пустые адреса открыли бы
+// пользователю внутреннюю сеть банка.
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range webhookDeniedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Webhook - адрес, на который отправляются события по счетам пользователя.
+// Секрет подписи не хранится: он выводится из HMAC_KEY и SecretNonce.
+type Webhook struct {
+	Id          int
+	UserId      int
+	Url         string
+	Events      []string
+	SecretNonce []byte
+	Active      bool
+	CreatedAt   time.Time
+}
+
+// WebhookDelivery - доставка события outbox на webhook и результат последней попытки.
+// Url и SecretNonce заполняются только для отправки.
+type WebhookDelivery struct {
+	Id            int64
+	WebhookId     int
+	OutboxId      int64
+	Event         string
+	Payload       json.RawMessage
+	Status        string
+	Attempts      int
+	ResponseCode  int
+	ResponseBody  string
+	Error         string
+	CreatedAt     time.Time
+	LastAttemptAt *time.Time
+	Url           string
+	SecretNonce   []byte
+}
+
+// WebhookRecipient - счёт, владельцам webhook которого отправляется событие,
+// и данные события для этой стороны.
+type WebhookRecipient struct {
+	AccountId int
+	Payload   json.RawMessage
+}
+
+// WebhookBody - тело запроса на webhook. Id доставки одинаковый во всех
+// попытках, по нему получатель отбрасывает повторы.
+type WebhookBody struct {
+	Id        int64           `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// WebhookSignature - hex(HMAC-SHA256(secret, "<timestamp>.<body>")). Время
+// входит в подпись, чтобы старый запрос нельзя было отправить повторно с новым временем.
+func WebhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	// printf '%s' '1700000000.{"id":1}' | openssl dgst -sha256 -hmac secret
+	want := "3dd1b9aef568d75f6790a84bd2e5dfa1f44409eef3cbdbd3f10b837376100c11"
+	if got := WebhookSignature("secret", 1700000000, []byte(`{"id":1}`)); got != want {
+		t.Errorf("Expected signature %s, but %s", want, got)
+	}
+
+	if WebhookSignature("secret", 1700000001, []byte(`{"id":1}`)) == want {
+		t.Errorf("Signature must depend on timestamp")
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	cases := map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"224.0.0.1":        false,
+		"ff02::1":          false,
+		"0.0.0.0":          false,
+		"::":               false,
+		"100.64.0.1":       false,
+		"::ffff:127.0.0.1": false,
+	}
+
+	for addr, public := range cases {
+		if got := IsPublicAddr(netip.MustParseAddr(addr)); got != public {
+			t.Errorf("%s: expected %v, but %v", addr, public, got)
+		}
+	}
+}
+
+func TestCanChangeAccountStatus(t *testing.T) {
+	if !CanChangeAccountStatus(AccountActive, AccountBlocked) || !CanChangeAccountStatus(AccountBlocked, AccountActive) {
+		t.Errorf("Expected account to be blocked and unblocked")
+	}
+
+	if CanChangeAccountStatus(AccountClosed, AccountActive) || CanChangeAccountStatus(AccountActive, AccountActive) {
+		t.Errorf("Closed account must not be reopened")
+	}
+}
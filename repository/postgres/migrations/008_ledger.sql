@@ -0,0 +1,102 @@
+CREATE TABLE ledger_accounts (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('asset', 'liability', 'income', 'equity')),
+    account_id INT NULL UNIQUE REFERENCES accounts(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO ledger_accounts (code, kind) VALUES
+    ('cash_clearing', 'asset'),
+    ('fee_income', 'income'),
+    ('opening_balance', 'equity');
+
+INSERT INTO ledger_accounts (code, kind, account_id)
+SELECT 'customer:' || id, 'liability', id FROM accounts;
+
+CREATE TABLE journal_entries (
+    id SERIAL PRIMARY KEY,
+    transaction_id INT NULL REFERENCES transactions(id),
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE postings (
+    id SERIAL PRIMARY KEY,
+    entry_id INT NOT NULL REFERENCES journal_entries(id),
+    ledger_account_id INT NOT NULL REFERENCES ledger_accounts(id),
+    direction VARCHAR(6) NOT NULL CHECK (direction IN ('debit', 'credit')),
+    amount DECIMAL(15,2) NOT NULL CHECK (amount > 0)
+);
+
+CREATE INDEX postings_entry_idx ON postings(entry_id);
+CREATE INDEX postings_ledger_account_idx ON postings(ledger_account_id);
+CREATE INDEX journal_entries_transaction_idx ON journal_entries(transaction_id);
+
+-- Проверка баланса проводки на момент COMMIT: сумма дебета = сумме кредита
+CREATE FUNCTION check_journal_entry_balanced() RETURNS trigger AS $$
+DECLARE
+    diff DECIMAL(15,2);
+BEGIN
+    SELECT COALESCE(SUM(CASE WHEN direction = 'debit' THEN amount ELSE -amount END), 0)
+    INTO diff
+    FROM postings
+    WHERE entry_id = NEW.entry_id;
+
+    IF diff <> 0 THEN
+        RAISE EXCEPTION 'journal entry % is not balanced (diff %)', NEW.entry_id, diff;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER postings_balanced
+AFTER INSERT OR UPDATE ON postings
+DEFERRABLE INITIALLY DEFERRED
+FOR EACH ROW EXECUTE FUNCTION check_journal_entry_balanced();
+
+-- Входящие остатки по уже существующим счетам
+INSERT INTO journal_entries (description) VALUES ('opening balances');
+
+INSERT INTO postings (entry_id, ledger_account_id, direction, amount)
+SELECT currval('journal_entries_id_seq'), la.id, 'credit', a.balance
+FROM accounts a
+JOIN ledger_accounts la ON la.account_id = a.id
+WHERE a.balance > 0;
+
+INSERT INTO postings (entry_id, ledger_account_id, direction, amount)
+SELECT currval('journal_entries_id_seq'),
+       (SELECT id FROM ledger_accounts WHERE code = 'opening_balance'),
+       'debit',
+       SUM(balance)
+FROM accounts
+HAVING SUM(balance) > 0;
+
+-- Остатки по главной книге в "естественном" знаке счёта
+CREATE VIEW ledger_balances AS
+SELECT
+    la.id AS ledger_account_id,
+    la.code,
+    la.kind,
+    la.account_id,
+    COALESCE(SUM(CASE WHEN p.direction = 'debit' THEN p.amount ELSE 0 END), 0) AS debit_total,
+    COALESCE(SUM(CASE WHEN p.direction = 'credit' THEN p.amount ELSE 0 END), 0) AS credit_total,
+    CASE WHEN la.kind = 'asset'
+        THEN COALESCE(SUM(CASE WHEN p.direction = 'debit' THEN p.amount ELSE -p.amount END), 0)
+        ELSE COALESCE(SUM(CASE WHEN p.direction = 'credit' THEN p.amount ELSE -p.amount END), 0)
+    END AS balance
+FROM ledger_accounts la
+LEFT JOIN postings p ON p.ledger_account_id = la.id
+GROUP BY la.id, la.code, la.kind, la.account_id;
+
+-- Сверка: кэшированный accounts.balance против главной книги
+CREATE VIEW account_balance_mismatches AS
+SELECT
+    a.id AS account_id,
+    a.account_number,
+    a.balance AS cached_balance,
+    COALESCE(lb.balance, 0) AS ledger_balance
+FROM accounts a
+LEFT JOIN ledger_balances lb ON lb.account_id = a.id
+WHERE a.balance <> COALESCE(lb.balance, 0);
@@ -0,0 +1,12 @@
+CREATE TABLE idempotency_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('processing', 'completed')),
+    response_code INT NULL,
+    response_body BYTEA NULL,
+    content_type VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT idempotency_key_unique UNIQUE (user_id, key)
+);
@@ -0,0 +1,3 @@
+CREATE INDEX transactions_account_time_idx ON transactions (account_id, time DESC, id DESC);
+CREATE INDEX transaction_trasfers_trans_idx ON transaction_trasfers (trans_id);
+CREATE INDEX transaction_trasfers_dest_idx ON transaction_trasfers (dest_account_id);
@@ -0,0 +1,22 @@
+ALTER TABLE transactions
+DROP CONSTRAINT transactions_type_check,
+ADD CONSTRAINT transactions_type_check CHECK (type IN ('deposit', 'withdrawal', 'transfer', 'card_payment'));
+
+-- Расчёты с торговыми точками по картам
+INSERT INTO ledger_accounts (code, kind) VALUES ('card_settlement', 'liability');
+
+CREATE TABLE card_holds (
+    id SERIAL PRIMARY KEY,
+    card_id INT NOT NULL REFERENCES cards(id),
+    account_id INT NOT NULL REFERENCES accounts(id),
+    initiator_id INT NOT NULL REFERENCES users(id),
+    amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+    captured_amount DECIMAL(15,2) NULL,
+    merchant VARCHAR(100) NOT NULL,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('authorized', 'captured', 'voided')),
+    transaction_id INT NULL REFERENCES transactions(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX card_holds_active_idx ON card_holds (account_id) WHERE status = 'authorized';
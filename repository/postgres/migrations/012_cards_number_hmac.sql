@@ -0,0 +1,6 @@
+-- Слепой индекс номера карты: PGP-шифрование даёт разный результат для одного
+-- номера, поэтому поиск и проверка уникальности идут по HMAC-SHA256 от номера.
+-- Старые карты заполняются приложением при запуске.
+ALTER TABLE cards ADD COLUMN number_hmac BYTEA NULL;
+
+ALTER TABLE cards ADD CONSTRAINT cards_number_hmac_key UNIQUE (number_hmac);
@@ -0,0 +1,19 @@
+ALTER TABLE cards
+ADD COLUMN status VARCHAR(10) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'blocked', 'lost', 'expired', 'closed')),
+ADD COLUMN reissued_from INT NULL REFERENCES cards(id);
+
+-- Журнал изменений статуса карты. old_status пустой у выпуска новой карты
+CREATE TABLE card_events (
+    id SERIAL PRIMARY KEY,
+    card_id INT NOT NULL REFERENCES cards(id),
+    old_status VARCHAR(10) NULL,
+    new_status VARCHAR(10) NOT NULL,
+    initiator_id INT NULL REFERENCES users(id),
+    reason VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX card_events_card_idx ON card_events (card_id, created_at);
+
+INSERT INTO card_events (card_id, new_status, reason, created_at)
+SELECT id, 'active', 'issued', COALESCE(created_at, NOW()) FROM cards;
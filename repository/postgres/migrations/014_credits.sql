@@ -0,0 +1,39 @@
+ALTER TABLE transactions
+DROP CONSTRAINT transactions_type_check,
+ADD CONSTRAINT transactions_type_check CHECK (type IN ('deposit', 'withdrawal', 'transfer', 'card_payment', 'credit_disbursement'));
+
+-- Выданные кредиты - актив банка
+INSERT INTO ledger_accounts (code, kind) VALUES ('loans_receivable', 'asset');
+
+-- rate_bp - ставка в сотых долях процента годовых (2150 = 21.50%)
+CREATE TABLE credits (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    account_id INT NOT NULL REFERENCES accounts(id),
+    principal DECIMAL(15,2) NOT NULL CHECK (principal > 0),
+    rate_bp INT NOT NULL CHECK (rate_bp >= 0),
+    term_months INT NOT NULL CHECK (term_months > 0),
+    schedule_type VARCHAR(15) NOT NULL CHECK (schedule_type IN ('annuity', 'differentiated')),
+    monthly_payment DECIMAL(15,2) NOT NULL,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('active', 'paid')),
+    transaction_id INT NULL REFERENCES transactions(id),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX credits_user_idx ON credits (user_id);
+
+CREATE TABLE credit_payments (
+    id SERIAL PRIMARY KEY,
+    credit_id INT NOT NULL REFERENCES credits(id),
+    number INT NOT NULL,
+    due_date DATE NOT NULL,
+    payment DECIMAL(15,2) NOT NULL,
+    principal DECIMAL(15,2) NOT NULL,
+    interest DECIMAL(15,2) NOT NULL,
+    remaining DECIMAL(15,2) NOT NULL,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('pending', 'paid')),
+    paid_at TIMESTAMP WITH TIME ZONE NULL,
+    UNIQUE (credit_id, number)
+);
+
+CREATE INDEX credit_payments_due_idx ON credit_payments (due_date) WHERE status = 'pending';
@@ -0,0 +1,12 @@
+-- Кэш ключевой ставки ЦБ РФ: ставка действует с даты date
+CREATE TABLE key_rates (
+    date DATE PRIMARY KEY,
+    rate_bp INT NOT NULL CHECK (rate_bp >= 0),
+    fetched_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Ставка кредита = ключевая ставка на дату выдачи + надбавка продукта
+ALTER TABLE credits
+ADD COLUMN product VARCHAR(20) NOT NULL DEFAULT 'consumer',
+ADD COLUMN key_rate_bp INT NULL,
+ADD COLUMN margin_bp INT NULL;
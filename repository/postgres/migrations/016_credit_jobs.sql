@@ -0,0 +1,34 @@
+ALTER TABLE transactions
+DROP CONSTRAINT transactions_type_check,
+ADD CONSTRAINT transactions_type_check CHECK (type IN ('deposit', 'withdrawal', 'transfer', 'card_payment', 'credit_disbursement', 'credit_payment'));
+
+-- Проценты и пени по кредитам - доход банка
+INSERT INTO ledger_accounts (code, kind) VALUES ('interest_income', 'income');
+
+ALTER TABLE credits
+DROP CONSTRAINT credits_status_check,
+ADD CONSTRAINT credits_status_check CHECK (status IN ('active', 'overdue', 'paid'));
+
+-- penalty - начисленные пени по просроченному платежу, penalty_accrued_at - дата, до которой они начислены
+ALTER TABLE credit_payments
+DROP CONSTRAINT credit_payments_status_check,
+ADD CONSTRAINT credit_payments_status_check CHECK (status IN ('pending', 'overdue', 'paid')),
+ADD COLUMN penalty DECIMAL(15,2) NOT NULL DEFAULT 0,
+ADD COLUMN penalty_accrued_at DATE NULL,
+ADD COLUMN transaction_id INT NULL REFERENCES transactions(id);
+
+DROP INDEX credit_payments_due_idx;
+CREATE INDEX credit_payments_due_idx ON credit_payments (due_date) WHERE status IN ('pending', 'overdue');
+
+-- Журнал запусков фоновых задач
+CREATE TABLE job_runs (
+    id SERIAL PRIMARY KEY,
+    job VARCHAR(50) NOT NULL,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('running', 'success', 'failed')),
+    processed INT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX job_runs_job_idx ON job_runs (job, started_at);
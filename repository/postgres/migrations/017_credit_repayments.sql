@@ -0,0 +1,26 @@
+ALTER TABLE transactions
+DROP CONSTRAINT transactions_type_check,
+ADD CONSTRAINT transactions_type_check CHECK (type IN ('deposit', 'withdrawal', 'transfer', 'card_payment', 'credit_disbursement', 'credit_payment', 'credit_prepayment'));
+
+-- schedule_version - текущая версия графика, строки старых версий остаются в credit_payments со статусом superseded
+ALTER TABLE credits
+ADD COLUMN schedule_version INT NOT NULL DEFAULT 1;
+
+ALTER TABLE credit_payments
+DROP CONSTRAINT credit_payments_status_check,
+ADD CONSTRAINT credit_payments_status_check CHECK (status IN ('pending', 'overdue', 'paid', 'superseded')),
+ADD COLUMN version INT NOT NULL DEFAULT 1,
+DROP CONSTRAINT credit_payments_credit_id_number_key,
+ADD CONSTRAINT credit_payments_credit_version_number_key UNIQUE (credit_id, version, number);
+
+-- Досрочные погашения: каждое создаёт новую версию графика
+CREATE TABLE credit_repayments (
+    id SERIAL PRIMARY KEY,
+    credit_id INT NOT NULL REFERENCES credits(id),
+    version INT NOT NULL,
+    mode VARCHAR(15) NOT NULL CHECK (mode IN ('shorten_term', 'reduce_payment')),
+    amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+    transaction_id INT NOT NULL REFERENCES transactions(id),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (credit_id, version)
+);
@@ -0,0 +1,9 @@
+-- Счета пользователя для аналитики
+CREATE INDEX accounts_user_idx ON accounts (user_id);
+
+-- Покрывающий индекс: агрегация по периоду читает только индекс, без таблицы
+CREATE INDEX transactions_account_time_cover_idx ON transactions (account_id, time) INCLUDE (type, amount, fee);
+
+-- Входящий остаток на дату: проводки счёта с датой журнальной записи
+CREATE INDEX postings_ledger_account_entry_idx ON postings (ledger_account_id, entry_id) INCLUDE (direction, amount);
+CREATE INDEX journal_entries_created_idx ON journal_entries (created_at);
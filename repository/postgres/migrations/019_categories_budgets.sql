@@ -0,0 +1,94 @@
+-- merchant - описание торговой точки для оплат картой, category - категория расходов
+ALTER TABLE transactions
+ADD COLUMN merchant VARCHAR(100) NULL,
+ADD COLUMN category VARCHAR(30) NULL,
+ADD COLUMN category_source VARCHAR(5) NULL CHECK (category_source IN ('rule', 'user'));
+
+UPDATE transactions t SET merchant = h.merchant FROM card_holds h WHERE h.transaction_id = t.id;
+
+-- Правила автоматической категоризации: pattern - шаблон ILIKE по торговой точке
+-- (или по типу операции, если точки нет). Правила пользователя (user_id) важнее общих,
+-- среди равных побеждает больший priority.
+CREATE TABLE category_rules (
+    id SERIAL PRIMARY KEY,
+    user_id INT NULL REFERENCES users(id),
+    pattern VARCHAR(100) NOT NULL,
+    category VARCHAR(30) NOT NULL,
+    priority INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX category_rules_user_pattern_key ON category_rules (COALESCE(user_id, 0), pattern);
+
+INSERT INTO category_rules (pattern, category) VALUES
+    ('deposit', 'income'),
+    ('credit_disbursement', 'loans'),
+    ('credit_payment', 'loans'),
+    ('credit_prepayment', 'loans'),
+    ('withdrawal', 'cash'),
+    ('transfer', 'transfers'),
+    ('%pyaterochka%', 'groceries'),
+    ('%perekrestok%', 'groceries'),
+    ('%magnit%', 'groceries'),
+    ('%vkusvill%', 'groceries'),
+    ('%cafe%', 'restaurants'),
+    ('%restaurant%', 'restaurants'),
+    ('%coffee%', 'restaurants'),
+    ('%taxi%', 'transport'),
+    ('%metro%', 'transport'),
+    ('%azs%', 'transport'),
+    ('%apteka%', 'health'),
+    ('%clinic%', 'health'),
+    ('%ozon%', 'shopping'),
+    ('%wildberries%', 'shopping'),
+    ('%cinema%', 'entertainment'),
+    ('%kino%', 'entertainment'),
+    ('%mts%', 'utilities'),
+    ('%beeline%', 'utilities'),
+    ('%zhkh%', 'utilities');
+
+CREATE FUNCTION classify_transaction(descriptor TEXT, owner_id INT) RETURNS VARCHAR AS $$
+    SELECT COALESCE(
+        (SELECT category
+         FROM category_rules
+         WHERE descriptor ILIKE pattern AND (user_id IS NULL OR user_id = owner_id)
+         ORDER BY user_id IS NULL, priority DESC, id
+         LIMIT 1),
+        'other'
+    );
+$$ LANGUAGE sql STABLE;
+
+-- Категория проставляется при вставке любой операции, если её не задали явно
+CREATE FUNCTION set_transaction_category() RETURNS trigger AS $$
+BEGIN
+    IF NEW.category IS NULL THEN
+        NEW.category := classify_transaction(
+            COALESCE(NEW.merchant, NEW.type),
+            (SELECT user_id FROM accounts WHERE id = NEW.account_id)
+        );
+        NEW.category_source := 'rule';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER transactions_category
+BEFORE INSERT ON transactions
+FOR EACH ROW EXECUTE FUNCTION set_transaction_category();
+
+UPDATE transactions t
+SET category = classify_transaction(COALESCE(t.merchant, t.type), a.user_id), category_source = 'rule'
+FROM accounts a
+WHERE a.id = t.account_id;
+
+-- Месячные бюджеты по категориям
+CREATE TABLE budgets (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    category VARCHAR(30) NOT NULL,
+    amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, category)
+);
+
+CREATE INDEX transactions_account_category_idx ON transactions (account_id, category, time);
@@ -0,0 +1,12 @@
+-- IP-адреса, с которых пользователь входил, чтобы сообщать о входе с нового адреса
+CREATE TABLE user_login_ips (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip VARCHAR(45) NOT NULL,
+    first_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, ip)
+);
+
+-- Когда клиенту напомнили о платеже, чтобы не слать напоминание повторно
+ALTER TABLE credit_payments
+ADD COLUMN reminded_at TIMESTAMP WITH TIME ZONE NULL;
@@ -0,0 +1,17 @@
+-- Исходящие события (transactional outbox): пишутся в той же транзакции, что и
+-- изменение данных, и доставляются получателям (sinks) фоновым диспетчером
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'done', 'dead')),
+    attempts INT NOT NULL DEFAULT 0,
+    -- получатели, которые уже приняли событие, при повторе им не отправляем
+    delivered_sinks TEXT[] NOT NULL DEFAULT '{}',
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    processed_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (next_attempt_at, id) WHERE status = 'pending';
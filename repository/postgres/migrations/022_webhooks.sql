@@ -0,0 +1,33 @@
+-- Webhook пользователя: события по его счетам отправляются на url.
+-- Секрет подписи = HMAC(HMAC_KEY, secret_nonce), сам секрет не хранится
+CREATE TABLE webhooks (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    events TEXT[] NOT NULL,
+    secret_nonce BYTEA NOT NULL,
+    -- удалённый webhook выключается, чтобы остался журнал доставок
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX webhooks_user_idx ON webhooks (user_id) WHERE active;
+
+-- Журнал доставок: одна строка на пару (webhook, событие outbox), результат последней попытки
+CREATE TABLE webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id INT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    outbox_id BIGINT NOT NULL REFERENCES outbox(id),
+    event VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'success', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    response_code INT NULL,
+    response_body TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_attempt_at TIMESTAMP WITH TIME ZONE NULL,
+    UNIQUE (webhook_id, outbox_id)
+);
+
+CREATE INDEX webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, id);
@@ -0,0 +1,29 @@
+-- Refresh-токены хранятся только как SHA-256. Каждое обновление создаёт новый
+-- токен той же семьи (family_id), а старый становится rotated. Повторное
+-- использование rotated токена значит, что он украден: отзывается вся семья.
+CREATE TABLE refresh_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    family_id CHAR(32) NOT NULL,
+    token_hash BYTEA NOT NULL UNIQUE,
+    status VARCHAR(10) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'rotated', 'revoked')),
+    -- access-токен, выданный вместе с этим refresh-токеном, отзывается вместе с семьёй
+    access_jti CHAR(32) NOT NULL,
+    access_expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX refresh_tokens_family_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_user_idx ON refresh_tokens (user_id);
+CREATE INDEX refresh_tokens_access_jti_idx ON refresh_tokens (access_jti);
+
+-- Отозванные access-токены. Строки нужны только до истечения токена
+CREATE TABLE revoked_tokens (
+    jti CHAR(32) PRIMARY KEY,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX revoked_tokens_expires_idx ON revoked_tokens (expires_at);
@@ -0,0 +1,12 @@
+-- Ключи подписи access-токенов. Закрытый ключ зашифрован PGP, как номера карт.
+-- Текущий ключ один (retired_at IS NULL), выведенные из оборота ключи нужны
+-- для проверки ещё не истёкших токенов и отдаются в JWKS
+CREATE TABLE jwt_keys (
+    kid VARCHAR(32) PRIMARY KEY,
+    alg VARCHAR(10) NOT NULL CHECK (alg IN ('RS256', 'EdDSA')),
+    private_key BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    retired_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE UNIQUE INDEX jwt_keys_current_idx ON jwt_keys ((TRUE)) WHERE retired_at IS NULL;
@@ -0,0 +1,30 @@
+-- TOTP (RFC 6238). Секрет зашифрован PGP. До подтверждения кодом секрет
+-- хранится с totp_enabled = FALSE. totp_last_step - шаг последнего принятого
+-- кода: код того же или более раннего шага повторно не принимается
+ALTER TABLE users
+    ADD COLUMN totp_secret BYTEA NULL,
+    ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN totp_last_step BIGINT NULL;
+
+-- Одноразовые коды восстановления, хранится только HMAC кода
+CREATE TABLE recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMP WITH TIME ZONE NULL,
+    UNIQUE (user_id, code_hash)
+);
+
+-- Вход после проверки пароля, ожидающий второй фактор. Хранится SHA-256 токена
+CREATE TABLE mfa_challenges (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash BYTEA NOT NULL UNIQUE,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX mfa_challenges_expires_idx ON mfa_challenges (expires_at);
@@ -0,0 +1,20 @@
+-- Переводы, ожидающие подтверждения одноразовым кодом: крупные суммы и
+-- переводы новому получателю. Хранится только HMAC кода
+CREATE TABLE pending_transfers (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source_account_id INT NOT NULL REFERENCES accounts(id),
+    dest_account_id INT NOT NULL REFERENCES accounts(id),
+    amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+    reason VARCHAR(20) NOT NULL CHECK (reason IN ('large_amount', 'new_recipient')),
+    code_hash BYTEA NOT NULL,
+    -- confirmed - код принят, перевод выполняется; failed - перевод отклонён после подтверждения
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'confirmed', 'completed', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    confirmed_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX pending_transfers_user_idx ON pending_transfers (user_id, id);
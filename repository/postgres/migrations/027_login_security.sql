@@ -0,0 +1,28 @@
+-- Журнал всех попыток входа. username - как введён, user_id заполнен,
+-- если такой пользователь есть
+CREATE TABLE login_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    user_id INT NULL REFERENCES users(id) ON DELETE SET NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    result VARCHAR(20) NOT NULL CHECK (result IN ('success', 'mfa_required', 'mfa_failed', 'wrong_password', 'unknown_user', 'blocked')),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX login_attempts_username_idx ON login_attempts (username, created_at);
+CREATE INDEX login_attempts_ip_idx ON login_attempts (ip, created_at);
+
+-- Счётчики неудачных входов по имени пользователя (scope = 'user') и по IP.
+-- Счётчик по имени ведётся и для несуществующих пользователей, чтобы ответы
+-- не выдавали, есть ли такой пользователь. unlock_token_hash - SHA-256
+-- токена из письма о блокировке
+CREATE TABLE login_throttle (
+    scope VARCHAR(4) NOT NULL CHECK (scope IN ('user', 'ip')),
+    key VARCHAR(255) NOT NULL,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    blocked_until TIMESTAMP WITH TIME ZONE NULL,
+    unlock_token_hash BYTEA NULL UNIQUE,
+    PRIMARY KEY (scope, key)
+);
@@ -0,0 +1,3 @@
+-- Когда владельцу последний раз отправлено письмо о блокировке входа: не
+-- чаще одного письма за время блокировки
+ALTER TABLE login_throttle ADD COLUMN lock_notified_at TIMESTAMP WITH TIME ZONE NULL;
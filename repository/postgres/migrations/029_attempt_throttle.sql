@@ -0,0 +1,4 @@
+-- В login_throttle считаются и неудачи при вводе кодов подтверждения и
+-- реквизитов карт. Список scope задаётся в models
+ALTER TABLE login_throttle DROP CONSTRAINT login_throttle_scope_check;
+ALTER TABLE login_throttle ALTER COLUMN scope TYPE VARCHAR(20);
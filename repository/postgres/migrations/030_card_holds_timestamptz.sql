@@ -0,0 +1,7 @@
+-- Срок холда сравнивается с NOW() базы, поэтому хранится с часовым поясом.
+-- Прежние значения читаются в часовом поясе сессии миграции: если приложение
+-- работало в другом поясе, перед миграцией нужно выполнить SET TIME ZONE с
+-- поясом приложения
+ALTER TABLE card_holds
+ALTER COLUMN created_at TYPE TIMESTAMP WITH TIME ZONE,
+ALTER COLUMN expires_at TYPE TIMESTAMP WITH TIME ZONE;
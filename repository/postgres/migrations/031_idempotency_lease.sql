@@ -0,0 +1,5 @@
+-- created_at ключа в processing - начало аренды: по нему ключ оборванного
+-- запроса занимается заново, а старые ключи удаляет задача idempotency_cleanup
+ALTER TABLE idempotency_keys ALTER COLUMN created_at TYPE TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idempotency_keys_created_idx ON idempotency_keys (created_at);
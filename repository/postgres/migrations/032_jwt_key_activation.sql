@@ -0,0 +1,5 @@
+-- Новый ключ публикуется в JWKS заранее и подписывает токены с activates_at,
+-- прежний ключ выводится из оборота в тот же момент (retired_at в будущем)
+ALTER TABLE jwt_keys ADD COLUMN activates_at TIMESTAMP WITH TIME ZONE NULL;
+UPDATE jwt_keys SET activates_at = created_at;
+ALTER TABLE jwt_keys ALTER COLUMN activates_at SET NOT NULL;
@@ -9,9 +9,10 @@ import (
 	"time"
 	"uniback/dto"
 	"uniback/models"
+	"uniback/repository"
 	"uniback/utils"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type PostgresRepository struct {
@@ -142,7 +143,7 @@ func (r *PostgresRepository) CreateUser(ctx context.Context, userDto dto.UserCre
 func (r *PostgresRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	query := `
 		SELECT
-			id, username, password, email, phone
+			id, username, password, email, phone, totp_enabled
 		FROM
 			users
 		WHERE username = $1
@@ -156,11 +157,12 @@ func (r *PostgresRepository) GetUserByUsername(ctx context.Context, username str
 		&user.Password,
 		&user.Email,
 		&user.Phone,
+		&user.TotpEnabled,
 	)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("user not found")
+			return nil, fmt.Errorf("user not found: %w", err)
 		}
 		return nil, fmt.Errorf("database error: %w", err)
 	}
@@ -303,6 +305,85 @@ func (r *PostgresRepository) GetAccountByNumber(ctx context.Context, number stri
 	return &Account, nil
 }
 
+// UpdateAccountStatus меняет статус счёта под блокировкой строки и пишет
+// событие account.status_changed в outbox. Закрыть можно только пустой счёт
+// без непогашенных кредитов.
+func (r *PostgresRepository) UpdateAccountStatus(ctx context.Context, accountId int, status string) (*models.Account, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var acc models.Account
+	err = tx.QueryRowContext(ctx, `
+		SELECT
+			id, user_id, account_number, account_type, balance, opening_date, status
+		FROM
+			accounts
+		WHERE
+			id = $1
+		FOR UPDATE
+	`, accountId).Scan(
+		&acc.Id,
+		&acc.UserId,
+		&acc.AccountNumber,
+		&acc.AccountType,
+		&acc.Balance,
+		&acc.OpeningDate,
+		&acc.Status,
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if !models.CanChangeAccountStatus(acc.Status, status) {
+		tx.Rollback()
+		return nil, repository.ErrAccountStatus
+	}
+
+	if status == models.AccountClosed {
+		var hasCredits bool
+		err = tx.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM credits WHERE account_id = $1 AND status <> 'paid')",
+			accountId,
+		).Scan(&hasCredits)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		if hasCredits || !acc.Balance.IsZero() {
+			tx.Rollback()
+			return nil, repository.ErrAccountNotEmpty
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE accounts SET status = $1 WHERE id = $2", status, accountId); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = insertOutboxEvent(ctx, tx, models.EventAccountStatusChanged, models.AccountStatusEvent{
+		AccountId:     acc.Id,
+		AccountNumber: acc.AccountNumber,
+		OldStatus:     acc.Status,
+		Status:        status,
+		ChangedAt:     time.Now(),
+	})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	acc.Status = status
+	return &acc, nil
+}
+
 func (r *PostgresRepository) CreateAccount(ctx context.Context, acc models.Account) (*dto.AccountResponseDto, error) {
 	query := `
 		INSERT INTO 
@@ -353,79 +434,70 @@ func (r *PostgresRepository) GetAccountByUsername(ctx context.Context, account s
 	return &resultAccount, nil
 }
 
-func (r *PostgresRepository) UpdateAccountTransaction(ctx context.Context, acc models.Account, amount float64, fee float64, trsType string) (*models.Account, error) {
+func (r *PostgresRepository) UpdateAccountTransaction(ctx context.Context, acc models.Account, amount models.Money, fee models.Money, trsType string, entry models.JournalEntry) (*models.Account, error) {
 
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = tx.Exec(
-		"UPDATE accounts SET balance = $1 WHERE id = $2",
-		acc.Balance, acc.Id,
-	)
-
-	if err != nil {
-		tx.Rollback()
-		return nil, err
-	}
+	var transactionId int
 
-	_, err = tx.Exec(
-		"INSERT INTO transactions (account_id, type, amount, fee) VALUES($1, $2 , $3, $4)",
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO transactions (account_id, type, amount, fee) VALUES($1, $2 , $3, $4) RETURNING id",
 		acc.Id,
 		trsType,
 		amount,
 		fee,
-	)
+	).Scan(&transactionId)
 
 	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
-	err = tx.Commit()
-	if err != nil {
+	entry.TransactionId = transactionId
+	if _, err = postJournalEntry(ctx, tx, entry); err != nil {
+		tx.Rollback()
 		return nil, err
 	}
 
-	result, err := r.GetAccountByNumber(ctx, acc.AccountNumber)
-
+	err = insertTransactionEvent(ctx, tx, models.TransactionEvent{
+		TransactionId: transactionId,
+		Type:          trsType,
+		AccountId:     acc.Id,
+		AccountNumber: acc.AccountNumber,
+		Amount:        amount,
+		Fee:           fee,
+	})
 	if err != nil {
+		tx.Rollback()
 		return nil, err
 	}
 
-	return result, nil
-}
-
-func (r *PostgresRepository) TransferAccountsTransaction(ctx context.Context, src models.Account, dest models.Account, amount float64, fee float64) (*models.Account, error) {
-	tx, err := r.db.BeginTx(ctx, nil)
+	err = tx.Commit()
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = tx.Exec(
-		"UPDATE accounts SET balance = $1 WHERE id = $2",
-		src.Balance, src.Id,
-	)
+	result, err := r.GetAccountByNumber(ctx, acc.AccountNumber)
 
 	if err != nil {
-		tx.Rollback()
 		return nil, err
 	}
 
-	_, err = tx.Exec(
-		"UPDATE accounts SET balance = $1 WHERE id = $2",
-		dest.Balance, dest.Id,
-	)
+	return result, nil
+}
 
+func (r *PostgresRepository) TransferAccountsTransaction(ctx context.Context, src models.Account, dest models.Account, amount models.Money, fee models.Money, entry models.JournalEntry) (*models.Account, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		tx.Rollback()
 		return nil, err
 	}
 
 	var transactionId int
 
-	err = tx.QueryRow(
+	err = tx.QueryRowContext(ctx,
 		"INSERT INTO transactions (account_id, type, amount, fee) VALUES($1, 'transfer', $2, $3) RETURNING id",
 		src.Id,
 		amount,
@@ -437,7 +509,7 @@ func (r *PostgresRepository) TransferAccountsTransaction(ctx context.Context, sr
 		return nil, err
 	}
 
-	_, err = tx.Exec(
+	_, err = tx.ExecContext(ctx,
 		"INSERT INTO transaction_trasfers (trans_id, dest_account_id) VALUES($1, $2)",
 		transactionId, dest.Id,
 	)
@@ -447,6 +519,27 @@ func (r *PostgresRepository) TransferAccountsTransaction(ctx context.Context, sr
 		return nil, err
 	}
 
+	entry.TransactionId = transactionId
+	if _, err = postJournalEntry(ctx, tx, entry); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = insertTransactionEvent(ctx, tx, models.TransactionEvent{
+		TransactionId:     transactionId,
+		Type:              "transfer",
+		AccountId:         src.Id,
+		AccountNumber:     src.AccountNumber,
+		DestAccountId:     dest.Id,
+		DestAccountNumber: dest.AccountNumber,
+		Amount:            amount,
+		Fee:               fee,
+	})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return nil, err
@@ -462,14 +555,14 @@ func (r *PostgresRepository) TransferAccountsTransaction(ctx context.Context, sr
 
 }
 
-func (r *PostgresRepository) IsCardExists(ctx context.Context, number []byte) (bool, error) {
+func (r *PostgresRepository) IsCardExists(ctx context.Context, numberHmac []byte) (bool, error) {
 	query := `
-		SELECT COUNT(*) FROM cards WHERE number = $1
+		SELECT COUNT(*) FROM cards WHERE number_hmac = $1
 	`
 
 	var count int
 
-	err := r.db.QueryRowContext(ctx, query, number).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query, numberHmac).Scan(&count)
 	if err != nil {
 		return false, err
 	}
@@ -481,16 +574,144 @@ func (r *PostgresRepository) IsCardExists(ctx context.Context, number []byte) (b
 	return true, nil
 }
 
-func (r *PostgresRepository) CreateNewCard(ctx context.Context, card models.Card) error {
+func (r *PostgresRepository) CreateNewCard(ctx context.Context, card models.Card, initiatorId int) (*models.Card, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := insertCard(ctx, tx, card, initiatorId, "issued")
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *PostgresRepository) GetCardsByUsername(ctx context.Context, username string) ([]models.Card, error) {
 	query := `
-		INSERT INTO 
-			cards (account_id, number, expiry, cvv, created_at)
-		VALUES ($1, $2, $3, $4, $5)
+		SELECT
+			c.id, c.account_id, a.account_number, c.number, c.expiry, c.status, c.created_at
+		FROM
+			cards c
+			JOIN accounts a ON c.account_id = a.id
+			JOIN users u ON a.user_id = u.id
+		WHERE
+			u.username = $1
+		ORDER BY c.created_at DESC
 	`
 
-	_, err := r.db.ExecContext(ctx, query, card.AccountId, card.Number, card.Expiry, card.Cvv, card.CreatedAt)
+	rows, err := r.db.QueryContext(ctx, query, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user cards: %w", err)
+	}
+	defer rows.Close()
 
-	return err
+	var cards []models.Card
+	for rows.Next() {
+		var card models.Card
+		err := rows.Scan(
+			&card.Id,
+			&card.AccountId,
+			&card.AccountNumber,
+			&card.Number,
+			&card.Expiry,
+			&card.Status,
+			&card.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan card: %w", err)
+		}
+		cards = append(cards, card)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return cards, nil
 }
 
 // PRIVATE SECTION
+
+type lockedAccount struct {
+	models.Account
+	// held - сумма активных холдов по картам, недоступная для списаний
+	held models.Money
+}
+
+// lockAccounts блокирует строки счетов до конца транзакции. Блокировки берутся
+// в порядке возрастания id, чтобы встречные переводы не приводили к deadlock.
+func lockAccounts(ctx context.Context, tx *sql.Tx, ids ...int) (map[int]*lockedAccount, error) {
+	query := `
+		SELECT
+			a.id, a.balance, a.status,
+			COALESCE((
+				SELECT SUM(h.amount)
+				FROM card_holds h
+				WHERE h.account_id = a.id AND h.status = 'authorized' AND h.expires_at > NOW()
+			), 0)
+		FROM
+			accounts a
+		WHERE
+			a.id = ANY($1)
+		ORDER BY a.id
+		FOR UPDATE OF a
+	`
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock accounts: %w", err)
+	}
+	defer rows.Close()
+
+	locked := make(map[int]*lockedAccount, len(ids))
+	for rows.Next() {
+		var acc lockedAccount
+		if err := rows.Scan(&acc.Id, &acc.Balance, &acc.Status, &acc.held); err != nil {
+			return nil, fmt.Errorf("failed to scan locked account: %w", err)
+		}
+		locked[acc.Id] = &acc
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	for _, id := range ids {
+		if _, ok := locked[id]; !ok {
+			return nil, fmt.Errorf("account %d not found", id)
+		}
+	}
+
+	return locked, nil
+}
+
+// applyBalanceDelta меняет баланс заблокированного счёта относительно текущего значения.
+// Списания не могут использовать сумму, заблокированную холдами.
+func applyBalanceDelta(ctx context.Context, tx *sql.Tx, acc *lockedAccount, delta models.Money) error {
+	if acc.Status != "active" {
+		return repository.ErrAccountNotActive
+	}
+
+	newBalance := acc.Balance.Add(delta)
+	if newBalance.IsNegative() || (delta.IsNegative() && newBalance.Sub(acc.held).IsNegative()) {
+		return repository.ErrInsufficientFunds
+	}
+
+	_, err := tx.ExecContext(ctx,
+		"UPDATE accounts SET balance = balance + $1 WHERE id = $2",
+		delta, acc.Id,
+	)
+	if err != nil {
+		return err
+	}
+
+	acc.Balance = newBalance
+	return nil
+}
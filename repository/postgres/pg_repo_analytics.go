@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"uniback/models"
+)
+
+// analyticsQuery агрегирует операции всех счетов пользователя по периодам.
+// Входящий остаток каждого счёта берётся из главной книги на момент from,
+// баланс на конец периода - нарастающий итог Net поверх него. Периоды без
+// операций тоже попадают в результат, чтобы тренд баланса был непрерывным.
+const analyticsQuery = `
+	WITH acc AS (
+		SELECT a.id, a.account_number
+		FROM accounts a JOIN users u ON u.id = a.user_id
+		WHERE u.username = $1
+	),
+	flows AS (
+		SELECT
+			t.account_id,
+			t.time,
+			CASE WHEN t.type IN ('deposit', 'credit_disbursement') THEN t.amount ELSE 0 END AS inflow,
+			CASE WHEN t.type IN ('deposit', 'credit_disbursement') THEN 0 ELSE t.amount END AS outflow,
+			COALESCE(t.fee, 0) AS fee
+		FROM
+			transactions t
+			JOIN acc ON acc.id = t.account_id
+		WHERE
+			t.time >= $2::timestamp AND t.time < $3::timestamp
+		UNION ALL
+		SELECT
+			tt.dest_account_id,
+			t.time,
+			t.amount,
+			0,
+			0
+		FROM
+			transaction_trasfers tt
+			JOIN acc ON acc.id = tt.dest_account_id
+			JOIN transactions t ON t.id = tt.trans_id
+		WHERE
+			t.time >= $2::timestamp AND t.time < $3::timestamp
+	),
+	totals AS (
+		SELECT
+			account_id,
+			date_trunc($4::text, time) AS period_start,
+			SUM(inflow) AS inflow,
+			SUM(outflow) AS outflow,
+			SUM(fee) AS fee
+		FROM flows
+		GROUP BY 1, 2
+	),
+	periods AS (
+		SELECT generate_series(
+			date_trunc($4::text, $2::timestamp),
+			$3::timestamp - interval '1 microsecond',
+			('1 ' || $4::text)::interval
+		) AS period_start
+	),
+	opening AS (
+		SELECT
+			acc.id AS account_id,
+			COALESCE(SUM(CASE WHEN p.direction = 'credit' THEN p.amount ELSE -p.amount END), 0) AS balance
+		FROM
+			acc
+			JOIN ledger_accounts la ON la.account_id = acc.id
+			JOIN postings p ON p.ledger_account_id = la.id
+			JOIN journal_entries je ON je.id = p.entry_id
+		WHERE
+			je.created_at < $2::timestamp
+		GROUP BY acc.id
+	)
+	SELECT
+		acc.id,
+		acc.account_number,
+		pr.period_start,
+		COALESCE(tl.inflow, 0),
+		COALESCE(tl.outflow, 0),
+		COALESCE(tl.fee, 0),
+		COALESCE(tl.inflow, 0) - COALESCE(tl.outflow, 0) - COALESCE(tl.fee, 0),
+		COALESCE(o.balance, 0) + SUM(COALESCE(tl.inflow, 0) - COALESCE(tl.outflow, 0) - COALESCE(tl.fee, 0))
+			OVER (PARTITION BY acc.id ORDER BY pr.period_start)
+	FROM
+		acc
+		CROSS JOIN periods pr
+		LEFT JOIN totals tl ON tl.account_id = acc.id AND tl.period_start = pr.period_start
+		LEFT JOIN opening o ON o.account_id = acc.id
+	ORDER BY acc.id, pr.period_start
+`
+
+// GetAnalytics возвращает обороты по всем счетам пользователя за [from, to)
+// с разбивкой по дням, неделям или месяцам.
+func (r *PostgresRepository) GetAnalytics(ctx context.Context, username string, from time.Time, to time.Time, granularity string) ([]models.AnalyticsPeriod, error) {
+	rows, err := r.db.QueryContext(ctx, analyticsQuery, username, pgTimestamp(&from), pgTimestamp(&to), granularity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query analytics: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.AnalyticsPeriod
+	for rows.Next() {
+		var period models.AnalyticsPeriod
+		err := rows.Scan(
+			&period.AccountId,
+			&period.AccountNumber,
+			&period.PeriodStart,
+			&period.Inflow,
+			&period.Outflow,
+			&period.Fees,
+			&period.Net,
+			&period.EndBalance,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan analytics: %w", err)
+		}
+		result = append(result, period)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,163 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"uniback/models"
+)
+
+// SetTransactionCategory задаёт категорию операции вручную. Менять можно
+// только операции со своих счетов. Возвращает описание операции, по которому
+// работают правила: торговую точку или тип операции.
+func (r *PostgresRepository) SetTransactionCategory(ctx context.Context, username string, transactionId int, category string) (string, error) {
+	query := `
+		UPDATE
+			transactions t
+		SET
+			category = $1, category_source = 'user'
+		FROM
+			accounts a
+			JOIN users u ON u.id = a.user_id
+		WHERE
+			t.id = $2 AND t.account_id = a.id AND u.username = $3
+		RETURNING COALESCE(t.merchant, t.type)
+	`
+
+	var descriptor string
+	err := r.db.QueryRowContext(ctx, query, category, transactionId, username).Scan(&descriptor)
+	return descriptor, err
+}
+
+// AddCategoryRule сохраняет правило пользователя: будущие операции с описанием
+// pattern получат категорию category.
+func (r *PostgresRepository) AddCategoryRule(ctx context.Context, username string, pattern string, category string) error {
+	query := `
+		INSERT INTO
+			category_rules (user_id, pattern, category)
+		SELECT id, $2, $3 FROM users WHERE username = $1
+		ON CONFLICT (COALESCE(user_id, 0), pattern) DO UPDATE SET category = EXCLUDED.category
+	`
+
+	_, err := r.db.ExecContext(ctx, query, username, pattern, category)
+	return err
+}
+
+// GetCategorySpending считает расходы пользователя по категориям за [from, to).
+func (r *PostgresRepository) GetCategorySpending(ctx context.Context, username string, from time.Time, to time.Time) (map[string]models.Money, error) {
+	query := `
+		SELECT
+			t.category, SUM(t.amount + COALESCE(t.fee, 0))
+		FROM
+			transactions t
+			JOIN accounts a ON a.id = t.account_id
+			JOIN users u ON u.id = a.user_id
+		WHERE
+			u.username = $1
+			AND t.type NOT IN ('deposit', 'credit_disbursement')
+			AND t.time >= $2::timestamp AND t.time < $3::timestamp
+		GROUP BY t.category
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, username, pgTimestamp(&from), pgTimestamp(&to))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query category spending: %w", err)
+	}
+	defer rows.Close()
+
+	spent := map[string]models.Money{}
+	for rows.Next() {
+		var category sql.NullString
+		var amount models.Money
+		if err := rows.Scan(&category, &amount); err != nil {
+			return nil, fmt.Errorf("failed to scan category spending: %w", err)
+		}
+		if !category.Valid {
+			category.String = models.CategoryOther
+		}
+		spent[category.String] = spent[category.String].Add(amount)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return spent, nil
+}
+
+func (r *PostgresRepository) GetBudgets(ctx context.Context, username string) ([]models.Budget, error) {
+	query := `
+		SELECT
+			b.id, b.category, b.amount
+		FROM
+			budgets b
+			JOIN users u ON u.id = b.user_id
+		WHERE
+			u.username = $1
+		ORDER BY b.category
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query budgets: %w", err)
+	}
+	defer rows.Close()
+
+	var budgets []models.Budget
+	for rows.Next() {
+		var budget models.Budget
+		if err := rows.Scan(&budget.Id, &budget.Category, &budget.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan budget: %w", err)
+		}
+		budgets = append(budgets, budget)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return budgets, nil
+}
+
+// SetBudget создаёт бюджет по категории или меняет его сумму.
+func (r *PostgresRepository) SetBudget(ctx context.Context, username string, category string, amount models.Money) (*models.Budget, error) {
+	query := `
+		INSERT INTO
+			budgets (user_id, category, amount)
+		SELECT id, $2, $3 FROM users WHERE username = $1
+		ON CONFLICT (user_id, category) DO UPDATE SET amount = EXCLUDED.amount
+		RETURNING id, category, amount
+	`
+
+	var budget models.Budget
+	err := r.db.QueryRowContext(ctx, query, username, category, amount).Scan(&budget.Id, &budget.Category, &budget.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &budget, nil
+}
+
+// DeleteBudget удаляет бюджет, если его нет - sql.ErrNoRows.
+func (r *PostgresRepository) DeleteBudget(ctx context.Context, username string, category string) error {
+	query := `
+		DELETE FROM
+			budgets b
+		USING
+			users u
+		WHERE
+			u.id = b.user_id AND u.username = $1 AND b.category = $2
+	`
+
+	result, err := r.db.ExecContext(ctx, query, username, category)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
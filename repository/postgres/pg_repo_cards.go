@@ -0,0 +1,465 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"uniback/models"
+	"uniback/repository"
+)
+
+const cardHoldColumns = `
+	id, card_id, account_id, initiator_id, amount, captured_amount, merchant,
+	status, transaction_id, created_at, expires_at
+`
+
+const cardColumns = `
+	c.id, c.account_id, a.account_number, c.number, c.number_hmac, c.expiry, c.cvv,
+	c.status, c.reissued_from, c.created_at
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// GetCardByNumberHmac ищет карту по слепому индексу номера.
+func (r *PostgresRepository) GetCardByNumberHmac(ctx context.Context, numberHmac []byte) (*models.Card, error) {
+	query := `
+		SELECT ` + cardColumns + `
+		FROM
+			cards c
+			JOIN accounts a ON c.account_id = a.id
+		WHERE
+			c.number_hmac = $1
+	`
+
+	return scanCard(r.db.QueryRowContext(ctx, query, numberHmac))
+}
+
+func (r *PostgresRepository) GetCardByIdAndUsername(ctx context.Context, cardId int, username string) (*models.Card, error) {
+	query := `
+		SELECT ` + cardColumns + `
+		FROM
+			cards c
+			JOIN accounts a ON c.account_id = a.id
+			JOIN users u ON a.user_id = u.id
+		WHERE
+			c.id = $1 AND u.username = $2
+	`
+
+	return scanCard(r.db.QueryRowContext(ctx, query, cardId, username))
+}
+
+// GetCardsWithoutNumberHmac возвращает карты, выпущенные до появления слепого индекса.
+func (r *PostgresRepository) GetCardsWithoutNumberHmac(ctx context.Context) ([]models.Card, error) {
+	query := `
+		SELECT ` + cardColumns + `
+		FROM
+			cards c
+			JOIN accounts a ON c.account_id = a.id
+		WHERE
+			c.number_hmac IS NULL
+		ORDER BY c.id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cards: %w", err)
+	}
+	defer rows.Close()
+
+	var cards []models.Card
+	for rows.Next() {
+		card, err := scanCard(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan card: %w", err)
+		}
+		cards = append(cards, *card)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return cards, nil
+}
+
+func (r *PostgresRepository) SetCardNumberHmac(ctx context.Context, cardId int, numberHmac []byte) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE cards SET number_hmac = $1 WHERE id = $2", numberHmac, cardId)
+	return err
+}
+
+func (r *PostgresRepository) UpdateCardStatus(ctx context.Context, cardId int, status string, initiatorId int, reason string) (*models.Card, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	card, err := changeCardStatus(ctx, tx, cardId, status, initiatorId, reason)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return card, nil
+}
+
+func (r *PostgresRepository) ReissueCard(ctx context.Context, cardId int, newCard models.Card, initiatorId int) (*models.Card, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	oldCard, err := changeCardStatus(ctx, tx, cardId, models.CardLost, initiatorId, "reported lost")
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	newCard.AccountId = oldCard.AccountId
+	newCard.ReissuedFrom = oldCard.Id
+
+	result, err := insertCard(ctx, tx, newCard, initiatorId, fmt.Sprintf("reissue of card %d", oldCard.Id))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	result.AccountNumber = oldCard.AccountNumber
+
+	return result, nil
+}
+
+func (r *PostgresRepository) GetCardEvents(ctx context.Context, cardId int) ([]models.CardEvent, error) {
+	query := `
+		SELECT
+			id, card_id, COALESCE(old_status, ''), new_status, COALESCE(initiator_id, 0), reason, created_at
+		FROM
+			card_events
+		WHERE
+			card_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, cardId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query card events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.CardEvent
+	for rows.Next() {
+		var event models.CardEvent
+		err := rows.Scan(
+			&event.Id,
+			&event.CardId,
+			&event.OldStatus,
+			&event.NewStatus,
+			&event.InitiatorId,
+			&event.Reason,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan card event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return events, nil
+}
+
+// AuthorizeCardHold блокирует сумму на счёте карты, если на нём хватает доступных средств.
+func (r *PostgresRepository) AuthorizeCardHold(ctx context.Context, hold models.CardHold) (*models.CardHold, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	locked, err := lockAccounts(ctx, tx, hold.AccountId)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	acc := locked[hold.AccountId]
+	if acc.Status != "active" {
+		tx.Rollback()
+		return nil, repository.ErrAccountNotActive
+	}
+
+	if acc.Balance.Sub(acc.held).Sub(hold.Amount).IsNegative() {
+		tx.Rollback()
+		return nil, repository.ErrInsufficientFunds
+	}
+
+	query := `
+		INSERT INTO
+			card_holds (card_id, account_id, initiator_id, amount, merchant, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5, 'authorized', $6)
+		RETURNING ` + cardHoldColumns
+
+	result, err := scanCardHold(tx.QueryRowContext(ctx, query,
+		hold.CardId,
+		hold.AccountId,
+		hold.InitiatorId,
+		hold.Amount,
+		hold.Merchant,
+		hold.ExpiresAt,
+	))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *PostgresRepository) GetCardHold(ctx context.Context, id int) (*models.CardHold, error) {
+	query := "SELECT " + cardHoldColumns + " FROM card_holds WHERE id = $1"
+
+	return scanCardHold(r.db.QueryRowContext(ctx, query, id))
+}
+
+// CaptureCardHold списывает деньги по холду: холд закрывается и вместо него
+// появляется операция card_payment с проводками entry.
+func (r *PostgresRepository) CaptureCardHold(ctx context.Context, hold models.CardHold, amount models.Money, entry models.JournalEntry) (*models.CardHold, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE
+			card_holds
+		SET
+			status = 'captured', captured_amount = $1
+		WHERE
+			id = $2 AND status = 'authorized' AND expires_at > NOW() AND amount >= $1
+		RETURNING ` + cardHoldColumns
+
+	// Холд закрывается до проводок, чтобы его сумма не считалась заблокированной
+	result, err := scanCardHold(tx.QueryRowContext(ctx, query, amount, hold.Id))
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repository.ErrHoldNotActive
+		}
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO transactions (account_id, type, amount, fee, merchant) VALUES($1, 'card_payment', $2, 0, $3) RETURNING id",
+		result.AccountId,
+		amount,
+		result.Merchant,
+	).Scan(&result.TransactionId)
+
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	entry.TransactionId = result.TransactionId
+	if _, err = postJournalEntry(ctx, tx, entry); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = insertTransactionEvent(ctx, tx, models.TransactionEvent{
+		TransactionId: result.TransactionId,
+		Type:          "card_payment",
+		AccountId:     result.AccountId,
+		Amount:        amount,
+	})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE card_holds SET transaction_id = $1 WHERE id = $2", result.TransactionId, result.Id)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *PostgresRepository) VoidCardHold(ctx context.Context, id int) (*models.CardHold, error) {
+	query := `
+		UPDATE
+			card_holds
+		SET
+			status = 'voided'
+		WHERE
+			id = $1 AND status = 'authorized'
+		RETURNING ` + cardHoldColumns
+
+	result, err := scanCardHold(r.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrHoldNotActive
+	}
+
+	return result, err
+}
+
+func scanCardHold(row *sql.Row) (*models.CardHold, error) {
+	var hold models.CardHold
+	var transactionId sql.NullInt64
+
+	err := row.Scan(
+		&hold.Id,
+		&hold.CardId,
+		&hold.AccountId,
+		&hold.InitiatorId,
+		&hold.Amount,
+		&hold.CapturedAmount,
+		&hold.Merchant,
+		&hold.Status,
+		&transactionId,
+		&hold.CreatedAt,
+		&hold.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	hold.TransactionId = int(transactionId.Int64)
+
+	return &hold, nil
+}
+
+func scanCard(row rowScanner) (*models.Card, error) {
+	var card models.Card
+	var reissuedFrom sql.NullInt64
+
+	err := row.Scan(
+		&card.Id,
+		&card.AccountId,
+		&card.AccountNumber,
+		&card.Number,
+		&card.NumberHmac,
+		&card.Expiry,
+		&card.Cvv,
+		&card.Status,
+		&reissuedFrom,
+		&card.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	card.ReissuedFrom = int(reissuedFrom.Int64)
+
+	return &card, nil
+}
+
+// insertCard сохраняет новую карту, событие её выпуска в card_events и card.issued в outbox.
+func insertCard(ctx context.Context, tx *sql.Tx, card models.Card, initiatorId int, reason string) (*models.Card, error) {
+	query := `
+		INSERT INTO
+			cards (account_id, number, number_hmac, expiry, cvv, status, reissued_from, created_at)
+		VALUES ($1, $2, $3, $4, $5, 'active', $6, $7)
+		RETURNING id, (SELECT account_number FROM accounts WHERE id = $1)
+	`
+
+	err := tx.QueryRowContext(ctx, query,
+		card.AccountId,
+		card.Number,
+		card.NumberHmac,
+		card.Expiry,
+		card.Cvv,
+		nullInt(card.ReissuedFrom),
+		card.CreatedAt,
+	).Scan(&card.Id, &card.AccountNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	card.Status = models.CardActive
+
+	if err := insertCardEvent(ctx, tx, card.Id, "", card.Status, initiatorId, reason); err != nil {
+		return nil, err
+	}
+
+	err = insertOutboxEvent(ctx, tx, models.EventCardIssued, models.CardIssuedEvent{
+		CardId:        card.Id,
+		AccountId:     card.AccountId,
+		AccountNumber: card.AccountNumber,
+		ReissuedFrom:  card.ReissuedFrom,
+		CreatedAt:     card.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &card, nil
+}
+
+// changeCardStatus меняет статус карты под блокировкой строки, чтобы два
+// одновременных запроса не прошли проверку перехода по одному и тому же статусу.
+func changeCardStatus(ctx context.Context, tx *sql.Tx, cardId int, status string, initiatorId int, reason string) (*models.Card, error) {
+	query := `
+		SELECT ` + cardColumns + `
+		FROM
+			cards c
+			JOIN accounts a ON c.account_id = a.id
+		WHERE
+			c.id = $1
+		FOR UPDATE OF c
+	`
+
+	card, err := scanCard(tx.QueryRowContext(ctx, query, cardId))
+	if err != nil {
+		return nil, err
+	}
+
+	if !models.CanChangeCardStatus(card.Status, status) {
+		return nil, repository.ErrCardStatus
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE cards SET status = $1 WHERE id = $2", status, cardId); err != nil {
+		return nil, err
+	}
+
+	if err := insertCardEvent(ctx, tx, cardId, card.Status, status, initiatorId, reason); err != nil {
+		return nil, err
+	}
+
+	card.Status = status
+
+	return card, nil
+}
+
+func insertCardEvent(ctx context.Context, tx *sql.Tx, cardId int, oldStatus string, newStatus string, initiatorId int, reason string) error {
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO card_events (card_id, old_status, new_status, initiator_id, reason) VALUES ($1, $2, $3, $4, $5)",
+		cardId,
+		nullString(oldStatus),
+		newStatus,
+		nullInt(initiatorId),
+		reason,
+	)
+	return err
+}
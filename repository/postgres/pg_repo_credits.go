@@ -0,0 +1,619 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+
+	"github.com/lib/pq"
+)
+
+const dateLayout = "2006-01-02"
+
+const loanColumns = `
+	cr.id, cr.user_id, cr.account_id, a.account_number, cr.principal, cr.product,
+	COALESCE(cr.key_rate_bp, 0), COALESCE(cr.margin_bp, 0), cr.rate_bp,
+	cr.term_months, cr.schedule_type, cr.monthly_payment, cr.status,
+	cr.transaction_id, cr.created_at, cr.schedule_version
+`
+
+const creditPaymentColumns = `
+	cp.id, cp.credit_id, cp.number, cp.due_date, cp.payment, cp.principal, cp.interest,
+	cp.remaining, cp.status, cp.paid_at, cp.penalty, cp.penalty_accrued_at, cp.transaction_id,
+	cp.version
+`
+
+// CreateCredit оформляет кредит, сохраняет график и зачисляет сумму кредита
+// на счёт проводкой entry. Всё выполняется в одной транзакции БД.
+func (r *PostgresRepository) CreateCredit(ctx context.Context, loan models.Loan, schedule []models.CreditPayment, entry models.JournalEntry) (*models.Loan, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO transactions (account_id, type, amount, fee) VALUES($1, 'credit_disbursement', $2, 0) RETURNING id",
+		loan.AccountId,
+		loan.Principal,
+	).Scan(&loan.TransactionId)
+
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	entry.TransactionId = loan.TransactionId
+	if _, err = postJournalEntry(ctx, tx, entry); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = insertTransactionEvent(ctx, tx, models.TransactionEvent{
+		TransactionId: loan.TransactionId,
+		Type:          "credit_disbursement",
+		AccountId:     loan.AccountId,
+		Amount:        loan.Principal,
+	})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO
+			credits (user_id, account_id, principal, product, key_rate_bp, margin_bp, rate_bp, term_months, schedule_type, monthly_payment, status, transaction_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, created_at
+	`
+
+	err = tx.QueryRowContext(ctx, query,
+		loan.UserId,
+		loan.AccountId,
+		loan.Principal,
+		loan.Product,
+		loan.KeyRateBp,
+		loan.MarginBp,
+		loan.RateBp,
+		loan.TermMonths,
+		loan.ScheduleType,
+		loan.MonthlyPayment,
+		loan.Status,
+		loan.TransactionId,
+	).Scan(&loan.Id, &loan.CreatedAt)
+
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	loan.ScheduleVersion = 1
+	if err = insertCreditPayments(ctx, tx, loan.Id, loan.ScheduleVersion, schedule); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &loan, nil
+}
+
+func (r *PostgresRepository) GetCreditsByUsername(ctx context.Context, username string) ([]models.Loan, error) {
+	query := `
+		SELECT ` + loanColumns + `
+		FROM
+			credits cr
+			JOIN accounts a ON cr.account_id = a.id
+			JOIN users u ON cr.user_id = u.id
+		WHERE
+			u.username = $1
+		ORDER BY cr.created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user credits: %w", err)
+	}
+	defer rows.Close()
+
+	var loans []models.Loan
+	for rows.Next() {
+		loan, err := scanLoan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan credit: %w", err)
+		}
+		loans = append(loans, *loan)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return loans, nil
+}
+
+func (r *PostgresRepository) GetCreditByIdAndUsername(ctx context.Context, creditId int, username string) (*models.Loan, error) {
+	query := `
+		SELECT ` + loanColumns + `
+		FROM
+			credits cr
+			JOIN accounts a ON cr.account_id = a.id
+			JOIN users u ON cr.user_id = u.id
+		WHERE
+			cr.id = $1 AND u.username = $2
+	`
+
+	return scanLoan(r.db.QueryRowContext(ctx, query, creditId, username))
+}
+
+// GetCreditSchedule возвращает действующий график: оплаченные платежи всех версий и
+// неоплаченные платежи текущей версии.
+func (r *PostgresRepository) GetCreditSchedule(ctx context.Context, creditId int) ([]models.CreditPayment, error) {
+	query := "SELECT " + creditPaymentColumns + " FROM credit_payments cp WHERE cp.credit_id = $1 AND cp.status <> 'superseded' ORDER BY cp.number"
+	return r.queryCreditPayments(ctx, query, creditId)
+}
+
+// GetCreditScheduleHistory возвращает строки всех версий графика, включая заменённые.
+func (r *PostgresRepository) GetCreditScheduleHistory(ctx context.Context, creditId int) ([]models.CreditPayment, error) {
+	query := "SELECT " + creditPaymentColumns + " FROM credit_payments cp WHERE cp.credit_id = $1 ORDER BY cp.version, cp.number"
+	return r.queryCreditPayments(ctx, query, creditId)
+}
+
+func (r *PostgresRepository) queryCreditPayments(ctx context.Context, query string, creditId int) ([]models.CreditPayment, error) {
+	rows, err := r.db.QueryContext(ctx, query, creditId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query credit schedule: %w", err)
+	}
+	defer rows.Close()
+
+	var schedule []models.CreditPayment
+	for rows.Next() {
+		payment, err := scanCreditPayment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan credit payment: %w", err)
+		}
+		schedule = append(schedule, *payment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return schedule, nil
+}
+
+// GetDueCreditPayments возвращает неоплаченные платежи со сроком не позже at.
+func (r *PostgresRepository) GetDueCreditPayments(ctx context.Context, at time.Time) ([]models.DueCreditPayment, error) {
+	query := `
+		SELECT ` + creditPaymentColumns + `, cr.account_id
+		FROM
+			credit_payments cp
+			JOIN credits cr ON cp.credit_id = cr.id
+		WHERE
+			cp.due_date <= $1 AND cp.status IN ('pending', 'overdue')
+		ORDER BY cp.due_date, cp.id
+	`
+
+	return r.queryDueCreditPayments(ctx, query, at.Format(dateLayout))
+}
+
+// GetUpcomingCreditPayments возвращает неоплаченные платежи по кредитам счёта
+// со сроком не позже to, включая просроченные.
+func (r *PostgresRepository) GetUpcomingCreditPayments(ctx context.Context, accountId int, to time.Time) ([]models.DueCreditPayment, error) {
+	query := `
+		SELECT ` + creditPaymentColumns + `, cr.account_id
+		FROM
+			credit_payments cp
+			JOIN credits cr ON cp.credit_id = cr.id
+		WHERE
+			cr.account_id = $1 AND cp.due_date <= $2 AND cp.status IN ('pending', 'overdue')
+		ORDER BY cp.due_date, cp.id
+	`
+
+	return r.queryDueCreditPayments(ctx, query, accountId, to.Format(dateLayout))
+}
+
+func (r *PostgresRepository) queryDueCreditPayments(ctx context.Context, query string, args ...any) ([]models.DueCreditPayment, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due credit payments: %w", err)
+	}
+	defer rows.Close()
+
+	var payments []models.DueCreditPayment
+	for rows.Next() {
+		var accountId int
+		payment, err := scanCreditPayment(extraColumns{rows, []any{&accountId}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan credit payment: %w", err)
+		}
+		payments = append(payments, models.DueCreditPayment{CreditPayment: *payment, AccountId: accountId})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return payments, nil
+}
+
+// PayCreditPayment списывает платёж проводкой entry и отмечает его оплаченным.
+// Если на счёте не хватает денег, ничего не меняется и возвращается ErrInsufficientFunds.
+func (r *PostgresRepository) PayCreditPayment(ctx context.Context, payment models.DueCreditPayment, entry models.JournalEntry) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// Условие по статусу защищает от повторного списания того же платежа
+	result, err := tx.ExecContext(ctx,
+		"UPDATE credit_payments SET status = 'paid', paid_at = NOW() WHERE id = $1 AND status IN ('pending', 'overdue')",
+		payment.Id,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected != 1 {
+		tx.Rollback()
+		return repository.ErrCreditPaymentPaid
+	}
+
+	var transactionId int
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO transactions (account_id, type, amount, fee) VALUES($1, 'credit_payment', $2, 0) RETURNING id",
+		payment.AccountId,
+		payment.Total(),
+	).Scan(&transactionId)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	entry.TransactionId = transactionId
+	if _, err = postJournalEntry(ctx, tx, entry); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = insertTransactionEvent(ctx, tx, models.TransactionEvent{
+		TransactionId: transactionId,
+		Type:          "credit_payment",
+		AccountId:     payment.AccountId,
+		Amount:        payment.Total(),
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE credit_payments SET transaction_id = $1 WHERE id = $2", transactionId, payment.Id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = refreshCreditStatus(ctx, tx, payment.CreditId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MarkCreditPaymentOverdue отмечает платёж просроченным, добавляет к нему пени
+// penalty, начисленные по дату accruedAt, и переводит кредит в overdue.
+func (r *PostgresRepository) MarkCreditPaymentOverdue(ctx context.Context, payment models.DueCreditPayment, penalty models.Money, accruedAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE
+			credit_payments
+		SET
+			status = 'overdue', penalty = penalty + $1, penalty_accrued_at = $2
+		WHERE
+			id = $3 AND status IN ('pending', 'overdue')
+	`, penalty, accruedAt.Format(dateLayout), payment.Id)
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = refreshCreditStatus(ctx, tx, payment.CreditId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RepayCredit выполняет досрочное погашение одной транзакцией: неоплаченные
+// платежи pending, по которым считался новый график, помечаются superseded и
+// остаются в истории, сумма списывается со счёта проводкой entry, график
+// schedule сохраняется следующей версией. Если график успел измениться
+// (платёж списан планировщиком или просрочен, параллельное погашение),
+// возвращается ErrCreditChanged.
+func (r *PostgresRepository) RepayCredit(ctx context.Context, loan models.Loan, repayment models.CreditRepayment, pending []models.CreditPayment, schedule []models.CreditPayment, entry models.JournalEntry) (*models.Loan, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(pending))
+	for _, p := range pending {
+		ids = append(ids, p.Id)
+	}
+
+	// Строки графика блокируются первыми - в том же порядке, что и при списании
+	// платежа. Платёж, списанный после чтения графика, уже не pending: тогда
+	// заменяется меньше строк, чем учтено в новом графике, и его основной долг
+	// был бы списан второй раз.
+	result, err := tx.ExecContext(ctx, `
+		UPDATE
+			credit_payments
+		SET
+			status = 'superseded'
+		WHERE
+			credit_id = $1 AND version = $2 AND status = 'pending' AND id = ANY($3)
+	`, loan.Id, loan.ScheduleVersion, pq.Array(ids))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected != int64(len(ids)) {
+		tx.Rollback()
+		return nil, repository.ErrCreditChanged
+	}
+
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO transactions (account_id, type, amount, fee) VALUES($1, 'credit_prepayment', $2, 0) RETURNING id",
+		loan.AccountId,
+		repayment.Amount,
+	).Scan(&repayment.TransactionId)
+
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	entry.TransactionId = repayment.TransactionId
+	if _, err = postJournalEntry(ctx, tx, entry); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = insertTransactionEvent(ctx, tx, models.TransactionEvent{
+		TransactionId: repayment.TransactionId,
+		Type:          "credit_prepayment",
+		AccountId:     loan.AccountId,
+		Amount:        repayment.Amount,
+	})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	repayment.Version = loan.ScheduleVersion + 1
+
+	result, err = tx.ExecContext(ctx, `
+		UPDATE
+			credits
+		SET
+			schedule_version = $1, monthly_payment = $2, term_months = $3
+		WHERE
+			id = $4 AND schedule_version = $5 AND status = 'active'
+	`, repayment.Version, loan.MonthlyPayment, loan.TermMonths, loan.Id, loan.ScheduleVersion)
+
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected != 1 {
+		tx.Rollback()
+		return nil, repository.ErrCreditChanged
+	}
+
+	if err = insertCreditPayments(ctx, tx, loan.Id, repayment.Version, schedule); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO credit_repayments (credit_id, version, mode, amount, transaction_id) VALUES ($1, $2, $3, $4, $5)",
+		loan.Id,
+		repayment.Version,
+		repayment.Mode,
+		repayment.Amount,
+		repayment.TransactionId,
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = refreshCreditStatus(ctx, tx, loan.Id); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.QueryRowContext(ctx, "SELECT status FROM credits WHERE id = $1", loan.Id).Scan(&loan.Status); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	loan.ScheduleVersion = repayment.Version
+
+	return &loan, nil
+}
+
+func (r *PostgresRepository) GetCreditRepayments(ctx context.Context, creditId int) ([]models.CreditRepayment, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT id, credit_id, version, mode, amount, transaction_id, created_at FROM credit_repayments WHERE credit_id = $1 ORDER BY version",
+		creditId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query credit repayments: %w", err)
+	}
+	defer rows.Close()
+
+	var repayments []models.CreditRepayment
+	for rows.Next() {
+		var repayment models.CreditRepayment
+		err := rows.Scan(
+			&repayment.Id,
+			&repayment.CreditId,
+			&repayment.Version,
+			&repayment.Mode,
+			&repayment.Amount,
+			&repayment.TransactionId,
+			&repayment.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan credit repayment: %w", err)
+		}
+		repayments = append(repayments, repayment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return repayments, nil
+}
+
+// refreshCreditStatus пересчитывает статус кредита по его графику.
+func refreshCreditStatus(ctx context.Context, tx *sql.Tx, creditId int) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE
+			credits
+		SET
+			status = CASE
+				WHEN NOT EXISTS (SELECT 1 FROM credit_payments WHERE credit_id = $1 AND status IN ('pending', 'overdue')) THEN 'paid'
+				WHEN EXISTS (SELECT 1 FROM credit_payments WHERE credit_id = $1 AND status = 'overdue') THEN 'overdue'
+				ELSE 'active'
+			END
+		WHERE
+			id = $1
+	`, creditId)
+	return err
+}
+
+func insertCreditPayments(ctx context.Context, tx *sql.Tx, creditId int, version int, schedule []models.CreditPayment) error {
+	query := `
+		INSERT INTO
+			credit_payments (credit_id, number, due_date, payment, principal, interest, remaining, status, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	for _, p := range schedule {
+		_, err := tx.ExecContext(ctx, query,
+			creditId,
+			p.Number,
+			p.DueDate.Format(dateLayout),
+			p.Payment,
+			p.Principal,
+			p.Interest,
+			p.Remaining,
+			p.Status,
+			version,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scanLoan(row rowScanner) (*models.Loan, error) {
+	var loan models.Loan
+	var transactionId sql.NullInt64
+
+	err := row.Scan(
+		&loan.Id,
+		&loan.UserId,
+		&loan.AccountId,
+		&loan.AccountNumber,
+		&loan.Principal,
+		&loan.Product,
+		&loan.KeyRateBp,
+		&loan.MarginBp,
+		&loan.RateBp,
+		&loan.TermMonths,
+		&loan.ScheduleType,
+		&loan.MonthlyPayment,
+		&loan.Status,
+		&transactionId,
+		&loan.CreatedAt,
+		&loan.ScheduleVersion,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.TransactionId = int(transactionId.Int64)
+
+	return &loan, nil
+}
+
+func scanCreditPayment(row rowScanner) (*models.CreditPayment, error) {
+	var payment models.CreditPayment
+	var paidAt sql.NullTime
+	var penaltyAccruedAt sql.NullTime
+	var transactionId sql.NullInt64
+
+	err := row.Scan(
+		&payment.Id,
+		&payment.CreditId,
+		&payment.Number,
+		&payment.DueDate,
+		&payment.Payment,
+		&payment.Principal,
+		&payment.Interest,
+		&payment.Remaining,
+		&payment.Status,
+		&paidAt,
+		&payment.Penalty,
+		&penaltyAccruedAt,
+		&transactionId,
+		&payment.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if paidAt.Valid {
+		payment.PaidAt = &paidAt.Time
+	}
+	if penaltyAccruedAt.Valid {
+		payment.PenaltyAccruedAt = &penaltyAccruedAt.Time
+	}
+	payment.TransactionId = int(transactionId.Int64)
+
+	return &payment, nil
+}
+
+// extraColumns дочитывает колонки, добавленные к общему списку в конце запроса.
+type extraColumns struct {
+	row   rowScanner
+	extra []any
+}
+
+func (e extraColumns) Scan(dest ...any) error {
+	return e.row.Scan(append(dest, e.extra...)...)
+}
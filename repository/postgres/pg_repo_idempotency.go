@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"uniback/models"
+)
+
+// AcquireIdempotencyKey сохраняет новый ключ в статусе processing. Ключ того же
+// запроса, оставшийся в processing с момента раньше staleBefore, занимается
+// заново. Если ключ уже есть, возвращает сохранённую запись и created = false.
+func (r *PostgresRepository) AcquireIdempotencyKey(ctx context.Context, key models.IdempotencyKey, staleBefore time.Time) (*models.IdempotencyKey, bool, error) {
+	query := `
+		INSERT INTO
+			idempotency_keys (user_id, key, request_hash, status)
+		VALUES ($1, $2, $3, 'processing')
+		ON CONFLICT (user_id, key) DO UPDATE SET
+			created_at = NOW()
+		WHERE
+			idempotency_keys.status = 'processing'
+			AND idempotency_keys.created_at < $4
+			AND idempotency_keys.request_hash = EXCLUDED.request_hash
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query, key.UserId, key.Key, key.RequestHash, staleBefore).Scan(&key.Id, &key.CreatedAt)
+	if err == nil {
+		key.Status = "processing"
+		return &key, true, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+
+	query = `
+		SELECT
+			id, user_id, key, request_hash, status, response_code, response_body, content_type, created_at
+		FROM
+			idempotency_keys
+		WHERE
+			user_id = $1 AND key = $2
+	`
+
+	var stored models.IdempotencyKey
+	var responseCode sql.NullInt64
+
+	err = r.db.QueryRowContext(ctx, query, key.UserId, key.Key).Scan(
+		&stored.Id,
+		&stored.UserId,
+		&stored.Key,
+		&stored.RequestHash,
+		&stored.Status,
+		&responseCode,
+		&stored.ResponseBody,
+		&stored.ContentType,
+		&stored.CreatedAt,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	stored.ResponseCode = int(responseCode.Int64)
+
+	return &stored, false, nil
+}
+
+func (r *PostgresRepository) CompleteIdempotencyKey(ctx context.Context, id int, code int, body []byte, contentType string) error {
+	query := `
+		UPDATE
+			idempotency_keys
+		SET
+			status = 'completed', response_code = $1, response_body = $2, content_type = $3
+		WHERE
+			id = $4
+	`
+
+	_, err := r.db.ExecContext(ctx, query, code, body, contentType, id)
+
+	return err
+}
+
+func (r *PostgresRepository) DeleteIdempotencyKey(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE id = $1", id)
+
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys удаляет ключи, занятые раньше before.
+func (r *PostgresRepository) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE created_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete idempotency keys: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), nil
+}
@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"context"
+	"hash/fnv"
+	"uniback/utils"
+)
+
+func (r *PostgresRepository) AcquireJobLock(ctx context.Context, job string) (func(), bool, error) {
+	// Session-level lock живёт, пока жив конкретный коннект, поэтому берём его из пула отдельно
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var acquired bool
+	key := jobLockKey(job)
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+
+	if !acquired {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	unlock := func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key); err != nil {
+			utils.GlobalLogger().Error("Can't release job lock %s: %w", job, err)
+		}
+		conn.Close()
+	}
+
+	return unlock, true, nil
+}
+
+func (r *PostgresRepository) StartJobRun(ctx context.Context, job string) (int, error) {
+	var id int
+	err := r.db.QueryRowContext(ctx, "INSERT INTO job_runs (job, status) VALUES ($1, 'running') RETURNING id", job).Scan(&id)
+	return id, err
+}
+
+func (r *PostgresRepository) FinishJobRun(ctx context.Context, id int, status string, processed int, errText string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE job_runs SET status = $1, processed = $2, error = $3, finished_at = NOW() WHERE id = $4",
+		status, processed, errText, id,
+	)
+	return err
+}
+
+func jobLockKey(job string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("uniback:job:" + job))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"uniback/models"
+)
+
+// GetJwtKeys возвращает текущий ключ и ключи, выведенные из оборота после
+// retiredAfter, старые сначала.
+func (r *PostgresRepository) GetJwtKeys(ctx context.Context, retiredAfter time.Time) ([]models.JwtKey, error) {
+	query := `
+		SELECT
+			kid, alg, private_key, created_at, activates_at, retired_at
+		FROM
+			jwt_keys
+		WHERE
+			retired_at IS NULL OR retired_at > $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, retiredAfter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jwt keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []models.JwtKey
+	for rows.Next() {
+		var key models.JwtKey
+		if err := rows.Scan(&key.Kid, &key.Alg, &key.PrivateKey, &key.CreatedAt, &key.ActivatesAt, &key.RetiredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan jwt key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return keys, nil
+}
+
+// RotateJwtKey сохраняет key последним ключом, если последнего нет, он создан
+// до createdBefore или у него другой алгоритм. Прежний ключ выводится из
+// оборота в key.ActivatesAt, когда новый начинает подписывать. Иначе ничего
+// не меняет и возвращает false: ключ уже сменил другой экземпляр приложения.
+func (r *PostgresRepository) RotateJwtKey(ctx context.Context, key models.JwtKey, createdBefore time.Time) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	// Экземпляры, стартующие одновременно, не должны создать по своему ключу
+	if _, err = tx.ExecContext(ctx, "LOCK TABLE jwt_keys IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	var alg string
+	var createdAt time.Time
+	err = tx.QueryRowContext(ctx,
+		"SELECT alg, created_at FROM jwt_keys WHERE retired_at IS NULL",
+	).Scan(&alg, &createdAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		return false, err
+	}
+
+	if err == nil && alg == key.Alg && createdAt.After(createdBefore) {
+		tx.Rollback()
+		return false, nil
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE jwt_keys SET retired_at = $1 WHERE retired_at IS NULL", key.ActivatesAt); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO jwt_keys (kid, alg, private_key, activates_at) VALUES ($1, $2, $3, $4)",
+		key.Kid, key.Alg, key.PrivateKey, key.ActivatesAt,
+	)
+	if err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("failed to save jwt key: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+	"time"
+	"uniback/models"
+)
+
+// GetLatestKeyRate возвращает ставку, действующую на дату at.
+func (r *PostgresRepository) GetLatestKeyRate(ctx context.Context, at time.Time) (*models.KeyRate, error) {
+	query := `
+		SELECT
+			date, rate_bp, fetched_at
+		FROM
+			key_rates
+		WHERE
+			date <= $1
+		ORDER BY date DESC
+		LIMIT 1
+	`
+
+	var rate models.KeyRate
+	err := r.db.QueryRowContext(ctx, query, at.Format(dateLayout)).Scan(&rate.Date, &rate.RateBp, &rate.FetchedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rate, nil
+}
+
+func (r *PostgresRepository) SaveKeyRates(ctx context.Context, rates []models.KeyRate) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO
+			key_rates (date, rate_bp, fetched_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (date) DO UPDATE SET rate_bp = EXCLUDED.rate_bp, fetched_at = EXCLUDED.fetched_at
+	`
+
+	for _, rate := range rates {
+		if _, err := tx.ExecContext(ctx, query, rate.Date.Format(dateLayout), rate.RateBp); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
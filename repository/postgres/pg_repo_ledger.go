@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"uniback/models"
+)
+
+// postJournalEntry записывает проводку в главную книгу и обновляет кэш
+// балансов accounts.balance. Должна вызываться внутри транзакции tx.
+func postJournalEntry(ctx context.Context, tx *sql.Tx, entry models.JournalEntry) (int, error) {
+	if err := entry.Validate(); err != nil {
+		return 0, err
+	}
+
+	deltas := entry.AccountDeltas()
+
+	ids := make([]int, 0, len(deltas))
+	for id := range deltas {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	locked, err := lockAccounts(ctx, tx, ids...)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := applyBalanceDelta(ctx, tx, locked[id], deltas[id]); err != nil {
+			return 0, err
+		}
+	}
+
+	var transactionId sql.NullInt64
+	if entry.TransactionId != 0 {
+		transactionId = sql.NullInt64{Int64: int64(entry.TransactionId), Valid: true}
+	}
+
+	var entryId int
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO journal_entries (transaction_id, description) VALUES($1, $2) RETURNING id",
+		transactionId, entry.Description,
+	).Scan(&entryId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create journal entry: %w", err)
+	}
+
+	for _, p := range entry.Postings {
+		ledgerId, err := ledgerAccountId(ctx, tx, p)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO postings (entry_id, ledger_account_id, direction, amount) VALUES($1, $2, $3, $4)",
+			entryId, ledgerId, p.Direction, p.Amount,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create posting: %w", err)
+		}
+	}
+
+	return entryId, nil
+}
+
+// ledgerAccountId находит счёт главной книги. Счета клиентов заводятся в книге
+// при первой проводке.
+func ledgerAccountId(ctx context.Context, tx *sql.Tx, p models.Posting) (int, error) {
+	var id int
+
+	if p.AccountId != 0 {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO
+				ledger_accounts (code, kind, account_id)
+			VALUES ('customer:' || $1::int, 'liability', $1)
+			ON CONFLICT (account_id) DO UPDATE SET account_id = EXCLUDED.account_id
+			RETURNING id
+		`, p.AccountId).Scan(&id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get ledger account for account %d: %w", p.AccountId, err)
+		}
+		return id, nil
+	}
+
+	err := tx.QueryRowContext(ctx, "SELECT id FROM ledger_accounts WHERE code = $1", p.LedgerCode).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get ledger account %s: %w", p.LedgerCode, err)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,200 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"uniback/models"
+)
+
+func (r *PostgresRepository) CreateLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO
+			login_attempts (username, user_id, ip, user_agent, result)
+		VALUES ($1, $2, $3, $4, $5)
+	`,
+		attempt.Username,
+		attempt.UserId,
+		attempt.Ip,
+		attempt.UserAgent,
+		attempt.Result,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save login attempt: %w", err)
+	}
+
+	return nil
+}
+
+// GetLoginBlockedUntil - до какого времени запрещены входы с именем username
+// или с адреса ip. nil - запрета не было.
+func (r *PostgresRepository) GetLoginBlockedUntil(ctx context.Context, username string, ip string) (*time.Time, error) {
+	var blockedUntil sql.NullTime
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			MAX(blocked_until)
+		FROM
+			login_throttle
+		WHERE
+			(scope = 'user' AND key = $1) OR (scope = 'ip' AND key = $2)
+	`, username, ip).Scan(&blockedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login block: %w", err)
+	}
+
+	if !blockedUntil.Valid {
+		return nil, nil
+	}
+	return &blockedUntil.Time, nil
+}
+
+// GetThrottleBlockedUntil - до какого времени запрещены попытки по ключу key. nil - запрета не было.
+func (r *PostgresRepository) GetThrottleBlockedUntil(ctx context.Context, scope string, key string) (*time.Time, error) {
+	var blockedUntil sql.NullTime
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			blocked_until
+		FROM
+			login_throttle
+		WHERE
+			scope = $1 AND key = $2
+	`, scope, key).Scan(&blockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get throttle block: %w", err)
+	}
+
+	if !blockedUntil.Valid {
+		return nil, nil
+	}
+	return &blockedUntil.Time, nil
+}
+
+// RecordLoginFailure увеличивает счётчик неудачных входов и возвращает его.
+// Если прошлая неудача была раньше resetBefore, счёт начинается заново.
+func (r *PostgresRepository) RecordLoginFailure(ctx context.Context, scope string, key string, at time.Time, resetBefore time.Time) (int, error) {
+	var failures int
+
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO
+			login_throttle (scope, key, failures, last_failure_at)
+		VALUES ($1, $2, 1, $3)
+		ON CONFLICT (scope, key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttle.last_failure_at < $4 THEN 1
+				ELSE login_throttle.failures + 1
+			END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures
+	`, scope, key, at, resetBefore).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	return failures, nil
+}
+
+// BlockLogin запрещает входы до until.
+func (r *PostgresRepository) BlockLogin(ctx context.Context, scope string, key string, until time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE
+			login_throttle
+		SET
+			blocked_until = $3
+		WHERE
+			scope = $1 AND key = $2
+	`, scope, key, until)
+	if err != nil {
+		return fmt.Errorf("failed to block login: %w", err)
+	}
+
+	return nil
+}
+
+// LockLogin блокирует вход пользователя до until и обнуляет счётчик, чтобы
+// блокировка не продлевалась каждой следующей неудачей. Новый токен
+// разблокировки сохраняется, только если письмо о блокировке не отправлялось
+// после notifiedBefore, true - письмо нужно отправить. Иначе остаётся
+// токен из прошлого письма.
+func (r *PostgresRepository) LockLogin(ctx context.Context, key string, until time.Time, unlockHash []byte, notifiedBefore time.Time, at time.Time) (bool, error) {
+	var notify bool
+
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE
+			login_throttle
+		SET
+			failures = 0,
+			blocked_until = $2,
+			unlock_token_hash = CASE
+				WHEN lock_notified_at IS NULL OR lock_notified_at < $4 THEN $3
+				ELSE unlock_token_hash
+			END,
+			lock_notified_at = CASE
+				WHEN lock_notified_at IS NULL OR lock_notified_at < $4 THEN $5
+				ELSE lock_notified_at
+			END
+		WHERE
+			scope = 'user' AND key = $1
+		RETURNING lock_notified_at = $5
+	`, key, until, unlockHash, notifiedBefore, at).Scan(&notify)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock login: %w", err)
+	}
+
+	return notify, nil
+}
+
+func (r *PostgresRepository) ResetLoginFailures(ctx context.Context, scope string, key string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM login_throttle WHERE scope = $1 AND key = $2", scope, key)
+	if err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+
+	return nil
+}
+
+// UnlockLogin снимает блокировку пользователя по токену из письма. false -
+// токен неверный или блокировка уже истекла. Время письма остаётся, чтобы
+// новая блокировка в том же окне не отправляла ещё одно письмо.
+func (r *PostgresRepository) UnlockLogin(ctx context.Context, hash []byte, at time.Time) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE
+			login_throttle
+		SET
+			failures = 0,
+			blocked_until = NULL,
+			unlock_token_hash = NULL
+		WHERE
+			scope = 'user' AND unlock_token_hash = $1 AND blocked_until > $2
+	`, hash, at)
+	if err != nil {
+		return false, fmt.Errorf("failed to unlock login: %w", err)
+	}
+
+	return affectedOne(result)
+}
+
+// DeleteStaleLoginThrottles удаляет счётчики без неудач после failedBefore и без действующего запрета.
+func (r *PostgresRepository) DeleteStaleLoginThrottles(ctx context.Context, failedBefore time.Time, at time.Time) (int, error) {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM
+			login_throttle
+		WHERE
+			last_failure_at < $1 AND (blocked_until IS NULL OR blocked_until < $2)
+	`, failedBefore, at)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete login throttles: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), nil
+}
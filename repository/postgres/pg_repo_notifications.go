@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"uniback/models"
+)
+
+// RememberLoginIp запоминает IP входа пользователя. isNew = true, если с этого
+// адреса раньше не входили, а другие адреса уже известны: о самом первом входе
+// после регистрации не сообщаем.
+func (r *PostgresRepository) RememberLoginIp(ctx context.Context, userId int, ip string) (bool, error) {
+	query := `
+		WITH known AS (
+			SELECT COUNT(*) AS n FROM user_login_ips WHERE user_id = $1
+		), saved AS (
+			INSERT INTO user_login_ips (user_id, ip)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id, ip) DO UPDATE SET last_seen_at = NOW()
+			RETURNING (xmax = 0) AS inserted
+		)
+		SELECT saved.inserted AND known.n > 0 FROM saved, known
+	`
+
+	var isNew bool
+	if err := r.db.QueryRowContext(ctx, query, userId, ip).Scan(&isNew); err != nil {
+		return false, fmt.Errorf("failed to save login ip: %w", err)
+	}
+
+	return isNew, nil
+}
+
+// GetAccountOwner возвращает владельца счёта без хэша пароля.
+func (r *PostgresRepository) GetAccountOwner(ctx context.Context, accountId int) (*models.User, error) {
+	query := `
+		SELECT
+			u.id, u.username, u.email, u.phone
+		FROM
+			users u
+			JOIN accounts a ON a.user_id = u.id
+		WHERE a.id = $1
+	`
+
+	var user models.User
+	err := r.db.QueryRowContext(ctx, query, accountId).Scan(&user.ID, &user.Name, &user.Email, &user.Phone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account owner: %w", err)
+	}
+
+	return &user, nil
+}
+
+// GetCreditReminders возвращает неоплаченные платежи со сроком не позже to,
+// о которых ещё не напоминали.
+func (r *PostgresRepository) GetCreditReminders(ctx context.Context, to time.Time) ([]models.CreditReminder, error) {
+	query := `
+		SELECT ` + creditPaymentColumns + `, cr.account_id, a.account_number, u.username, u.email
+		FROM
+			credit_payments cp
+			JOIN credits cr ON cp.credit_id = cr.id
+			JOIN accounts a ON cr.account_id = a.id
+			JOIN users u ON a.user_id = u.id
+		WHERE
+			cp.due_date <= $1 AND cp.status = 'pending' AND cp.reminded_at IS NULL
+		ORDER BY cp.due_date, cp.id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, to.Format(dateLayout))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query credit reminders: %w", err)
+	}
+	defer rows.Close()
+
+	var reminders []models.CreditReminder
+	for rows.Next() {
+		var reminder models.CreditReminder
+		payment, err := scanCreditPayment(extraColumns{rows, []any{
+			&reminder.AccountId,
+			&reminder.AccountNumber,
+			&reminder.Username,
+			&reminder.Email,
+		}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan credit reminder: %w", err)
+		}
+		reminder.CreditPayment = *payment
+		reminders = append(reminders, reminder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return reminders, nil
+}
+
+func (r *PostgresRepository) MarkCreditPaymentReminded(ctx context.Context, paymentId int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE credit_payments SET reminded_at = NOW() WHERE id = $1`, paymentId)
+	if err != nil {
+		return fmt.Errorf("failed to mark credit payment reminded: %w", err)
+	}
+	return nil
+}
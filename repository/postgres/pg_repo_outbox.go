@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+	"uniback/models"
+
+	"github.com/lib/pq"
+)
+
+// insertOutboxEvent пишет событие в outbox в транзакции tx, вместе с
+// изменением, которое оно описывает.
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, event string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("can't encode %s event: %w", event, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO outbox (event, payload) VALUES ($1, $2)", event, data)
+	if err != nil {
+		return fmt.Errorf("can't save %s event: %w", event, err)
+	}
+
+	return nil
+}
+
+// ClaimOutboxEvents забирает до limit готовых к отправке событий. Строки
+// берутся с SKIP LOCKED, поэтому несколько диспетчеров не получат одно событие,
+// а next_attempt_at сдвигается на lease: если процесс упадёт во время доставки,
+// событие вернётся в очередь после lease.
+func (r *PostgresRepository) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	query := `
+		WITH claimed AS (
+			SELECT id
+			FROM outbox
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE outbox o
+		SET
+			attempts = o.attempts + 1,
+			next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond'
+		FROM claimed
+		WHERE o.id = claimed.id
+		RETURNING
+			o.id, o.event, o.payload, o.status, o.attempts, o.delivered_sinks,
+			o.next_attempt_at, o.last_error, o.created_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.OutboxEvent
+	for rows.Next() {
+		var event models.OutboxEvent
+		err := rows.Scan(
+			&event.Id,
+			&event.Event,
+			&event.Payload,
+			&event.Status,
+			&event.Attempts,
+			pq.Array(&event.Delivered),
+			&event.NextAttemptAt,
+			&event.LastError,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	// UPDATE ... RETURNING не сохраняет порядок подзапроса
+	sort.Slice(events, func(i, j int) bool { return events[i].Id < events[j].Id })
+
+	return events, nil
+}
+
+func (r *PostgresRepository) CompleteOutboxEvent(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE outbox SET status = 'done', last_error = '', processed_at = NOW() WHERE id = $1",
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to complete outbox event %d: %w", id, err)
+	}
+	return nil
+}
+
+// FailOutboxEvent запоминает неудачную попытку: delivered - получатели, уже
+// принявшие событие. Если dead, событие больше не отправляется.
+func (r *PostgresRepository) FailOutboxEvent(ctx context.Context, id int64, delivered []string, nextAttemptAt time.Time, dead bool, errText string) error {
+	if delivered == nil {
+		delivered = []string{}
+	}
+
+	status := models.OutboxPending
+	var processedAt any
+	if dead {
+		status = models.OutboxDead
+		processedAt = time.Now()
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE
+			outbox
+		SET
+			status = $2, delivered_sinks = $3, next_attempt_at = $4, last_error = $5, processed_at = $6
+		WHERE
+			id = $1
+	`, id, status, pq.Array(delivered), nextAttemptAt, errText, processedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save outbox event %d attempt: %w", id, err)
+	}
+	return nil
+}
+
+// insertTransactionEvent дополняет событие номером и остатком счёта операции
+// после проводки и пишет его в outbox.
+func insertTransactionEvent(ctx context.Context, tx *sql.Tx, event models.TransactionEvent) error {
+	err := tx.QueryRowContext(ctx, "SELECT account_number, balance FROM accounts WHERE id = $1", event.AccountId).Scan(&event.AccountNumber, &event.Balance)
+	if err != nil {
+		return fmt.Errorf("can't get balance for transaction event: %w", err)
+	}
+	event.CreatedAt = time.Now()
+
+	return insertOutboxEvent(ctx, tx, models.EventTransactionCreated, event)
+}
@@ -0,0 +1,186 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"uniback/models"
+	"uniback/repository"
+)
+
+const pendingTransferColumns = `
+	p.id, p.user_id, p.source_account_id, s.account_number, p.dest_account_id, d.account_number,
+	p.amount, p.reason, p.code_hash, p.status, p.attempts, p.error, p.expires_at, p.created_at, p.confirmed_at
+`
+
+// HasTransferredTo - переводил ли пользователь раньше на счёт destAccountId
+// с любого из своих счетов.
+func (r *PostgresRepository) HasTransferredTo(ctx context.Context, userId int, destAccountId int) (bool, error) {
+	var exists bool
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT
+				1
+			FROM
+				transaction_trasfers tt
+				JOIN transactions t ON t.id = tt.trans_id
+				JOIN accounts a ON a.id = t.account_id
+			WHERE
+				tt.dest_account_id = $2 AND a.user_id = $1
+		)
+	`, userId, destAccountId).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check transfer recipient: %w", err)
+	}
+
+	return exists, nil
+}
+
+// CreatePendingTransfer сохраняет перевод до подтверждения. Строка пользователя
+// блокируется, чтобы параллельные запросы не превысили maxOpen.
+func (r *PostgresRepository) CreatePendingTransfer(ctx context.Context, transfer models.PendingTransfer, maxOpen int) (*models.PendingTransfer, error) {
+	transfer.Status = models.PendingTransferPending
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, "SELECT id FROM users WHERE id = $1 FOR UPDATE", transfer.UserId)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	var open int
+	err = tx.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*)
+		FROM
+			pending_transfers
+		WHERE
+			user_id = $1 AND status = 'pending' AND expires_at > NOW()
+	`, transfer.UserId).Scan(&open)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to count pending transfers: %w", err)
+	}
+
+	if open >= maxOpen {
+		tx.Rollback()
+		return nil, repository.ErrTooManyPending
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO
+			pending_transfers (user_id, source_account_id, dest_account_id, amount, reason, code_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`,
+		transfer.UserId,
+		transfer.SourceAccountId,
+		transfer.DestAccountId,
+		transfer.Amount,
+		transfer.Reason,
+		transfer.CodeHash,
+		transfer.ExpiresAt,
+	).Scan(&transfer.Id, &transfer.CreatedAt)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create pending transfer: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &transfer, nil
+}
+
+// GetPendingTransfer возвращает перевод id пользователя username, чужой перевод не находится.
+func (r *PostgresRepository) GetPendingTransfer(ctx context.Context, id int64, username string) (*models.PendingTransfer, error) {
+	query := `
+		SELECT` + pendingTransferColumns + `
+		FROM
+			pending_transfers p
+			JOIN users u ON u.id = p.user_id
+			JOIN accounts s ON s.id = p.source_account_id
+			JOIN accounts d ON d.id = p.dest_account_id
+		WHERE
+			p.id = $1 AND u.username = $2
+	`
+
+	return scanPendingTransfer(r.db.QueryRowContext(ctx, query, id, username))
+}
+
+// AttemptPendingTransfer засчитывает попытку ввода кода. Если перевод уже не
+// ожидает подтверждения, истёк или исчерпал maxAttempts попыток, возвращается
+// sql.ErrNoRows.
+func (r *PostgresRepository) AttemptPendingTransfer(ctx context.Context, id int64, maxAttempts int) (*models.PendingTransfer, error) {
+	query := `
+		WITH p AS (
+			UPDATE
+				pending_transfers
+			SET
+				attempts = attempts + 1
+			WHERE
+				id = $1 AND status = 'pending' AND expires_at > NOW() AND attempts < $2
+			RETURNING *
+		)
+		SELECT` + pendingTransferColumns + `
+		FROM
+			p
+			JOIN accounts s ON s.id = p.source_account_id
+			JOIN accounts d ON d.id = p.dest_account_id
+	`
+
+	return scanPendingTransfer(r.db.QueryRowContext(ctx, query, id, maxAttempts))
+}
+
+// SetPendingTransferStatus переводит перевод из статуса from в to. Если статус
+// уже сменил параллельный запрос, возвращается sql.ErrNoRows.
+func (r *PostgresRepository) SetPendingTransferStatus(ctx context.Context, id int64, from string, to string, errText string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE
+			pending_transfers
+		SET
+			status = $3,
+			error = $4,
+			confirmed_at = CASE WHEN $5 THEN NOW() ELSE confirmed_at END
+		WHERE
+			id = $1 AND status = $2
+	`, id, from, to, errText, to == models.PendingTransferConfirmed)
+	if err != nil {
+		return fmt.Errorf("failed to update pending transfer: %w", err)
+	}
+
+	return expectAffected(result)
+}
+
+func scanPendingTransfer(row *sql.Row) (*models.PendingTransfer, error) {
+	var transfer models.PendingTransfer
+
+	err := row.Scan(
+		&transfer.Id,
+		&transfer.UserId,
+		&transfer.SourceAccountId,
+		&transfer.SourceAccountNumber,
+		&transfer.DestAccountId,
+		&transfer.DestAccountNumber,
+		&transfer.Amount,
+		&transfer.Reason,
+		&transfer.CodeHash,
+		&transfer.Status,
+		&transfer.Attempts,
+		&transfer.Error,
+		&transfer.ExpiresAt,
+		&transfer.CreatedAt,
+		&transfer.ConfirmedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transfer, nil
+}
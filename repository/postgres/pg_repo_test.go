@@ -0,0 +1,1295 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"uniback/dto"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/service"
+	"uniback/utils"
+
+	"github.com/lib/pq"
+)
+
+// Тесты с БД запускаются только при UNIBACK_PG_TEST=1, параметры подключения
+// берутся из тех же переменных окружения, что и у приложения (DB_HOST, DB_PORT ...).
+func testRepository(t *testing.T) *PostgresRepository {
+	t.Helper()
+
+	if os.Getenv("UNIBACK_PG_TEST") != "1" {
+		t.Skip("UNIBACK_PG_TEST is not set, skip Postgres tests")
+	}
+
+	repo := New(context.Background(), PgConfigFromConfig(*utils.CfgLoad("UniBackTest")))
+	if repo == nil {
+		t.Fatalf("Can't connect to test DB")
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	return repo
+}
+
+func createTestAccount(t *testing.T, repo *PostgresRepository, userId int, balance models.Money) *models.Account {
+	t.Helper()
+	ctx := context.Background()
+
+	number := models.GenerateAccount()
+	if _, err := repo.CreateAccount(ctx, models.Account{
+		UserId:        userId,
+		AccountNumber: number,
+		AccountType:   "debit",
+		Status:        "active",
+	}); err != nil {
+		t.Fatalf("Can't create account: %v", err)
+	}
+
+	acc, err := repo.GetAccountByNumber(ctx, number)
+	if err != nil {
+		t.Fatalf("Can't read account: %v", err)
+	}
+
+	acc, err = service.NewTransactionService(repo).DepositTransaction(ctx, *acc, balance)
+	if err != nil {
+		t.Fatalf("Can't deposit initial balance: %v", err)
+	}
+
+	return acc
+}
+
+func createTestUser(t *testing.T, repo *PostgresRepository) int {
+	t.Helper()
+	ctx := context.Background()
+
+	suffix := fmt.Sprintf("%d%04d", time.Now().UnixNano(), rand.Intn(10000))
+	username := "test_" + suffix
+	err := repo.CreateUser(ctx, dto.UserCreateRequest{
+		Username: username,
+		Password: "not-a-hash",
+		Email:    username + "@example.com",
+		Phone:    "+7" + suffix[len(suffix)-10:],
+	})
+	if err != nil {
+		t.Fatalf("Can't create user: %v", err)
+	}
+
+	userId, err := repo.GetUserId(ctx, username)
+	if err != nil {
+		t.Fatalf("Can't get user id: %v", err)
+	}
+
+	return userId
+}
+
+func testUsername(t *testing.T, repo *PostgresRepository, userId int) string {
+	t.Helper()
+
+	var username string
+	if err := repo.db.QueryRowContext(context.Background(), "SELECT username FROM users WHERE id = $1", userId).Scan(&username); err != nil {
+		t.Fatalf("Can't read username: %v", err)
+	}
+
+	return username
+}
+
+func TestConcurrentTransactionsKeepMoney(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	trsService := service.NewTransactionService(repo)
+
+	userId := createTestUser(t, repo)
+	initial := models.NewMoney(100000)
+	accA := createTestAccount(t, repo, userId, initial)
+	accB := createTestAccount(t, repo, userId, initial)
+
+	const workers = 32
+	const opsPerWorker = 40
+	step := models.NewMoney(1700)
+
+	var mtx sync.Mutex
+	withdrawn := models.NewMoney(0)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < opsPerWorker; i++ {
+				// Снимки счетов намеренно устаревшие: баланс должен считаться в БД.
+				// Баланс снимка большой, чтобы сервис не отказывал заранее.
+				var err error
+				switch (w + i) % 3 {
+				case 0:
+					_, err = trsService.TransferTransaction(ctx, *accA, *accB, step)
+				case 1:
+					_, err = trsService.TransferTransaction(ctx, *accB, *accA, step)
+				case 2:
+					_, err = trsService.WithdrawalTransaction(ctx, *accA, step)
+					if err == nil {
+						mtx.Lock()
+						withdrawn = withdrawn.Add(step)
+						mtx.Unlock()
+					}
+				}
+
+				if err != nil && !errors.Is(err, repository.ErrInsufficientFunds) {
+					t.Errorf("Unexpected transaction error: %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	finalA, err := repo.GetAccountByNumber(ctx, accA.AccountNumber)
+	if err != nil {
+		t.Fatalf("Can't read account A: %v", err)
+	}
+
+	finalB, err := repo.GetAccountByNumber(ctx, accB.AccountNumber)
+	if err != nil {
+		t.Fatalf("Can't read account B: %v", err)
+	}
+
+	if finalA.Balance.IsNegative() || finalB.Balance.IsNegative() {
+		t.Errorf("Expected non negative balances, but %s and %s", finalA.Balance, finalB.Balance)
+	}
+
+	total := finalA.Balance.Add(finalB.Balance).Add(withdrawn)
+	if total.Cmp(initial.Add(initial)) != 0 {
+		t.Errorf("Expected %s in total, but %s (A = %s, B = %s, withdrawn = %s)",
+			initial.Add(initial), total, finalA.Balance, finalB.Balance, withdrawn)
+	}
+
+	var mismatches int
+	err = repo.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM account_balance_mismatches WHERE account_id = ANY($1)",
+		pq.Array([]int{accA.Id, accB.Id}),
+	).Scan(&mismatches)
+	if err != nil {
+		t.Fatalf("Can't reconcile ledger: %v", err)
+	}
+
+	if mismatches != 0 {
+		t.Errorf("Expected cached balances to match the ledger, but %d mismatches", mismatches)
+	}
+}
+
+func TestAccountTransactionsHistory(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	trsService := service.NewTransactionService(repo)
+
+	userId := createTestUser(t, repo)
+	src := createTestAccount(t, repo, userId, models.NewMoney(50000))
+	dest := createTestAccount(t, repo, userId, models.NewMoney(100))
+
+	for i := 0; i < 3; i++ {
+		if _, err := trsService.TransferTransaction(ctx, *src, *dest, models.NewMoney(1000)); err != nil {
+			t.Fatalf("Transfer error: %v", err)
+		}
+	}
+
+	incoming, err := repo.GetAccountTransactions(ctx, dest.Id, models.TransactionFilter{Direction: "in", Type: "transfer"})
+	if err != nil {
+		t.Fatalf("History error: %v", err)
+	}
+
+	if len(incoming) != 3 || incoming[0].CounterpartyAccount != src.AccountNumber {
+		t.Errorf("Expected 3 incoming transfers from %s, but %+v", src.AccountNumber, incoming)
+	}
+
+	firstPage, err := repo.GetAccountTransactions(ctx, src.Id, models.TransactionFilter{Limit: 2})
+	if err != nil || len(firstPage) != 2 {
+		t.Fatalf("Expected first page with 2 rows, but %d (%v)", len(firstPage), err)
+	}
+
+	last := firstPage[len(firstPage)-1]
+	secondPage, err := repo.GetAccountTransactions(ctx, src.Id, models.TransactionFilter{
+		After: &models.TransactionCursor{Time: last.Time, Id: last.Id},
+		Limit: 10,
+	})
+	if err != nil {
+		t.Fatalf("History error: %v", err)
+	}
+
+	// 1 пополнение + 3 перевода
+	if len(firstPage)+len(secondPage) != 4 {
+		t.Errorf("Expected 4 transactions on both pages, but %d", len(firstPage)+len(secondPage))
+	}
+
+	for _, trs := range secondPage {
+		if trs.Id == firstPage[0].Id || trs.Id == firstPage[1].Id {
+			t.Errorf("Transaction %d is on both pages", trs.Id)
+		}
+	}
+}
+
+func TestCardHoldLifecycle(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	trsService := service.NewTransactionService(repo)
+
+	userId := createTestUser(t, repo)
+	acc := createTestAccount(t, repo, userId, models.NewMoney(100000))
+
+	numberHmac := []byte(fmt.Sprintf("test-card-%d", acc.Id))
+	_, err := repo.CreateNewCard(ctx, models.Card{
+		AccountId:  acc.Id,
+		Number:     []byte("encrypted"),
+		NumberHmac: numberHmac,
+		Expiry:     []byte("07/30"),
+		Cvv:        []byte("123"),
+		CreatedAt:  time.Now(),
+	}, userId)
+	if err != nil {
+		t.Fatalf("Can't create card: %v", err)
+	}
+
+	if exists, err := repo.IsCardExists(ctx, numberHmac); err != nil || !exists {
+		t.Fatalf("Expected card to be found by number index (%v)", err)
+	}
+
+	card, err := repo.GetCardByNumberHmac(ctx, numberHmac)
+	if err != nil {
+		t.Fatalf("Can't read card: %v", err)
+	}
+
+	hold, err := trsService.AuthorizeCardPayment(ctx, *card, *acc, userId, models.NewMoney(60000), "Test shop")
+	if err != nil {
+		t.Fatalf("Authorize error: %v", err)
+	}
+
+	// Заблокированные деньги нельзя снять
+	if _, err := trsService.WithdrawalTransaction(ctx, *acc, models.NewMoney(50000)); !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Errorf("Expected insufficient funds while hold is active, but %v", err)
+	}
+
+	hold, err = trsService.CaptureCardPayment(ctx, *hold, models.NewMoney(30000))
+	if err != nil {
+		t.Fatalf("Capture error: %v", err)
+	}
+
+	if hold.Status != "captured" || hold.TransactionId == 0 {
+		t.Errorf("Expected captured hold with transaction, but %+v", hold)
+	}
+
+	if trs := lastTransactionEvent(t, repo, acc.Id); trs.Type != "card_payment" || trs.TransactionId != hold.TransactionId || trs.Amount.String() != "300.00" {
+		t.Errorf("Wrong card payment event %+v", trs)
+	}
+
+	if _, err := trsService.CaptureCardPayment(ctx, *hold, models.NewMoney(100)); !errors.Is(err, repository.ErrHoldNotActive) {
+		t.Errorf("Expected second capture to fail, but %v", err)
+	}
+
+	acc, err = repo.GetAccountByNumber(ctx, acc.AccountNumber)
+	if err != nil {
+		t.Fatalf("Can't read account: %v", err)
+	}
+
+	// Остаток холда освобождён после частичного списания
+	if acc.Balance.String() != "700.00" {
+		t.Errorf("Expected balance 700.00 after capture, but %s", acc.Balance)
+	}
+
+	if _, err := trsService.WithdrawalTransaction(ctx, *acc, models.NewMoney(50000)); err != nil {
+		t.Errorf("Expected withdrawal after capture, but %v", err)
+	}
+}
+
+func TestCardLifecycle(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	userId := createTestUser(t, repo)
+	acc := createTestAccount(t, repo, userId, models.NewMoney(100))
+
+	card, err := repo.CreateNewCard(ctx, models.Card{
+		AccountId:  acc.Id,
+		Number:     []byte("encrypted"),
+		NumberHmac: []byte(fmt.Sprintf("lifecycle-card-%d", acc.Id)),
+		Expiry:     []byte("07/30"),
+		Cvv:        []byte("123"),
+		CreatedAt:  time.Now(),
+	}, userId)
+	if err != nil {
+		t.Fatalf("Can't create card: %v", err)
+	}
+
+	if card, err = repo.UpdateCardStatus(ctx, card.Id, models.CardBlocked, userId, "test"); err != nil || card.Status != models.CardBlocked {
+		t.Fatalf("Block error: %v", err)
+	}
+
+	if _, err = repo.UpdateCardStatus(ctx, card.Id, models.CardBlocked, userId, "test"); !errors.Is(err, repository.ErrCardStatus) {
+		t.Errorf("Expected second block to fail, but %v", err)
+	}
+
+	newCard, err := repo.ReissueCard(ctx, card.Id, models.Card{
+		Number:     []byte("encrypted"),
+		NumberHmac: []byte(fmt.Sprintf("lifecycle-card-%d-new", acc.Id)),
+		Expiry:     []byte("07/30"),
+		Cvv:        []byte("321"),
+		CreatedAt:  time.Now(),
+	}, userId)
+	if err != nil {
+		t.Fatalf("Reissue error: %v", err)
+	}
+
+	if newCard.AccountId != acc.Id || newCard.ReissuedFrom != card.Id || newCard.Status != models.CardActive {
+		t.Errorf("Wrong reissued card: %+v", newCard)
+	}
+
+	if _, err = repo.UpdateCardStatus(ctx, card.Id, models.CardActive, userId, "test"); !errors.Is(err, repository.ErrCardStatus) {
+		t.Errorf("Expected lost card can't be unblocked, but %v", err)
+	}
+
+	events, err := repo.GetCardEvents(ctx, card.Id)
+	if err != nil {
+		t.Fatalf("Events error: %v", err)
+	}
+
+	// issued -> blocked -> lost
+	if len(events) != 3 || events[2].OldStatus != models.CardBlocked || events[2].NewStatus != models.CardLost {
+		t.Errorf("Wrong card events: %+v", events)
+	}
+}
+
+func TestIssueCredit(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	userId := createTestUser(t, repo)
+	number := models.GenerateAccount()
+	if _, err := repo.CreateAccount(ctx, models.Account{
+		UserId:        userId,
+		AccountNumber: number,
+		AccountType:   "credit",
+		Status:        "active",
+	}); err != nil {
+		t.Fatalf("Can't create account: %v", err)
+	}
+
+	acc, err := repo.GetAccountByNumber(ctx, number)
+	if err != nil {
+		t.Fatalf("Can't read account: %v", err)
+	}
+
+	keyRates := service.NewFixtureKeyRateProvider(models.KeyRate{Date: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), RateBp: 700})
+	credits := service.NewLoanService(repo, service.NewTransactionService(repo), keyRates, map[string]int{"consumer": 500}, 2000)
+	loan, schedule, err := credits.IssueCredit(ctx, *acc, "consumer", models.NewMoney(10000000), 12, models.ScheduleAnnuity)
+	if err != nil {
+		t.Fatalf("Issue credit error: %v", err)
+	}
+
+	acc, err = repo.GetAccountByNumber(ctx, number)
+	if err != nil {
+		t.Fatalf("Can't read account: %v", err)
+	}
+
+	if loan.RateBp != 1200 || loan.KeyRateBp != 700 {
+		t.Errorf("Expected rate 7.00 + 5.00, but %d (key %d)", loan.RateBp, loan.KeyRateBp)
+	}
+
+	if acc.Balance.String() != "100000.00" {
+		t.Errorf("Expected disbursed 100000.00 on account, but %s", acc.Balance)
+	}
+
+	stored, err := repo.GetCreditSchedule(ctx, loan.Id)
+	if err != nil {
+		t.Fatalf("Schedule error: %v", err)
+	}
+
+	if len(stored) != 12 || stored[0].Payment.Cmp(schedule[0].Payment) != 0 || !stored[11].Remaining.IsZero() {
+		t.Errorf("Wrong stored schedule: %+v", stored)
+	}
+
+	var mismatches int
+	if err := repo.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM account_balance_mismatches WHERE account_id = $1", acc.Id).Scan(&mismatches); err != nil || mismatches != 0 {
+		t.Errorf("Expected no ledger mismatches, but %d (%v)", mismatches, err)
+	}
+}
+
+func TestCollectDuePayments(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	userId := createTestUser(t, repo)
+	number := models.GenerateAccount()
+	if _, err := repo.CreateAccount(ctx, models.Account{
+		UserId:        userId,
+		AccountNumber: number,
+		AccountType:   "credit",
+		Status:        "active",
+	}); err != nil {
+		t.Fatalf("Can't create account: %v", err)
+	}
+
+	acc, err := repo.GetAccountByNumber(ctx, number)
+	if err != nil {
+		t.Fatalf("Can't read account: %v", err)
+	}
+
+	keyRates := service.NewFixtureKeyRateProvider(models.KeyRate{Date: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), RateBp: 700})
+	credits := service.NewLoanService(repo, service.NewTransactionService(repo), keyRates, map[string]int{"consumer": 500}, 2000)
+	loan, schedule, err := credits.IssueCredit(ctx, *acc, "consumer", models.NewMoney(1000000), 2, models.ScheduleAnnuity)
+	if err != nil {
+		t.Fatalf("Issue credit error: %v", err)
+	}
+
+	if trs := lastTransactionEvent(t, repo, acc.Id); trs.Type != "credit_disbursement" || trs.TransactionId != loan.TransactionId || trs.AccountNumber != number {
+		t.Errorf("Wrong disbursement event %+v", trs)
+	}
+
+	// Первый платёж списывается с выданных денег, на второй их уже не хватает
+	if _, err := credits.CollectDuePayments(ctx, schedule[0].DueDate); err != nil {
+		t.Fatalf("Collect error: %v", err)
+	}
+	if trs := lastTransactionEvent(t, repo, acc.Id); trs.Type != "credit_payment" || trs.Amount.String() != schedule[0].Payment.String() {
+		t.Errorf("Wrong credit payment event %+v", trs)
+	}
+	if acc, err = repo.GetAccountByNumber(ctx, number); err != nil {
+		t.Fatalf("Can't read account: %v", err)
+	}
+	if _, err := service.NewTransactionService(repo).WithdrawalTransaction(ctx, *acc, acc.Balance); err != nil {
+		t.Fatalf("Can't withdraw balance: %v", err)
+	}
+	if _, err := credits.CollectDuePayments(ctx, schedule[1].DueDate.AddDate(0, 0, 10)); err != nil {
+		t.Fatalf("Collect error: %v", err)
+	}
+
+	stored, err := repo.GetCreditSchedule(ctx, loan.Id)
+	if err != nil {
+		t.Fatalf("Schedule error: %v", err)
+	}
+
+	if stored[0].Status != models.PaymentPaid || stored[0].TransactionId == 0 {
+		t.Errorf("Expected first payment to be paid, but %+v", stored[0])
+	}
+
+	if stored[1].Status != models.PaymentOverdue || !stored[1].Penalty.IsPositive() {
+		t.Errorf("Expected second payment overdue with penalty, but %+v", stored[1])
+	}
+
+	var status string
+	if err := repo.db.QueryRowContext(ctx, "SELECT status FROM credits WHERE id = $1", loan.Id).Scan(&status); err != nil || status != models.CreditOverdue {
+		t.Errorf("Expected overdue credit, but %s (%v)", status, err)
+	}
+}
+
+func TestRepayCredit(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	userId := createTestUser(t, repo)
+	number := models.GenerateAccount()
+	if _, err := repo.CreateAccount(ctx, models.Account{
+		UserId:        userId,
+		AccountNumber: number,
+		AccountType:   "credit",
+		Status:        "active",
+	}); err != nil {
+		t.Fatalf("Can't create account: %v", err)
+	}
+
+	acc, err := repo.GetAccountByNumber(ctx, number)
+	if err != nil {
+		t.Fatalf("Can't read account: %v", err)
+	}
+
+	keyRates := service.NewFixtureKeyRateProvider(models.KeyRate{Date: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), RateBp: 700})
+	credits := service.NewLoanService(repo, service.NewTransactionService(repo), keyRates, map[string]int{"consumer": 500}, 2000)
+	loan, schedule, err := credits.IssueCredit(ctx, *acc, "consumer", models.NewMoney(10000000), 12, models.ScheduleAnnuity)
+	if err != nil {
+		t.Fatalf("Issue credit error: %v", err)
+	}
+
+	loan, current, err := credits.RepayCredit(ctx, *loan, models.NewMoney(3000000), models.RepayReducePayment)
+	if err != nil {
+		t.Fatalf("Repay error: %v", err)
+	}
+
+	if loan.ScheduleVersion != 2 || len(current) != 12 || current[0].Version != 2 || current[0].Payment.Cmp(schedule[0].Payment) >= 0 {
+		t.Errorf("Expected new schedule version with smaller payment, but %+v", current)
+	}
+
+	history, err := repo.GetCreditScheduleHistory(ctx, loan.Id)
+	if err != nil || len(history) != 24 || history[0].Status != models.PaymentSuperseded {
+		t.Errorf("Expected old schedule kept as superseded, but %d rows (%v)", len(history), err)
+	}
+
+	// Повторное погашение по устаревшей версии графика
+	stale := *loan
+	stale.ScheduleVersion = 1
+	if _, _, err := credits.RepayCredit(ctx, stale, models.NewMoney(100), models.RepayShortenTerm); !errors.Is(err, repository.ErrCreditChanged) {
+		t.Errorf("Expected stale version error, but %v", err)
+	}
+
+	loan, current, err = credits.RepayCredit(ctx, *loan, models.NewMoney(7000000), models.RepayShortenTerm)
+	if err != nil || loan.Status != models.CreditPaid || len(current) != 0 {
+		t.Errorf("Expected fully repaid credit, but %v, %d payments (%v)", loan, len(current), err)
+	}
+
+	acc, err = repo.GetAccountByNumber(ctx, number)
+	if err != nil || !acc.Balance.IsZero() {
+		t.Errorf("Expected all money spent on repayment, but %v (%v)", acc, err)
+	}
+
+	if trs := lastTransactionEvent(t, repo, acc.Id); trs.Type != "credit_prepayment" || trs.Amount.String() != "70000.00" || !trs.Balance.IsZero() {
+		t.Errorf("Wrong prepayment event %+v", trs)
+	}
+
+	repayments, err := repo.GetCreditRepayments(ctx, loan.Id)
+	if err != nil || len(repayments) != 2 || repayments[1].Version != 3 {
+		t.Errorf("Expected 2 repayments, but %+v (%v)", repayments, err)
+	}
+}
+
+// paidBeforeRepayRepo списывает первый неоплаченный платёж перед досрочным
+// погашением, как планировщик между чтением графика и погашением
+type paidBeforeRepayRepo struct {
+	*PostgresRepository
+}
+
+func (r paidBeforeRepayRepo) RepayCredit(ctx context.Context, loan models.Loan, repayment models.CreditRepayment, pending []models.CreditPayment, schedule []models.CreditPayment, entry models.JournalEntry) (*models.Loan, error) {
+	payment := models.DueCreditPayment{CreditPayment: pending[0], AccountId: loan.AccountId}
+	if err := service.NewTransactionService(r.PostgresRepository).PayCreditPayment(ctx, payment); err != nil {
+		return nil, err
+	}
+	return r.PostgresRepository.RepayCredit(ctx, loan, repayment, pending, schedule, entry)
+}
+
+func TestRepayCreditAfterPayment(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	userId := createTestUser(t, repo)
+	number := models.GenerateAccount()
+	if _, err := repo.CreateAccount(ctx, models.Account{
+		UserId:        userId,
+		AccountNumber: number,
+		AccountType:   "credit",
+		Status:        "active",
+	}); err != nil {
+		t.Fatalf("Can't create account: %v", err)
+	}
+
+	acc, err := repo.GetAccountByNumber(ctx, number)
+	if err != nil {
+		t.Fatalf("Can't read account: %v", err)
+	}
+
+	keyRates := service.NewFixtureKeyRateProvider(models.KeyRate{Date: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), RateBp: 700})
+	issuer := service.NewLoanService(repo, service.NewTransactionService(repo), keyRates, map[string]int{"consumer": 500}, 2000)
+	loan, _, err := issuer.IssueCredit(ctx, *acc, "consumer", models.NewMoney(10000000), 12, models.ScheduleAnnuity)
+	if err != nil {
+		t.Fatalf("Issue credit error: %v", err)
+	}
+
+	racing := paidBeforeRepayRepo{repo}
+	credits := service.NewLoanService(racing, service.NewTransactionService(racing), keyRates, map[string]int{"consumer": 500}, 2000)
+	if _, _, err := credits.RepayCredit(ctx, *loan, models.NewMoney(3000000), models.RepayShortenTerm); !errors.Is(err, repository.ErrCreditChanged) {
+		t.Fatalf("Expected changed credit error, but %v", err)
+	}
+
+	// Списан только плановый платёж, график прежней версии
+	stored, err := repo.GetCreditSchedule(ctx, loan.Id)
+	if err != nil || len(stored) != 12 || stored[0].Status != models.PaymentPaid || stored[1].Status != models.PaymentPending || stored[1].Version != 1 {
+		t.Errorf("Expected first payment paid and schedule unchanged, but %+v (%v)", stored, err)
+	}
+
+	repayments, err := repo.GetCreditRepayments(ctx, loan.Id)
+	if err != nil || len(repayments) != 0 {
+		t.Errorf("Expected no repayments, but %+v (%v)", repayments, err)
+	}
+}
+
+func TestAnalytics(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	userId := createTestUser(t, repo)
+	src := createTestAccount(t, repo, userId, models.NewMoney(50000))
+	dest := createTestAccount(t, repo, userId, models.NewMoney(100))
+
+	if _, err := service.NewTransactionService(repo).TransferTransaction(ctx, *src, *dest, models.NewMoney(20000)); err != nil {
+		t.Fatalf("Transfer error: %v", err)
+	}
+
+	username := testUsername(t, repo, userId)
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from := today.AddDate(0, 0, -2)
+	to := today.AddDate(0, 0, 1)
+
+	rows, err := repo.GetAnalytics(ctx, username, from, to, models.GranularityDay)
+	if err != nil {
+		t.Fatalf("Analytics error: %v", err)
+	}
+
+	// 2 счёта по 3 дня, пустые дни тоже в ответе
+	if len(rows) != 6 {
+		t.Fatalf("Expected 6 rows, but %d", len(rows))
+	}
+
+	analytics := models.SummarizeAnalytics(from, to, models.GranularityDay, rows)
+	total := analytics.Total[len(analytics.Total)-1]
+
+	// Перевод между своими счетами - и приход, и расход, итоговый баланс не меняется
+	if total.Inflow.String() != "701.00" || total.Outflow.String() != "200.00" || total.EndBalance.String() != "501.00" {
+		t.Errorf("Wrong total for today: %+v", total)
+	}
+
+	if analytics.Total[0].EndBalance.IsPositive() {
+		t.Errorf("Expected zero balance before deposits, but %s", analytics.Total[0].EndBalance)
+	}
+}
+
+func TestBudgets(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	trsService := service.NewTransactionService(repo)
+
+	userId := createTestUser(t, repo)
+	username := testUsername(t, repo, userId)
+	acc := createTestAccount(t, repo, userId, models.NewMoney(100000))
+
+	acc, err := trsService.WithdrawalTransaction(ctx, *acc, models.NewMoney(10000))
+	if err != nil {
+		t.Fatalf("Withdrawal error: %v", err)
+	}
+
+	history, err := repo.GetAccountTransactions(ctx, acc.Id, models.TransactionFilter{Type: "withdrawal"})
+	if err != nil || len(history) != 1 || history[0].Category != models.CategoryCash {
+		t.Fatalf("Expected withdrawal categorized as cash, but %+v (%v)", history, err)
+	}
+
+	// Пользователь переносит снятие в продукты и запоминает правило
+	descriptor, err := repo.SetTransactionCategory(ctx, username, history[0].Id, models.CategoryGroceries)
+	if err != nil || descriptor != "withdrawal" {
+		t.Fatalf("Recategorize error: %q (%v)", descriptor, err)
+	}
+	if err := repo.AddCategoryRule(ctx, username, descriptor, models.CategoryGroceries); err != nil {
+		t.Fatalf("Rule error: %v", err)
+	}
+
+	if _, err := trsService.WithdrawalTransaction(ctx, *acc, models.NewMoney(20000)); err != nil {
+		t.Fatalf("Withdrawal error: %v", err)
+	}
+
+	if _, err := repo.SetTransactionCategory(ctx, "nobody", history[0].Id, models.CategoryOther); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected foreign transaction not found, but %v", err)
+	}
+
+	if _, err := repo.SetBudget(ctx, username, models.CategoryGroceries, models.NewMoney(25000)); err != nil {
+		t.Fatalf("Budget error: %v", err)
+	}
+
+	report, err := service.NewSqlAnalyticsService(repo).BudgetReport(ctx, username, time.Now(), time.Now())
+	if err != nil || len(report) != 1 {
+		t.Fatalf("Expected 1 budget, but %+v (%v)", report, err)
+	}
+
+	if report[0].Spent.String() != "300.00" || report[0].Status != models.BudgetOver {
+		t.Errorf("Expected 300.00 spent over budget, but %+v", report[0])
+	}
+
+	if err := repo.DeleteBudget(ctx, username, models.CategoryGroceries); err != nil {
+		t.Errorf("Delete budget error: %v", err)
+	}
+	if err := repo.DeleteBudget(ctx, username, models.CategoryGroceries); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected deleted budget not found, but %v", err)
+	}
+}
+
+func TestForecast(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	userId := createTestUser(t, repo)
+	username := testUsername(t, repo, userId)
+	number := models.GenerateAccount()
+	if _, err := repo.CreateAccount(ctx, models.Account{
+		UserId:        userId,
+		AccountNumber: number,
+		AccountType:   "credit",
+		Status:        "active",
+	}); err != nil {
+		t.Fatalf("Can't create account: %v", err)
+	}
+
+	acc, err := repo.GetAccountByNumber(ctx, number)
+	if err != nil {
+		t.Fatalf("Can't read account: %v", err)
+	}
+
+	keyRates := service.NewFixtureKeyRateProvider(models.KeyRate{Date: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), RateBp: 700})
+	credits := service.NewLoanService(repo, service.NewTransactionService(repo), keyRates, map[string]int{"consumer": 500}, 2000)
+	_, schedule, err := credits.IssueCredit(ctx, *acc, "consumer", models.NewMoney(1000000), 2, models.ScheduleAnnuity)
+	if err != nil {
+		t.Fatalf("Issue credit error: %v", err)
+	}
+
+	forecasts, err := service.NewSqlAnalyticsService(repo).Forecast(ctx, username, 90, time.Now())
+	if err != nil || len(forecasts) != 1 {
+		t.Fatalf("Expected forecast for 1 account, but %d (%v)", len(forecasts), err)
+	}
+
+	// Оба платежа по кредиту укладываются в 90 дней, денег на них не хватает
+	last := forecasts[0].Days[len(forecasts[0].Days)-1]
+	expected := models.NewMoney(1000000).Sub(schedule[0].Payment).Sub(schedule[1].Payment)
+	if last.Balance.Cmp(expected) != 0 || forecasts[0].NegativeOn == nil {
+		t.Errorf("Expected balance %s and negative warning, but %s (%v)", expected, last.Balance, forecasts[0].NegativeOn)
+	}
+}
+
+func TestLoginIps(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	userId := createTestUser(t, repo)
+
+	// Первый вход после регистрации и повторный вход с того же адреса - не новый IP
+	for _, ip := range []string{"10.0.0.1", "10.0.0.1"} {
+		isNew, err := repo.RememberLoginIp(ctx, userId, ip)
+		if err != nil || isNew {
+			t.Fatalf("Expected %s not to be new, but %t (%v)", ip, isNew, err)
+		}
+	}
+
+	isNew, err := repo.RememberLoginIp(ctx, userId, "10.0.0.2")
+	if err != nil || !isNew {
+		t.Fatalf("Expected 10.0.0.2 to be new, but %t (%v)", isNew, err)
+	}
+
+	acc := createTestAccount(t, repo, userId, models.NewMoney(0))
+	owner, err := repo.GetAccountOwner(ctx, acc.Id)
+	if err != nil || owner.ID != userId || owner.Email != owner.Name+"@example.com" {
+		t.Errorf("Wrong account owner %+v (%v)", owner, err)
+	}
+}
+
+// lastTransactionEvent - последнее событие transaction.created по счёту
+func lastTransactionEvent(t *testing.T, repo *PostgresRepository, accountId int) models.TransactionEvent {
+	t.Helper()
+
+	var payload []byte
+	err := repo.db.QueryRowContext(context.Background(),
+		"SELECT payload FROM outbox WHERE event = $1 AND (payload->>'account_id')::int = $2 ORDER BY id DESC LIMIT 1",
+		models.EventTransactionCreated, accountId,
+	).Scan(&payload)
+	if err != nil {
+		t.Fatalf("Can't find transaction event: %v", err)
+	}
+
+	var trs models.TransactionEvent
+	if err := json.Unmarshal(payload, &trs); err != nil {
+		t.Fatalf("Wrong payload: %v", err)
+	}
+	return trs
+}
+
+func TestOutbox(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	userId := createTestUser(t, repo)
+	src := createTestAccount(t, repo, userId, models.NewMoney(100000))
+	dest := createTestAccount(t, repo, createTestUser(t, repo), models.NewMoney(0))
+
+	if _, err := service.NewTransactionService(repo).TransferTransaction(ctx, *src, *dest, models.NewMoney(30000)); err != nil {
+		t.Fatalf("Transfer error: %v", err)
+	}
+
+	// Событие записано в той же транзакции, что и перевод
+	var eventId int64
+	var payload []byte
+	err := repo.db.QueryRowContext(ctx,
+		"SELECT id, payload FROM outbox WHERE event = $1 AND (payload->>'account_id')::int = $2",
+		models.EventTransactionCreated, src.Id,
+	).Scan(&eventId, &payload)
+	if err != nil {
+		t.Fatalf("Can't find transfer event: %v", err)
+	}
+
+	var trs models.TransactionEvent
+	if err := json.Unmarshal(payload, &trs); err != nil {
+		t.Fatalf("Wrong payload: %v", err)
+	}
+	if trs.Type != "transfer" || trs.DestAccountId != dest.Id || trs.Amount.String() != "300.00" || trs.Balance.String() != "700.00" {
+		t.Errorf("Wrong transfer event %+v", trs)
+	}
+
+	claim := func() *models.OutboxEvent {
+		t.Helper()
+		events, err := repo.ClaimOutboxEvents(ctx, 1000, time.Hour)
+		if err != nil {
+			t.Fatalf("Claim error: %v", err)
+		}
+		for i := range events {
+			if events[i].Id == eventId {
+				return &events[i]
+			}
+		}
+		return nil
+	}
+
+	event := claim()
+	if event == nil || event.Attempts != 1 {
+		t.Fatalf("Expected event to be claimed with 1 attempt, but %+v", event)
+	}
+
+	// Пока не истёк lease, событие не отдаётся повторно
+	if again := claim(); again != nil {
+		t.Fatalf("Expected claimed event to be skipped")
+	}
+
+	if err := repo.FailOutboxEvent(ctx, eventId, []string{"email"}, time.Now().Add(-time.Second), false, "smtp down"); err != nil {
+		t.Fatalf("Fail error: %v", err)
+	}
+
+	event = claim()
+	if event == nil || event.Attempts != 2 || len(event.Delivered) != 1 || event.Delivered[0] != "email" || event.LastError != "smtp down" {
+		t.Fatalf("Expected retry with delivered sinks, but %+v", event)
+	}
+
+	if err := repo.CompleteOutboxEvent(ctx, eventId); err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+
+	var status string
+	repo.db.QueryRowContext(ctx, "SELECT status FROM outbox WHERE id = $1", eventId).Scan(&status)
+	if status != models.OutboxDone {
+		t.Errorf("Expected event to be done, but %s", status)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	userId := createTestUser(t, repo)
+	username := testUsername(t, repo, userId)
+	acc := createTestAccount(t, repo, userId, models.NewMoney(0))
+
+	hook, err := repo.CreateWebhook(ctx, username, models.Webhook{
+		Url:         "https://example.com/hook",
+		Events:      []string{models.EventAccountStatusChanged},
+		SecretNonce: []byte{1, 2, 3},
+	})
+	if err != nil {
+		t.Fatalf("Create webhook error: %v", err)
+	}
+
+	if _, err := repo.UpdateAccountStatus(ctx, acc.Id, models.AccountActive); !errors.Is(err, repository.ErrAccountStatus) {
+		t.Errorf("Expected status error, but %v", err)
+	}
+	if _, err := repo.UpdateAccountStatus(ctx, acc.Id, models.AccountBlocked); err != nil {
+		t.Fatalf("Block account error: %v", err)
+	}
+
+	var event models.OutboxEvent
+	var payload []byte
+	err = repo.db.QueryRowContext(ctx,
+		"SELECT id, event, payload FROM outbox WHERE event = $1 AND (payload->>'account_id')::int = $2",
+		models.EventAccountStatusChanged, acc.Id,
+	).Scan(&event.Id, &event.Event, &payload)
+	if err != nil {
+		t.Fatalf("Can't find status event: %v", err)
+	}
+	event.Payload = payload
+
+	recipients := []models.WebhookRecipient{{AccountId: acc.Id, Payload: event.Payload}}
+	deliveries, err := repo.PrepareWebhookDeliveries(ctx, event, recipients)
+	if err != nil || len(deliveries) != 1 || deliveries[0].WebhookId != hook.Id || deliveries[0].Url != hook.Url {
+		t.Fatalf("Expected one delivery, but %+v (%v)", deliveries, err)
+	}
+
+	if _, err := repo.SaveWebhookAttempt(ctx, deliveries[0].Id, models.WebhookDeliverySuccess, 200, "ok", ""); err != nil {
+		t.Fatalf("Save attempt error: %v", err)
+	}
+
+	// Повтор события не создаёт новых доставок и не отдаёт доставленные
+	again, err := repo.PrepareWebhookDeliveries(ctx, event, recipients)
+	if err != nil || len(again) != 0 {
+		t.Errorf("Expected no deliveries on retry, but %+v (%v)", again, err)
+	}
+
+	if err := repo.DeleteWebhook(ctx, username, hook.Id); err != nil {
+		t.Fatalf("Delete webhook error: %v", err)
+	}
+	if err := repo.DeleteWebhook(ctx, username, hook.Id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected no rows on second delete, but %v", err)
+	}
+
+	log, err := repo.GetWebhookDeliveries(ctx, hook.Id, 10)
+	if err != nil || len(log) != 1 || log[0].Attempts != 1 || log[0].ResponseCode != 200 {
+		t.Errorf("Wrong delivery log: %+v (%v)", log, err)
+	}
+}
+
+func TestRefreshTokens(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	userId := createTestUser(t, repo)
+	username := testUsername(t, repo, userId)
+	suffix := fmt.Sprintf("%020d", time.Now().UnixNano())
+
+	token := func(name string) models.RefreshToken {
+		return models.RefreshToken{
+			UserId:          userId,
+			FamilyId:        "family" + suffix + "000000",
+			TokenHash:       models.HashToken(name + suffix),
+			AccessJti:       name + suffix + strings.Repeat("0", 32-len(name)-len(suffix)),
+			AccessExpiresAt: time.Now().Add(time.Minute),
+			ExpiresAt:       time.Now().Add(time.Hour),
+		}
+	}
+
+	first := token("first")
+	if _, err := repo.CreateRefreshToken(ctx, first); err != nil {
+		t.Fatalf("Create refresh token error: %v", err)
+	}
+
+	second, err := repo.RotateRefreshToken(ctx, first.TokenHash, token("second"))
+	if err != nil || second.Username != username || second.FamilyId != first.FamilyId {
+		t.Fatalf("Wrong rotated token %+v (%v)", second, err)
+	}
+
+	// Повторное использование первого токена отзывает семью вместе с access-токенами
+	if _, err := repo.RotateRefreshToken(ctx, first.TokenHash, token("third")); !errors.Is(err, repository.ErrRefreshTokenReused) {
+		t.Fatalf("Expected reuse error, but %v", err)
+	}
+	if _, err := repo.RotateRefreshToken(ctx, second.TokenHash, token("fourth")); !errors.Is(err, repository.ErrRefreshTokenRevoked) {
+		t.Errorf("Expected revoked error, but %v", err)
+	}
+
+	for _, jti := range []string{first.AccessJti, second.AccessJti} {
+		if revoked, err := repo.IsTokenRevoked(ctx, jti); err != nil || !revoked {
+			t.Errorf("Expected access token %s to be revoked (%v)", jti, err)
+		}
+	}
+
+	other := token("other")
+	other.FamilyId = "other0" + suffix + "000000"
+	if _, err := repo.CreateRefreshToken(ctx, other); err != nil {
+		t.Fatalf("Create refresh token error: %v", err)
+	}
+	if err := repo.RevokeUserTokens(ctx, username); err != nil {
+		t.Fatalf("Revoke user tokens error: %v", err)
+	}
+	if revoked, _ := repo.IsTokenRevoked(ctx, other.AccessJti); !revoked {
+		t.Errorf("Expected all user tokens to be revoked")
+	}
+}
+
+func TestJwtKeys(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+	key := func(name string, alg string) models.JwtKey {
+		return models.JwtKey{Kid: name + suffix, Alg: alg, PrivateKey: []byte("encrypted"), ActivatesAt: time.Now()}
+	}
+
+	if _, err := repo.RotateJwtKey(ctx, key("a", models.JwtAlgRS256), time.Now()); err != nil {
+		t.Fatalf("Rotate error: %v", err)
+	}
+
+	// Свежий ключ с тем же алгоритмом не меняется
+	if rotated, err := repo.RotateJwtKey(ctx, key("b", models.JwtAlgRS256), time.Now().Add(-time.Hour)); err != nil || rotated {
+		t.Fatalf("Expected fresh key to be kept, but %v (%v)", rotated, err)
+	}
+
+	// Смена алгоритма меняет ключ сразу
+	if rotated, err := repo.RotateJwtKey(ctx, key("c", models.JwtAlgEdDSA), time.Now().Add(-time.Hour)); err != nil || !rotated {
+		t.Fatalf("Expected rotation on alg change, but %v (%v)", rotated, err)
+	}
+
+	keys, err := repo.GetJwtKeys(ctx, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Get keys error: %v", err)
+	}
+
+	current := 0
+	retired := false
+	for _, k := range keys {
+		if k.RetiredAt == nil {
+			current++
+			if k.Kid != "c"+suffix {
+				t.Errorf("Expected c to be current, but %s", k.Kid)
+			}
+		}
+		if k.Kid == "a"+suffix && k.RetiredAt != nil {
+			retired = true
+		}
+	}
+	if current != 1 || !retired {
+		t.Errorf("Expected one current key and retired a, but %+v", keys)
+	}
+}
+
+func TestTwoFactor(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	userId := createTestUser(t, repo)
+	username := testUsername(t, repo, userId)
+
+	if err := repo.SetTotpSecret(ctx, userId, []byte("secret")); err != nil {
+		t.Fatalf("Set secret error: %v", err)
+	}
+	if err := repo.EnableTotp(ctx, userId, 100, [][]byte{[]byte("code-1"), []byte("code-2")}); err != nil {
+		t.Fatalf("Enable error: %v", err)
+	}
+
+	// Включённый TOTP нельзя перезаписать новым секретом
+	if err := repo.SetTotpSecret(ctx, userId, []byte("other")); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected enabled secret to be kept, but %v", err)
+	}
+
+	user, err := repo.GetUserByUsername(ctx, username)
+	if err != nil || !user.TotpEnabled {
+		t.Fatalf("Expected totp enabled user, but %+v (%v)", user, err)
+	}
+
+	if fresh, err := repo.UseTotpStep(ctx, userId, 100); err != nil || fresh {
+		t.Errorf("Expected step replay to be rejected, but %v (%v)", fresh, err)
+	}
+	if fresh, err := repo.UseTotpStep(ctx, userId, 101); err != nil || !fresh {
+		t.Errorf("Expected next step to be accepted, but %v (%v)", fresh, err)
+	}
+
+	if used, err := repo.UseRecoveryCode(ctx, userId, []byte("code-1")); err != nil || !used {
+		t.Errorf("Expected recovery code to be used, but %v (%v)", used, err)
+	}
+	if used, err := repo.UseRecoveryCode(ctx, userId, []byte("code-1")); err != nil || used {
+		t.Errorf("Expected used recovery code to be rejected, but %v (%v)", used, err)
+	}
+
+	hash := models.HashToken(fmt.Sprintf("challenge-%d", time.Now().UnixNano()))
+	if err := repo.CreateMfaChallenge(ctx, userId, hash, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Create challenge error: %v", err)
+	}
+
+	challenge, err := repo.AttemptMfaChallenge(ctx, hash, 2)
+	if err != nil || challenge.Username != username || challenge.Attempts != 1 {
+		t.Fatalf("Wrong challenge %+v (%v)", challenge, err)
+	}
+	if _, err := repo.AttemptMfaChallenge(ctx, hash, 2); err != nil {
+		t.Fatalf("Second attempt error: %v", err)
+	}
+	if _, err := repo.AttemptMfaChallenge(ctx, hash, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected attempts limit, but %v", err)
+	}
+
+	if err := repo.CompleteMfaChallenge(ctx, challenge.Id); err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+	if err := repo.CompleteMfaChallenge(ctx, challenge.Id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected completed challenge to be rejected, but %v", err)
+	}
+
+	if err := repo.DisableTotp(ctx, userId); err != nil {
+		t.Fatalf("Disable error: %v", err)
+	}
+	if totp, err := repo.GetTotp(ctx, userId); err != nil || totp.Enabled || totp.Secret != nil {
+		t.Errorf("Expected totp to be reset, but %+v (%v)", totp, err)
+	}
+	if used, _ := repo.UseRecoveryCode(ctx, userId, []byte("code-2")); used {
+		t.Errorf("Expected recovery codes to be deleted")
+	}
+}
+
+func TestPendingTransfers(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	trsService := service.NewTransactionService(repo)
+
+	userId := createTestUser(t, repo)
+	username := testUsername(t, repo, userId)
+	src := createTestAccount(t, repo, userId, models.NewMoney(100000))
+	dest := createTestAccount(t, repo, createTestUser(t, repo), models.NewMoney(0))
+
+	if known, err := repo.HasTransferredTo(ctx, userId, dest.Id); err != nil || known {
+		t.Fatalf("Expected new recipient, but %v (%v)", known, err)
+	}
+	if _, err := trsService.TransferTransaction(ctx, *src, *dest, models.NewMoney(1000)); err != nil {
+		t.Fatalf("Transfer error: %v", err)
+	}
+	if known, err := repo.HasTransferredTo(ctx, userId, dest.Id); err != nil || !known {
+		t.Fatalf("Expected known recipient, but %v (%v)", known, err)
+	}
+
+	pending := models.PendingTransfer{
+		UserId:          userId,
+		SourceAccountId: src.Id,
+		DestAccountId:   dest.Id,
+		Amount:          models.NewMoney(5000),
+		Reason:          models.TransferConfirmLargeAmount,
+		CodeHash:        []byte("hash"),
+		ExpiresAt:       time.Now().Add(time.Minute),
+	}
+	created, err := repo.CreatePendingTransfer(ctx, pending, 1)
+	if err != nil {
+		t.Fatalf("Create error: %v", err)
+	}
+	if _, err := repo.CreatePendingTransfer(ctx, pending, 1); !errors.Is(err, repository.ErrTooManyPending) {
+		t.Errorf("Expected open transfers limit, but %v", err)
+	}
+
+	if _, err := repo.GetPendingTransfer(ctx, created.Id, "someone_else"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected foreign transfer to be hidden, but %v", err)
+	}
+
+	transfer, err := repo.GetPendingTransfer(ctx, created.Id, username)
+	if err != nil || transfer.SourceAccountNumber != src.AccountNumber || transfer.DestAccountNumber != dest.AccountNumber || transfer.Amount.Amount != 5000 {
+		t.Fatalf("Wrong pending transfer %+v (%v)", transfer, err)
+	}
+
+	if transfer, err = repo.AttemptPendingTransfer(ctx, created.Id, 2); err != nil || transfer.Attempts != 1 || string(transfer.CodeHash) != "hash" {
+		t.Fatalf("Wrong attempt %+v (%v)", transfer, err)
+	}
+
+	if err := repo.SetPendingTransferStatus(ctx, created.Id, models.PendingTransferPending, models.PendingTransferConfirmed, ""); err != nil {
+		t.Fatalf("Confirm error: %v", err)
+	}
+	if err := repo.SetPendingTransferStatus(ctx, created.Id, models.PendingTransferPending, models.PendingTransferConfirmed, ""); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected second confirmation to be rejected, but %v", err)
+	}
+	if _, err := repo.AttemptPendingTransfer(ctx, created.Id, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected confirmed transfer to reject attempts, but %v", err)
+	}
+
+	transfer, _ = repo.GetPendingTransfer(ctx, created.Id, username)
+	if transfer.Status != models.PendingTransferConfirmed || transfer.ConfirmedAt == nil {
+		t.Errorf("Expected confirmed transfer, but %+v", transfer)
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	username := fmt.Sprintf("throttle_%d", time.Now().UnixNano())
+	ip := fmt.Sprintf("192.0.2.%d", rand.Intn(250)+1)
+	t.Cleanup(func() {
+		repo.ResetLoginFailures(context.Background(), models.LoginScopeUser, username)
+		repo.ResetLoginFailures(context.Background(), models.LoginScopeIp, ip)
+	})
+
+	now := time.Now()
+	for i := 1; i <= 2; i++ {
+		if failures, err := repo.RecordLoginFailure(ctx, models.LoginScopeUser, username, now, now.Add(-time.Hour)); err != nil || failures != i {
+			t.Fatalf("Expected %d failures, but %d (%v)", i, failures, err)
+		}
+	}
+	// Прошлая неудача раньше resetBefore - счёт заново
+	if failures, err := repo.RecordLoginFailure(ctx, models.LoginScopeUser, username, now, now.Add(time.Minute)); err != nil || failures != 1 {
+		t.Fatalf("Expected reset counter, but %d (%v)", failures, err)
+	}
+
+	if until, err := repo.GetLoginBlockedUntil(ctx, username, ip); err != nil || until != nil {
+		t.Fatalf("Expected no block, but %v (%v)", until, err)
+	}
+
+	repo.RecordLoginFailure(ctx, models.LoginScopeIp, ip, now, now.Add(-time.Hour))
+	if err := repo.BlockLogin(ctx, models.LoginScopeIp, ip, now.Add(time.Minute)); err != nil {
+		t.Fatalf("Block ip error: %v", err)
+	}
+	if notify, err := repo.LockLogin(ctx, username, now.Add(time.Hour), []byte("unlock"), now.Add(-time.Hour), now); err != nil || !notify {
+		t.Fatalf("Expected lock with notification, but %v (%v)", notify, err)
+	}
+	until, err := repo.GetLoginBlockedUntil(ctx, username, ip)
+	if err != nil || until == nil || until.Sub(now.Add(time.Hour)).Abs() > time.Millisecond {
+		t.Fatalf("Expected latest block, but %v (%v)", until, err)
+	}
+	// Блокировка обнуляет счётчик
+	if failures, _ := repo.RecordLoginFailure(ctx, models.LoginScopeUser, username, now, now.Add(-time.Hour)); failures != 1 {
+		t.Errorf("Expected counter reset by lock, but %d", failures)
+	}
+
+	// Повторная блокировка в окне письма сохраняет прежний токен
+	if notify, err := repo.LockLogin(ctx, username, now.Add(2*time.Hour), []byte("other"), now.Add(-time.Hour), now.Add(time.Second)); err != nil || notify {
+		t.Fatalf("Expected lock without notification, but %v (%v)", notify, err)
+	}
+	if ok, err := repo.UnlockLogin(ctx, []byte("other"), now); err != nil || ok {
+		t.Errorf("Expected wrong token to be rejected, but %v (%v)", ok, err)
+	}
+	if ok, err := repo.UnlockLogin(ctx, []byte("unlock"), now); err != nil || !ok {
+		t.Fatalf("Expected unlock, but %v (%v)", ok, err)
+	}
+	if ok, _ := repo.UnlockLogin(ctx, []byte("unlock"), now); ok {
+		t.Errorf("Expected used token to be rejected")
+	}
+
+	until, _ = repo.GetLoginBlockedUntil(ctx, username, "198.51.100.1")
+	if until != nil {
+		t.Errorf("Expected unlocked user, but blocked until %v", until)
+	}
+
+	if _, err := repo.DeleteStaleLoginThrottles(ctx, now.Add(time.Second), now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("Cleanup error: %v", err)
+	}
+	if until, _ := repo.GetLoginBlockedUntil(ctx, "", ip); until != nil {
+		t.Errorf("Expected stale ip throttle to be deleted, but %v", until)
+	}
+
+	err = repo.CreateLoginAttempt(ctx, models.LoginAttempt{Username: username, Ip: ip, UserAgent: "test", Result: models.LoginUnknownUser})
+	if err != nil {
+		t.Errorf("Audit error: %v", err)
+	}
+}
+
+func TestIdempotencyKeyLease(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+
+	key := models.IdempotencyKey{UserId: createTestUser(t, repo), Key: "lease", RequestHash: strings.Repeat("a", 64)}
+	acquired, created, err := repo.AcquireIdempotencyKey(ctx, key, time.Now().Add(-time.Minute))
+	if err != nil || !created {
+		t.Fatalf("Expected new key, but %v (%v)", created, err)
+	}
+
+	// Аренда не истекла
+	if stored, created, err := repo.AcquireIdempotencyKey(ctx, key, time.Now().Add(-time.Minute)); err != nil || created || stored.Status != "processing" {
+		t.Fatalf("Expected key in progress, but %+v %v (%v)", stored, created, err)
+	}
+
+	other := key
+	other.RequestHash = strings.Repeat("b", 64)
+	if _, created, err := repo.AcquireIdempotencyKey(ctx, other, time.Now().Add(time.Minute)); err != nil || created {
+		t.Errorf("Expected stale key with another request to be kept, but %v (%v)", created, err)
+	}
+
+	reclaimed, created, err := repo.AcquireIdempotencyKey(ctx, key, time.Now().Add(time.Minute))
+	if err != nil || !created || reclaimed.Id != acquired.Id {
+		t.Fatalf("Expected stale key to be reclaimed, but %+v %v (%v)", reclaimed, created, err)
+	}
+
+	if err := repo.CompleteIdempotencyKey(ctx, reclaimed.Id, 200, []byte("{}"), "application/json"); err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+	if _, created, _ := repo.AcquireIdempotencyKey(ctx, key, time.Now().Add(time.Minute)); created {
+		t.Errorf("Expected completed key not to be reclaimed")
+	}
+
+	if deleted, err := repo.DeleteExpiredIdempotencyKeys(ctx, time.Now().Add(time.Minute)); err != nil || deleted < 1 {
+		t.Fatalf("Expected expired keys to be deleted, but %d (%v)", deleted, err)
+	}
+	if _, created, _ := repo.AcquireIdempotencyKey(ctx, key, time.Now().Add(-time.Minute)); !created {
+		t.Errorf("Expected deleted key to be acquired again")
+	}
+}
@@ -0,0 +1,268 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+
+	"github.com/lib/pq"
+)
+
+func (r *PostgresRepository) CreateRefreshToken(ctx context.Context, token models.RefreshToken) (*models.RefreshToken, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = insertRefreshToken(ctx, tx, &token); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// RotateRefreshToken меняет активный refresh-токен с хешем hash на next из той
+// же семьи. Повторное предъявление уже заменённого токена отзывает всю семью
+// и возвращает ErrRefreshTokenReused.
+func (r *PostgresRepository) RotateRefreshToken(ctx context.Context, hash []byte, next models.RefreshToken) (*models.RefreshToken, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var current models.RefreshToken
+	err = tx.QueryRowContext(ctx, `
+		SELECT
+			t.id, t.user_id, u.username, t.family_id, t.status, t.expires_at
+		FROM
+			refresh_tokens t
+			JOIN users u ON t.user_id = u.id
+		WHERE
+			t.token_hash = $1
+		FOR UPDATE OF t
+	`, hash).Scan(
+		&current.Id,
+		&current.UserId,
+		&current.Username,
+		&current.FamilyId,
+		&current.Status,
+		&current.ExpiresAt,
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if current.Status == models.RefreshTokenRotated {
+		if err = revokeTokenFamilies(ctx, tx, []string{current.FamilyId}); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, repository.ErrRefreshTokenReused
+	}
+
+	if current.Status != models.RefreshTokenActive || !current.ExpiresAt.After(time.Now()) {
+		tx.Rollback()
+		return nil, repository.ErrRefreshTokenRevoked
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE refresh_tokens SET status = 'rotated', used_at = NOW() WHERE id = $1",
+		current.Id,
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	next.UserId = current.UserId
+	next.Username = current.Username
+	next.FamilyId = current.FamilyId
+	if err = insertRefreshToken(ctx, tx, &next); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &next, nil
+}
+
+// RevokeTokenFamily отзывает access-токен accessJti и семью refresh-токена,
+// выданного вместе с ним (выход из одной сессии).
+func (r *PostgresRepository) RevokeTokenFamily(ctx context.Context, accessJti string, accessExpiresAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING",
+		accessJti, accessExpiresAt,
+	)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+
+	families, err := queryTokenFamilies(ctx, tx, "SELECT DISTINCT family_id FROM refresh_tokens WHERE access_jti = $1", accessJti)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = revokeTokenFamilies(ctx, tx, families); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeUserTokens отзывает все сессии пользователя.
+func (r *PostgresRepository) RevokeUserTokens(ctx context.Context, username string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	families, err := queryTokenFamilies(ctx, tx, `
+		SELECT DISTINCT
+			t.family_id
+		FROM
+			refresh_tokens t
+			JOIN users u ON t.user_id = u.id
+		WHERE
+			u.username = $1 AND (t.status = 'active' OR t.access_expires_at > NOW())
+	`, username)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = revokeTokenFamilies(ctx, tx, families); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := r.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)", jti).Scan(&revoked)
+	return revoked, err
+}
+
+// DeleteExpiredTokens удаляет истёкшие refresh-токены и записи об отзыве
+// истёкших access-токенов.
+func (r *PostgresRepository) DeleteExpiredTokens(ctx context.Context, at time.Time) (int, error) {
+	deleted := 0
+
+	for _, query := range []string{
+		"DELETE FROM revoked_tokens WHERE expires_at < $1",
+		"DELETE FROM refresh_tokens WHERE expires_at < $1 AND access_expires_at < $1",
+		"DELETE FROM mfa_challenges WHERE expires_at < $1",
+	} {
+		result, err := r.db.ExecContext(ctx, query, at)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete expired tokens: %w", err)
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(affected)
+	}
+
+	return deleted, nil
+}
+
+func insertRefreshToken(ctx context.Context, tx *sql.Tx, token *models.RefreshToken) error {
+	token.Status = models.RefreshTokenActive
+
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO
+			refresh_tokens (user_id, family_id, token_hash, access_jti, access_expires_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`,
+		token.UserId,
+		token.FamilyId,
+		token.TokenHash,
+		token.AccessJti,
+		token.AccessExpiresAt,
+		token.ExpiresAt,
+	).Scan(&token.Id, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func queryTokenFamilies(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query token families: %w", err)
+	}
+	defer rows.Close()
+
+	var families []string
+	for rows.Next() {
+		var family string
+		if err := rows.Scan(&family); err != nil {
+			return nil, err
+		}
+		families = append(families, family)
+	}
+
+	return families, rows.Err()
+}
+
+// revokeTokenFamilies отзывает refresh-токены семей и ещё не истёкшие
+// access-токены, выданные вместе с ними.
+func revokeTokenFamilies(ctx context.Context, tx *sql.Tx, families []string) error {
+	if len(families) == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx,
+		"UPDATE refresh_tokens SET status = 'revoked' WHERE family_id = ANY($1) AND status = 'active'",
+		pq.Array(families),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO
+			revoked_tokens (jti, expires_at)
+		SELECT
+			access_jti, access_expires_at
+		FROM
+			refresh_tokens
+		WHERE
+			family_id = ANY($1) AND access_expires_at > NOW()
+		ON CONFLICT (jti) DO NOTHING
+	`, pq.Array(families))
+	if err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+
+	return nil
+}
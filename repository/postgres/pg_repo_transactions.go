@@ -0,0 +1,169 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"uniback/models"
+)
+
+// Колонка transactions.time - TIMESTAMP без зоны, поэтому параметры передаём
+// строкой без смещения, иначе Postgres отбросит зону при приведении типа.
+const pgTimestampLayout = "2006-01-02 15:04:05.999999"
+
+// accountTransactionsQuery собирает историю счёта: собственные операции и
+// входящие переводы с других счетов.
+const accountTransactionsQuery = `
+	SELECT
+		id, type, direction, amount, fee, time, counterparty, category
+	FROM (
+		SELECT
+			t.id,
+			t.type,
+			CASE WHEN t.type IN ('deposit', 'credit_disbursement') THEN 'in' ELSE 'out' END AS direction,
+			t.amount,
+			COALESCE(t.fee, 0) AS fee,
+			t.time,
+			COALESCE(d.account_number, '') AS counterparty,
+			COALESCE(t.category, '') AS category
+		FROM
+			transactions t
+			LEFT JOIN transaction_trasfers tt ON tt.trans_id = t.id
+			LEFT JOIN accounts d ON d.id = tt.dest_account_id
+		WHERE
+			t.account_id = $1
+		UNION ALL
+		SELECT
+			t.id,
+			t.type,
+			'in' AS direction,
+			t.amount,
+			0 AS fee,
+			t.time,
+			s.account_number AS counterparty,
+			COALESCE(t.category, '') AS category
+		FROM
+			transactions t
+			JOIN transaction_trasfers tt ON tt.trans_id = t.id
+			JOIN accounts s ON s.id = t.account_id
+		WHERE
+			tt.dest_account_id = $1
+	) h
+	WHERE
+		($2::timestamp IS NULL OR h.time >= $2::timestamp)
+		AND ($3::timestamp IS NULL OR h.time < $3::timestamp)
+		AND ($4::text IS NULL OR h.type = $4::text)
+		AND ($5::text IS NULL OR h.direction = $5::text)
+		AND ($6::numeric IS NULL OR h.amount >= $6::numeric)
+		AND ($7::numeric IS NULL OR h.amount <= $7::numeric)
+		AND ($8::timestamp IS NULL OR (h.time, h.id) < ($8::timestamp, $9::int))
+	ORDER BY h.time DESC, h.id DESC
+`
+
+func (r *PostgresRepository) GetAccountTransactions(ctx context.Context, accountId int, filter models.TransactionFilter) ([]models.AccountTransaction, error) {
+	var cursorTime, cursorId any
+	if filter.After != nil {
+		cursorTime = pgTimestamp(&filter.After.Time)
+		cursorId = filter.After.Id
+	}
+
+	query := accountTransactionsQuery
+	args := []any{
+		accountId,
+		pgTimestamp(filter.From),
+		pgTimestamp(filter.To),
+		nullString(filter.Type),
+		nullString(filter.Direction),
+		nullMoney(filter.MinAmount),
+		nullMoney(filter.MaxAmount),
+		cursorTime,
+		cursorId,
+	}
+
+	if filter.Limit > 0 {
+		query += " LIMIT $10"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query account transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.AccountTransaction
+	for rows.Next() {
+		var trs models.AccountTransaction
+		err := rows.Scan(
+			&trs.Id,
+			&trs.Type,
+			&trs.Direction,
+			&trs.Amount,
+			&trs.Fee,
+			&trs.Time,
+			&trs.CounterpartyAccount,
+			&trs.Category,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		result = append(result, trs)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return result, nil
+}
+
+func pgTimestamp(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.Format(pgTimestampLayout)
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullInt(value int) any {
+	if value == 0 {
+		return nil
+	}
+	return value
+}
+
+func nullMoney(m *models.Money) any {
+	if m == nil {
+		return nil
+	}
+	return m.String()
+}
+
+// GetAccountBalanceAt считает баланс счёта по главной книге на момент at (не включая).
+func (r *PostgresRepository) GetAccountBalanceAt(ctx context.Context, accountId int, at time.Time) (models.Money, error) {
+	query := `
+		SELECT
+			COALESCE(SUM(CASE WHEN p.direction = 'credit' THEN p.amount ELSE -p.amount END), 0)
+		FROM
+			postings p
+			JOIN journal_entries je ON je.id = p.entry_id
+			JOIN ledger_accounts la ON la.id = p.ledger_account_id
+		WHERE
+			la.account_id = $1 AND je.created_at < $2::timestamp
+	`
+
+	var balance models.Money
+
+	err := r.db.QueryRowContext(ctx, query, accountId, pgTimestamp(&at)).Scan(&balance)
+	if err != nil {
+		return models.Money{}, fmt.Errorf("failed to get balance at %s: %w", at, err)
+	}
+
+	return balance, nil
+}
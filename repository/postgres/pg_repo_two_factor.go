@@ -0,0 +1,233 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"uniback/models"
+)
+
+func (r *PostgresRepository) GetTotp(ctx context.Context, userId int) (*models.Totp, error) {
+	totp := models.Totp{UserId: userId}
+
+	err := r.db.QueryRowContext(ctx,
+		"SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id = $1",
+		userId,
+	).Scan(&totp.Secret, &totp.Enabled, &totp.LastStep)
+	if err != nil {
+		return nil, err
+	}
+
+	return &totp, nil
+}
+
+// SetTotpSecret сохраняет секрет, ожидающий подтверждения. Если TOTP уже
+// включён, секрет не меняется и возвращается sql.ErrNoRows.
+func (r *PostgresRepository) SetTotpSecret(ctx context.Context, userId int, secret []byte) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE
+			users
+		SET
+			totp_secret = $2, totp_enabled = FALSE, totp_last_step = NULL
+		WHERE
+			id = $1 AND NOT totp_enabled
+	`, userId, secret)
+	if err != nil {
+		return fmt.Errorf("failed to save totp secret: %w", err)
+	}
+
+	return expectAffected(result)
+}
+
+// EnableTotp включает TOTP после подтверждения кодом шага step и заменяет
+// коды восстановления. Если TOTP уже включён, возвращает sql.ErrNoRows.
+func (r *PostgresRepository) EnableTotp(ctx context.Context, userId int, step int64, recoveryHashes [][]byte) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE
+			users
+		SET
+			totp_enabled = TRUE, totp_last_step = $2
+		WHERE
+			id = $1 AND NOT totp_enabled AND totp_secret IS NOT NULL
+	`, userId, step)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to enable totp: %w", err)
+	}
+
+	if err = expectAffected(result); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = replaceRecoveryCodes(ctx, tx, userId, recoveryHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresRepository) DisableTotp(ctx context.Context, userId int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE
+			users
+		SET
+			totp_secret = NULL, totp_enabled = FALSE, totp_last_step = NULL
+		WHERE
+			id = $1
+	`, userId)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to disable totp: %w", err)
+	}
+
+	if err = replaceRecoveryCodes(ctx, tx, userId, nil); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTotpStep запоминает шаг принятого кода. false - код этого или более
+// позднего шага уже был принят, то есть код использован повторно.
+func (r *PostgresRepository) UseTotpStep(ctx context.Context, userId int, step int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE
+			users
+		SET
+			totp_last_step = $2
+		WHERE
+			id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)
+	`, userId, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to save totp step: %w", err)
+	}
+
+	return affectedOne(result)
+}
+
+// UseRecoveryCode гасит неиспользованный код восстановления с хешем hash.
+func (r *PostgresRepository) UseRecoveryCode(ctx context.Context, userId int, hash []byte) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE
+			recovery_codes
+		SET
+			used_at = NOW()
+		WHERE
+			user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userId, hash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	return affectedOne(result)
+}
+
+func (r *PostgresRepository) CreateMfaChallenge(ctx context.Context, userId int, hash []byte, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO mfa_challenges (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		userId, hash, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create mfa challenge: %w", err)
+	}
+
+	return nil
+}
+
+// AttemptMfaChallenge засчитывает попытку ввода кода. Если вход уже выполнен,
+// истёк или исчерпал maxAttempts попыток, возвращается sql.ErrNoRows.
+func (r *PostgresRepository) AttemptMfaChallenge(ctx context.Context, hash []byte, maxAttempts int) (*models.MfaChallenge, error) {
+	query := `
+		UPDATE
+			mfa_challenges c
+		SET
+			attempts = c.attempts + 1
+		FROM
+			users u
+		WHERE
+			c.user_id = u.id AND c.token_hash = $1 AND c.used_at IS NULL
+			AND c.expires_at > NOW() AND c.attempts < $2
+		RETURNING c.id, c.user_id, u.username, u.email, c.attempts, c.expires_at
+	`
+
+	var challenge models.MfaChallenge
+	err := r.db.QueryRowContext(ctx, query, hash, maxAttempts).Scan(
+		&challenge.Id,
+		&challenge.UserId,
+		&challenge.Username,
+		&challenge.Email,
+		&challenge.Attempts,
+		&challenge.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &challenge, nil
+}
+
+// CompleteMfaChallenge отмечает вход выполненным. Если его уже выполнил
+// параллельный запрос, возвращается sql.ErrNoRows.
+func (r *PostgresRepository) CompleteMfaChallenge(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE mfa_challenges SET used_at = NOW() WHERE id = $1 AND used_at IS NULL",
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to complete mfa challenge: %w", err)
+	}
+
+	return expectAffected(result)
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userId int, hashes [][]byte) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userId); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	for _, hash := range hashes {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+			userId, hash,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save recovery code: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func affectedOne(result sql.Result) (bool, error) {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// expectAffected возвращает sql.ErrNoRows, если запрос не изменил ни одной строки.
+func expectAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"uniback/models"
+
+	"github.com/lib/pq"
+)
+
+const webhookColumns = `
+	w.id, w.user_id, w.url, w.events, w.secret_nonce, w.active, w.created_at
+`
+
+const webhookDeliveryColumns = `
+	d.id, d.webhook_id, d.outbox_id, d.event, d.payload, d.status, d.attempts,
+	COALESCE(d.response_code, 0), d.response_body, d.error, d.created_at, d.last_attempt_at,
+	w.url, w.secret_nonce
+`
+
+func (r *PostgresRepository) CreateWebhook(ctx context.Context, username string, hook models.Webhook) (*models.Webhook, error) {
+	query := `
+		INSERT INTO
+			webhooks (user_id, url, events, secret_nonce)
+		SELECT id, $2, $3, $4 FROM users WHERE username = $1
+		RETURNING id, user_id, active, created_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query, username, hook.Url, pq.Array(hook.Events), hook.SecretNonce).Scan(
+		&hook.Id,
+		&hook.UserId,
+		&hook.Active,
+		&hook.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return &hook, nil
+}
+
+func (r *PostgresRepository) GetWebhooks(ctx context.Context, username string) ([]models.Webhook, error) {
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM
+			webhooks w
+			JOIN users u ON w.user_id = u.id
+		WHERE
+			u.username = $1 AND w.active
+		ORDER BY w.id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var hooks []models.Webhook
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		hooks = append(hooks, *hook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return hooks, nil
+}
+
+// GetWebhookByIdAndUsername возвращает webhook пользователя, в том числе
+// удалённый: его журнал доставок остаётся доступен.
+func (r *PostgresRepository) GetWebhookByIdAndUsername(ctx context.Context, id int, username string) (*models.Webhook, error) {
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM
+			webhooks w
+			JOIN users u ON w.user_id = u.id
+		WHERE
+			w.id = $1 AND u.username = $2
+	`
+
+	return scanWebhook(r.db.QueryRowContext(ctx, query, id, username))
+}
+
+// DeleteWebhook выключает webhook. Если его нет, возвращается sql.ErrNoRows.
+func (r *PostgresRepository) DeleteWebhook(ctx context.Context, username string, id int) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE
+			webhooks w
+		SET
+			active = FALSE
+		FROM
+			users u
+		WHERE
+			w.user_id = u.id AND u.username = $1 AND w.id = $2 AND w.active
+	`, username, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// PrepareWebhookDeliveries заводит доставки события на активные webhook
+// владельцев счетов recipients, каждой стороне - её данные, и возвращает ещё
+// не доставленные. Если у пользователя оба счёта, он получает одну доставку с
+// данными первого получателя. При повторе того же события новые строки не
+// создаются.
+func (r *PostgresRepository) PrepareWebhookDeliveries(ctx context.Context, event models.OutboxEvent, recipients []models.WebhookRecipient) ([]models.WebhookDelivery, error) {
+	for _, recipient := range recipients {
+		_, err := r.db.ExecContext(ctx, `
+			INSERT INTO
+				webhook_deliveries (webhook_id, outbox_id, event, payload)
+			SELECT
+				w.id, $1, $2, $3
+			FROM
+				webhooks w
+			WHERE
+				w.active
+				AND $2 = ANY(w.events)
+				AND w.user_id = (SELECT user_id FROM accounts WHERE id = $4)
+			ON CONFLICT (webhook_id, outbox_id) DO NOTHING
+		`, event.Id, event.Event, []byte(recipient.Payload), recipient.AccountId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create webhook deliveries: %w", err)
+		}
+	}
+
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM
+			webhook_deliveries d
+			JOIN webhooks w ON d.webhook_id = w.id
+		WHERE
+			d.outbox_id = $1 AND d.status <> 'success' AND w.active
+		ORDER BY d.id
+	`
+
+	return r.queryWebhookDeliveries(ctx, query, event.Id)
+}
+
+// GetWebhookDeliveries - журнал доставок webhook, последние сначала.
+func (r *PostgresRepository) GetWebhookDeliveries(ctx context.Context, webhookId int, limit int) ([]models.WebhookDelivery, error) {
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM
+			webhook_deliveries d
+			JOIN webhooks w ON d.webhook_id = w.id
+		WHERE
+			d.webhook_id = $1
+		ORDER BY d.id DESC
+		LIMIT $2
+	`
+
+	return r.queryWebhookDeliveries(ctx, query, webhookId, limit)
+}
+
+func (r *PostgresRepository) GetWebhookDelivery(ctx context.Context, webhookId int, id int64) (*models.WebhookDelivery, error) {
+	query := `
+		SELECT ` + webhookDeliveryColumns + `
+		FROM
+			webhook_deliveries d
+			JOIN webhooks w ON d.webhook_id = w.id
+		WHERE
+			d.webhook_id = $1 AND d.id = $2
+	`
+
+	deliveries, err := r.queryWebhookDeliveries(ctx, query, webhookId, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return &deliveries[0], nil
+}
+
+func (r *PostgresRepository) SaveWebhookAttempt(ctx context.Context, id int64, status string, responseCode int, responseBody string, errText string) (*models.WebhookDelivery, error) {
+	query := `
+		UPDATE
+			webhook_deliveries d
+		SET
+			status = $2, attempts = d.attempts + 1, response_code = $3,
+			response_body = $4, error = $5, last_attempt_at = NOW()
+		FROM
+			webhooks w
+		WHERE
+			d.id = $1 AND d.webhook_id = w.id
+		RETURNING ` + webhookDeliveryColumns
+
+	deliveries, err := r.queryWebhookDeliveries(ctx, query, id, status, nullInt(responseCode), responseBody, errText)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return &deliveries[0], nil
+}
+
+func scanWebhook(row rowScanner) (*models.Webhook, error) {
+	var hook models.Webhook
+	err := row.Scan(
+		&hook.Id,
+		&hook.UserId,
+		&hook.Url,
+		pq.Array(&hook.Events),
+		&hook.SecretNonce,
+		&hook.Active,
+		&hook.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func (r *PostgresRepository) queryWebhookDeliveries(ctx context.Context, query string, args ...any) ([]models.WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var payload []byte
+		err := rows.Scan(
+			&d.Id,
+			&d.WebhookId,
+			&d.OutboxId,
+			&d.Event,
+			&payload,
+			&d.Status,
+			&d.Attempts,
+			&d.ResponseCode,
+			&d.ResponseBody,
+			&d.Error,
+			&d.CreatedAt,
+			&d.LastAttemptAt,
+			&d.Url,
+			&d.SecretNonce,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		d.Payload = payload
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return deliveries, nil
+}
@@ -2,11 +2,27 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"time"
 	"uniback/dto"
 	"uniback/models"
 	//"uniback/models"
 )
 
+var (
+	ErrInsufficientFunds   = errors.New("insufficient funds")
+	ErrAccountNotActive    = errors.New("account is not active")
+	ErrHoldNotActive       = errors.New("card hold is not active")
+	ErrCardStatus          = errors.New("card status change is not allowed")
+	ErrCreditPaymentPaid   = errors.New("credit payment is already paid")
+	ErrCreditChanged       = errors.New("credit was changed concurrently")
+	ErrAccountStatus       = errors.New("account status change is not allowed")
+	ErrAccountNotEmpty     = errors.New("account has balance or unpaid credits")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrRefreshTokenRevoked = errors.New("refresh token is revoked or expired")
+	ErrTooManyPending      = errors.New("too many transfers wait for confirmation")
+)
+
 type Repository interface {
 	// User methods
 	IsUserExistsByUsernameEmailPhone(ctx context.Context)
@@ -28,16 +44,133 @@ type UserRepository interface {
 	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
 	IsUserExists(ctx context.Context, username string) (bool, error)
 	GetUserId(ctx context.Context, username string) (int, error)
+	// RememberLoginIp сохраняет IP входа и сообщает, новый ли это адрес для пользователя
+	RememberLoginIp(ctx context.Context, userId int, ip string) (bool, error)
+	GetAccountOwner(ctx context.Context, accountId int) (*models.User, error)
+
+	CreateRefreshToken(ctx context.Context, token models.RefreshToken) (*models.RefreshToken, error)
+	// RotateRefreshToken заменяет refresh-токен на next из той же семьи. Повторное
+	// использование заменённого токена отзывает семью и возвращает ErrRefreshTokenReused
+	RotateRefreshToken(ctx context.Context, hash []byte, next models.RefreshToken) (*models.RefreshToken, error)
+	RevokeTokenFamily(ctx context.Context, accessJti string, accessExpiresAt time.Time) error
+	RevokeUserTokens(ctx context.Context, username string) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	DeleteExpiredTokens(ctx context.Context, at time.Time) (int, error)
+	GetJwtKeys(ctx context.Context, retiredAfter time.Time) ([]models.JwtKey, error)
+	// RotateJwtKey сохраняет key последним ключом, если последний создан до createdBefore
+	// или у него другой алгоритм, прежний ключ выводится из оборота в key.ActivatesAt
+	RotateJwtKey(ctx context.Context, key models.JwtKey, createdBefore time.Time) (bool, error)
+	GetTotp(ctx context.Context, userId int) (*models.Totp, error)
+	SetTotpSecret(ctx context.Context, userId int, secret []byte) error
+	EnableTotp(ctx context.Context, userId int, step int64, recoveryHashes [][]byte) error
+	DisableTotp(ctx context.Context, userId int) error
+	// UseTotpStep возвращает false, если код этого шага уже был принят
+	UseTotpStep(ctx context.Context, userId int, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userId int, hash []byte) (bool, error)
+	CreateMfaChallenge(ctx context.Context, userId int, hash []byte, expiresAt time.Time) error
+	AttemptMfaChallenge(ctx context.Context, hash []byte, maxAttempts int) (*models.MfaChallenge, error)
+	CompleteMfaChallenge(ctx context.Context, id int64) error
+	HasTransferredTo(ctx context.Context, userId int, destAccountId int) (bool, error)
+	// Если у пользователя уже maxOpen неистёкших переводов, возвращается ErrTooManyPendingTransfers
+	CreatePendingTransfer(ctx context.Context, transfer models.PendingTransfer, maxOpen int) (*models.PendingTransfer, error)
+	GetPendingTransfer(ctx context.Context, id int64, username string) (*models.PendingTransfer, error)
+	AttemptPendingTransfer(ctx context.Context, id int64, maxAttempts int) (*models.PendingTransfer, error)
+	SetPendingTransferStatus(ctx context.Context, id int64, from string, to string, errText string) error
+	CreateLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error
+	GetLoginBlockedUntil(ctx context.Context, username string, ip string) (*time.Time, error)
+	GetThrottleBlockedUntil(ctx context.Context, scope string, key string) (*time.Time, error)
+	RecordLoginFailure(ctx context.Context, scope string, key string, at time.Time, resetBefore time.Time) (int, error)
+	BlockLogin(ctx context.Context, scope string, key string, until time.Time) error
+	LockLogin(ctx context.Context, key string, until time.Time, unlockHash []byte, notifiedBefore time.Time, at time.Time) (bool, error)
+	ResetLoginFailures(ctx context.Context, scope string, key string) error
+	UnlockLogin(ctx context.Context, hash []byte, at time.Time) (bool, error)
+	DeleteStaleLoginThrottles(ctx context.Context, failedBefore time.Time, at time.Time) (int, error)
 
 	GetAccountsByUsername(ctx context.Context, username string) (*dto.AccountsResponseDto, error)
 	IsAccountExits(ctx context.Context, accountNumber string) (bool, error)
 	CreateAccount(ctx context.Context, acc models.Account) (*dto.AccountResponseDto, error)
 	GetAccountByUsername(ctx context.Context, account string, username string) (*models.Account, error)
 	GetAccountByNumber(ctx context.Context, account string) (*models.Account, error)
+	// UpdateAccountStatus проверяет переход по models.CanChangeAccountStatus, закрыть можно только пустой счёт
+	UpdateAccountStatus(ctx context.Context, accountId int, status string) (*models.Account, error)
+
+	// Балансы меняются только проводками entry, accounts.balance - кэш главной книги
+	UpdateAccountTransaction(ctx context.Context, acc models.Account, amount models.Money, fee models.Money, trsType string, entry models.JournalEntry) (*models.Account, error)
+	TransferAccountsTransaction(ctx context.Context, src models.Account, dest models.Account, amount models.Money, fee models.Money, entry models.JournalEntry) (*models.Account, error)
+	GetAccountTransactions(ctx context.Context, accountId int, filter models.TransactionFilter) ([]models.AccountTransaction, error)
+	GetAccountBalanceAt(ctx context.Context, accountId int, at time.Time) (models.Money, error)
+
+	// Карты ищутся только по HMAC номера (слепой индекс), а не по шифротексту
+	IsCardExists(ctx context.Context, numberHmac []byte) (bool, error)
+	CreateNewCard(ctx context.Context, card models.Card, initiatorId int) (*models.Card, error)
+	GetCardByIdAndUsername(ctx context.Context, cardId int, username string) (*models.Card, error)
+	// Смена статуса проверяется по models.CanChangeCardStatus и пишется в card_events
+	UpdateCardStatus(ctx context.Context, cardId int, status string, initiatorId int, reason string) (*models.Card, error)
+	// ReissueCard переводит карту в lost и выпускает вместо неё newCard на тот же счёт
+	ReissueCard(ctx context.Context, cardId int, newCard models.Card, initiatorId int) (*models.Card, error)
+	GetCardEvents(ctx context.Context, cardId int) ([]models.CardEvent, error)
+	GetCardsByUsername(ctx context.Context, username string) ([]models.Card, error)
+	GetCardByNumberHmac(ctx context.Context, numberHmac []byte) (*models.Card, error)
+	GetCardsWithoutNumberHmac(ctx context.Context) ([]models.Card, error)
+	SetCardNumberHmac(ctx context.Context, cardId int, numberHmac []byte) error
+
+	AuthorizeCardHold(ctx context.Context, hold models.CardHold) (*models.CardHold, error)
+	GetCardHold(ctx context.Context, id int) (*models.CardHold, error)
+	CaptureCardHold(ctx context.Context, hold models.CardHold, amount models.Money, entry models.JournalEntry) (*models.CardHold, error)
+	VoidCardHold(ctx context.Context, id int) (*models.CardHold, error)
+
+	// CreateCredit сохраняет кредит с графиком и зачисляет его сумму проводкой entry
+	CreateCredit(ctx context.Context, loan models.Loan, schedule []models.CreditPayment, entry models.JournalEntry) (*models.Loan, error)
+	GetCreditsByUsername(ctx context.Context, username string) ([]models.Loan, error)
+	GetCreditByIdAndUsername(ctx context.Context, creditId int, username string) (*models.Loan, error)
+	GetCreditSchedule(ctx context.Context, creditId int) ([]models.CreditPayment, error)
+	GetDueCreditPayments(ctx context.Context, at time.Time) ([]models.DueCreditPayment, error)
+	GetUpcomingCreditPayments(ctx context.Context, accountId int, to time.Time) ([]models.DueCreditPayment, error)
+	PayCreditPayment(ctx context.Context, payment models.DueCreditPayment, entry models.JournalEntry) error
+	MarkCreditPaymentOverdue(ctx context.Context, payment models.DueCreditPayment, penalty models.Money, accruedAt time.Time) error
+	// RepayCredit списывает досрочное погашение проводкой entry и заменяет
+	// неоплаченные платежи pending новой версией графика schedule
+	RepayCredit(ctx context.Context, loan models.Loan, repayment models.CreditRepayment, pending []models.CreditPayment, schedule []models.CreditPayment, entry models.JournalEntry) (*models.Loan, error)
+	GetCreditScheduleHistory(ctx context.Context, creditId int) ([]models.CreditPayment, error)
+	GetCreditRepayments(ctx context.Context, creditId int) ([]models.CreditRepayment, error)
+	GetCreditReminders(ctx context.Context, to time.Time) ([]models.CreditReminder, error)
+	MarkCreditPaymentReminded(ctx context.Context, paymentId int) error
+	GetAnalytics(ctx context.Context, username string, from time.Time, to time.Time, granularity string) ([]models.AnalyticsPeriod, error)
+	GetCategorySpending(ctx context.Context, username string, from time.Time, to time.Time) (map[string]models.Money, error)
+	SetTransactionCategory(ctx context.Context, username string, transactionId int, category string) (string, error)
+	AddCategoryRule(ctx context.Context, username string, pattern string, category string) error
+	GetBudgets(ctx context.Context, username string) ([]models.Budget, error)
+	SetBudget(ctx context.Context, username string, category string, amount models.Money) (*models.Budget, error)
+	DeleteBudget(ctx context.Context, username string, category string) error
+
+	// AcquireJobLock берёт advisory lock задачи job, чтобы её не выполняли
+	// одновременно несколько экземпляров приложения. unlock нужно вызвать всегда, если acquired
+	AcquireJobLock(ctx context.Context, job string) (unlock func(), acquired bool, err error)
+	StartJobRun(ctx context.Context, job string) (int, error)
+	FinishJobRun(ctx context.Context, id int, status string, processed int, errText string) error
+
+	GetLatestKeyRate(ctx context.Context, at time.Time) (*models.KeyRate, error)
+	SaveKeyRates(ctx context.Context, rates []models.KeyRate) error
+
+	// ClaimOutboxEvents забирает готовые к доставке события outbox, пока их
+	// не вернёт в очередь Complete/Fail или не истечёт lease
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error)
+	CompleteOutboxEvent(ctx context.Context, id int64) error
+	FailOutboxEvent(ctx context.Context, id int64, delivered []string, nextAttemptAt time.Time, dead bool, errText string) error
 
-	UpdateAccountTransaction(ctx context.Context, acc models.Account, amount float64, fee float64, trsType string) (*models.Account, error)
-	TransferAccountsTransaction(ctx context.Context, src models.Account, dest models.Account, amount float64, fee float64) (*models.Account, error)
+	CreateWebhook(ctx context.Context, username string, hook models.Webhook) (*models.Webhook, error)
+	GetWebhooks(ctx context.Context, username string) ([]models.Webhook, error)
+	GetWebhookByIdAndUsername(ctx context.Context, id int, username string) (*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, username string, id int) error
+	// PrepareWebhookDeliveries заводит доставки события outbox на webhook владельцев
+	// счетов recipients со своими данными и возвращает ещё не доставленные
+	PrepareWebhookDeliveries(ctx context.Context, event models.OutboxEvent, recipients []models.WebhookRecipient) ([]models.WebhookDelivery, error)
+	GetWebhookDeliveries(ctx context.Context, webhookId int, limit int) ([]models.WebhookDelivery, error)
+	GetWebhookDelivery(ctx context.Context, webhookId int, id int64) (*models.WebhookDelivery, error)
+	SaveWebhookAttempt(ctx context.Context, id int64, status string, responseCode int, responseBody string, errText string) (*models.WebhookDelivery, error)
 
-	IsCardExists(ctx context.Context, number []byte) (bool, error)
-	CreateNewCard(ctx context.Context, card models.Card) error
+	AcquireIdempotencyKey(ctx context.Context, key models.IdempotencyKey, staleBefore time.Time) (*models.IdempotencyKey, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, id int, code int, body []byte, contentType string) error
+	DeleteIdempotencyKey(ctx context.Context, id int) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int, error)
 }
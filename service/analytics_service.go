@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+)
+
+// SqlAnalyticsService считает обороты и траты агрегирующими запросами в БД,
+// в Go остаётся только группировка и прогноз.
+type SqlAnalyticsService struct {
+	userRepo repository.UserRepository
+}
+
+func NewSqlAnalyticsService(u repository.UserRepository) *SqlAnalyticsService {
+	return &SqlAnalyticsService{userRepo: u}
+}
+
+func (s *SqlAnalyticsService) Analytics(ctx context.Context, username string, from time.Time, to time.Time, granularity string) (*models.Analytics, error) {
+	rows, err := s.userRepo.GetAnalytics(ctx, username, from, to, granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	return models.SummarizeAnalytics(from, to, granularity, rows), nil
+}
+
+// BudgetReport сравнивает траты за месяц month с бюджетами пользователя и
+// прогнозирует траты на конец месяца по темпу на дату at.
+func (s *SqlAnalyticsService) BudgetReport(ctx context.Context, username string, month time.Time, at time.Time) ([]models.BudgetStatus, error) {
+	budgets, err := s.userRepo.GetBudgets(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	start := models.MonthStart(month)
+	spent, err := s.userRepo.GetCategorySpending(ctx, username, start, start.AddDate(0, 1, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	return models.BuildBudgetReport(start, at, budgets, spent), nil
+}
+
+// Forecast прогнозирует баланс активных счетов пользователя на days дней:
+// регулярные операции ищутся в истории за последние полгода, платежи по
+// кредитам берутся из графиков.
+func (s *SqlAnalyticsService) Forecast(ctx context.Context, username string, days int, at time.Time) ([]models.AccountForecast, error) {
+	accounts, err := s.userRepo.GetAccountsByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	historyFrom := at.AddDate(0, 0, -models.ForecastHistoryDays)
+	to := at.AddDate(0, 0, days)
+
+	result := []models.AccountForecast{}
+	for _, item := range accounts.Acounts {
+		if item.Status != "active" {
+			continue
+		}
+
+		acc, err := s.userRepo.GetAccountByUsername(ctx, item.AccountNumber, username)
+		if err != nil {
+			return nil, err
+		}
+
+		history, err := s.userRepo.GetAccountTransactions(ctx, acc.Id, models.TransactionFilter{From: &historyFrom, To: &at})
+		if err != nil {
+			return nil, err
+		}
+
+		payments, err := s.userRepo.GetUpcomingCreditPayments(ctx, acc.Id, to)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, models.BuildForecast(*acc, at, days, models.DetectRecurring(history, at), payments))
+	}
+
+	return result, nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"time"
+	"uniback/repository"
+	"uniback/utils"
+)
+
+type AttemptGuardConfig struct {
+	backoffAfter   int
+	ipBackoffAfter int
+}
+
+func TransferCodeGuardConfigFromGlobalConfig(cfg *utils.Config) *AttemptGuardConfig {
+	return &AttemptGuardConfig{
+		backoffAfter:   cfg.TransferCodeBackoff,
+		ipBackoffAfter: cfg.TransferCodeIpBackoff,
+	}
+}
+
+// ThrottleAttemptGuard считает неудачные попытки (неверные коды, реквизиты)
+// по пользователю и по IP в login_throttle. После backoffAfter неудач по
+// пользователю или ipBackoffAfter по IP каждая следующая удваивает паузу, как
+// при входе. Счётчики разных проверок разделяются по scope.
+type ThrottleAttemptGuard struct {
+	userRepo  repository.UserRepository
+	userScope string
+	ipScope   string
+	cfg       AttemptGuardConfig
+	now       func() time.Time
+}
+
+func NewThrottleAttemptGuard(u repository.UserRepository, userScope string, ipScope string, cfg *AttemptGuardConfig) *ThrottleAttemptGuard {
+	return &ThrottleAttemptGuard{
+		userRepo:  u,
+		userScope: userScope,
+		ipScope:   ipScope,
+		cfg:       *cfg,
+		now:       time.Now,
+	}
+}
+
+// Check возвращает, сколько ждать до следующей попытки, 0 - можно пробовать.
+func (g *ThrottleAttemptGuard) Check(ctx context.Context, username string, ip string) (time.Duration, error) {
+	var wait time.Duration
+	now := g.now()
+
+	for scope, key := range map[string]string{g.userScope: loginKey(username), g.ipScope: ip} {
+		blockedUntil, err := g.userRepo.GetThrottleBlockedUntil(ctx, scope, key)
+		if err != nil {
+			return 0, err
+		}
+		if blockedUntil != nil && blockedUntil.Sub(now) > wait {
+			wait = blockedUntil.Sub(now)
+		}
+	}
+
+	return wait, nil
+}
+
+// Failure учитывает неудачную попытку пользователя username с адреса ip.
+func (g *ThrottleAttemptGuard) Failure(ctx context.Context, username string, ip string) error {
+	if err := g.failure(ctx, g.ipScope, ip, g.cfg.ipBackoffAfter); err != nil {
+		return err
+	}
+	return g.failure(ctx, g.userScope, loginKey(username), g.cfg.backoffAfter)
+}
+
+func (g *ThrottleAttemptGuard) failure(ctx context.Context, scope string, key string, backoffAfter int) error {
+	now := g.now()
+
+	failures, err := g.userRepo.RecordLoginFailure(ctx, scope, key, now, now.Add(-loginFailureWindow))
+	if err != nil {
+		return err
+	}
+
+	if delay := loginBackoff(failures, backoffAfter); delay > 0 {
+		return g.userRepo.BlockLogin(ctx, scope, key, now.Add(delay))
+	}
+	return nil
+}
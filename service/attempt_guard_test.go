@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+	"uniback/models"
+)
+
+func TestAttemptGuard(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeLoginRepo{throttles: map[string]*fakeThrottle{}}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	g := NewThrottleAttemptGuard(repo, models.ThrottleScopeTransferUser, models.ThrottleScopeTransferIp, &AttemptGuardConfig{backoffAfter: 2, ipBackoffAfter: 4})
+	g.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		g.Failure(ctx, "ivan", "10.0.0.1")
+	}
+	if wait, err := g.Check(ctx, "ivan", "10.0.0.1"); err != nil || wait != 0 {
+		t.Fatalf("Expected no delay before backoff, but %s (%v)", wait, err)
+	}
+
+	g.Failure(ctx, "ivan", "10.0.0.1")
+	g.Failure(ctx, "ivan", "10.0.0.1")
+	// Пользователь ограничен и с другого адреса
+	if wait, _ := g.Check(ctx, "ivan", "10.0.0.2"); wait != 2*time.Second {
+		t.Errorf("Expected 2s user delay, but %s", wait)
+	}
+
+	// Перебор с одного IP от разных пользователей
+	g.Failure(ctx, "petr", "10.0.0.1")
+	if wait, _ := g.Check(ctx, "anna", "10.0.0.1"); wait != time.Second {
+		t.Errorf("Expected 1s ip delay, but %s", wait)
+	}
+
+	// Счётчики входа не затрагиваются
+	if _, ok := repo.throttles[models.LoginScopeUser+":ivan"]; ok {
+		t.Errorf("Expected login counter to stay untouched")
+	}
+}
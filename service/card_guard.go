@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/utils"
+)
+
+type CardGuardConfig struct {
+	attempts   AttemptGuardConfig
+	blockAfter int
+}
+
+func CardGuardConfigFromGlobalConfig(cfg *utils.Config) *CardGuardConfig {
+	return &CardGuardConfig{
+		attempts: AttemptGuardConfig{
+			backoffAfter:   cfg.CardCheckBackoff,
+			ipBackoffAfter: cfg.CardCheckIpBackoff,
+		},
+		blockAfter: cfg.CardCheckBlockAfter,
+	}
+}
+
+// ThrottleCardGuard считает неверные срок действия и CVV по пользователю и IP
+// (паузы как у ThrottleAttemptGuard) и по самой карте. После blockAfter неудач
+// по карте за сутки она блокируется: иначе разные пользователи могли бы вместе
+// перебрать 1000 вариантов CVV.
+type ThrottleCardGuard struct {
+	userRepo   repository.UserRepository
+	attempts   *ThrottleAttemptGuard
+	blockAfter int
+	now        func() time.Time
+}
+
+func NewThrottleCardGuard(u repository.UserRepository, cfg *CardGuardConfig) *ThrottleCardGuard {
+	return &ThrottleCardGuard{
+		userRepo:   u,
+		attempts:   NewThrottleAttemptGuard(u, models.ThrottleScopeCardUser, models.ThrottleScopeCardIp, &cfg.attempts),
+		blockAfter: cfg.blockAfter,
+		now:        time.Now,
+	}
+}
+
+func (g *ThrottleCardGuard) Check(ctx context.Context, username string, ip string) (time.Duration, error) {
+	return g.attempts.Check(ctx, username, ip)
+}
+
+// Failure учитывает неудачную проверку карты. card - найденная по номеру
+// карта или nil, если номера нет.
+func (g *ThrottleCardGuard) Failure(ctx context.Context, username string, ip string, card *models.Card) error {
+	if err := g.attempts.Failure(ctx, username, ip); err != nil {
+		return err
+	}
+
+	if card == nil {
+		return nil
+	}
+
+	now := g.now()
+	key := strconv.Itoa(card.Id)
+
+	failures, err := g.userRepo.RecordLoginFailure(ctx, models.ThrottleScopeCard, key, now, now.Add(-loginFailureWindow))
+	if err != nil {
+		return err
+	}
+
+	if failures < g.blockAfter {
+		return nil
+	}
+
+	if err := g.userRepo.ResetLoginFailures(ctx, models.ThrottleScopeCard, key); err != nil {
+		return err
+	}
+
+	if card.Status != models.CardActive {
+		return nil
+	}
+
+	// Карту блокирует система, поэтому initiator не указывается
+	_, err = g.userRepo.UpdateCardStatus(ctx, card.Id, models.CardBlocked, 0, "too many failed card checks")
+	if errors.Is(err, repository.ErrCardStatus) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	utils.GlobalLogger().Info("Card %d is blocked after %d failed checks, last by %s from %s", card.Id, failures, username, ip)
+	return nil
+}
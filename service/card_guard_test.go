@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	"uniback/models"
+)
+
+// fakeCardGuardRepo - счётчики в памяти и журнал смены статуса карт
+type fakeCardGuardRepo struct {
+	fakeLoginRepo
+	events []models.CardEvent
+}
+
+func (f *fakeCardGuardRepo) UpdateCardStatus(ctx context.Context, cardId int, status string, initiatorId int, reason string) (*models.Card, error) {
+	f.events = append(f.events, models.CardEvent{CardId: cardId, NewStatus: status, Reason: reason})
+	return &models.Card{Id: cardId, Status: status}, nil
+}
+
+func TestCardGuard(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeCardGuardRepo{fakeLoginRepo: fakeLoginRepo{throttles: map[string]*fakeThrottle{}}}
+	g := NewThrottleCardGuard(repo, &CardGuardConfig{
+		attempts:   AttemptGuardConfig{backoffAfter: 3, ipBackoffAfter: 20},
+		blockAfter: 5,
+	})
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	g.now = func() time.Time { return now }
+	g.attempts.now = g.now
+
+	card := &models.Card{Id: 7, Status: models.CardActive}
+
+	// Разные пользователи с разных адресов: по ним пауз нет, но карта блокируется
+	users := []string{"ivan", "petr", "anna", "oleg", "vera"}
+	for i, user := range users {
+		if err := g.Failure(ctx, user, fmt.Sprintf("10.0.0.%d", i+1), card); err != nil {
+			t.Fatalf("Failure error: %v", err)
+		}
+		if i < len(users)-1 && len(repo.events) != 0 {
+			t.Fatalf("Card blocked after %d failures", i+1)
+		}
+	}
+
+	if len(repo.events) != 1 || repo.events[0].CardId != 7 || repo.events[0].NewStatus != models.CardBlocked {
+		t.Fatalf("Expected card to be blocked, but %+v", repo.events)
+	}
+	if _, ok := repo.throttles[models.ThrottleScopeCard+":7"]; ok {
+		t.Errorf("Expected card counter to be reset after block")
+	}
+
+	// Неизвестный номер считается только по пользователю и IP
+	for i := 0; i < 4; i++ {
+		g.Failure(ctx, "ivan", "10.0.0.9", nil)
+	}
+	if wait, _ := g.Check(ctx, "ivan", "10.0.0.1"); wait != 2*time.Second {
+		t.Errorf("Expected 2s delay for user, but %s", wait)
+	}
+	if len(repo.events) != 1 {
+		t.Errorf("Unexpected card events %+v", repo.events)
+	}
+
+	// Уже заблокированная карта повторно не блокируется
+	blocked := &models.Card{Id: 8, Status: models.CardBlocked}
+	for i := 0; i < 5; i++ {
+		g.Failure(ctx, "petr", "10.0.1.1", blocked)
+	}
+	if len(repo.events) != 1 {
+		t.Errorf("Expected no event for blocked card, but %+v", repo.events)
+	}
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"uniback/repository"
+	"uniback/utils"
+)
+
+// BackfillCardNumberIndex заполняет слепой индекс номера для карт,
+// выпущенных до его появления. Вызывается один раз при запуске.
+func BackfillCardNumberIndex(ctx context.Context, u repository.UserRepository, cs CryptoService) error {
+	log := utils.GlobalLogger()
+
+	cards, err := u.GetCardsWithoutNumberHmac(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, card := range cards {
+		number := cs.PgpDecode(card.Number)
+		if number == "" {
+			log.Error("Can't decode number of card %d, skip it", card.Id)
+			continue
+		}
+
+		if err := u.SetCardNumberHmac(ctx, card.Id, cs.HmacIndex(number)); err != nil {
+			log.Error("Can't set number index for card %d: %w", card.Id, err)
+			continue
+		}
+	}
+
+	if len(cards) > 0 {
+		log.Info("Card number index filled for %d cards", len(cards))
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/utils"
+)
+
+// RemindCreditPayments напоминает клиентам о платежах по кредитам, срок
+// которых наступит в ближайшие days дней. Напоминание отправляется один раз.
+func RemindCreditPayments(ctx context.Context, u repository.UserRepository, n Notifier, at time.Time, days int) (int, error) {
+	log := utils.GlobalLogger()
+
+	reminders, err := u.GetCreditReminders(ctx, at.AddDate(0, 0, days))
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	var firstErr error
+
+	for _, reminder := range reminders {
+		err := n.Notify(ctx, reminder.Email, models.Notification{
+			Event:    models.NotifyCreditPaymentDue,
+			Username: reminder.Username,
+			Data: map[string]string{
+				"credit":   strconv.Itoa(reminder.CreditId),
+				"account":  reminder.AccountNumber,
+				"amount":   reminder.Total().String(),
+				"due_date": reminder.DueDate.Format("02.01.2006"),
+			},
+		})
+		if err == nil {
+			err = u.MarkCreditPaymentReminded(ctx, reminder.Id)
+		}
+		if err != nil {
+			log.Error("Can't remind about credit %d payment %d: %w", reminder.CreditId, reminder.Number, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		processed++
+	}
+
+	return processed, firstErr
+}
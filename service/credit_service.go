@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/utils"
+)
+
+var (
+	ErrUnknownCreditProduct = errors.New("unknown credit product")
+	ErrCreditClosed         = errors.New("credit is already paid")
+	ErrCreditOverdue        = errors.New("credit has overdue payments")
+	ErrRepaymentTooLarge    = errors.New("repayment exceeds outstanding principal")
+)
+
+type LoanServiceConfig struct {
+	// Надбавка к ключевой ставке по кредитным продуктам
+	marginsBp map[string]int
+	// Ставка пени за просрочку, годовых
+	penaltyRateBp int
+}
+
+type LoanService struct {
+	userRepo     repository.UserRepository
+	transactions Service
+	keyRates     KeyRateProvider
+	cfg          LoanServiceConfig
+}
+
+func NewLoanService(u repository.UserRepository, trs Service, kr KeyRateProvider, marginsBp map[string]int, penaltyRateBp int) *LoanService {
+	return &LoanService{
+		userRepo:     u,
+		transactions: trs,
+		keyRates:     kr,
+		cfg: LoanServiceConfig{
+			marginsBp:     marginsBp,
+			penaltyRateBp: penaltyRateBp,
+		},
+	}
+}
+
+// CreditRate возвращает ставку продукта на дату: ключевая ставка + надбавка.
+func (s *LoanService) CreditRate(ctx context.Context, product string, at time.Time) (keyRate *models.KeyRate, marginBp int, err error) {
+	marginBp, ok := s.cfg.marginsBp[product]
+	if !ok {
+		return nil, 0, ErrUnknownCreditProduct
+	}
+
+	keyRate, err = s.keyRates.KeyRate(ctx, at)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return keyRate, marginBp, nil
+}
+
+// IssueCredit строит график платежей и выдаёт кредит на кредитный счёт клиента.
+func (s *LoanService) IssueCredit(ctx context.Context, acc models.Account, product string, principal models.Money, months int, scheduleType string) (*models.Loan, []models.CreditPayment, error) {
+	if acc.AccountType != "credit" {
+		return nil, nil, fmt.Errorf("credit can be issued only to credit account")
+	}
+
+	if acc.Status != "active" {
+		return nil, nil, repository.ErrAccountNotActive
+	}
+
+	now := time.Now()
+
+	keyRate, marginBp, err := s.CreditRate(ctx, product, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	rateBp := keyRate.RateBp + marginBp
+
+	schedule, err := models.BuildCreditSchedule(principal, rateBp, months, scheduleType, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loan, err := s.transactions.DisburseCredit(ctx, acc, models.Loan{
+		UserId:         acc.UserId,
+		AccountId:      acc.Id,
+		AccountNumber:  acc.AccountNumber,
+		Principal:      principal,
+		Product:        product,
+		KeyRateBp:      keyRate.RateBp,
+		MarginBp:       marginBp,
+		RateBp:         rateBp,
+		TermMonths:     months,
+		ScheduleType:   scheduleType,
+		MonthlyPayment: schedule[0].Payment,
+		Status:         models.CreditActive,
+	}, schedule)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loan.AccountNumber = acc.AccountNumber
+	for i := range schedule {
+		schedule[i].CreditId = loan.Id
+	}
+
+	return loan, schedule, nil
+}
+
+// RepayCredit досрочно гасит часть основного долга и пересчитывает оставшийся
+// график. Пока есть просроченные платежи, досрочное погашение недоступно.
+func (s *LoanService) RepayCredit(ctx context.Context, loan models.Loan, amount models.Money, mode string) (*models.Loan, []models.CreditPayment, error) {
+	switch loan.Status {
+	case models.CreditPaid:
+		return nil, nil, ErrCreditClosed
+	case models.CreditOverdue:
+		return nil, nil, ErrCreditOverdue
+	}
+
+	schedule, err := s.userRepo.GetCreditSchedule(ctx, loan.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pending []models.CreditPayment
+	outstanding := models.NewMoney(0)
+	for _, p := range schedule {
+		switch p.Status {
+		case models.PaymentOverdue:
+			return nil, nil, ErrCreditOverdue
+		case models.PaymentPending:
+			pending = append(pending, p)
+			outstanding = outstanding.Add(p.Principal)
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil, nil, ErrCreditClosed
+	}
+
+	if amount.Cmp(outstanding) > 0 {
+		return nil, nil, ErrRepaymentTooLarge
+	}
+
+	newSchedule, err := models.RecalculateCreditSchedule(loan, pending, amount, mode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// При полном погашении срок и платёж остаются как были, кредит закрывается
+	if len(newSchedule) > 0 {
+		loan.MonthlyPayment = newSchedule[0].Payment
+		loan.TermMonths = pending[0].Number - 1 + len(newSchedule)
+	}
+
+	updated, err := s.transactions.PrepayCredit(ctx, loan, models.CreditRepayment{
+		CreditId: loan.Id,
+		Mode:     mode,
+		Amount:   amount,
+	}, pending, newSchedule)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	schedule, err = s.userRepo.GetCreditSchedule(ctx, loan.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return updated, schedule, nil
+}
+
+// CollectDuePayments списывает платежи, срок которых наступил к дате at. Если
+// денег на счёте не хватает, платёж становится просроченным и на него
+// начисляются пени за дни с момента прошлого начисления.
+func (s *LoanService) CollectDuePayments(ctx context.Context, at time.Time) (int, error) {
+	log := utils.GlobalLogger()
+
+	payments, err := s.userRepo.GetDueCreditPayments(ctx, at)
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	var firstErr error
+
+	for _, payment := range payments {
+		err := s.transactions.PayCreditPayment(ctx, payment)
+		switch {
+		case err == nil:
+			log.Info("Credit %d payment %d paid", payment.CreditId, payment.Number)
+			processed++
+			continue
+		case errors.Is(err, repository.ErrCreditPaymentPaid):
+			continue
+		case !errors.Is(err, repository.ErrInsufficientFunds) && !errors.Is(err, repository.ErrAccountNotActive):
+			log.Error("Credit %d payment %d error: %w", payment.CreditId, payment.Number, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		since := payment.DueDate
+		if payment.PenaltyAccruedAt != nil && payment.PenaltyAccruedAt.After(since) {
+			since = *payment.PenaltyAccruedAt
+		}
+		penalty := models.CreditPenalty(payment.Payment, s.cfg.penaltyRateBp, daysBetween(since, at))
+
+		if err := s.userRepo.MarkCreditPaymentOverdue(ctx, payment, penalty, at); err != nil {
+			log.Error("Can't mark credit %d payment %d overdue: %w", payment.CreditId, payment.Number, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		log.Info("Credit %d payment %d overdue, penalty %s", payment.CreditId, payment.Number, penalty)
+		processed++
+	}
+
+	return processed, firstErr
+}
+
+// daysBetween считает календарные дни между датами без учёта времени.
+func daysBetween(from time.Time, to time.Time) int {
+	fromDate := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(toDate.Sub(fromDate).Hours() / 24)
+}
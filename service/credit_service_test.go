@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+)
+
+// fakeRepayRepo - график кредита в памяти, RepayCredit только запоминает новую версию
+type fakeRepayRepo struct {
+	repository.UserRepository
+	schedule []models.CreditPayment
+	pending  []models.CreditPayment
+	repaid   []models.CreditPayment
+	entry    models.JournalEntry
+}
+
+func (f *fakeRepayRepo) GetCreditSchedule(ctx context.Context, creditId int) ([]models.CreditPayment, error) {
+	return f.schedule, nil
+}
+
+func (f *fakeRepayRepo) RepayCredit(ctx context.Context, loan models.Loan, repayment models.CreditRepayment, pending []models.CreditPayment, schedule []models.CreditPayment, entry models.JournalEntry) (*models.Loan, error) {
+	f.pending, f.repaid, f.entry = pending, schedule, entry
+	loan.ScheduleVersion++
+	return &loan, nil
+}
+
+func TestRepayCredit(t *testing.T) {
+	loan := models.Loan{Id: 1, AccountId: 7, RateBp: 1200, ScheduleType: models.ScheduleAnnuity, TermMonths: 12, Status: models.CreditActive, ScheduleVersion: 1}
+	schedule, err := models.BuildCreditSchedule(models.NewMoney(10000000), loan.RateBp, 12, loan.ScheduleType, time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Schedule error: %v", err)
+	}
+	schedule[0].Status = models.PaymentPaid
+
+	repo := &fakeRepayRepo{schedule: schedule}
+	s := NewLoanService(repo, NewTransactionService(repo), nil, nil, 2000)
+
+	updated, _, err := s.RepayCredit(context.Background(), loan, models.NewMoney(3000000), models.RepayShortenTerm)
+	if err != nil {
+		t.Fatalf("Repay error: %v", err)
+	}
+
+	if updated.ScheduleVersion != 2 || updated.TermMonths >= 12 || updated.TermMonths != 1+len(repo.repaid) || repo.repaid[0].Number != 2 {
+		t.Errorf("Expected shorter schedule from payment 2, but term %d, %d payments", updated.TermMonths, len(repo.repaid))
+	}
+
+	// Заменяются только неоплаченные строки, по которым считался новый график
+	if len(repo.pending) != 11 || repo.pending[0].Number != 2 {
+		t.Errorf("Expected 11 pending payments from payment 2, but %d", len(repo.pending))
+	}
+
+	if err := repo.entry.Validate(); err != nil || len(repo.entry.Postings) != 2 {
+		t.Errorf("Expected balanced prepayment entry, but %+v (%v)", repo.entry, err)
+	}
+
+	if _, _, err := s.RepayCredit(context.Background(), loan, schedule[0].Remaining.Add(models.NewMoney(1)), models.RepayShortenTerm); !errors.Is(err, ErrRepaymentTooLarge) {
+		t.Errorf("Expected too large repayment error, but %v", err)
+	}
+
+	schedule[1].Status = models.PaymentOverdue
+	if _, _, err := s.RepayCredit(context.Background(), loan, models.NewMoney(100), models.RepayShortenTerm); !errors.Is(err, ErrCreditOverdue) {
+		t.Errorf("Expected overdue error, but %v", err)
+	}
+}
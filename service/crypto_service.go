@@ -3,7 +3,9 @@ package service
 import (
 	"bytes"
 	"crypto"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"math/big"
@@ -178,13 +180,29 @@ func (cs *PgpHmacService) PgpEncode(data string) []byte {
 func (cs *PgpHmacService) PgpDecode(data []byte) string {
 	encryptedBuf := bytes.NewBuffer(data)
 
-	block, _ := armor.Decode(bytes.NewReader(encryptedBuf.Bytes()))
+	block, err := armor.Decode(bytes.NewReader(encryptedBuf.Bytes()))
+	if err != nil {
+		utils.GlobalLogger().Error("Can't decode pgp armor: %w", err)
+		return ""
+	}
 	keyRing := &openpgp.EntityList{&cs.pgpPrivateKey}
-	md, _ := openpgp.ReadMessage(block.Body, keyRing, nil, nil)
+	md, err := openpgp.ReadMessage(block.Body, keyRing, nil, nil)
+	if err != nil {
+		utils.GlobalLogger().Error("Can't read pgp message: %w", err)
+		return ""
+	}
 	decrypted, _ := io.ReadAll(md.UnverifiedBody)
 	return string(decrypted)
 }
 
+// HmacIndex считает HMAC-SHA256 от данных на ключе HmacKey. Используется как
+// слепой индекс: по нему можно искать зашифрованные PGP значения.
+func (cs *PgpHmacService) HmacIndex(data string) []byte {
+	mac := hmac.New(sha256.New, []byte(cs.cfg.hmacKey))
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
 func (cs *PgpHmacService) GenerateCardLuhn() (string, error) {
 	prefix := "2" // Карты "Мир" начинаются с 2
 	length := 16  // Стандартная длина номера карты
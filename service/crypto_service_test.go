@@ -0,0 +1,28 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHmacIndex(t *testing.T) {
+	cs := &PgpHmacService{cfg: PgpHmacConfig{hmacKey: "test_key"}}
+
+	first := cs.HmacIndex("2200123456781234")
+	if len(first) != 32 {
+		t.Fatalf("Expected 32 bytes HMAC-SHA256, but %d", len(first))
+	}
+
+	if !bytes.Equal(first, cs.HmacIndex("2200123456781234")) {
+		t.Errorf("Expected the same index for the same number")
+	}
+
+	if bytes.Equal(first, cs.HmacIndex("2200123456781235")) {
+		t.Errorf("Expected different index for different numbers")
+	}
+
+	other := &PgpHmacService{cfg: PgpHmacConfig{hmacKey: "other_key"}}
+	if bytes.Equal(first, other.HmacIndex("2200123456781234")) {
+		t.Errorf("Expected index to depend on the key")
+	}
+}
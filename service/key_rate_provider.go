@@ -0,0 +1,248 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/utils"
+)
+
+const (
+	cbrKeyRateAction  = "http://web.cbr.ru/KeyRate"
+	cbrDateTimeLayout = "2006-01-02T00:00:00"
+	// Ключевая ставка меняется не чаще раза в несколько недель, запрашиваем
+	// её не чаще раза в cbrCacheTtl, в остальное время отдаём кэш из БД
+	cbrCacheTtl = 12 * time.Hour
+	// За сколько дней назад запрашивать историю ставки
+	cbrRequestDays = 60
+)
+
+var ErrNoKeyRate = errors.New("key rate is not available")
+
+type CbrKeyRateConfig struct {
+	url     string
+	timeout time.Duration
+}
+
+func CbrKeyRateConfigFromGlobalConfig(cfg *utils.Config) *CbrKeyRateConfig {
+	return &CbrKeyRateConfig{
+		url:     cfg.CbrUrl,
+		timeout: 10 * time.Second,
+	}
+}
+
+// CbrKeyRateProvider получает ключевую ставку через SOAP-сервис ЦБ РФ DailyInfo
+// (метод KeyRate) и кэширует её в таблице key_rates.
+type CbrKeyRateProvider struct {
+	userRepo repository.UserRepository
+	client   *http.Client
+	cfg      CbrKeyRateConfig
+}
+
+func NewCbrKeyRateProvider(u repository.UserRepository, cfg *CbrKeyRateConfig) *CbrKeyRateProvider {
+	return &CbrKeyRateProvider{
+		userRepo: u,
+		client:   &http.Client{Timeout: cfg.timeout},
+		cfg:      *cfg,
+	}
+}
+
+func (p *CbrKeyRateProvider) KeyRate(ctx context.Context, at time.Time) (*models.KeyRate, error) {
+	log := utils.GlobalLogger()
+
+	cached, err := p.userRepo.GetLatestKeyRate(ctx, at)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if cached != nil && time.Since(cached.FetchedAt) < cbrCacheTtl {
+		return cached, nil
+	}
+
+	rates, err := p.fetch(ctx, at.AddDate(0, 0, -cbrRequestDays), at)
+	if err != nil {
+		// ЦБ недоступен - работаем по последней известной ставке
+		if cached != nil {
+			log.Error("Can't get key rate from CBR, use cached rate from %s: %w", cached.Date.Format(time.DateOnly), err)
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	if err := p.userRepo.SaveKeyRates(ctx, rates); err != nil {
+		log.Error("Can't save key rates to DB: %w", err)
+	}
+
+	rate := latestKeyRate(rates, at)
+	if rate == nil {
+		if cached != nil {
+			return cached, nil
+		}
+		return nil, ErrNoKeyRate
+	}
+	rate.FetchedAt = time.Now()
+
+	return rate, nil
+}
+
+func (p *CbrKeyRateProvider) fetch(ctx context.Context, from time.Time, to time.Time) ([]models.KeyRate, error) {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, `<?xml version="1.0" encoding="utf-8"?>
+<soap:Envelope xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <KeyRate xmlns="http://web.cbr.ru/">
+      <fromDate>%s</fromDate>
+      <ToDate>%s</ToDate>
+    </KeyRate>
+  </soap:Body>
+</soap:Envelope>`, from.Format(cbrDateTimeLayout), to.Format(cbrDateTimeLayout))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	req.Header.Set("SOAPAction", `"`+cbrKeyRateAction+`"`)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CBR KeyRate returned status %d", resp.StatusCode)
+	}
+
+	return parseCbrKeyRates(resp.Body)
+}
+
+// parseCbrKeyRates достаёт из ответа KeyRate все строки вида
+// <KR><DT>2025-07-28T00:00:00+03:00</DT><Rate>18.00</Rate></KR>.
+func parseCbrKeyRates(r io.Reader) ([]models.KeyRate, error) {
+	decoder := xml.NewDecoder(r)
+
+	var rates []models.KeyRate
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't parse CBR response: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "KR" {
+			continue
+		}
+
+		var row struct {
+			Date string `xml:"DT"`
+			Rate string `xml:"Rate"`
+		}
+		if err := decoder.DecodeElement(&row, &start); err != nil {
+			return nil, fmt.Errorf("can't parse CBR key rate: %w", err)
+		}
+
+		date, err := time.Parse(time.RFC3339, row.Date)
+		if err != nil {
+			return nil, fmt.Errorf("wrong CBR key rate date %q: %w", row.Date, err)
+		}
+
+		rateBp, err := models.ParseRate(row.Rate)
+		if err != nil {
+			return nil, err
+		}
+
+		rates = append(rates, models.KeyRate{
+			Date:   time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC),
+			RateBp: rateBp,
+		})
+	}
+
+	if len(rates) == 0 {
+		return nil, ErrNoKeyRate
+	}
+
+	return rates, nil
+}
+
+// FixtureKeyRateProvider отдаёт ставки из заранее заданного списка.
+// Используется в тестах и для запуска без доступа к ЦБ (KEY_RATE_FILE).
+type FixtureKeyRateProvider struct {
+	rates []models.KeyRate
+}
+
+func NewFixtureKeyRateProvider(rates ...models.KeyRate) *FixtureKeyRateProvider {
+	return &FixtureKeyRateProvider{rates: rates}
+}
+
+// LoadKeyRateFile читает ставки из JSON-файла вида
+// [{"date": "2025-07-28", "rate": "18.00"}].
+func LoadKeyRateFile(path string) (*FixtureKeyRateProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Date string `json:"date"`
+		Rate string `json:"rate"`
+	}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("can't parse key rate file: %w", err)
+	}
+
+	var rates []models.KeyRate
+	for _, row := range rows {
+		date, err := time.Parse(time.DateOnly, row.Date)
+		if err != nil {
+			return nil, fmt.Errorf("wrong key rate date %q: %w", row.Date, err)
+		}
+
+		rateBp, err := models.ParseRate(row.Rate)
+		if err != nil {
+			return nil, err
+		}
+
+		rates = append(rates, models.KeyRate{Date: date, RateBp: rateBp})
+	}
+
+	return NewFixtureKeyRateProvider(rates...), nil
+}
+
+func (p *FixtureKeyRateProvider) KeyRate(ctx context.Context, at time.Time) (*models.KeyRate, error) {
+	rate := latestKeyRate(p.rates, at)
+	if rate == nil {
+		return nil, ErrNoKeyRate
+	}
+	return rate, nil
+}
+
+// latestKeyRate выбирает ставку, действующую на дату at.
+func latestKeyRate(rates []models.KeyRate, at time.Time) *models.KeyRate {
+	sorted := append([]models.KeyRate(nil), rates...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	var result *models.KeyRate
+	for i := range sorted {
+		if sorted[i].Date.After(at) {
+			break
+		}
+		result = &sorted[i]
+	}
+
+	return result
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+)
+
+// fakeKeyRateRepo - кэш ставок в памяти вместо таблицы key_rates
+type fakeKeyRateRepo struct {
+	repository.UserRepository
+	rates []models.KeyRate
+}
+
+func (f *fakeKeyRateRepo) GetLatestKeyRate(ctx context.Context, at time.Time) (*models.KeyRate, error) {
+	rate := latestKeyRate(f.rates, at)
+	if rate == nil {
+		return nil, sql.ErrNoRows
+	}
+	return rate, nil
+}
+
+func (f *fakeKeyRateRepo) SaveKeyRates(ctx context.Context, rates []models.KeyRate) error {
+	for _, rate := range rates {
+		rate.FetchedAt = time.Now()
+		f.rates = append(f.rates, rate)
+	}
+	return nil
+}
+
+// newCbrStub поднимает заглушку SOAP-сервиса ЦБ, которая отвечает файлом из testdata.
+func newCbrStub(t *testing.T, calls *int, status *int) *httptest.Server {
+	t.Helper()
+
+	response, err := os.ReadFile("testdata/cbr_key_rate.xml")
+	if err != nil {
+		t.Fatalf("Can't read fixture: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("SOAPAction") != `"http://web.cbr.ru/KeyRate"` || !strings.Contains(string(body), "<KeyRate xmlns=\"http://web.cbr.ru/\">") {
+			t.Errorf("Wrong SOAP request: %s\n%s", r.Header.Get("SOAPAction"), body)
+		}
+
+		if *status != http.StatusOK {
+			w.WriteHeader(*status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		w.Write(response)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestCbrKeyRateProvider(t *testing.T) {
+	calls := 0
+	status := http.StatusOK
+	server := newCbrStub(t, &calls, &status)
+
+	repo := &fakeKeyRateRepo{}
+	provider := NewCbrKeyRateProvider(repo, &CbrKeyRateConfig{url: server.URL, timeout: time.Second})
+
+	at := time.Date(2025, 7, 30, 12, 0, 0, 0, time.UTC)
+	rate, err := provider.KeyRate(context.Background(), at)
+	if err != nil {
+		t.Fatalf("Key rate error: %v", err)
+	}
+
+	if rate.RateBp != 1800 || rate.Date.Format(time.DateOnly) != "2025-07-28" {
+		t.Errorf("Expected 18.00 from 2025-07-28, but %d from %s", rate.RateBp, rate.Date.Format(time.DateOnly))
+	}
+
+	if len(repo.rates) != 3 {
+		t.Errorf("Expected 3 rates in cache, but %d", len(repo.rates))
+	}
+
+	// Свежий кэш - в ЦБ не ходим
+	if _, err := provider.KeyRate(context.Background(), at); err != nil || calls != 1 {
+		t.Errorf("Expected cached rate without request, but %d calls (%v)", calls, err)
+	}
+
+	// Ставка на дату до снижения
+	rate, err = provider.KeyRate(context.Background(), time.Date(2025, 7, 26, 0, 0, 0, 0, time.UTC))
+	if err != nil || rate.RateBp != 2000 {
+		t.Errorf("Expected 20.00 on 2025-07-26, but %v (%v)", rate, err)
+	}
+}
+
+func TestCbrKeyRateProviderFallback(t *testing.T) {
+	calls := 0
+	status := http.StatusInternalServerError
+	server := newCbrStub(t, &calls, &status)
+
+	provider := NewCbrKeyRateProvider(&fakeKeyRateRepo{}, &CbrKeyRateConfig{url: server.URL, timeout: time.Second})
+	if _, err := provider.KeyRate(context.Background(), time.Now()); err == nil {
+		t.Errorf("Expected error without CBR and cache")
+	}
+
+	// Устаревший кэш лучше, чем отказ в выдаче кредита
+	repo := &fakeKeyRateRepo{rates: []models.KeyRate{
+		{Date: time.Date(2025, 6, 9, 0, 0, 0, 0, time.UTC), RateBp: 2000, FetchedAt: time.Now().AddDate(0, 0, -3)},
+	}}
+	provider = NewCbrKeyRateProvider(repo, &CbrKeyRateConfig{url: server.URL, timeout: time.Second})
+
+	rate, err := provider.KeyRate(context.Background(), time.Now())
+	if err != nil || rate.RateBp != 2000 {
+		t.Errorf("Expected stale cached rate, but %v (%v)", rate, err)
+	}
+}
+
+func TestFileKeyRateProvider(t *testing.T) {
+	provider, err := LoadKeyRateFile("testdata/key_rates.json")
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+
+	rate, err := provider.KeyRate(context.Background(), time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || rate.RateBp != 2000 {
+		t.Errorf("Expected 20.00 on 2025-07-01, but %v (%v)", rate, err)
+	}
+
+	if _, err := provider.KeyRate(context.Background(), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)); !errors.Is(err, ErrNoKeyRate) {
+		t.Errorf("Expected no rate before fixture dates, but %v", err)
+	}
+}
+
+func TestCreditRate(t *testing.T) {
+	s := NewLoanService(nil, nil, NewFixtureKeyRateProvider(models.KeyRate{Date: time.Date(2025, 7, 28, 0, 0, 0, 0, time.UTC), RateBp: 1800}), map[string]int{"consumer": 500}, 2000)
+
+	keyRate, marginBp, err := s.CreditRate(context.Background(), "consumer", time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || keyRate.RateBp+marginBp != 2300 {
+		t.Errorf("Expected 18.00 + 5.00, but %v + %d (%v)", keyRate, marginBp, err)
+	}
+
+	if _, _, err := s.CreditRate(context.Background(), "yacht", time.Now()); !errors.Is(err, ErrUnknownCreditProduct) {
+		t.Errorf("Expected unknown product error, but %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/utils"
+)
+
+const (
+	loginBackoffBase = time.Second
+	loginBackoffMax  = 5 * time.Minute
+	// Неудачи старше суток не учитываются
+	loginFailureWindow = 24 * time.Hour
+)
+
+type LoginGuardConfig struct {
+	backoffAfter   int
+	ipBackoffAfter int
+	lockAfter      int
+	lockTtl        time.Duration
+}
+
+func LoginGuardConfigFromGlobalConfig(cfg *utils.Config) *LoginGuardConfig {
+	return &LoginGuardConfig{
+		backoffAfter:   cfg.LoginBackoffAfter,
+		ipBackoffAfter: cfg.LoginIpBackoffAfter,
+		lockAfter:      cfg.LoginLockAfter,
+		lockTtl:        time.Duration(cfg.LoginLockMin) * time.Minute,
+	}
+}
+
+// ThrottleLoginGuard считает неудачные входы по имени пользователя и по IP.
+// После backoffAfter неудач каждая следующая удваивает паузу до следующей
+// попытки (1с, 2с, 4с... до 5 минут). После lockAfter неудач по имени вход
+// блокируется на lockTtl, счётчик начинается заново, а владельцу уходит
+// письмо с токеном разблокировки (не чаще одного за lockTtl).
+// Счётчик по имени ведётся и для несуществующих пользователей, поэтому
+// ответы не выдают, есть ли пользователь.
+type ThrottleLoginGuard struct {
+	userRepo repository.UserRepository
+	notifier Notifier
+	cfg      LoginGuardConfig
+	now      func() time.Time
+}
+
+func NewThrottleLoginGuard(u repository.UserRepository, n Notifier, cfg *LoginGuardConfig) *ThrottleLoginGuard {
+	return &ThrottleLoginGuard{
+		userRepo: u,
+		notifier: n,
+		cfg:      *cfg,
+		now:      time.Now,
+	}
+}
+
+// Check возвращает, сколько ждать до следующей попытки входа, 0 - можно входить.
+func (g *ThrottleLoginGuard) Check(ctx context.Context, username string, ip string) (time.Duration, error) {
+	blockedUntil, err := g.userRepo.GetLoginBlockedUntil(ctx, loginKey(username), ip)
+	if err != nil {
+		return 0, err
+	}
+
+	now := g.now()
+	if blockedUntil == nil || !blockedUntil.After(now) {
+		return 0, nil
+	}
+	return blockedUntil.Sub(now), nil
+}
+
+// Failure учитывает неудачный вход. Пустой username - неудача без имени
+// (неверный код второго фактора), считается только по IP. user - владелец
+// имени или nil, если такого пользователя нет.
+func (g *ThrottleLoginGuard) Failure(ctx context.Context, username string, ip string, user *models.User) error {
+	now := g.now()
+
+	ipFailures, err := g.userRepo.RecordLoginFailure(ctx, models.LoginScopeIp, ip, now, now.Add(-loginFailureWindow))
+	if err != nil {
+		return err
+	}
+	if delay := loginBackoff(ipFailures, g.cfg.ipBackoffAfter); delay > 0 {
+		if err := g.userRepo.BlockLogin(ctx, models.LoginScopeIp, ip, now.Add(delay)); err != nil {
+			return err
+		}
+	}
+
+	if username == "" {
+		return nil
+	}
+
+	key := loginKey(username)
+	failures, err := g.userRepo.RecordLoginFailure(ctx, models.LoginScopeUser, key, now, now.Add(-loginFailureWindow))
+	if err != nil {
+		return err
+	}
+
+	if failures >= g.cfg.lockAfter {
+		return g.lock(ctx, key, failures, now, user)
+	}
+
+	if delay := loginBackoff(failures, g.cfg.backoffAfter); delay > 0 {
+		return g.userRepo.BlockLogin(ctx, models.LoginScopeUser, key, now.Add(delay))
+	}
+
+	return nil
+}
+
+// Success сбрасывает счётчик по имени. Счётчик по IP не сбрасывается, иначе
+// перебор паролей чужих пользователей можно было бы перемежать входами в свой.
+func (g *ThrottleLoginGuard) Success(ctx context.Context, username string) error {
+	return g.userRepo.ResetLoginFailures(ctx, models.LoginScopeUser, loginKey(username))
+}
+
+// Unlock снимает блокировку по токену из письма.
+func (g *ThrottleLoginGuard) Unlock(ctx context.Context, token string) (bool, error) {
+	return g.userRepo.UnlockLogin(ctx, models.HashToken(token), g.now())
+}
+
+// DeleteStale удаляет счётчики, которые уже не учитываются и ничего не блокируют.
+func (g *ThrottleLoginGuard) DeleteStale(ctx context.Context, now time.Time) (int, error) {
+	return g.userRepo.DeleteStaleLoginThrottles(ctx, now.Add(-loginFailureWindow), now)
+}
+
+func (g *ThrottleLoginGuard) lock(ctx context.Context, key string, failures int, now time.Time, user *models.User) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	until := now.Add(g.cfg.lockTtl)
+
+	// Счётчик обнуляется, иначе после блокировки каждая неудача блокировала бы
+	// вход заново. Письмо - не чаще одного за время блокировки, иначе подбором
+	// можно было бы засыпать владельца письмами
+	notify, err := g.userRepo.LockLogin(ctx, key, until, models.HashToken(token), now.Add(-g.cfg.lockTtl), now)
+	if err != nil {
+		return err
+	}
+
+	if !notify || user == nil {
+		return nil
+	}
+
+	utils.GlobalLogger().Info("Login of %s is locked until %s after %d failures", user.Name, until.Format(time.RFC3339), failures)
+
+	// Письмо отправляется в фоне: по задержке ответа нельзя было бы узнать,
+	// что пользователь существует
+	notification := models.Notification{
+		Event:    models.NotifyAccountLocked,
+		Username: user.Name,
+		Data: map[string]string{
+			"attempts": strconv.Itoa(failures),
+			"until":    until.Format("02.01.2006 15:04 MST"),
+			"token":    token,
+		},
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := g.notifier.Notify(ctx, user.Email, notification); err != nil {
+			utils.GlobalLogger().Error("Can't send %s notification to %s: %w", notification.Event, user.Name, err)
+		}
+	}()
+
+	return nil
+}
+
+// loginBackoff - пауза после failures неудач, первые after неудач без паузы.
+func loginBackoff(failures int, after int) time.Duration {
+	if failures <= after {
+		return 0
+	}
+
+	shift := failures - after - 1
+	if shift > 16 {
+		return loginBackoffMax
+	}
+	return min(loginBackoffBase<<shift, loginBackoffMax)
+}
+
+// loginKey - имя без учёта регистра и пробелов по краям
+func loginKey(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
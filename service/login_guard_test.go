@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+)
+
+// fakeLockNotifier отдаёт письма в канал: письмо о блокировке уходит из горутины
+type fakeLockNotifier struct {
+	sent chan models.Notification
+}
+
+func (f *fakeLockNotifier) Notify(ctx context.Context, to string, n models.Notification) error {
+	f.sent <- n
+	return nil
+}
+
+type fakeThrottle struct {
+	failures       int
+	lastFailureAt  time.Time
+	blockedUntil   *time.Time
+	unlockHash     string
+	lockNotifiedAt *time.Time
+}
+
+// fakeLoginRepo - счётчики login_throttle в памяти
+type fakeLoginRepo struct {
+	repository.UserRepository
+	throttles map[string]*fakeThrottle
+}
+
+func (f *fakeLoginRepo) GetLoginBlockedUntil(ctx context.Context, username string, ip string) (*time.Time, error) {
+	var blockedUntil *time.Time
+	for _, key := range []string{models.LoginScopeUser + ":" + username, models.LoginScopeIp + ":" + ip} {
+		if th, ok := f.throttles[key]; ok && th.blockedUntil != nil && (blockedUntil == nil || th.blockedUntil.After(*blockedUntil)) {
+			blockedUntil = th.blockedUntil
+		}
+	}
+	return blockedUntil, nil
+}
+
+func (f *fakeLoginRepo) GetThrottleBlockedUntil(ctx context.Context, scope string, key string) (*time.Time, error) {
+	if th, ok := f.throttles[scope+":"+key]; ok {
+		return th.blockedUntil, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeLoginRepo) RecordLoginFailure(ctx context.Context, scope string, key string, at time.Time, resetBefore time.Time) (int, error) {
+	th, ok := f.throttles[scope+":"+key]
+	if !ok {
+		th = &fakeThrottle{}
+		f.throttles[scope+":"+key] = th
+	}
+	if th.lastFailureAt.Before(resetBefore) {
+		th.failures = 0
+	}
+	th.failures++
+	th.lastFailureAt = at
+	return th.failures, nil
+}
+
+func (f *fakeLoginRepo) BlockLogin(ctx context.Context, scope string, key string, until time.Time) error {
+	f.throttles[scope+":"+key].blockedUntil = &until
+	return nil
+}
+
+func (f *fakeLoginRepo) LockLogin(ctx context.Context, key string, until time.Time, unlockHash []byte, notifiedBefore time.Time, at time.Time) (bool, error) {
+	th := f.throttles[models.LoginScopeUser+":"+key]
+	th.failures, th.blockedUntil = 0, &until
+	if th.lockNotifiedAt != nil && !th.lockNotifiedAt.Before(notifiedBefore) {
+		return false, nil
+	}
+	th.unlockHash, th.lockNotifiedAt = hex.EncodeToString(unlockHash), &at
+	return true, nil
+}
+
+func (f *fakeLoginRepo) ResetLoginFailures(ctx context.Context, scope string, key string) error {
+	delete(f.throttles, scope+":"+key)
+	return nil
+}
+
+func (f *fakeLoginRepo) UnlockLogin(ctx context.Context, hash []byte, at time.Time) (bool, error) {
+	for _, th := range f.throttles {
+		if th.unlockHash != "" && th.unlockHash == hex.EncodeToString(hash) && th.blockedUntil.After(at) {
+			th.failures, th.blockedUntil, th.unlockHash = 0, nil, ""
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func testLoginGuard(repo *fakeLoginRepo, n Notifier, now *time.Time) *ThrottleLoginGuard {
+	g := NewThrottleLoginGuard(repo, n, &LoginGuardConfig{
+		backoffAfter:   3,
+		ipBackoffAfter: 20,
+		lockAfter:      10,
+		lockTtl:        30 * time.Minute,
+	})
+	g.now = func() time.Time { return *now }
+	return g
+}
+
+func TestLoginBackoff(t *testing.T) {
+	cases := []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{8, 16 * time.Second},
+		{12, 256 * time.Second},
+		{13, loginBackoffMax},
+		{100, loginBackoffMax},
+	}
+
+	for _, c := range cases {
+		if delay := loginBackoff(c.failures, 3); delay != c.delay {
+			t.Errorf("%d failures: expected %s, but %s", c.failures, c.delay, delay)
+		}
+	}
+}
+
+func TestLoginGuardBackoff(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeLoginRepo{throttles: map[string]*fakeThrottle{}}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	g := testLoginGuard(repo, &fakeLockNotifier{}, &now)
+
+	for i := 0; i < 3; i++ {
+		g.Failure(ctx, "Ivan", "10.0.0.1", nil)
+	}
+	if wait, err := g.Check(ctx, "ivan", "10.0.0.2"); err != nil || wait != 0 {
+		t.Fatalf("Expected no delay before backoff, but %s (%v)", wait, err)
+	}
+
+	g.Failure(ctx, "ivan ", "10.0.0.1", nil)
+	g.Failure(ctx, "ivan", "10.0.0.1", nil)
+	// Имя сравнивается без учёта регистра, IP другой - ограничение по имени
+	if wait, _ := g.Check(ctx, "IVAN", "10.0.0.2"); wait != 2*time.Second {
+		t.Fatalf("Expected 2s delay, but %s", wait)
+	}
+	if wait, _ := g.Check(ctx, "petr", "10.0.0.2"); wait != 0 {
+		t.Errorf("Expected other user to login, but %s", wait)
+	}
+
+	now = now.Add(3 * time.Second)
+	if wait, _ := g.Check(ctx, "ivan", "10.0.0.2"); wait != 0 {
+		t.Errorf("Expected delay to pass, but %s", wait)
+	}
+
+	// Успешный вход сбрасывает счётчик по имени, но не по IP
+	g.Success(ctx, "ivan")
+	g.Failure(ctx, "ivan", "10.0.0.1", nil)
+	if wait, _ := g.Check(ctx, "ivan", "10.0.0.2"); wait != 0 {
+		t.Errorf("Expected reset counter, but %s", wait)
+	}
+	if th := repo.throttles[models.LoginScopeIp+":10.0.0.1"]; th == nil || th.failures != 6 {
+		t.Errorf("Expected ip counter to keep failures, but %+v", th)
+	}
+
+	// Неудачи без имени (неверный код второго фактора) считаются только по IP
+	for i := 0; i < 15; i++ {
+		g.Failure(ctx, "", "10.0.0.1", nil)
+	}
+	if _, ok := repo.throttles[models.LoginScopeUser+":"]; ok {
+		t.Errorf("Expected no counter for empty username")
+	}
+	if wait, _ := g.Check(ctx, "petr", "10.0.0.1"); wait != time.Second {
+		t.Errorf("Expected ip backoff, but %s", wait)
+	}
+
+	// Через сутки счёт начинается заново
+	now = now.Add(loginFailureWindow + time.Hour)
+	g.Failure(ctx, "", "10.0.0.1", nil)
+	if th := repo.throttles[models.LoginScopeIp+":10.0.0.1"]; th.failures != 1 {
+		t.Errorf("Expected old failures to be forgotten, but %d", th.failures)
+	}
+}
+
+func TestLoginGuardLock(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeLoginRepo{throttles: map[string]*fakeThrottle{}}
+	notifier := &fakeLockNotifier{sent: make(chan models.Notification, 1)}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	g := testLoginGuard(repo, notifier, &now)
+
+	user := &models.User{ID: 1, Name: "ivan", Email: "ivan@example.com"}
+	for i := 0; i < 10; i++ {
+		if err := g.Failure(ctx, "ivan", "10.0.0.1", user); err != nil {
+			t.Fatalf("Failure error: %v", err)
+		}
+	}
+
+	if wait, _ := g.Check(ctx, "ivan", "10.0.0.2"); wait != 30*time.Minute {
+		t.Fatalf("Expected lock for 30m, but %s", wait)
+	}
+
+	var notification models.Notification
+	select {
+	case notification = <-notifier.sent:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected account locked notification")
+	}
+	token := notification.Data["token"]
+	if notification.Event != models.NotifyAccountLocked || token == "" || notification.Data["attempts"] != "10" {
+		t.Fatalf("Wrong notification %+v", notification)
+	}
+	if repo.throttles[models.LoginScopeUser+":ivan"].unlockHash == token {
+		t.Fatalf("Unlock token must be stored hashed")
+	}
+
+	if ok, err := g.Unlock(ctx, "wrong"); err != nil || ok {
+		t.Errorf("Expected wrong token to be rejected, but %v (%v)", ok, err)
+	}
+	if ok, err := g.Unlock(ctx, token); err != nil || !ok {
+		t.Fatalf("Expected unlock, but %v (%v)", ok, err)
+	}
+	if wait, _ := g.Check(ctx, "ivan", "10.0.0.2"); wait != 0 {
+		t.Errorf("Expected unlocked login, but %s", wait)
+	}
+	if ok, _ := g.Unlock(ctx, token); ok {
+		t.Errorf("Expected used token to be rejected")
+	}
+
+	// Новая блокировка в том же окне не отправляет ещё одно письмо
+	for i := 0; i < 10; i++ {
+		g.Failure(ctx, "ivan", "10.0.0.1", user)
+	}
+	if wait, _ := g.Check(ctx, "ivan", "10.0.0.2"); wait != 30*time.Minute {
+		t.Fatalf("Expected second lock for 30m, but %s", wait)
+	}
+	select {
+	case n := <-notifier.sent:
+		t.Errorf("Unexpected second notification %+v", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// После блокировки счёт начинается заново: следующая неудача вход не блокирует
+	now = now.Add(31 * time.Minute)
+	g.Failure(ctx, "ivan", "10.0.0.1", user)
+	if wait, _ := g.Check(ctx, "ivan", "10.0.0.2"); wait != 0 {
+		t.Errorf("Expected failure after lock not to relock, but %s", wait)
+	}
+	select {
+	case n := <-notifier.sent:
+		t.Errorf("Unexpected notification after lock %+v", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Несуществующее имя блокируется так же, но письмо отправить некому
+	for i := 0; i < 10; i++ {
+		g.Failure(ctx, "nobody", "10.0.0.3", nil)
+	}
+	if wait, _ := g.Check(ctx, "nobody", "10.0.0.4"); wait != 30*time.Minute {
+		t.Errorf("Expected unknown user lock for 30m, but %s", wait)
+	}
+	select {
+	case n := <-notifier.sent:
+		t.Errorf("Unexpected notification %+v", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"uniback/models"
+	"uniback/repository"
+)
+
+// NotificationSink - получатель outbox, который отправляет клиентам письма
+// об операциях по счёту и выпуске карт.
+type NotificationSink struct {
+	userRepo      repository.UserRepository
+	notifier      Notifier
+	cryptoService CryptoService
+}
+
+func NewNotificationSink(u repository.UserRepository, n Notifier, cs CryptoService) *NotificationSink {
+	return &NotificationSink{userRepo: u, notifier: n, cryptoService: cs}
+}
+
+func (s *NotificationSink) Name() string {
+	return "email"
+}
+
+func (s *NotificationSink) Deliver(ctx context.Context, event models.OutboxEvent) error {
+	switch event.Event {
+	case models.EventTransactionCreated:
+		var trs models.TransactionEvent
+		if err := json.Unmarshal(event.Payload, &trs); err != nil {
+			return fmt.Errorf("wrong %s payload: %w", event.Event, err)
+		}
+		return s.transaction(ctx, trs)
+	case models.EventCardIssued:
+		var card models.CardIssuedEvent
+		if err := json.Unmarshal(event.Payload, &card); err != nil {
+			return fmt.Errorf("wrong %s payload: %w", event.Event, err)
+		}
+		return s.cardIssued(ctx, card)
+	}
+
+	// О прочих событиях писем нет
+	return nil
+}
+
+func (s *NotificationSink) transaction(ctx context.Context, trs models.TransactionEvent) error {
+	switch trs.Type {
+	case "deposit", "withdrawal":
+		event := models.NotifyDeposit
+		if trs.Type == "withdrawal" {
+			event = models.NotifyWithdrawal
+		}
+		return s.notifyAccountOwner(ctx, trs.AccountId, event, map[string]string{
+			"account": trs.AccountNumber,
+			"amount":  trs.Amount.String(),
+			"balance": trs.Balance.String(),
+		})
+	case "transfer":
+		err := s.notifyAccountOwner(ctx, trs.AccountId, models.NotifyTransferOut, map[string]string{
+			"account":      trs.AccountNumber,
+			"counterparty": trs.DestAccountNumber,
+			"amount":       trs.Amount.String(),
+			"balance":      trs.Balance.String(),
+		})
+		if err != nil {
+			return err
+		}
+		return s.notifyAccountOwner(ctx, trs.DestAccountId, models.NotifyTransferIn, map[string]string{
+			"account":      trs.DestAccountNumber,
+			"counterparty": trs.AccountNumber,
+			"amount":       trs.Amount.String(),
+		})
+	}
+
+	return nil
+}
+
+func (s *NotificationSink) cardIssued(ctx context.Context, event models.CardIssuedEvent) error {
+	owner, err := s.userRepo.GetAccountOwner(ctx, event.AccountId)
+	if err != nil {
+		return err
+	}
+
+	card, err := s.userRepo.GetCardByIdAndUsername(ctx, event.CardId, owner.Name)
+	if err != nil {
+		return err
+	}
+
+	// В письме только маска номера, полный номер и CVV не отправляются
+	return s.notifier.Notify(ctx, owner.Email, models.Notification{
+		Event:    models.NotifyCardIssued,
+		Username: owner.Name,
+		Data: map[string]string{
+			"account": event.AccountNumber,
+			"card":    models.MaskCardNumber(s.cryptoService.PgpDecode(card.Number)),
+			"expiry":  s.cryptoService.PgpDecode(card.Expiry),
+		},
+	})
+}
+
+func (s *NotificationSink) notifyAccountOwner(ctx context.Context, accountId int, event string, data map[string]string) error {
+	owner, err := s.userRepo.GetAccountOwner(ctx, accountId)
+	if err != nil {
+		return err
+	}
+
+	return s.notifier.Notify(ctx, owner.Email, models.Notification{Event: event, Username: owner.Name, Data: data})
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+	"uniback/models"
+	"uniback/utils"
+)
+
+const (
+	SmtpSecurityNone     = "none"
+	SmtpSecurityStartTls = "starttls"
+	SmtpSecurityTls      = "tls"
+)
+
+//go:embed templates/notifications/*.html
+var notificationTemplates embed.FS
+
+var notificationSubjects = map[string]string{
+	models.NotifyRegistration:     "Добро пожаловать",
+	models.NotifyNewLoginIp:       "Вход с нового IP-адреса",
+	models.NotifyDeposit:          "Пополнение счёта",
+	models.NotifyWithdrawal:       "Списание со счёта",
+	models.NotifyTransferOut:      "Исходящий перевод",
+	models.NotifyTransferIn:       "Входящий перевод",
+	models.NotifyCardIssued:       "Выпущена новая карта",
+	models.NotifyCreditPaymentDue: "Скоро платёж по кредиту",
+	models.NotifyTransferCode:     "Код подтверждения перевода",
+	models.NotifyAccountLocked:    "Вход в аккаунт заблокирован",
+}
+
+// Notifier отправляет клиенту письмо о событии n на адрес to.
+type Notifier interface {
+	Notify(ctx context.Context, to string, n models.Notification) error
+}
+
+type SmtpConfig struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	security string
+	appName  string
+	timeout  time.Duration
+	// Нужен тестам с самоподписанным сертификатом, по умолчанию nil
+	tlsConfig *tls.Config
+}
+
+func SmtpConfigFromGlobalConfig(cfg *utils.Config) *SmtpConfig {
+	return &SmtpConfig{
+		host:     cfg.SmtpHost,
+		port:     cfg.SmtpPort,
+		username: cfg.SmtpUsername,
+		password: cfg.SmtpPassword,
+		from:     cfg.SmtpFrom,
+		security: cfg.SmtpSecurity,
+		appName:  cfg.AppName,
+		timeout:  10 * time.Second,
+	}
+}
+
+// SmtpNotifier отправляет письма через SMTP-сервер. Соединение открывается
+// на каждое письмо: писем немного, а держать сессию дольше таймаута сервера
+// всё равно нельзя.
+type SmtpNotifier struct {
+	cfg       SmtpConfig
+	from      *mail.Address
+	templates map[string]*template.Template
+}
+
+func NewSmtpNotifier(cfg *SmtpConfig) (*SmtpNotifier, error) {
+	switch cfg.security {
+	case SmtpSecurityNone, SmtpSecurityStartTls, SmtpSecurityTls:
+	default:
+		return nil, fmt.Errorf("unknown SMTP security mode: %q", cfg.security)
+	}
+
+	from, err := mail.ParseAddress(cfg.from)
+	if err != nil {
+		return nil, fmt.Errorf("wrong SMTP sender address %q: %w", cfg.from, err)
+	}
+
+	templates, err := parseNotificationTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SmtpNotifier{cfg: *cfg, from: from, templates: templates}, nil
+}
+
+func parseNotificationTemplates() (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template, len(notificationSubjects))
+	for event := range notificationSubjects {
+		tmpl, err := template.ParseFS(notificationTemplates, "templates/notifications/layout.html", "templates/notifications/"+event+".html")
+		if err != nil {
+			return nil, fmt.Errorf("can't parse %s notification template: %w", event, err)
+		}
+		templates[event] = tmpl
+	}
+	return templates, nil
+}
+
+func (n *SmtpNotifier) Notify(ctx context.Context, to string, notification models.Notification) error {
+	message, err := n.buildMessage(to, notification)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.cfg.timeout)
+		defer cancel()
+	}
+
+	return n.send(ctx, to, message)
+}
+
+func (n *SmtpNotifier) buildMessage(to string, notification models.Notification) ([]byte, error) {
+	tmpl, ok := n.templates[notification.Event]
+	if !ok {
+		return nil, fmt.Errorf("unknown notification event: %q", notification.Event)
+	}
+
+	subject := notificationSubjects[notification.Event]
+
+	var body bytes.Buffer
+	err := tmpl.ExecuteTemplate(&body, "layout.html", map[string]any{
+		"Subject":  subject,
+		"AppName":  n.cfg.appName,
+		"Username": notification.Username,
+		"Data":     notification.Data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't render %s notification: %w", notification.Event, err)
+	}
+
+	messageId := make([]byte, 16)
+	if _, err := rand.Read(messageId); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(messageId), n.cfg.host)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	// base64 по 76 символов в строке, чтобы не упереться в ограничение длины строки SMTP
+	encoded := base64.StdEncoding.EncodeToString(body.Bytes())
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+
+	return msg.Bytes(), nil
+}
+
+func (n *SmtpNotifier) send(ctx context.Context, to string, message []byte) error {
+	addr := net.JoinHostPort(n.cfg.host, strconv.Itoa(n.cfg.port))
+
+	tlsConfig := n.cfg.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: n.cfg.host}
+	}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("can't connect to SMTP server %s: %w", addr, err)
+	}
+	if n.cfg.security == SmtpSecurityTls {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	// Дедлайн контекста действует на весь SMTP-диалог
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, n.cfg.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake error: %w", err)
+	}
+	defer client.Close()
+
+	if n.cfg.security == SmtpSecurityStartTls {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server %s doesn't support STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("SMTP STARTTLS error: %w", err)
+		}
+	}
+
+	if n.cfg.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.cfg.username, n.cfg.password, n.cfg.host)); err != nil {
+			return fmt.Errorf("SMTP auth error: %w", err)
+		}
+	}
+
+	if err := client.Mail(n.from.Address); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM error: %w", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("SMTP RCPT TO %s error: %w", to, err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA error: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("SMTP write error: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP message rejected: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// LogNotifier только пишет событие в лог. Используется, когда SMTP не настроен.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, to string, n models.Notification) error {
+	utils.GlobalLogger().Info("Notification %s for %s <%s>: %v", n.Event, n.Username, to, n.Data)
+	return nil
+}
@@ -0,0 +1,385 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+)
+
+type fakeSmtpMessage struct {
+	from string
+	to   []string
+	data string
+	auth string
+	tls  bool
+}
+
+// fakeSmtpServer - минимальный SMTP-сервер для тестов: EHLO, STARTTLS,
+// AUTH PLAIN, MAIL, RCPT, DATA, QUIT. Принятые письма складываются в messages.
+type fakeSmtpServer struct {
+	listener    net.Listener
+	tlsConfig   *tls.Config
+	implicitTls bool
+
+	mu       sync.Mutex
+	messages []fakeSmtpMessage
+}
+
+func newFakeSmtpServer(t *testing.T, tlsConfig *tls.Config, implicitTls bool) *fakeSmtpServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Can't listen: %v", err)
+	}
+
+	s := &fakeSmtpServer{listener: listener, tlsConfig: tlsConfig, implicitTls: implicitTls}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+
+	return s
+}
+
+func (s *fakeSmtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSmtpServer) received() []fakeSmtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeSmtpMessage(nil), s.messages...)
+}
+
+func (s *fakeSmtpServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	var msg fakeSmtpMessage
+	if s.implicitTls {
+		conn = tls.Server(conn, s.tlsConfig)
+		msg.tls = true
+	}
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			if s.tlsConfig != nil && !msg.tls {
+				tp.PrintfLine("250-fake")
+				tp.PrintfLine("250-STARTTLS")
+			} else {
+				tp.PrintfLine("250-fake")
+			}
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			tp.PrintfLine("220 ready to start TLS")
+			conn = tls.Server(conn, s.tlsConfig)
+			tp = textproto.NewConn(conn)
+			msg.tls = true
+		case "AUTH":
+			_, creds, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(creds)
+			msg.auth = string(decoded)
+			tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			msg.to = append(msg.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// testTlsConfigs выпускает самоподписанный сертификат на 127.0.0.1 и
+// возвращает настройки TLS для сервера и доверяющего ему клиента.
+func testTlsConfigs(t *testing.T) (server *tls.Config, client *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fake smtp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	server = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client = &tls.Config{ServerName: "127.0.0.1", RootCAs: pool}
+	return server, client
+}
+
+func testSmtpNotifier(t *testing.T, server *fakeSmtpServer, security string, tlsConfig *tls.Config) *SmtpNotifier {
+	t.Helper()
+
+	n, err := NewSmtpNotifier(&SmtpConfig{
+		host:      "127.0.0.1",
+		port:      server.port(),
+		username:  "bank",
+		password:  "secret",
+		from:      "UniBack <noreply@uniback.local>",
+		security:  security,
+		appName:   "UniBack",
+		timeout:   5 * time.Second,
+		tlsConfig: tlsConfig,
+	})
+	if err != nil {
+		t.Fatalf("Can't create notifier: %v", err)
+	}
+	return n
+}
+
+// readTestMessage разбирает письмо и возвращает тему и HTML-тело.
+func readTestMessage(t *testing.T, data string) (string, string) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(data)))
+	if err != nil {
+		t.Fatalf("Can't parse message: %v", err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("Can't decode subject: %v", err)
+	}
+
+	body, err := readAllBase64(msg)
+	if err != nil {
+		t.Fatalf("Can't decode body: %v", err)
+	}
+
+	return subject, body
+}
+
+func readAllBase64(msg *mail.Message) (string, error) {
+	var sb strings.Builder
+	scanner := bufio.NewScanner(msg.Body)
+	for scanner.Scan() {
+		sb.WriteString(strings.TrimSpace(scanner.Text()))
+	}
+	decoded, err := base64.StdEncoding.DecodeString(sb.String())
+	return string(decoded), err
+}
+
+func TestSmtpNotifierStartTls(t *testing.T) {
+	serverTls, clientTls := testTlsConfigs(t)
+	server := newFakeSmtpServer(t, serverTls, false)
+	n := testSmtpNotifier(t, server, SmtpSecurityStartTls, clientTls)
+
+	err := n.Notify(context.Background(), "ivan@example.com", models.Notification{
+		Event:    models.NotifyDeposit,
+		Username: "<b>ivan</b>",
+		Data:     map[string]string{"account": "40817810000000000001", "amount": "1500.00", "balance": "2500.00"},
+	})
+	if err != nil {
+		t.Fatalf("Notify error: %v", err)
+	}
+
+	messages := server.received()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message, but %d", len(messages))
+	}
+
+	msg := messages[0]
+	if !msg.tls || msg.auth != "\x00bank\x00secret" {
+		t.Errorf("Expected authenticated TLS session, but tls=%t auth=%q", msg.tls, msg.auth)
+	}
+	if msg.from != "noreply@uniback.local" || len(msg.to) != 1 || msg.to[0] != "ivan@example.com" {
+		t.Errorf("Wrong envelope: %s -> %v", msg.from, msg.to)
+	}
+
+	subject, body := readTestMessage(t, msg.data)
+	if subject != "Пополнение счёта" {
+		t.Errorf("Wrong subject %q", subject)
+	}
+	for _, want := range []string{"40817810000000000001", "1500.00", "2500.00", "&lt;b&gt;ivan&lt;/b&gt;"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in body:\n%s", want, body)
+		}
+	}
+}
+
+func TestSmtpNotifierImplicitTls(t *testing.T) {
+	serverTls, clientTls := testTlsConfigs(t)
+	server := newFakeSmtpServer(t, serverTls, true)
+	n := testSmtpNotifier(t, server, SmtpSecurityTls, clientTls)
+
+	err := n.Notify(context.Background(), "ivan@example.com", models.Notification{
+		Event:    models.NotifyNewLoginIp,
+		Username: "ivan",
+		Data:     map[string]string{"ip": "10.1.2.3", "time": "17.10.2026 12:00 UTC"},
+	})
+	if err != nil {
+		t.Fatalf("Notify error: %v", err)
+	}
+
+	messages := server.received()
+	if len(messages) != 1 || !messages[0].tls {
+		t.Fatalf("Expected 1 message over TLS, but %v", messages)
+	}
+
+	if _, body := readTestMessage(t, messages[0].data); !strings.Contains(body, "10.1.2.3") {
+		t.Errorf("Expected ip in body:\n%s", body)
+	}
+}
+
+func TestSmtpNotifierErrors(t *testing.T) {
+	// Сервер без STARTTLS: отправлять пароль открытым текстом нельзя
+	server := newFakeSmtpServer(t, nil, false)
+	n := testSmtpNotifier(t, server, SmtpSecurityStartTls, nil)
+
+	err := n.Notify(context.Background(), "ivan@example.com", models.Notification{Event: models.NotifyRegistration, Username: "ivan"})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Expected STARTTLS error, but %v", err)
+	}
+
+	err = n.Notify(context.Background(), "ivan@example.com", models.Notification{Event: "unknown"})
+	if err == nil {
+		t.Errorf("Expected unknown event error")
+	}
+
+	if len(server.received()) != 0 {
+		t.Errorf("Expected no messages to be sent")
+	}
+
+	if _, err := NewSmtpNotifier(&SmtpConfig{from: "noreply@uniback.local", security: "ssl"}); err == nil {
+		t.Errorf("Expected unknown security mode error")
+	}
+}
+
+// fakeReminderRepo - платежи к напоминанию в памяти
+type fakeReminderRepo struct {
+	repository.UserRepository
+	reminders []models.CreditReminder
+	reminded  []int
+}
+
+func (f *fakeReminderRepo) GetCreditReminders(ctx context.Context, to time.Time) ([]models.CreditReminder, error) {
+	var result []models.CreditReminder
+	for _, r := range f.reminders {
+		if !r.DueDate.After(to) {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeReminderRepo) MarkCreditPaymentReminded(ctx context.Context, paymentId int) error {
+	f.reminded = append(f.reminded, paymentId)
+	return nil
+}
+
+func TestRemindCreditPayments(t *testing.T) {
+	server := newFakeSmtpServer(t, nil, false)
+	n, err := NewSmtpNotifier(&SmtpConfig{
+		host:     "127.0.0.1",
+		port:     server.port(),
+		from:     "noreply@uniback.local",
+		security: SmtpSecurityNone,
+		timeout:  5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reminder := func(id int, due time.Time) models.CreditReminder {
+		return models.CreditReminder{
+			DueCreditPayment: models.DueCreditPayment{CreditPayment: models.CreditPayment{
+				Id: id, CreditId: 7, Number: id, DueDate: due, Payment: models.NewMoney(888488),
+			}},
+			AccountNumber: "45507810000000000007",
+			Username:      "ivan",
+			Email:         "ivan" + strconv.Itoa(id) + "@example.com",
+		}
+	}
+
+	repo := &fakeReminderRepo{reminders: []models.CreditReminder{
+		reminder(1, time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)),
+		reminder(2, time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)),
+	}}
+
+	processed, err := RemindCreditPayments(context.Background(), repo, n, time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC), 3)
+	if err != nil || processed != 1 {
+		t.Fatalf("Expected 1 reminder, but %d (%v)", processed, err)
+	}
+
+	if len(repo.reminded) != 1 || repo.reminded[0] != 1 {
+		t.Errorf("Expected payment 1 to be marked reminded, but %v", repo.reminded)
+	}
+
+	messages := server.received()
+	if len(messages) != 1 || messages[0].to[0] != "ivan1@example.com" {
+		t.Fatalf("Expected reminder to ivan1@example.com, but %v", messages)
+	}
+
+	if _, body := readTestMessage(t, messages[0].data); !strings.Contains(body, "8884.88") || !strings.Contains(body, "03.03.2025") {
+		t.Errorf("Expected amount and due date in body:\n%s", body)
+	}
+}
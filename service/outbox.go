@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/utils"
+)
+
+const (
+	outboxBatchSize = 50
+	// Пока идёт доставка, событие не отдаётся другим диспетчерам. Если процесс
+	// упадёт, событие вернётся в очередь через outboxLease
+	outboxLease       = 5 * time.Minute
+	outboxSinkTimeout = 30 * time.Second
+	outboxBackoffBase = 10 * time.Second
+	outboxBackoffMax  = time.Hour
+)
+
+// OutboxSink - получатель событий outbox. Name не должен меняться между
+// запусками: по нему запоминается, кто уже принял событие.
+type OutboxSink interface {
+	Name() string
+	Deliver(ctx context.Context, event models.OutboxEvent) error
+}
+
+type OutboxConfig struct {
+	pollInterval time.Duration
+	// После стольких неудачных попыток событие уходит в dead
+	maxAttempts int
+}
+
+func OutboxConfigFromGlobalConfig(cfg *utils.Config) *OutboxConfig {
+	return &OutboxConfig{
+		pollInterval: time.Duration(cfg.OutboxPollSec) * time.Second,
+		maxAttempts:  cfg.OutboxMaxAttempts,
+	}
+}
+
+// OutboxDispatcher доставляет события из outbox всем получателям. Доставка
+// "хотя бы один раз": получатель может увидеть событие повторно, если процесс
+// упал между доставкой и отметкой в БД.
+type OutboxDispatcher struct {
+	userRepo repository.UserRepository
+	sinks    []OutboxSink
+	cfg      OutboxConfig
+	wg       sync.WaitGroup
+}
+
+func NewOutboxDispatcher(u repository.UserRepository, cfg *OutboxConfig) *OutboxDispatcher {
+	return &OutboxDispatcher{userRepo: u, cfg: *cfg}
+}
+
+func (d *OutboxDispatcher) AddSink(sink OutboxSink) {
+	d.sinks = append(d.sinks, sink)
+}
+
+// Start опрашивает outbox раз в pollInterval, пока не отменён ctx. Если
+// пришла полная пачка, следующая забирается сразу.
+func (d *OutboxDispatcher) Start(ctx context.Context) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		log := utils.GlobalLogger()
+
+		for {
+			processed, err := d.DispatchOnce(ctx)
+			if err != nil {
+				log.Error("Outbox dispatch error: %w", err)
+			}
+
+			if err == nil && processed == outboxBatchSize {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.cfg.pollInterval):
+			}
+		}
+	}()
+}
+
+// Wait ждёт остановки диспетчера после отмены контекста.
+func (d *OutboxDispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// DispatchOnce забирает одну пачку событий и доставляет их. Возвращает
+// число взятых событий.
+func (d *OutboxDispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	events, err := d.userRepo.ClaimOutboxEvents(ctx, outboxBatchSize, outboxLease)
+	if err != nil {
+		return 0, err
+	}
+
+	var firstErr error
+	for _, event := range events {
+		if err := d.deliver(ctx, event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return len(events), firstErr
+}
+
+func (d *OutboxDispatcher) deliver(ctx context.Context, event models.OutboxEvent) error {
+	log := utils.GlobalLogger()
+
+	delivered := slices.Clone(event.Delivered)
+	var errs []error
+
+	for _, sink := range d.sinks {
+		if slices.Contains(delivered, sink.Name()) {
+			continue
+		}
+
+		sinkCtx, cancel := context.WithTimeout(ctx, outboxSinkTimeout)
+		err := sink.Deliver(sinkCtx, event)
+		cancel()
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+			continue
+		}
+		delivered = append(delivered, sink.Name())
+	}
+
+	// Результат доставки записывается даже если приложение уже останавливается
+	saveCtx := context.WithoutCancel(ctx)
+
+	if len(errs) == 0 {
+		return d.userRepo.CompleteOutboxEvent(saveCtx, event.Id)
+	}
+
+	errText := errors.Join(errs...).Error()
+	dead := event.Attempts >= d.cfg.maxAttempts
+	next := time.Now().Add(models.OutboxBackoff(event.Attempts, outboxBackoffBase, outboxBackoffMax))
+
+	if dead {
+		log.Critical("Outbox event %d (%s) dead after %d attempts: %s", event.Id, event.Event, event.Attempts, errText)
+	} else {
+		log.Error("Outbox event %d (%s) attempt %d failed, retry at %s: %s", event.Id, event.Event, event.Attempts, next.Format(time.DateTime), errText)
+	}
+
+	return d.userRepo.FailOutboxEvent(saveCtx, event.Id, delivered, next, dead, errText)
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+)
+
+// fakeOutboxRepo - очередь outbox в памяти
+type fakeOutboxRepo struct {
+	repository.UserRepository
+	events map[int64]*models.OutboxEvent
+}
+
+func (f *fakeOutboxRepo) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	var result []models.OutboxEvent
+	for id := int64(1); id <= int64(len(f.events)); id++ {
+		event := f.events[id]
+		if event.Status != models.OutboxPending || event.NextAttemptAt.After(time.Now()) {
+			continue
+		}
+		event.Attempts++
+		event.NextAttemptAt = time.Now().Add(lease)
+		result = append(result, *event)
+	}
+	return result, nil
+}
+
+func (f *fakeOutboxRepo) CompleteOutboxEvent(ctx context.Context, id int64) error {
+	f.events[id].Status = models.OutboxDone
+	return nil
+}
+
+func (f *fakeOutboxRepo) FailOutboxEvent(ctx context.Context, id int64, delivered []string, nextAttemptAt time.Time, dead bool, errText string) error {
+	event := f.events[id]
+	event.Delivered = delivered
+	event.LastError = errText
+	// В тесте не ждём паузу, следующая попытка доступна сразу
+	event.NextAttemptAt = time.Time{}
+	if dead {
+		event.Status = models.OutboxDead
+	}
+	return nil
+}
+
+type fakeSink struct {
+	name     string
+	fails    int
+	received []int64
+}
+
+func (s *fakeSink) Name() string {
+	return s.name
+}
+
+func (s *fakeSink) Deliver(ctx context.Context, event models.OutboxEvent) error {
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("unavailable")
+	}
+	s.received = append(s.received, event.Id)
+	return nil
+}
+
+func TestOutboxDispatcher(t *testing.T) {
+	repo := &fakeOutboxRepo{events: map[int64]*models.OutboxEvent{
+		1: {Id: 1, Event: models.EventCardIssued, Status: models.OutboxPending},
+		2: {Id: 2, Event: models.EventCardIssued, Status: models.OutboxPending},
+	}}
+
+	stable := &fakeSink{name: "stable"}
+	flaky := &fakeSink{name: "flaky", fails: 2}
+
+	d := NewOutboxDispatcher(repo, &OutboxConfig{maxAttempts: 3})
+	d.AddSink(stable)
+	d.AddSink(flaky)
+
+	for i := 0; i < 3; i++ {
+		if _, err := d.DispatchOnce(context.Background()); err != nil {
+			t.Fatalf("Dispatch error: %v", err)
+		}
+	}
+
+	for id, event := range repo.events {
+		if event.Status != models.OutboxDone {
+			t.Errorf("Expected event %d to be done, but %s (%s)", id, event.Status, event.LastError)
+		}
+	}
+
+	// Успешный получатель не должен получать событие повторно из-за сбоя другого
+	if len(stable.received) != 2 || len(flaky.received) != 2 {
+		t.Errorf("Expected each sink to receive 2 events once, but %v and %v", stable.received, flaky.received)
+	}
+}
+
+func TestOutboxDispatcherDeadLetter(t *testing.T) {
+	repo := &fakeOutboxRepo{events: map[int64]*models.OutboxEvent{
+		1: {Id: 1, Event: models.EventCardIssued, Status: models.OutboxPending},
+	}}
+
+	d := NewOutboxDispatcher(repo, &OutboxConfig{maxAttempts: 2})
+	d.AddSink(&fakeSink{name: "broken", fails: 100})
+
+	for i := 0; i < 3; i++ {
+		d.DispatchOnce(context.Background())
+	}
+
+	if event := repo.events[1]; event.Status != models.OutboxDead || event.Attempts != 2 || event.LastError == "" {
+		t.Errorf("Expected event to be dead after 2 attempts, but %+v", event)
+	}
+}
+
+type recordingNotifier struct {
+	sent map[string]models.Notification
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, to string, notification models.Notification) error {
+	n.sent[to] = notification
+	return nil
+}
+
+// fakeOwnerRepo - владельцы счетов по id счёта
+type fakeOwnerRepo struct {
+	repository.UserRepository
+	owners map[int]models.User
+}
+
+func (f *fakeOwnerRepo) GetAccountOwner(ctx context.Context, accountId int) (*models.User, error) {
+	owner, ok := f.owners[accountId]
+	if !ok {
+		return nil, errors.New("no account")
+	}
+	return &owner, nil
+}
+
+func TestNotificationSinkTransfer(t *testing.T) {
+	repo := &fakeOwnerRepo{owners: map[int]models.User{
+		1: {Name: "ivan", Email: "ivan@example.com"},
+		2: {Name: "petr", Email: "petr@example.com"},
+	}}
+	notifier := &recordingNotifier{sent: map[string]models.Notification{}}
+
+	payload, _ := json.Marshal(models.TransactionEvent{
+		Type: "transfer", AccountId: 1, AccountNumber: "40817810000000000001",
+		DestAccountId: 2, DestAccountNumber: "40817810000000000002",
+		Amount: models.NewMoney(150000), Balance: models.NewMoney(50000),
+	})
+
+	sink := NewNotificationSink(repo, notifier, nil)
+	err := sink.Deliver(context.Background(), models.OutboxEvent{Event: models.EventTransactionCreated, Payload: payload})
+	if err != nil {
+		t.Fatalf("Deliver error: %v", err)
+	}
+
+	out := notifier.sent["ivan@example.com"]
+	if out.Event != models.NotifyTransferOut || out.Data["amount"] != "1500.00" || out.Data["balance"] != "500.00" || out.Data["counterparty"] != "40817810000000000002" {
+		t.Errorf("Wrong outgoing transfer notification: %+v", out)
+	}
+
+	in := notifier.sent["petr@example.com"]
+	if in.Event != models.NotifyTransferIn || in.Username != "petr" || in.Data["account"] != "40817810000000000002" {
+		t.Errorf("Wrong incoming transfer notification: %+v", in)
+	}
+}
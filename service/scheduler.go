@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/utils"
+)
+
+// Job - периодическая фоновая задача. Run возвращает число обработанных записей.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) (int, error)
+}
+
+// Scheduler запускает задачи внутри процесса приложения. Если приложение
+// запущено в нескольких экземплярах, задачу выполняет только тот, кто взял
+// её advisory lock в Postgres, остальные пропускают запуск.
+type Scheduler struct {
+	userRepo repository.UserRepository
+	jobs     []Job
+	wg       sync.WaitGroup
+}
+
+func NewScheduler(u repository.UserRepository) *Scheduler {
+	return &Scheduler{userRepo: u}
+}
+
+func (s *Scheduler) AddJob(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Start запускает все задачи: первый раз сразу, дальше раз в Interval,
+// пока не отменён ctx.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go func(job Job) {
+			defer s.wg.Done()
+
+			ticker := time.NewTicker(job.Interval)
+			defer ticker.Stop()
+
+			for {
+				s.runJob(ctx, job)
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(job)
+	}
+}
+
+// Wait ждёт завершения задач после отмены контекста.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) runJob(ctx context.Context, job Job) {
+	log := utils.GlobalLogger()
+
+	unlock, acquired, err := s.userRepo.AcquireJobLock(ctx, job.Name)
+	if err != nil {
+		log.Error("Can't lock job %s: %w", job.Name, err)
+		return
+	}
+
+	if !acquired {
+		log.Debug("Job %s is running in other instance, skip", job.Name)
+		return
+	}
+	defer unlock()
+
+	runId, err := s.userRepo.StartJobRun(ctx, job.Name)
+	if err != nil {
+		log.Error("Can't record job %s run: %w", job.Name, err)
+		return
+	}
+
+	log.Info("Job %s started", job.Name)
+
+	processed, err := job.Run(ctx)
+
+	status, errText := models.JobSuccess, ""
+	if err != nil {
+		log.Error("Job %s failed: %w", job.Name, err)
+		status, errText = models.JobFailed, err.Error()
+	}
+
+	// Результат записывается даже если приложение уже останавливается
+	if err := s.userRepo.FinishJobRun(context.WithoutCancel(ctx), runId, status, processed, errText); err != nil {
+		log.Error("Can't finish job %s run: %w", job.Name, err)
+	}
+
+	log.Info("Job %s finished: %s, processed %d", job.Name, status, processed)
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+)
+
+// fakeJobRepo - блокировки и журнал запусков задач в памяти
+type fakeJobRepo struct {
+	repository.UserRepository
+	locked   bool
+	unlocked bool
+	runs     map[int]string
+}
+
+func (f *fakeJobRepo) AcquireJobLock(ctx context.Context, job string) (func(), bool, error) {
+	if f.locked {
+		return nil, false, nil
+	}
+	return func() { f.unlocked = true }, true, nil
+}
+
+func (f *fakeJobRepo) StartJobRun(ctx context.Context, job string) (int, error) {
+	if f.runs == nil {
+		f.runs = map[int]string{}
+	}
+	id := len(f.runs) + 1
+	f.runs[id] = models.JobRunning
+	return id, nil
+}
+
+func (f *fakeJobRepo) FinishJobRun(ctx context.Context, id int, status string, processed int, errText string) error {
+	f.runs[id] = status
+	return nil
+}
+
+func TestSchedulerRunJob(t *testing.T) {
+	repo := &fakeJobRepo{}
+	s := NewScheduler(repo)
+
+	calls := 0
+	job := Job{Name: "test", Interval: time.Hour, Run: func(ctx context.Context) (int, error) {
+		calls++
+		if calls == 2 {
+			return 0, errors.New("boom")
+		}
+		return 1, nil
+	}}
+
+	s.runJob(context.Background(), job)
+	s.runJob(context.Background(), job)
+
+	if calls != 2 || repo.runs[1] != models.JobSuccess || repo.runs[2] != models.JobFailed || !repo.unlocked {
+		t.Errorf("Expected success and failed runs, but %d calls, %v", calls, repo.runs)
+	}
+
+	// Задачу уже выполняет другой экземпляр приложения
+	repo.locked = true
+	s.runJob(context.Background(), job)
+
+	if calls != 2 || len(repo.runs) != 2 {
+		t.Errorf("Expected locked job to be skipped, but %d calls", calls)
+	}
+}
+
+// fakeCreditRepo - платежи по кредиту в памяти, счёт с фиксированным балансом
+type fakeCreditRepo struct {
+	repository.UserRepository
+	balance  models.Money
+	payments []models.DueCreditPayment
+	overdue  map[int]models.Money
+}
+
+func (f *fakeCreditRepo) GetDueCreditPayments(ctx context.Context, at time.Time) ([]models.DueCreditPayment, error) {
+	return f.payments, nil
+}
+
+func (f *fakeCreditRepo) PayCreditPayment(ctx context.Context, payment models.DueCreditPayment, entry models.JournalEntry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+	if f.balance.Cmp(payment.Total()) < 0 {
+		return repository.ErrInsufficientFunds
+	}
+	f.balance = f.balance.Sub(payment.Total())
+	return nil
+}
+
+func (f *fakeCreditRepo) MarkCreditPaymentOverdue(ctx context.Context, payment models.DueCreditPayment, penalty models.Money, accruedAt time.Time) error {
+	f.overdue[payment.Id] = penalty
+	return nil
+}
+
+func TestCollectDuePayments(t *testing.T) {
+	accruedAt := time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC)
+	repo := &fakeCreditRepo{
+		balance: models.NewMoney(1000000),
+		overdue: map[int]models.Money{},
+		payments: []models.DueCreditPayment{
+			{AccountId: 1, CreditPayment: models.CreditPayment{
+				Id: 1, CreditId: 1, Number: 1, DueDate: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+				Payment: models.NewMoney(888488), Principal: models.NewMoney(788488), Interest: models.NewMoney(100000),
+			}},
+			// На второй платёж денег уже не хватит, пени считаются с прошлого начисления
+			{AccountId: 1, CreditPayment: models.CreditPayment{
+				Id: 2, CreditId: 1, Number: 2, DueDate: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+				Payment: models.NewMoney(1000000), Principal: models.NewMoney(900000), Interest: models.NewMoney(100000),
+				Status: models.PaymentOverdue, PenaltyAccruedAt: &accruedAt,
+			}},
+		},
+	}
+
+	s := NewLoanService(repo, NewTransactionService(repo), nil, nil, 2000)
+
+	processed, err := s.CollectDuePayments(context.Background(), time.Date(2025, 4, 10, 12, 0, 0, 0, time.UTC))
+	if err != nil || processed != 2 {
+		t.Fatalf("Expected 2 processed payments, but %d (%v)", processed, err)
+	}
+
+	if repo.balance.String() != "1115.12" {
+		t.Errorf("Expected first payment to be paid, but balance %s", repo.balance)
+	}
+
+	if _, ok := repo.overdue[1]; ok {
+		t.Errorf("Expected first payment not to be overdue")
+	}
+
+	// 10000.00 * 20% * 30 / 365
+	if penalty := repo.overdue[2]; penalty.String() != "164.38" {
+		t.Errorf("Expected penalty 164.38 for 30 days, but %s", penalty)
+	}
+}
@@ -2,18 +2,106 @@ package service
 
 import (
 	"context"
+	"io"
+	"time"
 	"uniback/models"
 )
 
 type Service interface {
-	DepositTransaction(ctx context.Context, acc models.Account, amount float64) (*models.Account, error)
-	WithdrawalTransaction(ctx context.Context, acc models.Account, amount float64) (*models.Account, error)
-	TransferTransaction(ctx context.Context, source models.Account, dest models.Account, amount float64) (*models.Account, error)
+	DepositTransaction(ctx context.Context, acc models.Account, amount models.Money) (*models.Account, error)
+	WithdrawalTransaction(ctx context.Context, acc models.Account, amount models.Money) (*models.Account, error)
+	TransferTransaction(ctx context.Context, source models.Account, dest models.Account, amount models.Money) (*models.Account, error)
+
+	AuthorizeCardPayment(ctx context.Context, card models.Card, acc models.Account, initiatorId int, amount models.Money, merchant string) (*models.CardHold, error)
+	CaptureCardPayment(ctx context.Context, hold models.CardHold, amount models.Money) (*models.CardHold, error)
+	VoidCardPayment(ctx context.Context, hold models.CardHold) (*models.CardHold, error)
+
+	DisburseCredit(ctx context.Context, acc models.Account, loan models.Loan, schedule []models.CreditPayment) (*models.Loan, error)
+	PayCreditPayment(ctx context.Context, payment models.DueCreditPayment) error
+	PrepayCredit(ctx context.Context, loan models.Loan, repayment models.CreditRepayment, pending []models.CreditPayment, schedule []models.CreditPayment) (*models.Loan, error)
 }
 
 type CryptoService interface {
 	PgpEncode(data string) []byte
 	PgpDecode(data []byte) string
+	HmacIndex(data string) []byte
 	GenerateCardLuhn() (string, error)
 	GenerateCvv() string
 }
+
+type StatementService interface {
+	BuildStatement(ctx context.Context, acc models.Account, from time.Time, to time.Time) (*models.Statement, error)
+	WriteStatementCsv(w io.Writer, st *models.Statement) error
+	WriteStatementPdf(w io.Writer, st *models.Statement) error
+}
+
+type CreditService interface {
+	IssueCredit(ctx context.Context, acc models.Account, product string, principal models.Money, months int, scheduleType string) (*models.Loan, []models.CreditPayment, error)
+	CollectDuePayments(ctx context.Context, at time.Time) (int, error)
+	RepayCredit(ctx context.Context, loan models.Loan, amount models.Money, mode string) (*models.Loan, []models.CreditPayment, error)
+}
+
+type AnalyticsService interface {
+	Analytics(ctx context.Context, username string, from time.Time, to time.Time, granularity string) (*models.Analytics, error)
+	BudgetReport(ctx context.Context, username string, month time.Time, at time.Time) ([]models.BudgetStatus, error)
+	Forecast(ctx context.Context, username string, days int, at time.Time) ([]models.AccountForecast, error)
+}
+
+// TokenService выдаёт и проверяет access-токены (JWT) и публикует ключи проверки.
+type TokenService interface {
+	Issue(username string, jti string, expiresAt time.Time) (string, error)
+	Verify(token string) (*TokenClaims, error)
+	Jwks() models.Jwks
+}
+
+// TwoFactorService - второй фактор входа: подключение TOTP и проверка кода
+// при входе. Вместо кода TOTP можно предъявить одноразовый код восстановления.
+type TwoFactorService interface {
+	Enroll(ctx context.Context, user models.User) (*models.TotpEnrollment, error)
+	Confirm(ctx context.Context, userId int, code string) (recoveryCodes []string, err error)
+	Disable(ctx context.Context, userId int, code string, recoveryCode string) error
+	CreateChallenge(ctx context.Context, userId int) (token string, expiresAt time.Time, err error)
+	VerifyChallenge(ctx context.Context, token string, code string, recoveryCode string) (*models.MfaChallenge, error)
+}
+
+// TransferConfirmService - подтверждение крупных переводов и переводов новому
+// получателю одноразовым кодом.
+type TransferConfirmService interface {
+	ConfirmReason(ctx context.Context, userId int, dest models.Account, amount models.Money) (string, error)
+	Request(ctx context.Context, user models.User, source models.Account, dest models.Account, amount models.Money, reason string) (*models.PendingTransfer, error)
+	Confirm(ctx context.Context, username string, id int64, code string) (*models.Account, error)
+}
+
+// LoginGuard ограничивает подбор паролей: паузы между неудачными входами и
+// временная блокировка входа с письмом для разблокировки.
+type LoginGuard interface {
+	Check(ctx context.Context, username string, ip string) (retryAfter time.Duration, err error)
+	Failure(ctx context.Context, username string, ip string, user *models.User) error
+	Success(ctx context.Context, username string) error
+	Unlock(ctx context.Context, token string) (bool, error)
+}
+
+// AttemptGuard ограничивает подбор кодов и реквизитов: паузы после неудачных
+// попыток пользователя и с одного IP.
+type AttemptGuard interface {
+	Check(ctx context.Context, username string, ip string) (retryAfter time.Duration, err error)
+	Failure(ctx context.Context, username string, ip string) error
+}
+
+// CardGuard ограничивает подбор срока действия и CVV карт: паузы по
+// пользователю и IP, блокировка карты после нескольких неудач по ней.
+type CardGuard interface {
+	Check(ctx context.Context, username string, ip string) (retryAfter time.Duration, err error)
+	Failure(ctx context.Context, username string, ip string, card *models.Card) error
+}
+
+// WebhookService создаёт секреты подписи webhook и повторяет доставки вручную.
+type WebhookService interface {
+	NewWebhookSecret() (nonce []byte, secret string, err error)
+	Redeliver(ctx context.Context, delivery models.WebhookDelivery) (*models.WebhookDelivery, error)
+}
+
+// KeyRateProvider - источник ключевой ставки ЦБ РФ, действующей на дату at.
+type KeyRateProvider interface {
+	KeyRate(ctx context.Context, at time.Time) (*models.KeyRate, error)
+}
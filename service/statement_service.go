@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+const statementDateLayout = "2006-01-02"
+
+type StatementServiceConfig struct {
+	bankName string
+}
+
+type LedgerStatementService struct {
+	userRepo repository.UserRepository
+	cfg      StatementServiceConfig
+}
+
+func NewLedgerStatementService(u repository.UserRepository, bankName string) *LedgerStatementService {
+	return &LedgerStatementService{
+		userRepo: u,
+		cfg: StatementServiceConfig{
+			bankName: bankName,
+		},
+	}
+}
+
+// BuildStatement собирает выписку за период [from, to): входящий остаток берётся
+// из главной книги, движения - из истории операций счёта.
+func (s *LedgerStatementService) BuildStatement(ctx context.Context, acc models.Account, from time.Time, to time.Time) (*models.Statement, error) {
+	opening, err := s.userRepo.GetAccountBalanceAt(ctx, acc.Id, from)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := s.userRepo.GetAccountTransactions(ctx, acc.Id, models.TransactionFilter{
+		From: &from,
+		To:   &to,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &models.Statement{
+		Account:        acc,
+		From:           from,
+		To:             to,
+		GeneratedAt:    time.Now(),
+		OpeningBalance: opening,
+		TotalIn:        models.NewMoney(0),
+		TotalOut:       models.NewMoney(0),
+		TotalFee:       models.NewMoney(0),
+	}
+
+	// История отдаётся от новых к старым, выписка идёт по возрастанию времени
+	balance := opening
+	for i := len(transactions) - 1; i >= 0; i-- {
+		trs := transactions[i]
+
+		balance = balance.Add(trs.Delta())
+		if trs.Direction == "in" {
+			statement.TotalIn = statement.TotalIn.Add(trs.Amount)
+		} else {
+			statement.TotalOut = statement.TotalOut.Add(trs.Amount)
+		}
+		statement.TotalFee = statement.TotalFee.Add(trs.Fee)
+
+		statement.Lines = append(statement.Lines, models.StatementLine{
+			AccountTransaction: trs,
+			Balance:            balance,
+		})
+	}
+
+	statement.ClosingBalance = balance
+
+	return statement, nil
+}
+
+func (s *LedgerStatementService) WriteStatementCsv(w io.Writer, st *models.Statement) error {
+	writer := csv.NewWriter(w)
+
+	records := [][]string{
+		{"bank", s.cfg.bankName},
+		{"account", st.Account.AccountNumber},
+		{"period", st.From.Format(statementDateLayout), statementLastDay(st)},
+		{"opening_balance", st.OpeningBalance.String()},
+		{},
+		{"time", "type", "direction", "counterparty_account", "amount", "fee", "balance"},
+	}
+
+	for _, line := range st.Lines {
+		records = append(records, []string{
+			line.Time.Format(time.DateTime),
+			line.Type,
+			line.Direction,
+			line.CounterpartyAccount,
+			line.Amount.String(),
+			line.Fee.String(),
+			line.Balance.String(),
+		})
+	}
+
+	records = append(records,
+		[]string{},
+		[]string{"total_in", st.TotalIn.String()},
+		[]string{"total_out", st.TotalOut.String()},
+		[]string{"total_fee", st.TotalFee.String()},
+		[]string{"closing_balance", st.ClosingBalance.String()},
+	)
+
+	if err := writer.WriteAll(records); err != nil {
+		return fmt.Errorf("failed to write csv statement: %w", err)
+	}
+
+	return nil
+}
+
+// WriteStatementPdf рисует выписку стандартными шрифтами PDF, поэтому все
+// тексты в документе латиницей.
+func (s *LedgerStatementService) WriteStatementPdf(w io.Writer, st *models.Statement) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Account statement "+st.Account.AccountNumber, false)
+	pdf.SetAuthor(s.cfg.bankName, false)
+
+	widths := []float64{36, 24, 12, 42, 26, 18, 26}
+	headers := []string{"Time", "Type", "Dir", "Counterparty", "Amount", "Fee", "Balance"}
+
+	tableHeader := func() {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.SetFillColor(230, 230, 230)
+		for i, header := range headers {
+			pdf.CellFormat(widths[i], 7, header, "1", 0, "C", true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", 9)
+	}
+
+	pdf.SetHeaderFunc(func() {
+		pdf.SetFont("Helvetica", "B", 16)
+		pdf.CellFormat(0, 10, s.cfg.bankName, "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(0, 6, "Account statement", "B", 1, "L", false, 0, "")
+		pdf.Ln(4)
+	})
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.CellFormat(0, 10, fmt.Sprintf("Page %d/{nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AliasNbPages("")
+
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "", 10)
+	info := [][2]string{
+		{"Account number", st.Account.AccountNumber},
+		{"Account type", st.Account.AccountType},
+		{"Currency", st.OpeningBalance.Currency},
+		{"Period", st.From.Format(statementDateLayout) + " - " + statementLastDay(st)},
+		{"Generated at", st.GeneratedAt.Format(time.DateTime)},
+		{"Opening balance", st.OpeningBalance.String()},
+	}
+	for _, row := range info {
+		pdf.CellFormat(40, 6, row[0], "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, row[1], "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	tableHeader()
+	for _, line := range st.Lines {
+		// Перенос таблицы на новую страницу вместе с заголовком
+		if pdf.GetY() > 270 {
+			pdf.AddPage()
+			tableHeader()
+		}
+
+		cells := []string{
+			line.Time.Format(time.DateTime),
+			line.Type,
+			line.Direction,
+			line.CounterpartyAccount,
+			line.Amount.String(),
+			line.Fee.String(),
+			line.Balance.String(),
+		}
+		for i, cell := range cells {
+			align := "L"
+			if i >= 4 {
+				align = "R"
+			}
+			pdf.CellFormat(widths[i], 6, cell, "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	pdf.Ln(4)
+	pdf.SetFont("Helvetica", "B", 10)
+	totals := [][2]string{
+		{"Total in", st.TotalIn.String()},
+		{"Total out", st.TotalOut.String()},
+		{"Total fee", st.TotalFee.String()},
+		{"Closing balance", st.ClosingBalance.String()},
+	}
+	for _, row := range totals {
+		pdf.CellFormat(40, 6, row[0], "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, row[1], "", 1, "L", false, 0, "")
+	}
+
+	return pdf.Output(w)
+}
+
+// Период хранится полуоткрытым [From, To), в документах показываем последний день.
+func statementLastDay(st *models.Statement) string {
+	return st.To.AddDate(0, 0, -1).Format(statementDateLayout)
+}
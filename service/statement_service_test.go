@@ -0,0 +1,78 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+)
+
+type fakeStatementRepo struct {
+	repository.UserRepository
+	opening      models.Money
+	transactions []models.AccountTransaction
+}
+
+func (f *fakeStatementRepo) GetAccountBalanceAt(ctx context.Context, accountId int, at time.Time) (models.Money, error) {
+	return f.opening, nil
+}
+
+func (f *fakeStatementRepo) GetAccountTransactions(ctx context.Context, accountId int, filter models.TransactionFilter) ([]models.AccountTransaction, error) {
+	return f.transactions, nil
+}
+
+func TestBuildStatement(t *testing.T) {
+	day := time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC)
+
+	// Репозиторий отдаёт историю от новых к старым
+	repo := &fakeStatementRepo{
+		opening: models.NewMoney(10000),
+		transactions: []models.AccountTransaction{
+			{Id: 3, Type: "transfer", Direction: "in", Amount: models.NewMoney(2500), Time: day.Add(3 * time.Hour), CounterpartyAccount: "40881010875173177486"},
+			{Id: 2, Type: "withdrawal", Direction: "out", Amount: models.NewMoney(3000), Fee: models.NewMoney(100), Time: day.Add(2 * time.Hour)},
+			{Id: 1, Type: "deposit", Direction: "in", Amount: models.NewMoney(5000), Fee: models.NewMoney(50), Time: day.Add(time.Hour)},
+		},
+	}
+
+	s := NewLedgerStatementService(repo, "UniBack")
+	st, err := s.BuildStatement(context.Background(), models.Account{Id: 1, AccountNumber: "40881066752914644069"}, day, day.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("Build statement error: %v", err)
+	}
+
+	if len(st.Lines) != 3 || st.Lines[0].Id != 1 {
+		t.Fatalf("Expected 3 lines in ascending order, but %+v", st.Lines)
+	}
+
+	expected := []string{"149.50", "118.50", "143.50"}
+	for i, line := range st.Lines {
+		if line.Balance.String() != expected[i] {
+			t.Errorf("Line %d: expected running balance %s, but %s", i, expected[i], line.Balance)
+		}
+	}
+
+	if st.ClosingBalance.String() != "143.50" || st.TotalIn.String() != "75.00" || st.TotalOut.String() != "30.00" || st.TotalFee.String() != "1.50" {
+		t.Errorf("Wrong totals: closing %s, in %s, out %s, fee %s", st.ClosingBalance, st.TotalIn, st.TotalOut, st.TotalFee)
+	}
+
+	var csvBuf bytes.Buffer
+	if err := s.WriteStatementCsv(&csvBuf, st); err != nil {
+		t.Fatalf("CSV error: %v", err)
+	}
+
+	if !strings.Contains(csvBuf.String(), "opening_balance,100.00") || !strings.Contains(csvBuf.String(), "closing_balance,143.50") {
+		t.Errorf("Wrong CSV statement:\n%s", csvBuf.String())
+	}
+
+	var pdfBuf bytes.Buffer
+	if err := s.WriteStatementPdf(&pdfBuf, st); err != nil {
+		t.Fatalf("PDF error: %v", err)
+	}
+
+	if !bytes.HasPrefix(pdfBuf.Bytes(), []byte("%PDF-")) {
+		t.Errorf("Expected PDF document")
+	}
+}
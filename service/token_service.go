@@ -0,0 +1,392 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// Ключи перечитываются из БД не чаще раза в минуту: ротацию выполняет один
+	// экземпляр приложения, остальные узнают о новом ключе при перечитывании
+	jwtKeysReloadInterval = time.Minute
+	// Токен с неизвестным kid перечитывает ключи не чаще раза в 10 секунд,
+	// чтобы поток поддельных токенов не нагружал БД
+	jwtKeysMissReloadInterval = 10 * time.Second
+	jwtRsaBits                = 2048
+	// JwksMaxAge - сколько другие сервисы могут кэшировать JWKS
+	JwksMaxAge = 5 * time.Minute
+	// Новый ключ сначала только публикуется в JWKS и начинает подписывать
+	// токены, когда JWKS без него уже не может оставаться ни в кэше
+	// проверяющих сервисов, ни в памяти других экземпляров приложения
+	jwtKeyActivationDelay = JwksMaxAge + jwtKeysReloadInterval
+)
+
+var ErrNoJwtKey = errors.New("no jwt signing key")
+
+// TokenClaims - claims access-токена. Username дублирует sub для обработчиков.
+type TokenClaims struct {
+	Username string `json:"username"`
+	jwt.RegisteredClaims
+}
+
+type TokenConfig struct {
+	alg         string
+	issuer      string
+	audience    string
+	accessTtl   time.Duration
+	rotateEvery time.Duration
+}
+
+func TokenConfigFromGlobalConfig(cfg *utils.Config) *TokenConfig {
+	return &TokenConfig{
+		alg:         cfg.JwtAlg,
+		issuer:      cfg.JwtIssuer,
+		audience:    cfg.JwtAudience,
+		accessTtl:   time.Duration(cfg.AccessTokenTtlMin) * time.Minute,
+		rotateEvery: time.Duration(cfg.JwtRotateDays) * 24 * time.Hour,
+	}
+}
+
+type signingKey struct {
+	kid         string
+	alg         string
+	private     crypto.Signer
+	createdAt   time.Time
+	activatesAt time.Time
+	retiredAt   *time.Time
+}
+
+// JwtTokenService подписывает access-токены ключами RS256 или EdDSA из таблицы
+// jwt_keys. Новый ключ публикуется в JWKS за jwtKeyActivationDelay до того,
+// как начнёт подписывать. Выведенный из оборота ключ остаётся в JWKS и
+// проверяет токены ещё accessTtl после ротации, пока не истекут выданные им токены.
+type JwtTokenService struct {
+	userRepo      repository.UserRepository
+	cryptoService CryptoService
+	cfg           TokenConfig
+
+	mtx  sync.RWMutex
+	keys map[string]*signingKey
+	// latest - последний созданный ключ, он может ещё не подписывать токены
+	latest   *signingKey
+	loadedAt time.Time
+}
+
+func NewJwtTokenService(ctx context.Context, u repository.UserRepository, cs CryptoService, cfg *TokenConfig) (*JwtTokenService, error) {
+	if cfg.alg != models.JwtAlgRS256 && cfg.alg != models.JwtAlgEdDSA {
+		return nil, fmt.Errorf("unsupported jwt alg %q", cfg.alg)
+	}
+
+	s := &JwtTokenService{
+		userRepo:      u,
+		cryptoService: cs,
+		cfg:           *cfg,
+		keys:          make(map[string]*signingKey),
+	}
+
+	// Сначала читаем сохранённые ключи: если текущий ещё не устарел, новый не создаётся
+	if err := s.reload(ctx, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.RotateKeys(ctx, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Issue подписывает access-токен пользователя текущим ключом.
+func (s *JwtTokenService) Issue(username string, jti string, expiresAt time.Time) (string, error) {
+	s.reloadIfStale(jwtKeysReloadInterval)
+
+	now := time.Now()
+	key := s.signingKey(now)
+	if key == nil {
+		return "", ErrNoJwtKey
+	}
+
+	token := jwt.NewWithClaims(jwtSigningMethod(key.alg), TokenClaims{
+		Username: username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    s.cfg.issuer,
+			Subject:   username,
+			Audience:  jwt.ClaimStrings{s.cfg.audience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
+	token.Header["kid"] = key.kid
+
+	return token.SignedString(key.private)
+}
+
+// Verify проверяет подпись, kid, iss, aud, exp и nbf access-токена.
+func (s *JwtTokenService) Verify(tokenString string) (*TokenClaims, error) {
+	claims := &TokenClaims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, s.verificationKey,
+		jwt.WithValidMethods([]string{models.JwtAlgRS256, models.JwtAlgEdDSA}),
+		jwt.WithIssuer(s.cfg.issuer),
+		jwt.WithAudience(s.cfg.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithNotBeforeRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (s *JwtTokenService) verificationKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	s.mtx.RLock()
+	key, ok := s.keys[kid]
+	s.mtx.RUnlock()
+
+	if !ok {
+		s.reloadIfStale(jwtKeysMissReloadInterval)
+
+		s.mtx.RLock()
+		key, ok = s.keys[kid]
+		s.mtx.RUnlock()
+
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+	}
+
+	if key.alg != token.Method.Alg() {
+		return nil, fmt.Errorf("kid %q is %s key", kid, key.alg)
+	}
+
+	if key.retiredAt != nil && time.Now().After(key.retiredAt.Add(s.cfg.accessTtl)) {
+		return nil, fmt.Errorf("kid %q is retired", kid)
+	}
+
+	return key.private.Public(), nil
+}
+
+// Jwks - открытые ключи для проверки токенов другими сервисами.
+func (s *JwtTokenService) Jwks() models.Jwks {
+	s.reloadIfStale(jwtKeysReloadInterval)
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	jwks := models.Jwks{Keys: []models.Jwk{}}
+	now := time.Now()
+	for _, key := range s.keys {
+		if key.retiredAt != nil && now.After(key.retiredAt.Add(s.cfg.accessTtl)) {
+			continue
+		}
+
+		jwk := models.Jwk{Use: "sig", Alg: key.alg, Kid: key.kid}
+		switch pub := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	slices.SortFunc(jwks.Keys, func(a, b models.Jwk) int {
+		return strings.Compare(a.Kid, b.Kid)
+	})
+
+	return jwks
+}
+
+// signingKey - ключ, которым подписываются токены в момент now: последний из
+// уже начавших подписывать и ещё не выведенных из оборота.
+func (s *JwtTokenService) signingKey(now time.Time) *signingKey {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var current *signingKey
+	for _, key := range s.keys {
+		if key.activatesAt.After(now) || (key.retiredAt != nil && !key.retiredAt.After(now)) {
+			continue
+		}
+		if current == nil || key.activatesAt.After(current.activatesAt) {
+			current = key
+		}
+	}
+
+	return current
+}
+
+// RotateKeys создаёт новый ключ, если последнему больше rotateEvery или в
+// настройках сменился алгоритм, и перечитывает ключи. Новый ключ начинает
+// подписывать через jwtKeyActivationDelay, до этого подписывает прежний.
+// Только если подписывать нечем (первый запуск), ключ действует сразу.
+// Возвращает 1, если ключ создан этим вызовом.
+func (s *JwtTokenService) RotateKeys(ctx context.Context, now time.Time) (int, error) {
+	s.mtx.RLock()
+	latest := s.latest
+	s.mtx.RUnlock()
+
+	createdBefore := now.Add(-s.cfg.rotateEvery)
+	if latest != nil && latest.alg == s.cfg.alg && latest.createdAt.After(createdBefore) {
+		return 0, s.reload(ctx, now)
+	}
+
+	activatesAt := now
+	if s.signingKey(now) != nil {
+		activatesAt = now.Add(jwtKeyActivationDelay)
+	}
+
+	key, err := s.generateKey(now, activatesAt)
+	if err != nil {
+		return 0, err
+	}
+
+	rotated, err := s.userRepo.RotateJwtKey(ctx, *key, createdBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.reload(ctx, now); err != nil {
+		return 0, err
+	}
+
+	if rotated {
+		utils.GlobalLogger().Info("New %s jwt key %s, signs from %s", key.Alg, key.Kid, activatesAt.Format(time.RFC3339))
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+func (s *JwtTokenService) generateKey(now time.Time, activatesAt time.Time) (*models.JwtKey, error) {
+	var private crypto.Signer
+	var err error
+
+	if s.cfg.alg == models.JwtAlgEdDSA {
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	} else {
+		private, err = rsa.GenerateKey(rand.Reader, jwtRsaBits)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+
+	return &models.JwtKey{
+		Kid:         now.UTC().Format("20060102") + "-" + hex.EncodeToString(suffix),
+		Alg:         s.cfg.alg,
+		PrivateKey:  s.cryptoService.PgpEncode(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))),
+		CreatedAt:   now,
+		ActivatesAt: activatesAt,
+	}, nil
+}
+
+// reload перечитывает ключи из БД. Ключи, выведенные из оборота раньше
+// accessTtl назад, уже не нужны: их токены истекли.
+func (s *JwtTokenService) reload(ctx context.Context, now time.Time) error {
+	stored, err := s.userRepo.GetJwtKeys(ctx, now.Add(-s.cfg.accessTtl))
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey)
+	var latest *signingKey
+	for _, k := range stored {
+		block, _ := pem.Decode([]byte(s.cryptoService.PgpDecode(k.PrivateKey)))
+		if block == nil {
+			return fmt.Errorf("can't decrypt jwt key %s", k.Kid)
+		}
+
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("wrong jwt key %s: %w", k.Kid, err)
+		}
+
+		private, ok := parsed.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("wrong jwt key %s type %T", k.Kid, parsed)
+		}
+
+		key := &signingKey{kid: k.Kid, alg: k.Alg, private: private, createdAt: k.CreatedAt, activatesAt: k.ActivatesAt, retiredAt: k.RetiredAt}
+		keys[k.Kid] = key
+		if k.RetiredAt == nil {
+			latest = key
+		}
+	}
+
+	s.mtx.Lock()
+	s.keys = keys
+	s.latest = latest
+	s.loadedAt = time.Now()
+	s.mtx.Unlock()
+
+	return nil
+}
+
+// reloadIfStale перечитывает ключи, если они загружены раньше interval назад.
+// Ошибка только логируется: до следующей попытки работают прежние ключи.
+func (s *JwtTokenService) reloadIfStale(interval time.Duration) {
+	s.mtx.RLock()
+	stale := time.Since(s.loadedAt) > interval
+	s.mtx.RUnlock()
+
+	if !stale {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.reload(ctx, time.Now()); err != nil {
+		utils.GlobalLogger().Error("Can't reload jwt keys: %w", err)
+
+		s.mtx.Lock()
+		s.loadedAt = time.Now()
+		s.mtx.Unlock()
+	}
+}
+
+func jwtSigningMethod(alg string) jwt.SigningMethod {
+	if alg == models.JwtAlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakePlainCrypto "шифрует" без изменений
+type fakePlainCrypto struct {
+	CryptoService
+}
+
+func (fakePlainCrypto) PgpEncode(data string) []byte {
+	return []byte(data)
+}
+
+func (fakePlainCrypto) PgpDecode(data []byte) string {
+	return string(data)
+}
+
+// fakeJwtKeyRepo - таблица jwt_keys в памяти
+type fakeJwtKeyRepo struct {
+	repository.UserRepository
+	keys []models.JwtKey
+}
+
+func (f *fakeJwtKeyRepo) GetJwtKeys(ctx context.Context, retiredAfter time.Time) ([]models.JwtKey, error) {
+	var result []models.JwtKey
+	for _, key := range f.keys {
+		if key.RetiredAt == nil || key.RetiredAt.After(retiredAfter) {
+			result = append(result, key)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeJwtKeyRepo) RotateJwtKey(ctx context.Context, key models.JwtKey, createdBefore time.Time) (bool, error) {
+	for i := range f.keys {
+		current := &f.keys[i]
+		if current.RetiredAt != nil {
+			continue
+		}
+		if current.Alg == key.Alg && current.CreatedAt.After(createdBefore) {
+			return false, nil
+		}
+		retiredAt := key.ActivatesAt
+		current.RetiredAt = &retiredAt
+	}
+	f.keys = append(f.keys, key)
+	return true, nil
+}
+
+func testTokenService(t *testing.T, repo *fakeJwtKeyRepo, alg string) *JwtTokenService {
+	t.Helper()
+
+	s, err := NewJwtTokenService(context.Background(), repo, fakePlainCrypto{}, &TokenConfig{
+		alg:         alg,
+		issuer:      "uniback",
+		audience:    "uniback",
+		accessTtl:   15 * time.Minute,
+		rotateEvery: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Token service error: %v", err)
+	}
+	return s
+}
+
+func TestTokenServiceIssueVerify(t *testing.T) {
+	for _, alg := range []string{models.JwtAlgRS256, models.JwtAlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			s := testTokenService(t, &fakeJwtKeyRepo{}, alg)
+
+			token, err := s.Issue("ivan", "jti-1", time.Now().Add(time.Minute))
+			if err != nil {
+				t.Fatalf("Issue error: %v", err)
+			}
+
+			claims, err := s.Verify(token)
+			if err != nil {
+				t.Fatalf("Verify error: %v", err)
+			}
+			if claims.Username != "ivan" || claims.Subject != "ivan" || claims.ID != "jti-1" || claims.Issuer != "uniback" {
+				t.Errorf("Wrong claims: %+v", claims)
+			}
+
+			jwks := s.Jwks()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Alg != alg || jwks.Keys[0].Kid != s.latest.kid {
+				t.Errorf("Wrong jwks: %+v", jwks)
+			}
+			if alg == models.JwtAlgEdDSA && (jwks.Keys[0].Kty != "OKP" || jwks.Keys[0].X == "") {
+				t.Errorf("Wrong Ed25519 jwk: %+v", jwks.Keys[0])
+			}
+			if alg == models.JwtAlgRS256 && (jwks.Keys[0].Kty != "RSA" || jwks.Keys[0].E != "AQAB") {
+				t.Errorf("Wrong RSA jwk: %+v", jwks.Keys[0])
+			}
+		})
+	}
+}
+
+func TestTokenServiceRejects(t *testing.T) {
+	s := testTokenService(t, &fakeJwtKeyRepo{}, models.JwtAlgEdDSA)
+	now := time.Now()
+
+	sign := func(method jwt.SigningMethod, key any, claims jwt.RegisteredClaims) string {
+		t.Helper()
+		token := jwt.NewWithClaims(method, TokenClaims{Username: "ivan", RegisteredClaims: claims})
+		token.Header["kid"] = s.latest.kid
+		str, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("Sign error: %v", err)
+		}
+		return str
+	}
+
+	valid := jwt.RegisteredClaims{
+		ID:        "jti",
+		Issuer:    "uniback",
+		Audience:  jwt.ClaimStrings{"uniback"},
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+
+	cases := map[string]func(c *jwt.RegisteredClaims){
+		"audience":   func(c *jwt.RegisteredClaims) { c.Audience = jwt.ClaimStrings{"other"} },
+		"issuer":     func(c *jwt.RegisteredClaims) { c.Issuer = "other" },
+		"not before": func(c *jwt.RegisteredClaims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Hour)) },
+		"no nbf":     func(c *jwt.RegisteredClaims) { c.NotBefore = nil },
+		"expired":    func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) },
+	}
+
+	if _, err := s.Verify(sign(jwt.SigningMethodEdDSA, s.latest.private, valid)); err != nil {
+		t.Fatalf("Expected valid token, but %v", err)
+	}
+
+	for name, change := range cases {
+		claims := valid
+		change(&claims)
+		if _, err := s.Verify(sign(jwt.SigningMethodEdDSA, s.latest.private, claims)); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+
+	// Открытый ключ из JWKS нельзя использовать как секрет HS256
+	if _, err := s.Verify(sign(jwt.SigningMethodHS256, []byte(s.Jwks().Keys[0].X), valid)); err == nil {
+		t.Errorf("Expected HS256 token to be rejected")
+	}
+}
+
+func TestTokenServiceRotation(t *testing.T) {
+	repo := &fakeJwtKeyRepo{}
+	s := testTokenService(t, repo, models.JwtAlgRS256)
+	oldKid := s.latest.kid
+
+	oldToken, err := s.Issue("ivan", "old", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+
+	if rotated, err := s.RotateKeys(context.Background(), time.Now()); err != nil || rotated != 0 {
+		t.Fatalf("Expected fresh key to be kept, but %d (%v)", rotated, err)
+	}
+
+	rotateAt := time.Now().Add(25 * time.Hour)
+	if rotated, err := s.RotateKeys(context.Background(), rotateAt); err != nil || rotated != 1 {
+		t.Fatalf("Expected key rotation, but %d (%v)", rotated, err)
+	}
+	newKey := s.latest
+	if newKey.kid == oldKid || !newKey.activatesAt.Equal(rotateAt.Add(jwtKeyActivationDelay)) {
+		t.Fatalf("Expected new key signing after activation delay, but %+v", newKey)
+	}
+
+	// Новый ключ уже в JWKS, но подписывает прежний, пока кэш JWKS не устареет
+	if keys := s.Jwks().Keys; len(keys) != 2 {
+		t.Errorf("Expected both keys in jwks, but %+v", keys)
+	}
+	if key := s.signingKey(rotateAt.Add(JwksMaxAge)); key == nil || key.kid != oldKid {
+		t.Errorf("Expected old key to sign before activation, but %+v", key)
+	}
+	if key := s.signingKey(newKey.activatesAt); key == nil || key.kid != newKey.kid {
+		t.Errorf("Expected new key to sign after activation, but %+v", key)
+	}
+
+	// Ожидающий ключ второй раз не создаётся
+	if rotated, err := s.RotateKeys(context.Background(), rotateAt.Add(time.Minute)); err != nil || rotated != 0 {
+		t.Errorf("Expected pending key to be kept, but %d (%v)", rotated, err)
+	}
+
+	// Токены старого ключа действуют, пока не истекут
+	if _, err := s.Verify(oldToken); err != nil {
+		t.Errorf("Expected old token to be valid after rotation, but %v", err)
+	}
+
+	// Через accessTtl после ротации старый ключ больше не загружается
+	retiredAt := time.Now().Add(-time.Hour)
+	repo.keys[0].RetiredAt = &retiredAt
+	if err := s.reload(context.Background(), time.Now()); err != nil {
+		t.Fatalf("Reload error: %v", err)
+	}
+
+	if _, err := s.Verify(oldToken); err == nil {
+		t.Errorf("Expected token of expired key to be rejected")
+	}
+	if keys := s.Jwks().Keys; len(keys) != 1 || keys[0].Kid != newKey.kid {
+		t.Errorf("Expected only new key in jwks, but %+v", keys)
+	}
+}
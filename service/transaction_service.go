@@ -3,12 +3,13 @@ package service
 import (
 	"context"
 	"fmt"
+	"time"
 	"uniback/models"
 	"uniback/repository"
 )
 
 type TransacrionServiceConfig struct {
-	globalFee float64
+	globalFee models.Money
 }
 
 type TransactionService struct {
@@ -20,40 +21,136 @@ func NewTransactionService(u repository.UserRepository) *TransactionService {
 	return &TransactionService{
 		userRepo: u,
 		cfg: TransacrionServiceConfig{
-			globalFee: 0.,
+			globalFee: models.NewMoney(0),
 		},
 	}
 }
 
-func (s *TransactionService) DepositTransaction(ctx context.Context, acc models.Account, amount float64) (*models.Account, error) {
+// Деньги двигаются только проводками по главной книге:
+// счета клиентов - пассив банка, cash_clearing - актив (касса/расчёты),
+// fee_income - доход от комиссий.
+func (s *TransactionService) DepositTransaction(ctx context.Context, acc models.Account, amount models.Money) (*models.Account, error) {
 
-	if (amount - s.cfg.globalFee) <= 0 {
+	if !amount.Sub(s.cfg.globalFee).IsPositive() {
 		return nil, fmt.Errorf("not enought money for fee on this transaction")
 	}
 
-	acc.Balance += (amount - s.cfg.globalFee)
+	entry := models.NewJournalEntry("deposit",
+		models.DebitLedger(models.LedgerCashClearing, amount),
+		models.CreditAccount(acc.Id, amount.Sub(s.cfg.globalFee)),
+		models.CreditLedger(models.LedgerFeeIncome, s.cfg.globalFee),
+	)
 
-	return s.userRepo.UpdateAccountTransaction(ctx, acc, amount, s.cfg.globalFee, "deposit")
+	return s.userRepo.UpdateAccountTransaction(ctx, acc, amount, s.cfg.globalFee, "deposit", entry)
 }
 
-func (s *TransactionService) WithdrawalTransaction(ctx context.Context, acc models.Account, amount float64) (*models.Account, error) {
+// Проверки баланса здесь - только быстрый отказ по снимку счёта.
+// Окончательная проверка выполняется в репозитории под блокировкой строки.
+func (s *TransactionService) WithdrawalTransaction(ctx context.Context, acc models.Account, amount models.Money) (*models.Account, error) {
 
-	if (acc.Balance - (amount + s.cfg.globalFee)) < 0 {
+	if acc.Balance.Sub(amount.Add(s.cfg.globalFee)).IsNegative() {
 		return nil, fmt.Errorf("not enought money for transaction")
 	}
 
-	acc.Balance -= (amount + s.cfg.globalFee)
+	entry := models.NewJournalEntry("withdrawal",
+		models.DebitAccount(acc.Id, amount.Add(s.cfg.globalFee)),
+		models.CreditLedger(models.LedgerCashClearing, amount),
+		models.CreditLedger(models.LedgerFeeIncome, s.cfg.globalFee),
+	)
 
-	return s.userRepo.UpdateAccountTransaction(ctx, acc, amount, s.cfg.globalFee, "withdrawal")
+	return s.userRepo.UpdateAccountTransaction(ctx, acc, amount, s.cfg.globalFee, "withdrawal", entry)
 }
 
-func (s *TransactionService) TransferTransaction(ctx context.Context, source models.Account, dest models.Account, amount float64) (*models.Account, error) {
-	if (source.Balance - (amount + s.cfg.globalFee)) < 0 {
+func (s *TransactionService) TransferTransaction(ctx context.Context, source models.Account, dest models.Account, amount models.Money) (*models.Account, error) {
+	if source.Id == dest.Id {
+		return nil, fmt.Errorf("source and destination accounts are the same")
+	}
+
+	if source.Balance.Sub(amount.Add(s.cfg.globalFee)).IsNegative() {
 		return nil, fmt.Errorf("not enought money for transfer")
 	}
 
-	source.Balance -= (amount + s.cfg.globalFee)
-	dest.Balance += amount
+	entry := models.NewJournalEntry("transfer",
+		models.DebitAccount(source.Id, amount.Add(s.cfg.globalFee)),
+		models.CreditAccount(dest.Id, amount),
+		models.CreditLedger(models.LedgerFeeIncome, s.cfg.globalFee),
+	)
+
+	return s.userRepo.TransferAccountsTransaction(ctx, source, dest, amount, s.cfg.globalFee, entry)
+}
+
+// Оплата картой идёт в два шага: авторизация блокирует сумму (холд),
+// подтверждение списывает её на счёт расчётов с торговыми точками card_settlement.
+func (s *TransactionService) AuthorizeCardPayment(ctx context.Context, card models.Card, acc models.Account, initiatorId int, amount models.Money, merchant string) (*models.CardHold, error) {
+	if card.AccountId != acc.Id {
+		return nil, fmt.Errorf("card is not linked to account")
+	}
+
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("wrong payment amount")
+	}
+
+	return s.userRepo.AuthorizeCardHold(ctx, models.CardHold{
+		CardId:      card.Id,
+		AccountId:   acc.Id,
+		InitiatorId: initiatorId,
+		Amount:      amount,
+		Merchant:    merchant,
+		ExpiresAt:   time.Now().Add(models.CardHoldTtl),
+	})
+}
+
+// Подтвердить можно сумму не больше заблокированной, остаток холда освобождается.
+func (s *TransactionService) CaptureCardPayment(ctx context.Context, hold models.CardHold, amount models.Money) (*models.CardHold, error) {
+	if !amount.IsPositive() || amount.Cmp(hold.Amount) > 0 {
+		return nil, fmt.Errorf("capture amount must be positive and not greater than hold amount")
+	}
+
+	entry := models.NewJournalEntry("card_payment: "+hold.Merchant,
+		models.DebitAccount(hold.AccountId, amount),
+		models.CreditLedger(models.LedgerCardSettlement, amount),
+	)
+
+	return s.userRepo.CaptureCardHold(ctx, hold, amount, entry)
+}
+
+func (s *TransactionService) VoidCardPayment(ctx context.Context, hold models.CardHold) (*models.CardHold, error) {
+	return s.userRepo.VoidCardHold(ctx, hold.Id)
+}
+
+// Выдача кредита: долг клиента перед банком (loans_receivable) растёт,
+// сумма кредита зачисляется на его счёт.
+func (s *TransactionService) DisburseCredit(ctx context.Context, acc models.Account, loan models.Loan, schedule []models.CreditPayment) (*models.Loan, error) {
+	if loan.AccountId != acc.Id {
+		return nil, fmt.Errorf("credit is not linked to account")
+	}
+
+	entry := models.NewJournalEntry("credit_disbursement",
+		models.DebitLedger(models.LedgerLoansReceivable, loan.Principal),
+		models.CreditAccount(acc.Id, loan.Principal),
+	)
+
+	return s.userRepo.CreateCredit(ctx, loan, schedule, entry)
+}
+
+// Платёж по кредиту гасит основной долг (loans_receivable), а проценты
+// и пени становятся доходом банка.
+func (s *TransactionService) PayCreditPayment(ctx context.Context, payment models.DueCreditPayment) error {
+	entry := models.NewJournalEntry(fmt.Sprintf("credit_payment: credit %d, payment %d", payment.CreditId, payment.Number),
+		models.DebitAccount(payment.AccountId, payment.Total()),
+		models.CreditLedger(models.LedgerLoansReceivable, payment.Principal),
+		models.CreditLedger(models.LedgerInterestIncome, payment.Interest.Add(payment.Penalty)),
+	)
+
+	return s.userRepo.PayCreditPayment(ctx, payment, entry)
+}
+
+// Досрочное погашение целиком идёт в счёт основного долга.
+func (s *TransactionService) PrepayCredit(ctx context.Context, loan models.Loan, repayment models.CreditRepayment, pending []models.CreditPayment, schedule []models.CreditPayment) (*models.Loan, error) {
+	entry := models.NewJournalEntry(fmt.Sprintf("credit_prepayment: credit %d, %s", loan.Id, repayment.Mode),
+		models.DebitAccount(loan.AccountId, repayment.Amount),
+		models.CreditLedger(models.LedgerLoansReceivable, repayment.Amount),
+	)
 
-	return s.userRepo.TransferAccountsTransaction(ctx, source, dest, amount, s.cfg.globalFee)
+	return s.userRepo.RepayCredit(ctx, loan, repayment, pending, schedule, entry)
 }
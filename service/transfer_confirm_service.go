@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/utils"
+)
+
+var (
+	ErrTransferNotPending = errors.New("transfer is not waiting for confirmation")
+	ErrWrongTransferCode  = errors.New("wrong transfer confirmation code")
+	ErrTransferFailed     = errors.New("confirmed transfer failed")
+)
+
+type TransferConfirmConfig struct {
+	threshold   models.Money
+	codeTtl     time.Duration
+	maxAttempts int
+	maxPending  int
+}
+
+func TransferConfirmConfigFromGlobalConfig(cfg *utils.Config) (*TransferConfirmConfig, error) {
+	threshold, err := models.ParseMoney(cfg.TransferConfirmAmount)
+	if err != nil {
+		return nil, fmt.Errorf("wrong transfer confirm amount: %w", err)
+	}
+
+	return &TransferConfirmConfig{
+		threshold:   threshold,
+		codeTtl:     time.Duration(cfg.TransferCodeTtlMin) * time.Minute,
+		maxAttempts: cfg.TransferCodeAttempts,
+		maxPending:  cfg.TransferPendingMax,
+	}, nil
+}
+
+// CodeTransferConfirmService откладывает переводы дороже threshold и переводы
+// новому получателю, пока клиент не введёт одноразовый код. Код уходит через
+// Notifier (сейчас письмом), в БД хранится только его HMAC. Неистёкших
+// переводов с кодом у пользователя не больше maxPending: иначе с украденным
+// токеном можно было бы получать новые попытки без ограничений.
+type CodeTransferConfirmService struct {
+	userRepo      repository.UserRepository
+	transactions  Service
+	notifier      Notifier
+	cryptoService CryptoService
+	cfg           TransferConfirmConfig
+	now           func() time.Time
+}
+
+func NewCodeTransferConfirmService(u repository.UserRepository, trs Service, n Notifier, cs CryptoService, cfg *TransferConfirmConfig) *CodeTransferConfirmService {
+	return &CodeTransferConfirmService{
+		userRepo:      u,
+		transactions:  trs,
+		notifier:      n,
+		cryptoService: cs,
+		cfg:           *cfg,
+		now:           time.Now,
+	}
+}
+
+// ConfirmReason возвращает причину подтверждения перевода кодом или пустую
+// строку, если перевод можно выполнить сразу. Переводы между своими счетами
+// новым получателем не считаются.
+func (s *CodeTransferConfirmService) ConfirmReason(ctx context.Context, userId int, dest models.Account, amount models.Money) (string, error) {
+	if amount.Cmp(s.cfg.threshold) > 0 {
+		return models.TransferConfirmLargeAmount, nil
+	}
+
+	if dest.UserId == userId {
+		return "", nil
+	}
+
+	known, err := s.userRepo.HasTransferredTo(ctx, userId, dest.Id)
+	if err != nil {
+		return "", err
+	}
+	if !known {
+		return models.TransferConfirmNewRecipient, nil
+	}
+
+	return "", nil
+}
+
+// Request сохраняет перевод до подтверждения и отправляет клиенту код. Если
+// уже maxPending переводов ждут кода, возвращается repository.ErrTooManyPending.
+func (s *CodeTransferConfirmService) Request(ctx context.Context, user models.User, source models.Account, dest models.Account, amount models.Money, reason string) (*models.PendingTransfer, error) {
+	code, err := newTransferCode()
+	if err != nil {
+		return nil, err
+	}
+
+	transfer, err := s.userRepo.CreatePendingTransfer(ctx, models.PendingTransfer{
+		UserId:          user.ID,
+		SourceAccountId: source.Id,
+		DestAccountId:   dest.Id,
+		Amount:          amount,
+		Reason:          reason,
+		CodeHash:        s.codeHash(code),
+		ExpiresAt:       s.now().Add(s.cfg.codeTtl),
+	}, s.cfg.maxPending)
+	if err != nil {
+		return nil, err
+	}
+	transfer.SourceAccountNumber = source.AccountNumber
+	transfer.DestAccountNumber = dest.AccountNumber
+
+	// Без доставленного кода перевод не подтвердить, поэтому ошибка отправки
+	// возвращается клиенту, а сохранённый перевод просто истечёт
+	err = s.notifier.Notify(ctx, user.Email, models.Notification{
+		Event:    models.NotifyTransferCode,
+		Username: user.Name,
+		Data: map[string]string{
+			"code":         code,
+			"amount":       amount.String(),
+			"account":      source.AccountNumber,
+			"counterparty": dest.AccountNumber,
+			"ttl":          strconv.Itoa(int(s.cfg.codeTtl.Minutes())),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't send transfer code: %w", err)
+	}
+
+	return transfer, nil
+}
+
+// Confirm выполняет перевод id пользователя username, если code верный.
+// Попытка засчитывается до проверки кода, после maxAttempts неверных кодов
+// перевод нужно создать заново.
+func (s *CodeTransferConfirmService) Confirm(ctx context.Context, username string, id int64, code string) (*models.Account, error) {
+	// Чужой перевод не находится: проверка владельца до подсчёта попыток
+	if _, err := s.userRepo.GetPendingTransfer(ctx, id, username); err != nil {
+		return nil, err
+	}
+
+	transfer, err := s.userRepo.AttemptPendingTransfer(ctx, id, s.cfg.maxAttempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTransferNotPending
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare(transfer.CodeHash, s.codeHash(code)) != 1 {
+		return nil, ErrWrongTransferCode
+	}
+
+	err = s.userRepo.SetPendingTransferStatus(ctx, id, models.PendingTransferPending, models.PendingTransferConfirmed, "")
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTransferNotPending
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	account, transferErr := s.execute(ctx, username, transfer)
+
+	// Итог сохраняем даже если клиент уже отвалился по таймауту
+	status, errText := models.PendingTransferCompleted, ""
+	if transferErr != nil {
+		status, errText = models.PendingTransferFailed, transferErr.Error()
+	}
+	err = s.userRepo.SetPendingTransferStatus(context.WithoutCancel(ctx), id, models.PendingTransferConfirmed, status, errText)
+	if err != nil {
+		utils.GlobalLogger().Critical("Can't save pending transfer %d status %s: %w", id, status, err)
+	}
+
+	if transferErr != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTransferFailed, transferErr)
+	}
+
+	return account, nil
+}
+
+// execute перечитывает счета: за время ожидания кода их могли заблокировать,
+// а баланс - измениться.
+func (s *CodeTransferConfirmService) execute(ctx context.Context, username string, transfer *models.PendingTransfer) (*models.Account, error) {
+	source, err := s.userRepo.GetAccountByUsername(ctx, transfer.SourceAccountNumber, username)
+	if err != nil {
+		return nil, err
+	}
+
+	dest, err := s.userRepo.GetAccountByNumber(ctx, transfer.DestAccountNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if source.Status != models.AccountActive || dest.Status != models.AccountActive {
+		return nil, repository.ErrAccountNotActive
+	}
+
+	return s.transactions.TransferTransaction(ctx, *source, *dest, transfer.Amount)
+}
+
+// codeHash - HMAC кода: у 6 цифр всего миллион вариантов, простой хеш
+// перебирается мгновенно.
+func (s *CodeTransferConfirmService) codeHash(code string) []byte {
+	return s.cryptoService.HmacIndex("transfer:" + code)
+}
+
+func newTransferCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
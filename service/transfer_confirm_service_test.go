@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+)
+
+// fakeCodeNotifier запоминает отправленные письма
+type fakeCodeNotifier struct {
+	sent []models.Notification
+}
+
+func (f *fakeCodeNotifier) Notify(ctx context.Context, to string, n models.Notification) error {
+	f.sent = append(f.sent, n)
+	return nil
+}
+
+// fakePendingTransferRepo - счета, прежние получатели и отложенные переводы в памяти
+type fakePendingTransferRepo struct {
+	repository.UserRepository
+	accounts  map[string]*models.Account
+	known     map[int]bool
+	transfers []*models.PendingTransfer
+	executed  int
+}
+
+func (f *fakePendingTransferRepo) HasTransferredTo(ctx context.Context, userId int, destAccountId int) (bool, error) {
+	return f.known[destAccountId], nil
+}
+
+func (f *fakePendingTransferRepo) CreatePendingTransfer(ctx context.Context, transfer models.PendingTransfer, maxOpen int) (*models.PendingTransfer, error) {
+	open := 0
+	for _, t := range f.transfers {
+		if t.UserId == transfer.UserId && t.Status == models.PendingTransferPending && t.ExpiresAt.After(time.Now()) {
+			open++
+		}
+	}
+	if open >= maxOpen {
+		return nil, repository.ErrTooManyPending
+	}
+
+	transfer.Id = int64(len(f.transfers) + 1)
+	transfer.Status = models.PendingTransferPending
+	for _, acc := range f.accounts {
+		if acc.Id == transfer.SourceAccountId {
+			transfer.SourceAccountNumber = acc.AccountNumber
+		}
+		if acc.Id == transfer.DestAccountId {
+			transfer.DestAccountNumber = acc.AccountNumber
+		}
+	}
+	f.transfers = append(f.transfers, &transfer)
+	saved := transfer
+	return &saved, nil
+}
+
+func (f *fakePendingTransferRepo) GetPendingTransfer(ctx context.Context, id int64, username string) (*models.PendingTransfer, error) {
+	if id < 1 || int(id) > len(f.transfers) || username != "ivan" {
+		return nil, sql.ErrNoRows
+	}
+	transfer := *f.transfers[id-1]
+	return &transfer, nil
+}
+
+func (f *fakePendingTransferRepo) AttemptPendingTransfer(ctx context.Context, id int64, maxAttempts int) (*models.PendingTransfer, error) {
+	transfer := f.transfers[id-1]
+	if transfer.Status != models.PendingTransferPending || !transfer.ExpiresAt.After(time.Now()) || transfer.Attempts >= maxAttempts {
+		return nil, sql.ErrNoRows
+	}
+	transfer.Attempts++
+	copied := *transfer
+	return &copied, nil
+}
+
+func (f *fakePendingTransferRepo) SetPendingTransferStatus(ctx context.Context, id int64, from string, to string, errText string) error {
+	transfer := f.transfers[id-1]
+	if transfer.Status != from {
+		return sql.ErrNoRows
+	}
+	transfer.Status, transfer.Error = to, errText
+	return nil
+}
+
+func (f *fakePendingTransferRepo) GetAccountByUsername(ctx context.Context, account string, username string) (*models.Account, error) {
+	acc, ok := f.accounts[account]
+	if !ok || acc.UserId != 1 {
+		return nil, sql.ErrNoRows
+	}
+	copied := *acc
+	return &copied, nil
+}
+
+func (f *fakePendingTransferRepo) GetAccountByNumber(ctx context.Context, account string) (*models.Account, error) {
+	acc, ok := f.accounts[account]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *acc
+	return &copied, nil
+}
+
+func (f *fakePendingTransferRepo) TransferAccountsTransaction(ctx context.Context, src models.Account, dest models.Account, amount models.Money, fee models.Money, entry models.JournalEntry) (*models.Account, error) {
+	f.executed++
+	f.accounts[src.AccountNumber].Balance = f.accounts[src.AccountNumber].Balance.Sub(amount)
+	f.accounts[dest.AccountNumber].Balance = f.accounts[dest.AccountNumber].Balance.Add(amount)
+	f.known[dest.Id] = true
+	result := *f.accounts[src.AccountNumber]
+	return &result, nil
+}
+
+func testTransferConfirmService(repo *fakePendingTransferRepo, n Notifier) *CodeTransferConfirmService {
+	return NewCodeTransferConfirmService(repo, NewTransactionService(repo), n, fakeTotpCrypto{}, &TransferConfirmConfig{
+		threshold:   models.NewMoney(100000),
+		codeTtl:     10 * time.Minute,
+		maxAttempts: 3,
+		maxPending:  2,
+	})
+}
+
+func newFakePendingTransferRepo() *fakePendingTransferRepo {
+	return &fakePendingTransferRepo{
+		accounts: map[string]*models.Account{
+			"own-1":   {Id: 1, UserId: 1, AccountNumber: "own-1", Balance: models.NewMoney(500000), Status: models.AccountActive},
+			"own-2":   {Id: 2, UserId: 1, AccountNumber: "own-2", Status: models.AccountActive},
+			"other-1": {Id: 3, UserId: 2, AccountNumber: "other-1", Status: models.AccountActive},
+		},
+		known: map[int]bool{},
+	}
+}
+
+func TestTransferConfirmReason(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakePendingTransferRepo()
+	s := testTransferConfirmService(repo, &fakeCodeNotifier{})
+
+	other := *repo.accounts["other-1"]
+
+	cases := []struct {
+		name   string
+		dest   models.Account
+		amount models.Money
+		known  bool
+		reason string
+	}{
+		{"own account", *repo.accounts["own-2"], models.NewMoney(5000), false, ""},
+		{"large to own account", *repo.accounts["own-2"], models.NewMoney(100001), false, models.TransferConfirmLargeAmount},
+		{"threshold is allowed", other, models.NewMoney(100000), true, ""},
+		{"new recipient", other, models.NewMoney(5000), false, models.TransferConfirmNewRecipient},
+		{"known recipient", other, models.NewMoney(5000), true, ""},
+	}
+
+	for _, c := range cases {
+		repo.known[other.Id] = c.known
+		reason, err := s.ConfirmReason(ctx, 1, c.dest, c.amount)
+		if err != nil || reason != c.reason {
+			t.Errorf("%s: expected %q, but %q (%v)", c.name, c.reason, reason, err)
+		}
+	}
+}
+
+func TestTransferConfirmCode(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakePendingTransferRepo()
+	notifier := &fakeCodeNotifier{}
+	s := testTransferConfirmService(repo, notifier)
+
+	user := models.User{ID: 1, Name: "ivan", Email: "ivan@example.com"}
+	transfer, err := s.Request(ctx, user, *repo.accounts["own-1"], *repo.accounts["other-1"], models.NewMoney(200000), models.TransferConfirmLargeAmount)
+	if err != nil {
+		t.Fatalf("Request error: %v", err)
+	}
+
+	if len(notifier.sent) != 1 || notifier.sent[0].Event != models.NotifyTransferCode {
+		t.Fatalf("Expected code notification, but %+v", notifier.sent)
+	}
+	code := notifier.sent[0].Data["code"]
+	if len(code) != 6 || notifier.sent[0].Data["amount"] != "2000.00" {
+		t.Fatalf("Wrong code notification %+v", notifier.sent[0].Data)
+	}
+	if string(repo.transfers[0].CodeHash) == code {
+		t.Fatalf("Code must be stored hashed")
+	}
+
+	if _, err := s.Confirm(ctx, "petr", transfer.Id, code); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected foreign transfer to be hidden, but %v", err)
+	}
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	if _, err := s.Confirm(ctx, "ivan", transfer.Id, wrong); !errors.Is(err, ErrWrongTransferCode) {
+		t.Fatalf("Expected wrong code error, but %v", err)
+	}
+	if repo.executed != 0 {
+		t.Fatalf("Transfer executed before confirmation")
+	}
+
+	account, err := s.Confirm(ctx, "ivan", transfer.Id, code)
+	if err != nil {
+		t.Fatalf("Confirm error: %v", err)
+	}
+	if repo.executed != 1 || account.Balance.Amount != 300000 || repo.transfers[0].Status != models.PendingTransferCompleted {
+		t.Errorf("Wrong transfer result %+v, status %s", account, repo.transfers[0].Status)
+	}
+
+	if _, err := s.Confirm(ctx, "ivan", transfer.Id, code); !errors.Is(err, ErrTransferNotPending) {
+		t.Errorf("Expected confirmed transfer to be rejected, but %v", err)
+	}
+}
+
+func TestTransferConfirmLimits(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakePendingTransferRepo()
+	notifier := &fakeCodeNotifier{}
+	s := testTransferConfirmService(repo, notifier)
+	user := models.User{ID: 1, Name: "ivan"}
+
+	// После maxAttempts неверных кодов не подходит и верный
+	transfer, _ := s.Request(ctx, user, *repo.accounts["own-1"], *repo.accounts["other-1"], models.NewMoney(5000), models.TransferConfirmNewRecipient)
+	code := notifier.sent[len(notifier.sent)-1].Data["code"]
+	for i := 0; i < 3; i++ {
+		s.Confirm(ctx, "ivan", transfer.Id, "x")
+	}
+	if _, err := s.Confirm(ctx, "ivan", transfer.Id, code); !errors.Is(err, ErrTransferNotPending) {
+		t.Errorf("Expected attempts limit, but %v", err)
+	}
+
+	// Истёкший код
+	s.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	transfer, _ = s.Request(ctx, user, *repo.accounts["own-1"], *repo.accounts["other-1"], models.NewMoney(5000), models.TransferConfirmNewRecipient)
+	code = notifier.sent[len(notifier.sent)-1].Data["code"]
+	if _, err := s.Confirm(ctx, "ivan", transfer.Id, code); !errors.Is(err, ErrTransferNotPending) {
+		t.Errorf("Expected expired code to be rejected, but %v", err)
+	}
+
+	// Счёт заблокировали, пока клиент ждал код
+	s.now = time.Now
+	transfer, _ = s.Request(ctx, user, *repo.accounts["own-1"], *repo.accounts["other-1"], models.NewMoney(5000), models.TransferConfirmNewRecipient)
+	code = notifier.sent[len(notifier.sent)-1].Data["code"]
+	repo.accounts["other-1"].Status = models.AccountBlocked
+	if _, err := s.Confirm(ctx, "ivan", transfer.Id, code); !errors.Is(err, ErrTransferFailed) {
+		t.Errorf("Expected transfer to blocked account to fail, but %v", err)
+	}
+	if status := repo.transfers[transfer.Id-1].Status; status != models.PendingTransferFailed || repo.executed != 0 {
+		t.Errorf("Expected failed transfer, but %s (executed %d)", status, repo.executed)
+	}
+}
+
+func TestTransferConfirmPendingLimit(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakePendingTransferRepo()
+	notifier := &fakeCodeNotifier{}
+	s := testTransferConfirmService(repo, notifier)
+	user := models.User{ID: 1, Name: "ivan"}
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Request(ctx, user, *repo.accounts["own-1"], *repo.accounts["other-1"], models.NewMoney(5000), models.TransferConfirmNewRecipient); err != nil {
+			t.Fatalf("Request error: %v", err)
+		}
+	}
+
+	// Третий перевод не создаётся, и код не отправляется
+	if _, err := s.Request(ctx, user, *repo.accounts["own-1"], *repo.accounts["other-1"], models.NewMoney(5000), models.TransferConfirmNewRecipient); !errors.Is(err, repository.ErrTooManyPending) {
+		t.Fatalf("Expected pending transfers limit, but %v", err)
+	}
+	if len(notifier.sent) != 2 {
+		t.Errorf("Expected 2 codes, but %d", len(notifier.sent))
+	}
+
+	// Истёкший перевод место не занимает
+	repo.transfers[0].ExpiresAt = time.Now().Add(-time.Minute)
+	if _, err := s.Request(ctx, user, *repo.accounts["own-1"], *repo.accounts["other-1"], models.NewMoney(5000), models.TransferConfirmNewRecipient); err != nil {
+		t.Errorf("Expected request after expiry, but %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/utils"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	totpPeriod = 30
+	// Допускаем расхождение часов телефона и сервера на один шаг в обе стороны
+	totpSkew            = 1
+	recoveryCodesCount  = 10
+	mfaChallengeTtl     = 5 * time.Minute
+	mfaChallengeRetries = 5
+)
+
+var (
+	ErrTotpEnabled    = errors.New("totp is already enabled")
+	ErrTotpNotEnabled = errors.New("totp is not enabled")
+	ErrWrongMfaCode   = errors.New("wrong two-factor code")
+	ErrMfaChallenge   = errors.New("two-factor challenge is expired or used")
+)
+
+type TotpConfig struct {
+	issuer string
+}
+
+func TotpConfigFromGlobalConfig(cfg *utils.Config) *TotpConfig {
+	return &TotpConfig{
+		issuer: cfg.TotpIssuer,
+	}
+}
+
+// TotpService - второй фактор входа по TOTP (RFC 6238). Секрет хранится
+// зашифрованным PGP, коды восстановления - только в виде HMAC. Принятый шаг
+// TOTP запоминается, поэтому один код нельзя использовать дважды.
+type TotpService struct {
+	userRepo      repository.UserRepository
+	cryptoService CryptoService
+	cfg           TotpConfig
+	now           func() time.Time
+}
+
+func NewTotpService(u repository.UserRepository, cs CryptoService, cfg *TotpConfig) *TotpService {
+	return &TotpService{
+		userRepo:      u,
+		cryptoService: cs,
+		cfg:           *cfg,
+		now:           time.Now,
+	}
+}
+
+// Enroll создаёт новый секрет, ожидающий подтверждения кодом. Повторный вызов
+// до подтверждения заменяет секрет.
+func (s *TotpService) Enroll(ctx context.Context, user models.User) (*models.TotpEnrollment, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.cfg.issuer,
+		AccountName: user.Name,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.userRepo.SetTotpSecret(ctx, user.ID, s.cryptoService.PgpEncode(key.Secret()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTotpEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TotpEnrollment{Secret: key.Secret(), Uri: key.URL()}, nil
+}
+
+// Confirm включает TOTP, если code подходит к ожидающему секрету, и возвращает
+// коды восстановления. В открытом виде коды больше нигде не сохраняются.
+func (s *TotpService) Confirm(ctx context.Context, userId int, code string) ([]string, error) {
+	stored, err := s.userRepo.GetTotp(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Enabled {
+		return nil, ErrTotpEnabled
+	}
+	if stored.Secret == nil {
+		return nil, ErrTotpNotEnabled
+	}
+
+	step, ok := s.matchStep(stored, code)
+	if !ok {
+		return nil, ErrWrongMfaCode
+	}
+
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([][]byte, recoveryCodesCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = s.recoveryHash(codes[i])
+	}
+
+	err = s.userRepo.EnableTotp(ctx, userId, step, hashes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTotpEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable выключает TOTP после проверки кода или кода восстановления.
+func (s *TotpService) Disable(ctx context.Context, userId int, code string, recoveryCode string) error {
+	if err := s.verify(ctx, userId, code, recoveryCode); err != nil {
+		return err
+	}
+	return s.userRepo.DisableTotp(ctx, userId)
+}
+
+// CreateChallenge начинает вход со вторым фактором и возвращает токен, который
+// вместе с кодом обменивается на сессию.
+func (s *TotpService) CreateChallenge(ctx context.Context, userId int) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	expiresAt := s.now().Add(mfaChallengeTtl)
+
+	if err := s.userRepo.CreateMfaChallenge(ctx, userId, models.HashToken(token), expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
+// VerifyChallenge проверяет код для входа token. Попытка засчитывается до
+// проверки кода: после mfaChallengeRetries неверных кодов нужен новый вход
+// по паролю.
+func (s *TotpService) VerifyChallenge(ctx context.Context, token string, code string, recoveryCode string) (*models.MfaChallenge, error) {
+	challenge, err := s.userRepo.AttemptMfaChallenge(ctx, models.HashToken(token), mfaChallengeRetries)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMfaChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.verify(ctx, challenge.UserId, code, recoveryCode); err != nil {
+		return nil, err
+	}
+
+	err = s.userRepo.CompleteMfaChallenge(ctx, challenge.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMfaChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// verify принимает либо код TOTP, либо одноразовый код восстановления.
+func (s *TotpService) verify(ctx context.Context, userId int, code string, recoveryCode string) error {
+	stored, err := s.userRepo.GetTotp(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if !stored.Enabled {
+		return ErrTotpNotEnabled
+	}
+
+	if recoveryCode != "" {
+		used, err := s.userRepo.UseRecoveryCode(ctx, userId, s.recoveryHash(recoveryCode))
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrWrongMfaCode
+		}
+		return nil
+	}
+
+	step, ok := s.matchStep(stored, code)
+	if !ok {
+		return ErrWrongMfaCode
+	}
+
+	fresh, err := s.userRepo.UseTotpStep(ctx, userId, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrWrongMfaCode
+	}
+
+	return nil
+}
+
+// matchStep ищет шаг, которому соответствует code. Шаги не позже уже
+// принятого не проверяются.
+func (s *TotpService) matchStep(stored *models.Totp, code string) (int64, bool) {
+	if len(code) != otp.DigitsSix.Length() {
+		return 0, false
+	}
+
+	secret := s.cryptoService.PgpDecode(stored.Secret)
+	current := s.now().Unix() / totpPeriod
+
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if stored.LastStep != nil && step <= *stored.LastStep {
+			continue
+		}
+
+		expected, err := hotp.GenerateCodeCustom(secret, uint64(step), hotp.ValidateOpts{
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// recoveryHash - HMAC кода восстановления. У кода 40 бит случайности, поэтому
+// простой хеш можно было бы перебрать по утёкшей таблице.
+func (s *TotpService) recoveryHash(code string) []byte {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return s.cryptoService.HmacIndex("recovery:" + normalized)
+}
+
+// newRecoveryCode возвращает код вида XXXX-XXXX.
+func newRecoveryCode() (string, error) {
+	raw := make([]byte, 5)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := base32.StdEncoding.EncodeToString(raw)
+	return code[:4] + "-" + code[4:], nil
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// fakeTotpCrypto - PGP без шифрования и HMAC на тестовом ключе
+type fakeTotpCrypto struct {
+	fakePlainCrypto
+}
+
+func (fakeTotpCrypto) HmacIndex(data string) []byte {
+	return fakeHmacCrypto{}.HmacIndex(data)
+}
+
+// fakeTotpRepo - TOTP одного пользователя и его входы в памяти
+type fakeTotpRepo struct {
+	repository.UserRepository
+	totp       models.Totp
+	recovery   map[string]bool
+	challenges map[string]*models.MfaChallenge
+	used       map[int64]bool
+}
+
+func newFakeTotpRepo() *fakeTotpRepo {
+	return &fakeTotpRepo{
+		totp:       models.Totp{UserId: 1},
+		recovery:   map[string]bool{},
+		challenges: map[string]*models.MfaChallenge{},
+		used:       map[int64]bool{},
+	}
+}
+
+func (f *fakeTotpRepo) GetTotp(ctx context.Context, userId int) (*models.Totp, error) {
+	totp := f.totp
+	return &totp, nil
+}
+
+func (f *fakeTotpRepo) SetTotpSecret(ctx context.Context, userId int, secret []byte) error {
+	if f.totp.Enabled {
+		return sql.ErrNoRows
+	}
+	f.totp.Secret, f.totp.LastStep = secret, nil
+	return nil
+}
+
+func (f *fakeTotpRepo) EnableTotp(ctx context.Context, userId int, step int64, recoveryHashes [][]byte) error {
+	if f.totp.Enabled {
+		return sql.ErrNoRows
+	}
+	f.totp.Enabled, f.totp.LastStep = true, &step
+	for _, hash := range recoveryHashes {
+		f.recovery[hex.EncodeToString(hash)] = true
+	}
+	return nil
+}
+
+func (f *fakeTotpRepo) DisableTotp(ctx context.Context, userId int) error {
+	f.totp = models.Totp{UserId: userId}
+	f.recovery = map[string]bool{}
+	return nil
+}
+
+func (f *fakeTotpRepo) UseTotpStep(ctx context.Context, userId int, step int64) (bool, error) {
+	if f.totp.LastStep != nil && *f.totp.LastStep >= step {
+		return false, nil
+	}
+	f.totp.LastStep = &step
+	return true, nil
+}
+
+func (f *fakeTotpRepo) UseRecoveryCode(ctx context.Context, userId int, hash []byte) (bool, error) {
+	key := hex.EncodeToString(hash)
+	if !f.recovery[key] {
+		return false, nil
+	}
+	f.recovery[key] = false
+	return true, nil
+}
+
+func (f *fakeTotpRepo) CreateMfaChallenge(ctx context.Context, userId int, hash []byte, expiresAt time.Time) error {
+	f.challenges[hex.EncodeToString(hash)] = &models.MfaChallenge{
+		Id:        int64(len(f.challenges) + 1),
+		UserId:    userId,
+		Username:  "ivan",
+		ExpiresAt: expiresAt,
+	}
+	return nil
+}
+
+func (f *fakeTotpRepo) AttemptMfaChallenge(ctx context.Context, hash []byte, maxAttempts int) (*models.MfaChallenge, error) {
+	challenge, ok := f.challenges[hex.EncodeToString(hash)]
+	if !ok || f.used[challenge.Id] || challenge.Attempts >= maxAttempts {
+		return nil, sql.ErrNoRows
+	}
+	challenge.Attempts++
+	return challenge, nil
+}
+
+func (f *fakeTotpRepo) CompleteMfaChallenge(ctx context.Context, id int64) error {
+	if f.used[id] {
+		return sql.ErrNoRows
+	}
+	f.used[id] = true
+	return nil
+}
+
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	code, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1})
+	if err != nil {
+		t.Fatalf("Generate code error: %v", err)
+	}
+	return code
+}
+
+// enrolledTotpService возвращает сервис с подтверждённым TOTP, секрет и коды восстановления
+func enrolledTotpService(t *testing.T, repo *fakeTotpRepo, now *time.Time) (*TotpService, string, []string) {
+	t.Helper()
+	ctx := context.Background()
+
+	s := NewTotpService(repo, fakeTotpCrypto{}, &TotpConfig{issuer: "UniBack"})
+	s.now = func() time.Time { return *now }
+
+	enrollment, err := s.Enroll(ctx, models.User{ID: 1, Name: "ivan"})
+	if err != nil {
+		t.Fatalf("Enroll error: %v", err)
+	}
+	if key, err := otp.NewKeyFromURL(enrollment.Uri); err != nil || key.Issuer() != "UniBack" || key.AccountName() != "ivan" {
+		t.Fatalf("Wrong otpauth uri %q (%v)", enrollment.Uri, err)
+	}
+
+	if _, err := s.Confirm(ctx, 1, "000000x"); !errors.Is(err, ErrWrongMfaCode) {
+		t.Fatalf("Expected wrong code error, but %v", err)
+	}
+
+	codes, err := s.Confirm(ctx, 1, totpCode(t, enrollment.Secret, *now))
+	if err != nil {
+		t.Fatalf("Confirm error: %v", err)
+	}
+	if len(codes) != recoveryCodesCount || len(codes[0]) != 9 {
+		t.Fatalf("Wrong recovery codes %v", codes)
+	}
+
+	return s, enrollment.Secret, codes
+}
+
+func TestTotpLoginChallenge(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeTotpRepo()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	s, secret, _ := enrolledTotpService(t, repo, &now)
+
+	if _, err := s.Enroll(ctx, models.User{ID: 1, Name: "ivan"}); !errors.Is(err, ErrTotpEnabled) {
+		t.Fatalf("Expected enabled totp to be kept, but %v", err)
+	}
+
+	now = now.Add(2 * totpPeriod * time.Second)
+	token, _, err := s.CreateChallenge(ctx, 1)
+	if err != nil {
+		t.Fatalf("Challenge error: %v", err)
+	}
+
+	if _, err := s.VerifyChallenge(ctx, token, "123456", ""); !errors.Is(err, ErrWrongMfaCode) {
+		t.Fatalf("Expected wrong code error, but %v", err)
+	}
+
+	// Код предыдущего шага принимается: часы телефона могут отставать
+	code := totpCode(t, secret, now.Add(-totpPeriod*time.Second))
+	challenge, err := s.VerifyChallenge(ctx, token, code, "")
+	if err != nil || challenge.Username != "ivan" {
+		t.Fatalf("Expected login, but %+v (%v)", challenge, err)
+	}
+
+	if _, err := s.VerifyChallenge(ctx, token, code, ""); !errors.Is(err, ErrMfaChallenge) {
+		t.Errorf("Expected used challenge to be rejected, but %v", err)
+	}
+
+	// Тот же код не подходит и для нового входа
+	token, _, _ = s.CreateChallenge(ctx, 1)
+	if _, err := s.VerifyChallenge(ctx, token, code, ""); !errors.Is(err, ErrWrongMfaCode) {
+		t.Errorf("Expected replayed code to be rejected, but %v", err)
+	}
+
+	for i := 1; i < mfaChallengeRetries; i++ {
+		s.VerifyChallenge(ctx, token, "000000", "")
+	}
+	if _, err := s.VerifyChallenge(ctx, token, totpCode(t, secret, now), ""); !errors.Is(err, ErrMfaChallenge) {
+		t.Errorf("Expected challenge to be locked after %d attempts, but %v", mfaChallengeRetries, err)
+	}
+}
+
+func TestTotpRecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeTotpRepo()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	s, _, codes := enrolledTotpService(t, repo, &now)
+
+	token, _, _ := s.CreateChallenge(ctx, 1)
+	// Код восстановления принимается без дефиса и в нижнем регистре
+	relaxed := strings.ToLower(codes[0][:4] + codes[0][5:])
+	if _, err := s.VerifyChallenge(ctx, token, "", relaxed); err != nil {
+		t.Fatalf("Expected recovery code login, but %v", err)
+	}
+
+	token, _, _ = s.CreateChallenge(ctx, 1)
+	if _, err := s.VerifyChallenge(ctx, token, "", codes[0]); !errors.Is(err, ErrWrongMfaCode) {
+		t.Errorf("Expected used recovery code to be rejected, but %v", err)
+	}
+
+	if err := s.Disable(ctx, 1, "", codes[1]); err != nil {
+		t.Fatalf("Disable error: %v", err)
+	}
+	if err := s.Disable(ctx, 1, "", codes[2]); !errors.Is(err, ErrTotpNotEnabled) {
+		t.Errorf("Expected disabled totp, but %v", err)
+	}
+}
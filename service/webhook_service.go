@@ -0,0 +1,237 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+	"uniback/utils"
+)
+
+const (
+	WebhookEventHeader     = "X-Uniback-Event"
+	WebhookDeliveryHeader  = "X-Uniback-Delivery"
+	WebhookTimestampHeader = "X-Uniback-Timestamp"
+	WebhookSignatureHeader = "X-Uniback-Signature"
+	// В журнал сохраняется только начало ответа получателя
+	webhookResponseLimit = 1024
+)
+
+var errWebhookAddress = errors.New("webhook address is not allowed")
+
+type WebhookConfig struct {
+	timeout time.Duration
+}
+
+func WebhookConfigFromGlobalConfig(cfg *utils.Config) *WebhookConfig {
+	return &WebhookConfig{
+		timeout: time.Duration(cfg.WebhookTimeoutSec) * time.Second,
+	}
+}
+
+// HttpWebhookService отправляет события outbox на webhook пользователей.
+// Тело подписывается HMAC-SHA256 на секрете webhook, секрет выводится из
+// HMAC_KEY (CryptoService.HmacIndex) и случайного nonce webhook.
+type HttpWebhookService struct {
+	userRepo      repository.UserRepository
+	cryptoService CryptoService
+	client        *http.Client
+	allowAddr     func(netip.Addr) bool
+}
+
+func NewHttpWebhookService(u repository.UserRepository, cs CryptoService, cfg *WebhookConfig) *HttpWebhookService {
+	s := &HttpWebhookService{
+		userRepo:      u,
+		cryptoService: cs,
+		allowAddr:     models.IsPublicAddr,
+	}
+
+	// Адрес проверяется при каждом соединении уже после разрешения имени,
+	// поэтому DNS-имя, указывающее во внутреннюю сеть, тоже не пройдёт.
+	// Прокси из окружения не используется: иначе соединение шло бы к прокси.
+	dialer := &net.Dialer{
+		Timeout: cfg.timeout,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !s.allowAddr(addrPort.Addr()) {
+				return errWebhookAddress
+			}
+			return nil
+		},
+	}
+
+	s.client = &http.Client{
+		Timeout:   cfg.timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		// Редиректы не выполняем: подписанное тело уходит только на заданный адрес
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return s
+}
+
+// NewWebhookSecret создаёт nonce нового webhook и секрет подписи для него.
+func (s *HttpWebhookService) NewWebhookSecret() ([]byte, string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", err
+	}
+	return nonce, s.secret(nonce), nil
+}
+
+func (s *HttpWebhookService) secret(nonce []byte) string {
+	return hex.EncodeToString(s.cryptoService.HmacIndex("webhook:" + hex.EncodeToString(nonce)))
+}
+
+func (s *HttpWebhookService) Name() string {
+	return "webhooks"
+}
+
+// Deliver отправляет событие на webhook владельцев затронутых счетов. Если
+// какой-то адрес не принял событие, возвращается ошибка и outbox повторит
+// доставку позже, уже принявшие адреса повторно его не получат.
+func (s *HttpWebhookService) Deliver(ctx context.Context, event models.OutboxEvent) error {
+	if !models.IsWebhookEvent(event.Event) {
+		return nil
+	}
+
+	recipients, err := webhookRecipients(event)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := s.userRepo.PrepareWebhookDeliveries(ctx, event, recipients)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, delivery := range deliveries {
+		saved, err := s.send(ctx, delivery)
+		if err != nil {
+			return err
+		}
+		if saved.Status != models.WebhookDeliverySuccess {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d webhook deliveries failed", failed, len(deliveries))
+	}
+
+	return nil
+}
+
+// webhookRecipients - счета, по которым отправляется событие, и данные для
+// каждой стороны. У всех событий есть account_id. Получатель перевода видит
+// только сумму и номера счетов: остаток и внутренние id отправителя ему не
+// отправляются.
+func webhookRecipients(event models.OutboxEvent) ([]models.WebhookRecipient, error) {
+	var accounts struct {
+		AccountId     int `json:"account_id"`
+		DestAccountId int `json:"dest_account_id"`
+	}
+	if err := json.Unmarshal(event.Payload, &accounts); err != nil {
+		return nil, fmt.Errorf("wrong %s payload: %w", event.Event, err)
+	}
+
+	recipients := []models.WebhookRecipient{{AccountId: accounts.AccountId, Payload: event.Payload}}
+	if event.Event != models.EventTransactionCreated || accounts.DestAccountId == 0 {
+		return recipients, nil
+	}
+
+	var trs models.TransactionEvent
+	if err := json.Unmarshal(event.Payload, &trs); err != nil {
+		return nil, fmt.Errorf("wrong %s payload: %w", event.Event, err)
+	}
+
+	incoming, err := json.Marshal(trs.Incoming())
+	if err != nil {
+		return nil, err
+	}
+
+	return append(recipients, models.WebhookRecipient{AccountId: trs.DestAccountId, Payload: incoming}), nil
+}
+
+// Redeliver повторно отправляет доставку по запросу пользователя. Неудачная
+// отправка не считается ошибкой: её результат записан в доставке.
+func (s *HttpWebhookService) Redeliver(ctx context.Context, delivery models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	return s.send(ctx, delivery)
+}
+
+// send выполняет одну попытку доставки и сохраняет её результат. Ошибка
+// возвращается только если результат не удалось сохранить.
+func (s *HttpWebhookService) send(ctx context.Context, delivery models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	log := utils.GlobalLogger()
+
+	code, response, sendErr := s.post(ctx, delivery)
+
+	status, errText := models.WebhookDeliverySuccess, ""
+	if sendErr != nil {
+		status, errText = models.WebhookDeliveryFailed, sendErr.Error()
+		log.Error("Webhook %d delivery %d failed: %w", delivery.WebhookId, delivery.Id, sendErr)
+	}
+
+	return s.userRepo.SaveWebhookAttempt(context.WithoutCancel(ctx), delivery.Id, status, code, response, errText)
+}
+
+func (s *HttpWebhookService) post(ctx context.Context, delivery models.WebhookDelivery) (int, string, error) {
+	body, err := json.Marshal(models.WebhookBody{
+		Id:        delivery.Id,
+		Event:     delivery.Event,
+		CreatedAt: delivery.CreatedAt,
+		Data:      delivery.Payload,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+
+	// Время отправки входит в подпись, получатель отклоняет старые запросы и
+	// уже обработанные id доставки
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "UniBack-Webhooks")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, "sha256="+models.WebhookSignature(s.secret(delivery.SecretNonce), timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if errors.Is(err, errWebhookAddress) {
+		// Без адреса и текста ошибки соединения: по ним пользователь узнал бы
+		// устройство внутренней сети
+		return 0, "", errWebhookAddress
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	response, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(response), fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, string(response), nil
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+	"uniback/models"
+	"uniback/repository"
+)
+
+// fakeHmacCrypto - CryptoService только с HmacIndex
+type fakeHmacCrypto struct {
+	CryptoService
+}
+
+func (fakeHmacCrypto) HmacIndex(data string) []byte {
+	mac := hmac.New(sha256.New, []byte("test-key"))
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// fakeWebhookRepo - доставки одного webhook в памяти
+type fakeWebhookRepo struct {
+	repository.UserRepository
+	url        string
+	nonce      []byte
+	deliveries map[int64]*models.WebhookDelivery
+	recipients []models.WebhookRecipient
+}
+
+func (f *fakeWebhookRepo) PrepareWebhookDeliveries(ctx context.Context, event models.OutboxEvent, recipients []models.WebhookRecipient) ([]models.WebhookDelivery, error) {
+	f.recipients = recipients
+	if _, ok := f.deliveries[event.Id]; !ok {
+		f.deliveries[event.Id] = &models.WebhookDelivery{
+			Id: event.Id, WebhookId: 1, OutboxId: event.Id, Event: event.Event, Payload: event.Payload,
+			Status: models.WebhookDeliveryPending, CreatedAt: event.CreatedAt, Url: f.url, SecretNonce: f.nonce,
+		}
+	}
+
+	var result []models.WebhookDelivery
+	if d := f.deliveries[event.Id]; d.Status != models.WebhookDeliverySuccess {
+		result = append(result, *d)
+	}
+	return result, nil
+}
+
+func (f *fakeWebhookRepo) SaveWebhookAttempt(ctx context.Context, id int64, status string, responseCode int, responseBody string, errText string) (*models.WebhookDelivery, error) {
+	d := f.deliveries[id]
+	d.Status, d.ResponseCode, d.ResponseBody, d.Error = status, responseCode, responseBody, errText
+	d.Attempts++
+	saved := *d
+	return &saved, nil
+}
+
+// allowLoopback разрешает отправку на httptest-сервер на 127.0.0.1
+func allowLoopback(addr netip.Addr) bool {
+	return addr.IsLoopback()
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	fail := true
+	var received []*http.Request
+	var bodies [][]byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, r)
+		bodies = append(bodies, body)
+		if fail {
+			fail = false
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	s := NewHttpWebhookService(nil, fakeHmacCrypto{}, &WebhookConfig{timeout: 5 * time.Second})
+	s.allowAddr = allowLoopback
+	nonce, secret, err := s.NewWebhookSecret()
+	if err != nil {
+		t.Fatalf("Secret error: %v", err)
+	}
+	if secret != s.secret(nonce) {
+		t.Fatalf("Secret must be derived from nonce")
+	}
+
+	repo := &fakeWebhookRepo{url: server.URL, nonce: nonce, deliveries: map[int64]*models.WebhookDelivery{}}
+	s.userRepo = repo
+
+	payload, _ := json.Marshal(models.CardIssuedEvent{CardId: 7, AccountId: 3, AccountNumber: "40817810000000000003"})
+	event := models.OutboxEvent{Id: 42, Event: models.EventCardIssued, Payload: payload, CreatedAt: time.Now()}
+
+	// Первая попытка получает 503, ошибка нужна outbox для повтора
+	if err := s.Deliver(context.Background(), event); err == nil {
+		t.Fatalf("Expected error on failed delivery")
+	}
+	if d := repo.deliveries[42]; d.Status != models.WebhookDeliveryFailed || d.ResponseCode != 503 || d.ResponseBody != "try later\n" {
+		t.Errorf("Wrong failed delivery: %+v", d)
+	}
+
+	if err := s.Deliver(context.Background(), event); err != nil {
+		t.Fatalf("Deliver error: %v", err)
+	}
+	if d := repo.deliveries[42]; d.Status != models.WebhookDeliverySuccess || d.Attempts != 2 {
+		t.Errorf("Wrong delivered delivery: %+v", d)
+	}
+
+	// Доставленное событие повторно не отправляется
+	if err := s.Deliver(context.Background(), event); err != nil || len(received) != 2 {
+		t.Fatalf("Expected no resend, but %d requests (%v)", len(received), err)
+	}
+
+	req, body := received[1], bodies[1]
+	if req.Header.Get(WebhookEventHeader) != models.EventCardIssued || req.Header.Get(WebhookDeliveryHeader) != "42" {
+		t.Errorf("Wrong webhook headers: %v", req.Header)
+	}
+
+	timestamp, err := strconv.ParseInt(req.Header.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil {
+		t.Fatalf("Wrong timestamp header: %v", err)
+	}
+	if req.Header.Get(WebhookSignatureHeader) != "sha256="+models.WebhookSignature(secret, timestamp, body) {
+		t.Errorf("Wrong webhook signature")
+	}
+
+	var webhookBody models.WebhookBody
+	if err := json.Unmarshal(body, &webhookBody); err != nil {
+		t.Fatalf("Wrong webhook body: %v", err)
+	}
+	if webhookBody.Id != 42 || webhookBody.Event != models.EventCardIssued || string(webhookBody.Data) != string(payload) {
+		t.Errorf("Wrong webhook body: %s", body)
+	}
+
+	redelivered, err := s.Redeliver(context.Background(), *repo.deliveries[42])
+	if err != nil || redelivered.Attempts != 3 || len(received) != 3 {
+		t.Errorf("Wrong redelivery: %+v (%v)", redelivered, err)
+	}
+}
+
+func TestWebhookNoRedirect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Redirect must not be followed")
+	}))
+	defer target.Close()
+
+	server := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer server.Close()
+
+	repo := &fakeWebhookRepo{url: server.URL, deliveries: map[int64]*models.WebhookDelivery{}}
+	s := NewHttpWebhookService(repo, fakeHmacCrypto{}, &WebhookConfig{timeout: 5 * time.Second})
+	s.allowAddr = allowLoopback
+
+	event := models.OutboxEvent{Id: 1, Event: models.EventAccountStatusChanged, Payload: json.RawMessage(`{"account_id":1}`)}
+	if err := s.Deliver(context.Background(), event); err == nil {
+		t.Errorf("Expected redirect to fail delivery")
+	}
+	if d := repo.deliveries[1]; d.Status != models.WebhookDeliveryFailed || d.ResponseCode != http.StatusTemporaryRedirect {
+		t.Errorf("Wrong redirected delivery: %+v", d)
+	}
+}
+
+func TestWebhookTransferRecipients(t *testing.T) {
+	trs := models.TransactionEvent{
+		TransactionId: 10, Type: "transfer", AccountId: 1, AccountNumber: "40817810000000000001",
+		DestAccountId: 2, DestAccountNumber: "40817810000000000002",
+		Amount: models.NewMoney(100), Fee: models.NewMoney(1), Balance: models.NewMoney(5000), CreatedAt: time.Now(),
+	}
+	payload, _ := json.Marshal(trs)
+
+	repo := &fakeWebhookRepo{deliveries: map[int64]*models.WebhookDelivery{}}
+	s := NewHttpWebhookService(repo, fakeHmacCrypto{}, &WebhookConfig{timeout: 5 * time.Second})
+
+	// Доставка не нужна: у фейка нет адреса, проверяются только данные сторон
+	s.Deliver(context.Background(), models.OutboxEvent{Id: 1, Event: models.EventTransactionCreated, Payload: payload})
+
+	if len(repo.recipients) != 2 || repo.recipients[0].AccountId != 1 || string(repo.recipients[0].Payload) != string(payload) {
+		t.Fatalf("Expected sender with full payload first, but %+v", repo.recipients)
+	}
+
+	if repo.recipients[1].AccountId != 2 {
+		t.Fatalf("Expected destination account, but %d", repo.recipients[1].AccountId)
+	}
+	var incoming map[string]any
+	if err := json.Unmarshal(repo.recipients[1].Payload, &incoming); err != nil {
+		t.Fatalf("Wrong destination payload: %v", err)
+	}
+	for _, field := range []string{"balance", "fee", "account_id", "dest_account_id", "transaction_id"} {
+		if _, ok := incoming[field]; ok {
+			t.Errorf("Destination payload must not contain %s: %s", field, repo.recipients[1].Payload)
+		}
+	}
+	var transfer models.IncomingTransferEvent
+	json.Unmarshal(repo.recipients[1].Payload, &transfer)
+	if transfer.Amount != trs.Amount || transfer.AccountNumber != trs.AccountNumber || transfer.DestAccountNumber != trs.DestAccountNumber {
+		t.Errorf("Wrong destination payload: %s", repo.recipients[1].Payload)
+	}
+
+	// Прочие операции уходят только владельцу счёта
+	deposit, _ := json.Marshal(models.TransactionEvent{Type: "deposit", AccountId: 1, AccountNumber: trs.AccountNumber, Amount: trs.Amount})
+	s.Deliver(context.Background(), models.OutboxEvent{Id: 2, Event: models.EventTransactionCreated, Payload: deposit})
+	if len(repo.recipients) != 1 || repo.recipients[0].AccountId != 1 {
+		t.Errorf("Expected only account owner, but %+v", repo.recipients)
+	}
+}
+
+func TestWebhookInternalAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Internal address must not be requested")
+		w.Write([]byte("internal data"))
+	}))
+	defer server.Close()
+
+	// Имя localhost разрешается в 127.0.0.1 уже при соединении
+	for i, url := range []string{server.URL, "http://localhost:" + server.URL[len("http://127.0.0.1:"):]} {
+		repo := &fakeWebhookRepo{url: url, deliveries: map[int64]*models.WebhookDelivery{}}
+		s := NewHttpWebhookService(repo, fakeHmacCrypto{}, &WebhookConfig{timeout: 5 * time.Second})
+
+		event := models.OutboxEvent{Id: int64(i + 1), Event: models.EventAccountStatusChanged, Payload: json.RawMessage(`{"account_id":1}`)}
+		if err := s.Deliver(context.Background(), event); err == nil {
+			t.Errorf("%s: expected internal address to fail delivery", url)
+		}
+		d := repo.deliveries[event.Id]
+		if d.Status != models.WebhookDeliveryFailed || d.ResponseCode != 0 || d.ResponseBody != "" || d.Error != errWebhookAddress.Error() {
+			t.Errorf("%s: wrong rejected delivery: %+v", url, d)
+		}
+	}
+}
@@ -7,38 +7,106 @@ import (
 )
 
 type Config struct {
-	AppName         string
-	DbHost          string
-	DbPort          string
-	DbUsername      string
-	DbPassword      string
-	DbName          string
-	JwtKey          string
-	HmacKey         string
-	PgpPublicPath   string
-	PgpPrivatePath  string
-	HostAddress     string
-	DbCtxTimeoutSec int
-	DbSslMode       bool
+	AppName               string
+	DbHost                string
+	DbPort                string
+	DbUsername            string
+	DbPassword            string
+	DbName                string
+	JwtAlg                string
+	JwtIssuer             string
+	JwtAudience           string
+	TotpIssuer            string
+	HmacKey               string
+	PgpPublicPath         string
+	PgpPrivatePath        string
+	HostAddress           string
+	CbrUrl                string
+	KeyRateFile           string
+	CreditMargins         string
+	CreditPenalty         string
+	TransferConfirmAmount string
+	SmtpHost              string
+	SmtpUsername          string
+	SmtpPassword          string
+	SmtpFrom              string
+	SmtpSecurity          string
+	SmtpPort              int
+	DbCtxTimeoutSec       int
+	JobIntervalMin        int
+	RemindDays            int
+	OutboxPollSec         int
+	OutboxMaxAttempts     int
+	WebhookTimeoutSec     int
+	AccessTokenTtlMin     int
+	RefreshTokenTtlHours  int
+	JwtRotateDays         int
+	TransferCodeTtlMin    int
+	TransferCodeAttempts  int
+	TransferPendingMax    int
+	TransferCodeBackoff   int
+	TransferCodeIpBackoff int
+	CardCheckBackoff      int
+	CardCheckIpBackoff    int
+	CardCheckBlockAfter   int
+	LoginBackoffAfter     int
+	LoginIpBackoffAfter   int
+	LoginLockAfter        int
+	LoginLockMin          int
+	DbSslMode             bool
 }
 
 func CfgLoad(app string) *Config {
 	GlobalLogger().Info("Loading config for %s", app)
 	defer GlobalLogger().Info("Loading config for %s done", app)
 	return &Config{
-		AppName:         app,
-		DbHost:          getEnv("DB_HOST", "localhost"),
-		DbPort:          getEnv("DB_PORT", "5432"),
-		DbUsername:      getEnv("DB_USERNAME", "uniback"),
-		DbPassword:      getEnv("DB_PASSWORD", "112233"),
-		DbName:          getEnv("DB_NAME", "bank"),
-		JwtKey:          getEnv("JWT_KEY", "mifi_secret_key"),
-		HmacKey:         getEnv("HMAC_KEY", "mifi_hmac_key"),
-		PgpPublicPath:   getEnv("PGP_PUBLIC", "pubkey.asc"),
-		PgpPrivatePath:  getEnv("PGP_PRIVATE", "privkey.asc"),
-		HostAddress:     getEnv("HOST_ADDRESS", ":8089"),
-		DbCtxTimeoutSec: getEnvInt("DB_CTX_TOUT_SEC", 3),
-		DbSslMode:       getEnvBool("DB_SSL_MODE", false),
+		AppName:               app,
+		DbHost:                getEnv("DB_HOST", "localhost"),
+		DbPort:                getEnv("DB_PORT", "5432"),
+		DbUsername:            getEnv("DB_USERNAME", "uniback"),
+		DbPassword:            getEnv("DB_PASSWORD", "112233"),
+		DbName:                getEnv("DB_NAME", "bank"),
+		JwtAlg:                getEnv("JWT_ALG", "RS256"),
+		JwtIssuer:             getEnv("JWT_ISSUER", "uniback"),
+		JwtAudience:           getEnv("JWT_AUDIENCE", "uniback"),
+		TotpIssuer:            getEnv("TOTP_ISSUER", "UniBack"),
+		HmacKey:               getEnv("HMAC_KEY", "mifi_hmac_key"),
+		PgpPublicPath:         getEnv("PGP_PUBLIC", "pubkey.asc"),
+		PgpPrivatePath:        getEnv("PGP_PRIVATE", "privkey.asc"),
+		HostAddress:           getEnv("HOST_ADDRESS", ":8089"),
+		CbrUrl:                getEnv("CBR_URL", "https://www.cbr.ru/DailyInfoWebServ/DailyInfo.asmx"),
+		KeyRateFile:           getEnv("KEY_RATE_FILE", ""),
+		CreditMargins:         getEnv("CREDIT_MARGINS", "consumer:5.00,car:3.50,mortgage:2.00"),
+		CreditPenalty:         getEnv("CREDIT_PENALTY_RATE", "20.00"),
+		TransferConfirmAmount: getEnv("TRANSFER_CONFIRM_AMOUNT", "100000.00"),
+		SmtpHost:              getEnv("SMTP_HOST", ""),
+		SmtpUsername:          getEnv("SMTP_USERNAME", ""),
+		SmtpPassword:          getEnv("SMTP_PASSWORD", ""),
+		SmtpFrom:              getEnv("SMTP_FROM", "UniBack <noreply@uniback.local>"),
+		SmtpSecurity:          getEnv("SMTP_SECURITY", "starttls"),
+		SmtpPort:              getEnvInt("SMTP_PORT", 587),
+		DbCtxTimeoutSec:       getEnvInt("DB_CTX_TOUT_SEC", 3),
+		JobIntervalMin:        getEnvInt("JOB_INTERVAL_MIN", 60),
+		RemindDays:            getEnvInt("CREDIT_REMIND_DAYS", 3),
+		OutboxPollSec:         getEnvInt("OUTBOX_POLL_SEC", 2),
+		OutboxMaxAttempts:     getEnvInt("OUTBOX_MAX_ATTEMPTS", 10),
+		WebhookTimeoutSec:     getEnvInt("WEBHOOK_TIMEOUT_SEC", 10),
+		AccessTokenTtlMin:     getEnvInt("ACCESS_TOKEN_TTL_MIN", 15),
+		RefreshTokenTtlHours:  getEnvInt("REFRESH_TOKEN_TTL_HOURS", 720),
+		JwtRotateDays:         getEnvInt("JWT_ROTATE_DAYS", 30),
+		TransferCodeTtlMin:    getEnvInt("TRANSFER_CODE_TTL_MIN", 10),
+		TransferCodeAttempts:  getEnvInt("TRANSFER_CODE_ATTEMPTS", 3),
+		TransferPendingMax:    getEnvInt("TRANSFER_PENDING_MAX", 3),
+		TransferCodeBackoff:   getEnvInt("TRANSFER_CODE_BACKOFF_AFTER", 5),
+		TransferCodeIpBackoff: getEnvInt("TRANSFER_CODE_IP_BACKOFF_AFTER", 20),
+		CardCheckBackoff:      getEnvInt("CARD_CHECK_BACKOFF_AFTER", 3),
+		CardCheckIpBackoff:    getEnvInt("CARD_CHECK_IP_BACKOFF_AFTER", 20),
+		CardCheckBlockAfter:   getEnvInt("CARD_CHECK_BLOCK_AFTER", 5),
+		LoginBackoffAfter:     getEnvInt("LOGIN_BACKOFF_AFTER", 3),
+		LoginIpBackoffAfter:   getEnvInt("LOGIN_IP_BACKOFF_AFTER", 20),
+		LoginLockAfter:        getEnvInt("LOGIN_LOCK_AFTER", 10),
+		LoginLockMin:          getEnvInt("LOGIN_LOCK_MIN", 30),
+		DbSslMode:             getEnvBool("DB_SSL_MODE", false),
 	}
 }
 